@@ -1,16 +1,30 @@
 package ELLIO_Traefik_Middleware_Plugin
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"html/template"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/utils"
 )
 
-// blockPageHTML contains the HTML for the 403 Forbidden page
+// blockPageHTML contains the html/template source for the block page
 const blockPageHTML = `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>403 - Access Forbidden | ELLIO</title>
+    <title>{{.Title}}</title>
     <link rel="preconnect" href="https://fonts.googleapis.com">
     <link rel="preconnect" href="https://fonts.gstatic.com" crossorigin>
     <link href="https://fonts.googleapis.com/css2?family=Montserrat:wght@300;400;500;600;700&display=swap" rel="stylesheet">
@@ -159,6 +173,17 @@ const blockPageHTML = `<!DOCTYPE html>
             }
         }
 
+        .details {
+            font-size: 0.875rem;
+            color: var(--text-secondary);
+            margin-bottom: 0.5rem;
+        }
+
+        .details a {
+            color: var(--primary);
+            text-decoration: none;
+        }
+
         .protection-footer {
             position: absolute;
             bottom: 2rem;
@@ -227,13 +252,15 @@ const blockPageHTML = `<!DOCTYPE html>
 </head>
 <body>
     <div class="container">
+{{- if .LogoURL}}
         <div class="logo-container">
-            <img src="https://cdn.ellio.tech/logo/ELLIO_dark.png" alt="ELLIO Logo" class="logo">
+            <img src="{{.LogoURL}}" alt="{{.LogoAlt}}" class="logo">
         </div>
+{{- end}}
 
-        <div class="error-code">403</div>
+        <div class="error-code">{{.StatusCode}}</div>
 
-        <h1>Forbidden</h1>
+        <h1>{{.StatusText}}</h1>
 
         <div class="lock-animation">
             <div class="lock-shackle"></div>
@@ -243,19 +270,514 @@ const blockPageHTML = `<!DOCTYPE html>
         <p class="message">
             Access to this resource is denied.
         </p>
-
+{{if .ClientIP}}
+        <p class="details">Your IP: {{.ClientIP}}</p>
+{{- end}}
+{{if .RequestID}}
+        <p class="details">Request ID: {{.RequestID}}</p>
+{{- end}}
+{{if .Timestamp}}
+        <p class="details">Time: {{.Timestamp}}</p>
+{{- end}}
+{{if .SupportEmail}}
+        <p class="details">Contact <a href="mailto:{{.SupportEmail}}">{{.SupportEmail}}</a> if you believe this is a mistake.</p>
+{{- end}}
+{{if .SupportURL}}
+        <p class="details"><a href="{{.SupportURL}}" target="_blank" rel="noopener noreferrer">Report a problem</a></p>
+{{- end}}
+
+{{- if not .HideBranding}}
         <div class="protection-footer">
             <span>Protection by</span>
             <a href="https://ellio.tech" target="_blank" rel="noopener noreferrer">ELLIO</a>
         </div>
+{{- end}}
     </div>
 
 </body>
 </html>`
 
+// blockPageTemplate is parsed once at startup so blocked requests only pay for execution
+var blockPageTemplate = template.Must(template.New("blockpage").Parse(blockPageHTML))
+
+const (
+	defaultBlockPageTitle = "403 - Access Forbidden"
+	ellioLogoURL          = "https://cdn.ellio.tech/logo/ELLIO_dark.png"
+)
+
+// BlockPageData holds the variables available to the block page template
+type BlockPageData struct {
+	StatusCode   int    // blockStatusCode of the response
+	StatusText   string // Standard text of StatusCode, e.g. "Not Found"
+	RequestID    string
+	EventID      string // Same as RequestID, recorded on the block event for support lookups
+	ClientIP     string // Only set when blockPageShowClientIP is enabled or a custom template is used
+	Timestamp    string
+	SupportEmail string
+	SupportURL   string // Ticketing or contact link
+
+	// Branding
+	Title        string
+	LogoURL      string // Empty removes the logo
+	LogoAlt      string
+	HideBranding bool // Removes the ELLIO footer link
+}
+
+// applyBranding fills the status, title, logo and footer settings from the
+// config
+func applyBranding(data *BlockPageData, config *Config) {
+	data.HideBranding = config.HideBranding
+	setBlockStatus(data, config.BlockStatusCode)
+
+	data.Title = config.BlockPageTitle
+	if data.Title == "" {
+		data.Title = defaultBlockPageTitle
+		if data.StatusCode != http.StatusForbidden {
+			data.Title = strconv.Itoa(data.StatusCode) + " - " + data.StatusText
+		}
+		if !config.HideBranding {
+			data.Title += " | ELLIO"
+		}
+	}
+
+	switch {
+	case config.BlockPageLogoURL != "":
+		data.LogoURL = config.BlockPageLogoURL
+		data.LogoAlt = "Logo"
+	case !config.HideBranding:
+		data.LogoURL = ellioLogoURL
+		data.LogoAlt = "ELLIO Logo"
+	}
+}
+
+// setBlockStatus fills the status code and text shown on the page, 403
+// when status is unset
+func setBlockStatus(data *BlockPageData, status int) {
+	if status == 0 {
+		status = http.StatusForbidden
+	}
+	data.StatusCode = status
+	data.StatusText = http.StatusText(status)
+}
+
+// bufferPool reuses render buffers on the block path
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// renderBlockPage executes the block page template into buf. A nil tmpl
+// uses the built-in page.
+func renderBlockPage(buf *bytes.Buffer, tmpl *template.Template, data *BlockPageData) error {
+	if tmpl == nil {
+		tmpl = blockPageTemplate
+	}
+	return tmpl.Execute(buf, data)
+}
+
+// loadBlockPageTemplate parses blockPageTemplate, given either inline HTML
+// or the path of a template file. Values containing '<' are taken as HTML.
+func loadBlockPageTemplate(value string) (*template.Template, error) {
+	source := value
+	if !strings.Contains(value, "<") {
+		content, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		source = string(content)
+	}
+	return template.New("custom-blockpage").Parse(source)
+}
+
 // ServeBlockPage serves the HTML 403 block page
-func ServeBlockPage(w http.ResponseWriter) {
+func ServeBlockPage(w http.ResponseWriter, data *BlockPageData) {
+	serveBlockPage(w, nil, data, http.StatusForbidden)
+}
+
+// serveBlockPage renders the HTML block page with the given status code
+func serveBlockPage(w http.ResponseWriter, tmpl *template.Template, data *BlockPageData, status int) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusForbidden)
-	_, _ = w.Write([]byte(blockPageHTML))
+	if data.StatusCode == 0 {
+		setBlockStatus(data, status)
+	}
+
+	if err := renderBlockPage(buf, tmpl, data); err != nil {
+		// Never leak a partially rendered page
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(http.StatusText(status)))
+		return
+	}
+
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// writeBlockResponse writes the response for a blocked request with the
+// configured status code. HEAD gets headers only and OPTIONS preflights get
+// a minimal CORS answer. API clients get a JSON error instead of the page,
+// see wantsJSONBlock. It returns the event ID shown to the client, if any.
+func (e *EllioMiddleware) writeBlockResponse(w http.ResponseWriter, req *http.Request, clientIP string) string {
+	status := e.blockStatus()
+	if req.Method == http.MethodOptions {
+		writeBlockedPreflight(w, req, e.config.BlockedPreflightCORS, status)
+		return ""
+	}
+
+	// A fixed blockResponseBody is served as configured, without negotiation
+	custom := e.config.BlockResponseBody != "" && e.staticPage != nil
+	asJSON := !custom && e.wantsJSONBlock(req)
+	if !custom && e.config.BlockResponseMode == "auto" {
+		w.Header().Add("Vary", "Accept")
+	}
+
+	if req.Method == http.MethodHead {
+		contentType := "text/html; charset=utf-8"
+		switch {
+		case asJSON:
+			contentType = "application/json"
+		case e.staticPage != nil:
+			contentType = e.staticPage.contentType
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		return ""
+	}
+
+	if asJSON {
+		return writeBlockJSON(w, status)
+	}
+	if e.staticPage != nil {
+		e.staticPage.serve(w, req)
+		return ""
+	}
+	data := e.blockPageData(clientIP)
+	if e.splicedPage != nil {
+		e.splicedPage.serve(w, req, data)
+	} else {
+		serveBlockPage(w, e.pageTemplate, data, status)
+	}
+	return data.EventID
+}
+
+// blockStatus returns the status code of block responses
+func (e *EllioMiddleware) blockStatus() int {
+	if e.config.BlockStatusCode == 0 {
+		return http.StatusForbidden
+	}
+	return e.config.BlockStatusCode
+}
+
+// blockErrorResponse is the JSON body of block responses for API clients
+type blockErrorResponse struct {
+	Error   string `json:"error"`    // "forbidden", or the status text of blockStatusCode
+	EventID string `json:"event_id"` // Recorded on the block event for support lookups
+}
+
+// writeBlockJSON writes a JSON block response and returns its event ID
+func writeBlockJSON(w http.ResponseWriter, status int) string {
+	eventID := utils.GenerateUUID()
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	h.Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(blockErrorResponse{
+		Error:   blockErrorCode(status),
+		EventID: eventID,
+	})
+	return eventID
+}
+
+// blockErrorCode turns a status code into a snake_case error code such as
+// "forbidden" or "too_many_requests"
+func blockErrorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "blocked"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+// wantsJSONBlock picks the block response format. In "auto" mode (default)
+// requests to apiPaths and clients asking for JSON but not HTML get JSON.
+func (e *EllioMiddleware) wantsJSONBlock(req *http.Request) bool {
+	switch e.config.BlockResponseMode {
+	case "json":
+		return true
+	case "html", "":
+		return false
+	}
+
+	_, path := requestTarget(req)
+	for _, prefix := range e.config.APIPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	accept := strings.ToLower(req.Header.Get("Accept"))
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// writeBlockedPreflight answers a blocked OPTIONS request without a body.
+// In "permissive" mode CORS preflights succeed so browsers can surface the
+// subsequent block response to scripts; otherwise the preflight is denied
+// with status.
+func writeBlockedPreflight(w http.ResponseWriter, req *http.Request, mode string, status int) {
+	h := w.Header()
+	h.Set("Content-Length", "0")
+	h.Set("Cache-Control", "no-store")
+
+	origin := req.Header.Get("Origin")
+	if strings.EqualFold(mode, "permissive") && origin != "" {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+		if method := req.Header.Get("Access-Control-Request-Method"); method != "" {
+			h.Set("Access-Control-Allow-Methods", method)
+		}
+		if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+			h.Set("Access-Control-Allow-Headers", headers)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.WriteHeader(status)
+}
+
+// staticBlockPage holds a block response built once together with its
+// pre-compressed variant: the block page when it has no per-request values,
+// or the configured blockResponseBody. Brotli is not offered because it is
+// not available in the standard library.
+type staticBlockPage struct {
+	body        []byte
+	gzip        []byte
+	contentType string
+	status      int
+}
+
+// newStaticResponse compresses a fixed block response body once
+func newStaticResponse(body []byte, contentType string, status int) (*staticBlockPage, error) {
+	var compressed bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &staticBlockPage{
+		body:        body,
+		gzip:        compressed.Bytes(),
+		contentType: contentType,
+		status:      status,
+	}, nil
+}
+
+// serve writes the cached page, compressed when the client accepts gzip
+func (p *staticBlockPage) serve(w http.ResponseWriter, req *http.Request) {
+	h := w.Header()
+	h.Set("Content-Type", p.contentType)
+	h.Add("Vary", "Accept-Encoding")
+
+	body := p.body
+	if acceptsGzip(req.Header.Get("Accept-Encoding")) {
+		h.Set("Content-Encoding", "gzip")
+		body = p.gzip
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	w.WriteHeader(p.status)
+	_, _ = w.Write(body)
+}
+
+// Slots of the per-request values in a spliced block page
+const (
+	slotRequestID = iota
+	slotTimestamp
+	slotClientIP
+	slotCount
+)
+
+// blockPageSlotMarker stands in for a per-request value while the built-in
+// page is pre-rendered, followed by the slot digit
+const blockPageSlotMarker = "ellioslot7f3a9c"
+
+// splicedGzipHeader is the fixed gzip header of spliced pages: deflate, no
+// flags, no modification time, unknown OS
+var splicedGzipHeader = []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 0xff}
+
+// splicedBlockPage is the built-in block page pre-rendered around its
+// per-request values. Each static part is compressed once into deflate
+// blocks ending on a byte boundary, so the gzip response of a request is
+// assembled by inserting its values as stored blocks in between, without
+// compressing the page again.
+type splicedBlockPage struct {
+	parts    [][]byte // Static HTML around the slots
+	deflated [][]byte // Each part compressed, the last one ending the stream
+	slots    []int    // Slot of the value following each part but the last
+	status   int
+}
+
+// newSplicedBlockPage renders the built-in page with slot markers in place
+// of the request ID, timestamp and, when shown, client IP, and compresses
+// the parts between them
+func newSplicedBlockPage(data *BlockPageData, showClientIP bool, status int) (*splicedBlockPage, error) {
+	data.RequestID = blockPageSlotMarker + strconv.Itoa(slotRequestID)
+	data.Timestamp = blockPageSlotMarker + strconv.Itoa(slotTimestamp)
+	data.ClientIP = ""
+	if showClientIP {
+		data.ClientIP = blockPageSlotMarker + strconv.Itoa(slotClientIP)
+	}
+	var buf bytes.Buffer
+	if err := renderBlockPage(&buf, nil, data); err != nil {
+		return nil, err
+	}
+
+	p := &splicedBlockPage{status: status}
+	rest := buf.Bytes()
+	marker := []byte(blockPageSlotMarker)
+	for {
+		i := bytes.Index(rest, marker)
+		if i < 0 {
+			break
+		}
+		end := i + len(marker)
+		if end == len(rest) || rest[end] < '0' || int(rest[end]-'0') >= slotCount {
+			return nil, fmt.Errorf("invalid block page slot at offset %d", len(buf.Bytes())-len(rest)+i)
+		}
+		p.parts = append(p.parts, rest[:i])
+		p.slots = append(p.slots, int(rest[end]-'0'))
+		rest = rest[end+1:]
+	}
+	p.parts = append(p.parts, rest)
+
+	for i, part := range p.parts {
+		var compressed bytes.Buffer
+		zw, err := flate.NewWriter(&compressed, flate.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(part); err != nil {
+			return nil, err
+		}
+		// A sync flush leaves the stream open on a byte boundary, where the
+		// stored block of the next value starts
+		if i < len(p.parts)-1 {
+			err = zw.Flush()
+		} else {
+			err = zw.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.deflated = append(p.deflated, compressed.Bytes())
+	}
+	return p, nil
+}
+
+// serve writes the page with the values of data, compressed when the
+// client accepts gzip
+func (p *splicedBlockPage) serve(w http.ResponseWriter, req *http.Request, data *BlockPageData) {
+	var values [slotCount]string
+	values[slotRequestID] = template.HTMLEscapeString(data.RequestID)
+	values[slotTimestamp] = template.HTMLEscapeString(data.Timestamp)
+	values[slotClientIP] = template.HTMLEscapeString(data.ClientIP)
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Add("Vary", "Accept-Encoding")
+	if acceptsGzip(req.Header.Get("Accept-Encoding")) {
+		h.Set("Content-Encoding", "gzip")
+		p.writeGzip(buf, &values)
+	} else {
+		p.writePlain(buf, &values)
+	}
+	h.Set("Content-Length", strconv.Itoa(buf.Len()))
+
+	w.WriteHeader(p.status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// writePlain writes the uncompressed page
+func (p *splicedBlockPage) writePlain(buf *bytes.Buffer, values *[slotCount]string) {
+	for i, part := range p.parts {
+		buf.Write(part)
+		if i < len(p.slots) {
+			buf.WriteString(values[p.slots[i]])
+		}
+	}
+}
+
+// writeGzip writes the page as a single gzip member of the pre-compressed
+// parts and the values as stored blocks
+func (p *splicedBlockPage) writeGzip(buf *bytes.Buffer, values *[slotCount]string) {
+	buf.Write(splicedGzipHeader)
+	var crc uint32
+	size := 0
+	for i, part := range p.parts {
+		buf.Write(p.deflated[i])
+		crc = crc32.Update(crc, crc32.IEEETable, part)
+		size += len(part)
+		if i < len(p.slots) {
+			value := values[p.slots[i]]
+			writeStoredBlocks(buf, value)
+			crc = crc32.Update(crc, crc32.IEEETable, []byte(value))
+			size += len(value)
+		}
+	}
+
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], crc)
+	binary.LittleEndian.PutUint32(trailer[4:], uint32(size))
+	buf.Write(trailer[:])
+}
+
+// writeStoredBlocks writes s as non-final stored deflate blocks, which must
+// start on a byte boundary
+func writeStoredBlocks(buf *bytes.Buffer, s string) {
+	for len(s) > 0 {
+		n := len(s)
+		if n > 0xffff {
+			n = 0xffff
+		}
+		buf.WriteByte(0) // BFINAL=0, BTYPE=00 (stored), padded to the byte
+		buf.Write([]byte{byte(n), byte(n >> 8), ^byte(n), ^byte(n >> 8)})
+		buf.WriteString(s[:n])
+		s = s[n:]
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding value allows gzip
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		// Honor explicit refusal via q=0
+		params = strings.ReplaceAll(params, " ", "")
+		if q, ok := strings.CutPrefix(params, "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
 }
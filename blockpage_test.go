@@ -0,0 +1,563 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeBlockPage(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ServeBlockPage(rec, &BlockPageData{
+		RequestID:    "req-123",
+		Timestamp:    "2025-01-01T00:00:00Z",
+		SupportEmail: "security@example.com",
+	})
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{"req-123", "2025-01-01T00:00:00Z", "mailto:security@example.com"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "Your IP") {
+		t.Error("client IP should not be shown unless opted in")
+	}
+}
+
+func TestBlockPageBranding(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		contains   []string
+		notContain []string
+	}{
+		{
+			name:     "default ELLIO branding",
+			config:   &Config{},
+			contains: []string{"403 - Access Forbidden | ELLIO", ellioLogoURL, "Protection by"},
+		},
+		{
+			name:       "branding removed",
+			config:     &Config{HideBranding: true},
+			contains:   []string{"<title>403 - Access Forbidden</title>"},
+			notContain: []string{ellioLogoURL, "Protection by", "| ELLIO"},
+		},
+		{
+			name: "custom logo and title",
+			config: &Config{
+				HideBranding:     true,
+				BlockPageTitle:   "Acme Corp - Access Denied",
+				BlockPageLogoURL: "https://acme.example.com/logo.png",
+			},
+			contains:   []string{"Acme Corp - Access Denied", "https://acme.example.com/logo.png"},
+			notContain: []string{ellioLogoURL, "Protection by"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &BlockPageData{}
+			applyBranding(data, tt.config)
+
+			var buf bytes.Buffer
+			if err := renderBlockPage(&buf, nil, data); err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+
+			body := buf.String()
+			for _, want := range tt.contains {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected body to contain %q", want)
+				}
+			}
+			for _, unwanted := range tt.notContain {
+				if strings.Contains(body, unwanted) {
+					t.Errorf("expected body not to contain %q", unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderBlockPageEscaping(t *testing.T) {
+	var buf bytes.Buffer
+	err := renderBlockPage(&buf, nil, &BlockPageData{
+		ClientIP:  "<script>alert(1)</script>",
+		RequestID: `"><img src=x onerror=alert(1)>`,
+	})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+
+	body := buf.String()
+	if strings.Contains(body, "<script>alert(1)</script>") {
+		t.Error("client IP was not HTML escaped")
+	}
+	if strings.Contains(body, "<img src=x") {
+		t.Error("request ID was not HTML escaped")
+	}
+}
+
+func BenchmarkRenderBlockPage(b *testing.B) {
+	data := &BlockPageData{
+		RequestID:    "0b5f3b0e-8c1a-4c1e-9b53-4a8a2c7e1f00",
+		ClientIP:     "203.0.113.7",
+		Timestamp:    "2025-01-01T00:00:00Z",
+		SupportEmail: "security@example.com",
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		ServeBlockPage(rec, data)
+	}
+}
+
+func TestStaticResponseCompression(t *testing.T) {
+	data := &BlockPageData{}
+	applyBranding(data, &Config{})
+	var buf bytes.Buffer
+	if err := renderBlockPage(&buf, nil, data); err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+
+	page, err := newStaticResponse(buf.Bytes(), "text/html; charset=utf-8", http.StatusForbidden)
+	if err != nil {
+		t.Fatalf("failed to build static page: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		expectGzip     bool
+	}{
+		{"no header", "", false},
+		{"gzip", "gzip, deflate, br", true},
+		{"wildcard", "*", true},
+		{"gzip refused", "gzip;q=0, deflate", false},
+		{"identity only", "identity", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			page.serve(rec, req)
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("expected status 403, got %d", rec.Code)
+			}
+
+			gotGzip := rec.Header().Get("Content-Encoding") == "gzip"
+			if gotGzip != tt.expectGzip {
+				t.Fatalf("expected gzip=%v, got %v", tt.expectGzip, gotGzip)
+			}
+
+			body := rec.Body.Bytes()
+			if gotGzip {
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatalf("invalid gzip body: %v", err)
+				}
+				body, err = io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("failed to decompress body: %v", err)
+				}
+			}
+			if !bytes.Equal(body, page.body) {
+				t.Error("served body does not match rendered page")
+			}
+		})
+	}
+}
+
+func TestSplicedBlockPage(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		showClientIP   bool
+		expectGzip     bool
+	}{
+		{"plain", "", false, false},
+		{"gzip", "gzip, deflate, br", false, true},
+		{"plain with client IP", "", true, false},
+		{"gzip with client IP", "gzip", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &BlockPageData{SupportEmail: "security@example.com"}
+			applyBranding(base, &Config{})
+			slots := *base
+			page, err := newSplicedBlockPage(&slots, tt.showClientIP, http.StatusNotFound)
+			if err != nil {
+				t.Fatalf("failed to build spliced page: %v", err)
+			}
+
+			// Each request renders its own values, escaped like the template does
+			for _, id := range []string{"0b5f3b0e-8c1a-4c1e-9b53-4a8a2c7e1f00", `"><img src=x>`, strings.Repeat("x", 70000)} {
+				data := *base
+				data.RequestID = id
+				data.Timestamp = "2025-01-01T00:00:00Z"
+				if tt.showClientIP {
+					data.ClientIP = "2001:db8::<1>"
+				}
+				var want bytes.Buffer
+				if err := renderBlockPage(&want, nil, &data); err != nil {
+					t.Fatalf("render failed: %v", err)
+				}
+
+				req := httptest.NewRequest("GET", "/", nil)
+				if tt.acceptEncoding != "" {
+					req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+				}
+				rec := httptest.NewRecorder()
+				page.serve(rec, req, &data)
+
+				if rec.Code != http.StatusNotFound {
+					t.Errorf("expected status 404, got %d", rec.Code)
+				}
+				gotGzip := rec.Header().Get("Content-Encoding") == "gzip"
+				if gotGzip != tt.expectGzip {
+					t.Fatalf("expected gzip=%v, got %v", tt.expectGzip, gotGzip)
+				}
+				body := rec.Body.Bytes()
+				if gotGzip {
+					zr, err := gzip.NewReader(bytes.NewReader(body))
+					if err != nil {
+						t.Fatalf("invalid gzip body: %v", err)
+					}
+					body, err = io.ReadAll(zr)
+					if err != nil {
+						t.Fatalf("failed to decompress body: %v", err)
+					}
+				}
+				if !bytes.Equal(body, want.Bytes()) {
+					t.Errorf("served body does not match the rendered page for request ID %.40q", id)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteBlockResponseShowsDetails(t *testing.T) {
+	config := &Config{BlockStatusCode: http.StatusForbidden}
+	middleware := &EllioMiddleware{config: config}
+	page, err := newSplicedBlockPage(middleware.blockPageData(""), false, config.BlockStatusCode)
+	if err != nil {
+		t.Fatalf("failed to build spliced page: %v", err)
+	}
+	middleware.splicedPage = page
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	eventID := middleware.writeBlockResponse(rec, req, "203.0.113.1")
+
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("invalid gzip body: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to decompress body: %v", err)
+	}
+	if eventID == "" || !strings.Contains(string(body), "Request ID: "+eventID) {
+		t.Errorf("expected request ID %q on the default page", eventID)
+	}
+	if !strings.Contains(string(body), "Time: ") {
+		t.Error("expected timestamp on the default page")
+	}
+	if strings.Contains(string(body), "203.0.113.1") || strings.Contains(string(body), blockPageSlotMarker) {
+		t.Error("client IP must stay hidden and no slot marker may leak")
+	}
+}
+
+func TestBlockPageStatusCode(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		spliced bool
+		gzip    bool
+	}{
+		{"rendered", false, false},
+		{"spliced", true, false},
+		{"spliced gzip", true, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{BlockStatusCode: http.StatusNotFound}
+			middleware := &EllioMiddleware{config: config}
+			if tt.spliced {
+				page, err := newSplicedBlockPage(middleware.blockPageData(""), false, config.BlockStatusCode)
+				if err != nil {
+					t.Fatalf("failed to build spliced page: %v", err)
+				}
+				middleware.splicedPage = page
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.gzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			rec := httptest.NewRecorder()
+			middleware.writeBlockResponse(rec, req, "203.0.113.1")
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("expected status 404, got %d", rec.Code)
+			}
+
+			body := rec.Body.Bytes()
+			if tt.gzip {
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatalf("invalid gzip body: %v", err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatalf("failed to decompress body: %v", err)
+				}
+			}
+			page := string(body)
+			for _, want := range []string{`<div class="error-code">404</div>`, "<h1>Not Found</h1>", "<title>404 - Not Found | ELLIO</title>"} {
+				if !strings.Contains(page, want) {
+					t.Errorf("expected body to contain %q", want)
+				}
+			}
+			if strings.Contains(page, ">403<") || strings.Contains(page, "Forbidden") {
+				t.Error("expected no trace of 403 Forbidden on a 404 page")
+			}
+		})
+	}
+}
+
+func BenchmarkServeSplicedBlockPage(b *testing.B) {
+	data := &BlockPageData{}
+	applyBranding(data, &Config{})
+	page, err := newSplicedBlockPage(data, false, http.StatusForbidden)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	data = &BlockPageData{RequestID: "0b5f3b0e-8c1a-4c1e-9b53-4a8a2c7e1f00", Timestamp: "2025-01-01T00:00:00Z"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		page.serve(rec, req, data)
+	}
+}
+
+func TestWriteBlockResponseMethods(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		corsMode     string
+		headers      map[string]string
+		expectStatus int
+		expectEmpty  bool
+		expectACAO   string
+	}{
+		{
+			name:         "GET serves page",
+			method:       http.MethodGet,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name:         "HEAD has no body",
+			method:       http.MethodHead,
+			expectStatus: http.StatusForbidden,
+			expectEmpty:  true,
+		},
+		{
+			name:         "OPTIONS denied by default",
+			method:       http.MethodOptions,
+			headers:      map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+			expectStatus: http.StatusForbidden,
+			expectEmpty:  true,
+		},
+		{
+			name:         "OPTIONS permissive",
+			method:       http.MethodOptions,
+			corsMode:     "permissive",
+			headers:      map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+			expectStatus: http.StatusNoContent,
+			expectEmpty:  true,
+			expectACAO:   "https://app.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware := &EllioMiddleware{
+				config: &Config{BlockedPreflightCORS: tt.corsMode},
+			}
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			middleware.writeBlockResponse(rec, req, "203.0.113.1")
+
+			if rec.Code != tt.expectStatus {
+				t.Errorf("expected status %d, got %d", tt.expectStatus, rec.Code)
+			}
+			if tt.expectEmpty && rec.Body.Len() != 0 {
+				t.Errorf("expected empty body, got %d bytes", rec.Body.Len())
+			}
+			if !tt.expectEmpty && rec.Body.Len() == 0 {
+				t.Error("expected block page body")
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.expectACAO {
+				t.Errorf("expected Access-Control-Allow-Origin %q, got %q", tt.expectACAO, got)
+			}
+		})
+	}
+}
+
+func TestWriteBlockResponseCustomStatusAndBody(t *testing.T) {
+	page, err := newStaticResponse([]byte(`{"error":"blocked"}`), "application/json", http.StatusNotFound)
+	if err != nil {
+		t.Fatalf("failed to build static response: %v", err)
+	}
+	middleware := &EllioMiddleware{
+		config:     &Config{BlockStatusCode: http.StatusNotFound},
+		staticPage: page,
+	}
+
+	rec := httptest.NewRecorder()
+	middleware.writeBlockResponse(rec, httptest.NewRequest(http.MethodGet, "/", nil), "203.0.113.1")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected application/json, got %q", got)
+	}
+	if rec.Body.String() != `{"error":"blocked"}` {
+		t.Errorf("unexpected body %q", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	middleware.writeBlockResponse(rec, httptest.NewRequest(http.MethodHead, "/", nil), "203.0.113.1")
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "application/json" || rec.Body.Len() != 0 {
+		t.Errorf("unexpected HEAD response: status=%d type=%q body=%d bytes",
+			rec.Code, rec.Header().Get("Content-Type"), rec.Body.Len())
+	}
+
+	// The rendered page follows the configured status too
+	middleware = &EllioMiddleware{config: &Config{BlockStatusCode: http.StatusTooManyRequests}}
+	rec = httptest.NewRecorder()
+	middleware.writeBlockResponse(rec, httptest.NewRequest(http.MethodGet, "/", nil), "203.0.113.1")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("expected HTML page with 429, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestCustomBlockPageTemplate(t *testing.T) {
+	inline := `<html><p>{{.ClientIP}}</p><p>{{.EventID}}</p><a href="{{.SupportURL}}">help</a></html>`
+	path := filepath.Join(t.TempDir(), "page.html")
+	if err := os.WriteFile(path, []byte(inline), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{inline, path} {
+		tmpl, err := loadBlockPageTemplate(value)
+		if err != nil {
+			t.Fatalf("failed to load template %q: %v", value, err)
+		}
+		middleware := &EllioMiddleware{
+			config:       &Config{SupportURL: "https://support.example.com/new?x=<1>"},
+			pageTemplate: tmpl,
+		}
+
+		rec := httptest.NewRecorder()
+		eventID := middleware.writeBlockResponse(rec, httptest.NewRequest(http.MethodGet, "/", nil), "203.0.113.1")
+		body := rec.Body.String()
+
+		if eventID == "" || !strings.Contains(body, eventID) {
+			t.Errorf("expected event ID %q in body %q", eventID, body)
+		}
+		if !strings.Contains(body, "<p>203.0.113.1</p>") {
+			t.Errorf("expected client IP in body %q", body)
+		}
+		if strings.Contains(body, "<1>") {
+			t.Errorf("expected escaped support URL in body %q", body)
+		}
+	}
+
+	if _, err := loadBlockPageTemplate(filepath.Join(t.TempDir(), "missing.html")); err == nil {
+		t.Error("expected error for a missing template file")
+	}
+	if _, err := loadBlockPageTemplate("<html>{{.Broken</html>"); err == nil {
+		t.Error("expected error for an invalid template")
+	}
+}
+
+func TestBlockResponseNegotiation(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		path       string
+		accept     string
+		status     int
+		expectJSON bool
+		expectErr  string
+	}{
+		{name: "browser", mode: "auto", path: "/", accept: "text/html,application/xhtml+xml,*/*;q=0.8"},
+		{name: "json client", mode: "auto", path: "/", accept: "application/json", expectJSON: true, expectErr: "forbidden"},
+		{name: "api path", mode: "auto", path: "/api/v1/users", accept: "*/*", expectJSON: true, expectErr: "forbidden"},
+		{name: "forced html", mode: "html", path: "/api/v1/users", accept: "application/json"},
+		{name: "forced json", mode: "json", path: "/", accept: "text/html", status: http.StatusTooManyRequests, expectJSON: true, expectErr: "too_many_requests"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware := &EllioMiddleware{
+				config: &Config{BlockResponseMode: tt.mode, APIPaths: []string{"/api/"}, BlockStatusCode: tt.status},
+			}
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+
+			eventID := middleware.writeBlockResponse(rec, req, "203.0.113.1")
+
+			gotJSON := rec.Header().Get("Content-Type") == "application/json"
+			if gotJSON != tt.expectJSON {
+				t.Fatalf("expected JSON=%v, got Content-Type %q", tt.expectJSON, rec.Header().Get("Content-Type"))
+			}
+			if !tt.expectJSON {
+				return
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON body: %v", err)
+			}
+			if body["error"] != tt.expectErr {
+				t.Errorf("expected error %q, got %v", tt.expectErr, body["error"])
+			}
+			if eventID == "" || body["event_id"] != eventID {
+				t.Errorf("expected event_id %q, got %v", eventID, body["event_id"])
+			}
+		})
+	}
+}
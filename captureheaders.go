@@ -0,0 +1,70 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+const (
+	// maxCaptureHeaders caps the number of logCaptureHeaders
+	maxCaptureHeaders = 16
+	// maxCapturedHeaderLen caps each captured header value
+	maxCapturedHeaderLen = 256
+	// maxCapturedHeadersBytes caps the captured names and values of one
+	// event; headers beyond it are left out
+	maxCapturedHeadersBytes = 4096
+)
+
+// sensitiveHeaders carry credentials and are never captured
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// parseCaptureHeaders canonicalizes the logCaptureHeaders names, dropping
+// duplicates, credential headers and names beyond maxCaptureHeaders
+func parseCaptureHeaders(names []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		switch {
+		case name == "" || seen[name]:
+			continue
+		case sensitiveHeaders[name]:
+			logger.Warnf("Ignoring logCaptureHeaders entry '%s', credentials are never captured", name)
+			continue
+		case len(result) == maxCaptureHeaders:
+			logger.Warnf("logCaptureHeaders has more than %d entries, ignoring '%s' and later ones", maxCaptureHeaders, name)
+			return result
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result
+}
+
+// captureHeaders collects the first value of each named header present in
+// h, sanitized and capped, nil when none is present
+func captureHeaders(h http.Header, names []string) map[string]string {
+	var captured map[string]string
+	size := 0
+	for _, name := range names {
+		value := eventHeader(h, name, maxCapturedHeaderLen)
+		if value == "" {
+			continue
+		}
+		if size += len(name) + len(value); size > maxCapturedHeadersBytes {
+			break
+		}
+		if captured == nil {
+			captured = make(map[string]string, len(names))
+		}
+		captured[name] = value
+	}
+	return captured
+}
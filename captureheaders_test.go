@@ -0,0 +1,79 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestParseCaptureHeaders(t *testing.T) {
+	got := parseCaptureHeaders([]string{" referer ", "x-request-id", "Referer", "authorization", "Cookie", ""})
+	if strings.Join(got, ",") != "Referer,X-Request-Id" {
+		t.Errorf("expected canonical names without duplicates and credentials, got %q", got)
+	}
+
+	var many []string
+	for i := 0; i < maxCaptureHeaders+2; i++ {
+		many = append(many, fmt.Sprintf("X-Header-%d", i))
+	}
+	if got := parseCaptureHeaders(many); len(got) != maxCaptureHeaders {
+		t.Errorf("expected at most %d headers, got %d", maxCaptureHeaders, len(got))
+	}
+}
+
+func TestCaptureHeaders(t *testing.T) {
+	h := make(http.Header)
+	h.Set("Referer", "https://example.com/\x00")
+	h.Set("X-Request-Id", strings.Repeat("a", 1000))
+	names := []string{"Referer", "X-Request-Id", "X-Missing"}
+
+	captured := captureHeaders(h, names)
+	if len(captured) != 2 || captured["Referer"] != "https://example.com/�" || len(captured["X-Request-Id"]) != maxCapturedHeaderLen {
+		t.Errorf("expected sanitized and capped values, got %q", captured)
+	}
+	if captureHeaders(make(http.Header), names) != nil {
+		t.Error("expected nil without captured headers")
+	}
+
+	// The event total is capped
+	var many []string
+	for i := 0; i < maxCaptureHeaders; i++ {
+		name := fmt.Sprintf("X-Header-%d", i)
+		h.Set(name, strings.Repeat("b", maxCapturedHeaderLen))
+		many = append(many, name)
+	}
+	size := 0
+	for name, value := range captureHeaders(h, many) {
+		size += len(name) + len(value)
+	}
+	if size == 0 || size > maxCapturedHeadersBytes {
+		t.Errorf("expected captured headers within %d bytes, got %d", maxCapturedHeadersBytes, size)
+	}
+}
+
+func TestBlockEventCapturedHeaders(t *testing.T) {
+	e := &EllioMiddleware{config: &Config{}, captureHeaders: parseCaptureHeaders([]string{"X-Request-ID"})}
+	req := readRequest(t, "GET / HTTP/1.1\r\nHost: example.com\r\nX-Request-ID: abc-123\r\n\r\n")
+
+	event := e.newRequestEvent(req, "192.0.2.1", "blocklist", singleton.Decision{Source: singleton.SourceEDL})
+	data, err := json.Marshal(event)
+	logs.ReturnToPool(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"headers":{"X-Request-Id":"abc-123"}`) {
+		t.Errorf("expected the captured header in the event, got %s", data)
+	}
+
+	// Allowed requests are not captured
+	event = e.newRequestEvent(req, "192.0.2.1", "blocklist", singleton.Decision{Allowed: true, Source: singleton.SourceEDL})
+	defer logs.ReturnToPool(event)
+	if event.Request.Headers != nil {
+		t.Errorf("expected no headers on allow events, got %q", event.Request.Headers)
+	}
+}
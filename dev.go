@@ -0,0 +1,35 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/admin"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// devAdminSources may call the unauthenticated admin endpoints in dev mode:
+// loopback and the private ranges of docker-compose networks
+var devAdminSources = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// devAdminGuard enables the admin endpoints in dev mode. Without a token or
+// client certificate requirement they are opened to adminAllowedSources,
+// or to devAdminSources when none are configured.
+func devAdminGuard(guard admin.GuardOptions) admin.GuardOptions {
+	if guard.Enabled() {
+		return guard
+	}
+	guard.Open = true
+	if len(guard.AllowedSources) == 0 {
+		guard.AllowedSources = parsePrefixes(devAdminSources, "dev admin source")
+	}
+	logger.Warnf("Dev mode opens the admin endpoints without authentication to %d source ranges", len(guard.AllowedSources))
+	return guard
+}
+
+// newDevTracer traces the decisions on every client until the middleware
+// is recreated, unless traceClientIPs selects clients already
+func newDevTracer() *clientTracer {
+	all := []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+	return newClientTracer(all, time.Time{})
+}
@@ -0,0 +1,66 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/admin"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestDevMode(t *testing.T) {
+	// The manager is created directly, Acquire would register it for the
+	// whole test binary
+	manager, err := singleton.NewManager(singleton.Options{DevMode: true, DevBlocklist: []string{"203.0.113.0/24"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer manager.Stop()
+
+	e := &EllioMiddleware{
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		name:    "dev-test",
+		config:  &Config{DevMode: true, IPStrategy: "direct", BlockStatusCode: http.StatusForbidden},
+		manager: manager,
+		tracer:  newDevTracer(),
+		admin: admin.New(admin.Options{
+			Guard:  devAdminGuard(admin.GuardOptions{}),
+			Status: func() interface{} { return manager.Status() },
+		}),
+	}
+
+	serve := func(path, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve("/", "203.0.113.5:4711"); code != http.StatusForbidden {
+		t.Errorf("expected a devBlocklist client to be blocked, got %d", code)
+	}
+	if code := serve("/", "192.0.2.1:4711"); code != http.StatusOK {
+		t.Errorf("expected other clients to pass, got %d", code)
+	}
+
+	// Admin endpoints are open to private sources only
+	if code := serve(admin.PathPrefix+"admin/status", "172.18.0.1:4711"); code != http.StatusOK {
+		t.Errorf("expected the admin status from a docker network, got %d", code)
+	}
+	if code := serve(admin.PathPrefix+"admin/status", "192.0.2.1:4711"); code != http.StatusForbidden {
+		t.Errorf("expected public sources to be refused, got %d", code)
+	}
+}
+
+func TestDevAdminGuard(t *testing.T) {
+	if g := devAdminGuard(admin.GuardOptions{Token: "secret"}); g.Open || len(g.AllowedSources) != 0 {
+		t.Errorf("expected a configured token to be kept, got %+v", g)
+	}
+	g := devAdminGuard(admin.GuardOptions{AllowedSources: parsePrefixes([]string{"192.0.2.0/24"}, "test")})
+	if !g.Open || len(g.AllowedSources) != 1 {
+		t.Errorf("expected configured sources to be kept, got %+v", g)
+	}
+}
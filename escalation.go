@@ -0,0 +1,89 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/bounded"
+)
+
+const (
+	// defaultEscalationWindow is how long distinct blocked IPs of a /24 are counted
+	defaultEscalationWindow = 10 * time.Minute
+	// defaultEscalationTTL is how long an escalated /24 stays blocked
+	defaultEscalationTTL = time.Hour
+)
+
+// neighborhood collects the distinct blocked IPs of one /24 in a window
+type neighborhood struct {
+	start time.Time
+	ips   []netip.Addr
+}
+
+// escalator counts distinct blocked IPv4 addresses per /24 and reports when
+// a /24 reaches the threshold within the window
+type escalator struct {
+	threshold int
+	window    time.Duration
+	ttl       time.Duration
+	seen      *bounded.LRU
+	now       func() time.Time
+}
+
+func newEscalator(threshold int, window, ttl time.Duration, maxEntries int) *escalator {
+	if window <= 0 {
+		window = defaultEscalationWindow
+	}
+	if ttl <= 0 {
+		ttl = defaultEscalationTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = defaultTrackerMaxEntries
+	}
+	return &escalator{
+		threshold: threshold,
+		window:    window,
+		ttl:       ttl,
+		seen:      bounded.NewLRU("escalation", maxEntries, window),
+		now:       time.Now,
+	}
+}
+
+// Observe records a blocked address. When its /24 reaches the threshold it
+// returns the /24 and the distinct IP count, and starts a new window.
+func (x *escalator) Observe(addr netip.Addr) (netip.Prefix, int, bool) {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return netip.Prefix{}, 0, false
+	}
+	prefix := netip.PrefixFrom(addr, 24).Masked()
+	now := x.now()
+
+	var count int
+	var escalate bool
+	x.seen.Update(prefix.String(), func(old interface{}, found bool) interface{} {
+		n, _ := old.(*neighborhood)
+		if !found || now.Sub(n.start) >= x.window {
+			n = &neighborhood{start: now}
+		}
+		for _, ip := range n.ips {
+			if ip == addr {
+				count = len(n.ips)
+				return n
+			}
+		}
+		n.ips = append(n.ips, addr)
+		count = len(n.ips)
+		if count >= x.threshold {
+			escalate = true
+			return &neighborhood{start: now}
+		}
+		return n
+	})
+	return prefix, count, escalate
+}
+
+// Stats reports the tracker memory usage
+func (x *escalator) Stats() bounded.Stats {
+	return x.seen.Stats()
+}
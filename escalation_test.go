@@ -0,0 +1,67 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestEscalatorThreshold(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	x := newEscalator(3, time.Minute, time.Hour, 0)
+	x.now = func() time.Time { return now }
+
+	observe := func(ip string) (string, int, bool) {
+		prefix, count, escalate := x.Observe(netip.MustParseAddr(ip))
+		return prefix.String(), count, escalate
+	}
+
+	observe("203.0.113.1")
+	if _, count, escalate := observe("203.0.113.1"); count != 1 || escalate {
+		t.Errorf("repeat blocks of one IP must not count, got %d %v", count, escalate)
+	}
+	observe("198.51.100.1") // other /24
+	observe("203.0.113.2")
+	prefix, count, escalate := observe("203.0.113.3")
+	if !escalate || count != 3 || prefix != "203.0.113.0/24" {
+		t.Errorf("expected escalation of 203.0.113.0/24 at 3 IPs, got %s %d %v", prefix, count, escalate)
+	}
+	if _, count, _ := observe("203.0.113.4"); count != 1 {
+		t.Errorf("expected a new window after escalation, got count %d", count)
+	}
+
+	// IPs spread over more than the window do not escalate
+	observe("192.0.2.1")
+	observe("192.0.2.2")
+	now = now.Add(time.Minute)
+	if _, count, escalate := observe("192.0.2.3"); escalate || count != 1 {
+		t.Errorf("expected the window to expire, got %d %v", count, escalate)
+	}
+
+	if _, _, escalate := x.Observe(netip.MustParseAddr("2001:db8::1")); escalate {
+		t.Error("IPv6 addresses are not escalated")
+	}
+}
+
+func TestEscalateBlocksPrefix(t *testing.T) {
+	e := &EllioMiddleware{
+		config:     &Config{},
+		overlay:    locallist.NewOverlay(),
+		escalation: newEscalator(2, time.Minute, time.Hour, 0),
+	}
+	manager := &singleton.Manager{}
+
+	e.escalate(manager, "203.0.113.1", "blocklist")
+	if e.overlay.Block.Len() != 0 {
+		t.Fatal("expected no escalation below the threshold")
+	}
+	e.escalate(manager, "203.0.113.2", "blocklist")
+
+	entries := e.overlay.Block.Entries()
+	if len(entries) != 1 || entries[0].Prefix.String() != "203.0.113.0/24" || entries[0].Expires.IsZero() {
+		t.Errorf("expected a temporary /24 block, got %+v", entries)
+	}
+}
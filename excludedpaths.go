@@ -0,0 +1,98 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// regexPathPrefix marks an excludedPaths entry as a regular expression
+const regexPathPrefix = "regex:"
+
+// pathMatcher matches request paths against exact paths, prefixes ending in
+// "*" and regular expressions prefixed with "regex:"
+type pathMatcher struct {
+	exact    map[string]struct{}
+	prefixes []string
+	patterns []*regexp.Regexp
+}
+
+// newPathMatcher parses the entries, nil when none is valid. Invalid
+// entries are logged and skipped.
+func newPathMatcher(entries []string, label string) *pathMatcher {
+	m := &pathMatcher{exact: make(map[string]struct{})}
+	n := 0
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			continue
+		case strings.HasPrefix(entry, regexPathPrefix):
+			re, err := regexp.Compile(strings.TrimPrefix(entry, regexPathPrefix))
+			if err != nil {
+				logger.Warnf("Invalid %s '%s', skipping: %v", label, entry, err)
+				continue
+			}
+			m.patterns = append(m.patterns, re)
+		case !strings.HasPrefix(entry, "/"):
+			logger.Warnf("Invalid %s '%s', must start with / or %s, skipping", label, entry, regexPathPrefix)
+			continue
+		case strings.HasSuffix(entry, "*"):
+			m.prefixes = append(m.prefixes, strings.TrimSuffix(entry, "*"))
+		default:
+			m.exact[entry] = struct{}{}
+		}
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	return m
+}
+
+// Matches reports whether the path matches any entry, false for a nil matcher
+func (m *pathMatcher) Matches(path string) bool {
+	_, ok := m.Match(path)
+	return ok
+}
+
+// Match returns the entry matching the path as configured, ok is false when
+// none matches or the matcher is nil
+func (m *pathMatcher) Match(path string) (entry string, ok bool) {
+	if m == nil {
+		return "", false
+	}
+	if _, ok := m.exact[path]; ok {
+		return path, true
+	}
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return prefix + "*", true
+		}
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(path) {
+			return regexPathPrefix + re.String(), true
+		}
+	}
+	return "", false
+}
+
+// entries returns the valid entries as configured
+func (m *pathMatcher) entries() []string {
+	if m == nil {
+		return nil
+	}
+	entries := make([]string, 0, len(m.exact)+len(m.prefixes)+len(m.patterns))
+	for path := range m.exact {
+		entries = append(entries, path)
+	}
+	for _, prefix := range m.prefixes {
+		entries = append(entries, prefix+"*")
+	}
+	for _, re := range m.patterns {
+		entries = append(entries, regexPathPrefix+re.String())
+	}
+	return entries
+}
@@ -0,0 +1,79 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/admin"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestPathMatcher(t *testing.T) {
+	m := newPathMatcher([]string{
+		"/healthz",
+		"/.well-known/acme-challenge/*",
+		`regex:^/hooks/[a-z]+$`,
+		"regex:[",  // invalid
+		"relative", // invalid
+		"",
+	}, "excluded path")
+
+	tests := map[string]bool{
+		"/healthz":                        true,
+		"/healthz/deep":                   false,
+		"/.well-known/acme-challenge/tok": true,
+		"/.well-known/acme-challenge/":    true,
+		"/.well-known/security.txt":       false,
+		"/hooks/github":                   true,
+		"/hooks/github/extra":             false,
+		"/":                               false,
+	}
+	for path, want := range tests {
+		if got := m.Matches(path); got != want {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+
+	if entry, _ := m.Match("/hooks/github"); entry != `regex:^/hooks/[a-z]+$` {
+		t.Errorf("expected the regex entry to match, got %q", entry)
+	}
+	if entry, _ := m.Match("/.well-known/acme-challenge/tok"); entry != "/.well-known/acme-challenge/*" {
+		t.Errorf("expected the prefix entry to match, got %q", entry)
+	}
+	if n := len(m.entries()); n != 3 {
+		t.Errorf("expected 3 valid entries, got %d", n)
+	}
+
+	if newPathMatcher([]string{"regex:(", "  "}, "excluded path") != nil {
+		t.Error("expected no matcher without valid entries")
+	}
+	var none *pathMatcher
+	if none.Matches("/healthz") {
+		t.Error("a nil matcher must not match")
+	}
+}
+
+func TestServeHTTP_ExcludedPathsBypassFailClosed(t *testing.T) {
+	middleware := &EllioMiddleware{
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		name:          "test",
+		config:        &Config{FailureMode: "closed", IPStrategy: "direct"},
+		readiness:     admin.ReadinessHandler(singleton.GetManager().Readiness),
+		excludedPaths: newPathMatcher([]string{"/healthz"}, "excluded path"),
+	}
+
+	for path, want := range map[string]int{
+		"/healthz": http.StatusOK,
+		"/":        http.StatusServiceUnavailable,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		rec := httptest.NewRecorder()
+		middleware.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+}
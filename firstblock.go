@@ -0,0 +1,67 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/bounded"
+)
+
+const (
+	// defaultFirstBlockWindow is how long an IP stays "already seen" after its first block
+	defaultFirstBlockWindow = 10 * time.Minute
+	// defaultTrackerMaxEntries bounds per-IP tracking structures so floods
+	// from many sources cannot grow them without limit
+	defaultTrackerMaxEntries = 10000
+)
+
+// blockWindow counts the blocks of one IP since its first block
+type blockWindow struct {
+	start time.Time
+	count int64
+}
+
+// firstBlockTracker decides whether a block is the first for an IP within
+// the window. Only the first block ships a detailed event, later ones ship
+// counter-only events. When the tracker is full the least recently blocked
+// IPs are forgotten, which only means they get another detailed event.
+type firstBlockTracker struct {
+	window time.Duration
+	seen   *bounded.LRU
+	now    func() time.Time
+}
+
+func newFirstBlockTracker(window time.Duration, maxEntries int) *firstBlockTracker {
+	if window <= 0 {
+		window = defaultFirstBlockWindow
+	}
+	if maxEntries <= 0 {
+		maxEntries = defaultTrackerMaxEntries
+	}
+	return &firstBlockTracker{
+		window: window,
+		seen:   bounded.NewLRU("first_block", maxEntries, window),
+		now:    time.Now,
+	}
+}
+
+// Observe records a block of ip. It returns whether this is the first block
+// in the current window, the number of blocks in the window including this
+// one, and when the window started.
+func (t *firstBlockTracker) Observe(ip string) (bool, int64, time.Time) {
+	now := t.now()
+	w := t.seen.Update(ip, func(old interface{}, found bool) interface{} {
+		if found {
+			if w := old.(*blockWindow); now.Sub(w.start) < t.window {
+				w.count++
+				return w
+			}
+		}
+		return &blockWindow{start: now, count: 1}
+	}).(*blockWindow)
+	return w.count == 1, w.count, w.start
+}
+
+// Stats reports the tracker memory usage
+func (t *firstBlockTracker) Stats() bounded.Stats {
+	return t.seen.Stats()
+}
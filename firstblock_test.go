@@ -0,0 +1,43 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFirstBlockTracker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newFirstBlockTracker(time.Minute, 0)
+	tracker.now = func() time.Time { return now }
+
+	if first, count, _ := tracker.Observe("1.2.3.4"); !first || count != 1 {
+		t.Fatalf("expected first block, got first=%v count=%d", first, count)
+	}
+	if first, count, start := tracker.Observe("1.2.3.4"); first || count != 2 || !start.Equal(now) {
+		t.Errorf("expected repeat with count 2, got first=%v count=%d start=%v", first, count, start)
+	}
+	if first, _, _ := tracker.Observe("5.6.7.8"); !first {
+		t.Error("other IPs must get their own first block")
+	}
+
+	now = now.Add(time.Minute)
+	if first, count, _ := tracker.Observe("1.2.3.4"); !first || count != 1 {
+		t.Errorf("expected a new window after expiry, got first=%v count=%d", first, count)
+	}
+}
+
+func TestFirstBlockTrackerBounded(t *testing.T) {
+	tracker := newFirstBlockTracker(time.Minute, 100)
+	for i := 0; i < 110; i++ {
+		tracker.Observe(fmt.Sprintf("10.0.0.%d", i))
+	}
+	stats := tracker.Stats()
+	if stats.Entries != 100 || stats.Evictions != 10 {
+		t.Errorf("expected the tracker capped at 100 with 10 evictions, got %+v", stats)
+	}
+	// The oldest IP was evicted and counts as a first block again
+	if first, _, _ := tracker.Observe("10.0.0.0"); !first {
+		t.Error("expected an evicted IP to get a new first block")
+	}
+}
@@ -0,0 +1,130 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/netip"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/geo"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+// geoPolicy refuses clients by country. It only ever blocks: clients the EDL
+// allows are refused when their country is in blockedCountries, or outside
+// allowedCountries when that is set. Clients not found in the geo file are
+// not restricted.
+type geoPolicy struct {
+	table   *geo.Table
+	blocked map[string]bool
+	allowed map[string]bool // Empty allows every country not blocked
+}
+
+// newGeoPolicy loads the geo file of the country rules, nil when no rules
+// are configured or the file cannot be loaded
+func newGeoPolicy(path string, blocked, allowed []string) *geoPolicy {
+	g := &geoPolicy{
+		blocked: parseCountries(blocked, "blockedCountries"),
+		allowed: parseCountries(allowed, "allowedCountries"),
+	}
+	if len(g.blocked) == 0 && len(g.allowed) == 0 {
+		return nil
+	}
+	if path == "" {
+		logger.Warn("blockedCountries and allowedCountries need geoFile, country rules are not applied")
+		return nil
+	}
+	table, invalid, err := geo.Load(path)
+	if err != nil {
+		logger.Errorf("Failed to load geo file %s, country rules are not applied: %v", path, err)
+		return nil
+	}
+	if len(invalid) > 0 {
+		logger.Warnf("Skipped %d invalid or overlapping lines of geo file %s, first: %q", len(invalid), path, invalid[0])
+	}
+	logger.Infof("Loaded geo file %s: %d prefixes of %d countries", path, table.Len(), table.Countries())
+	g.table = table
+	return g
+}
+
+// parseCountries normalizes country codes, skipping invalid ones
+func parseCountries(codes []string, label string) map[string]bool {
+	countries := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		country, ok := geo.NormalizeCountry(code)
+		if !ok {
+			logger.Warnf("Ignoring invalid %s entry '%s', expected a two-letter country code", label, code)
+			continue
+		}
+		countries[country] = true
+	}
+	return countries
+}
+
+// Country returns the country of clientIP, empty when unknown
+func (g *geoPolicy) Country(clientIP string) (string, netip.Prefix) {
+	if g == nil {
+		return "", netip.Prefix{}
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return "", netip.Prefix{}
+	}
+	country, prefix, _ := g.table.Lookup(addr)
+	return country, prefix
+}
+
+// Refuses reports whether country is refused and the rule kind refusing it
+func (g *geoPolicy) Refuses(country string) (string, bool) {
+	switch {
+	case country == "":
+		return "", false
+	case g.blocked[country]:
+		return ruleBlockedCountry, true
+	case len(g.allowed) > 0 && !g.allowed[country]:
+		return ruleAllowedCountry, true
+	}
+	return "", false
+}
+
+// rules returns the configured countries per rule kind, for registering
+// their hit counters
+func (g *geoPolicy) rules() map[string][]string {
+	rules := make(map[string][]string)
+	for country := range g.blocked {
+		rules[ruleBlockedCountry] = append(rules[ruleBlockedCountry], country)
+	}
+	if len(g.allowed) > 0 {
+		rules[ruleAllowedCountry] = append(rules[ruleAllowedCountry], ruleOtherCountry)
+	}
+	return rules
+}
+
+// applyGeo records the client's country on d and refuses clients the EDL
+// allowed when a country rule applies. Decisions of overrides and local
+// lists are final and not passed here.
+func (e *EllioMiddleware) applyGeo(clientIP string, d singleton.Decision) singleton.Decision {
+	if e.geo == nil || d.Source == singleton.SourceError {
+		return d
+	}
+	country, prefix := e.geo.Country(clientIP)
+	d.Country = country
+	if !d.Allowed {
+		return d
+	}
+	kind, refused := e.geo.Refuses(country)
+	if !refused {
+		return d
+	}
+	rule := country
+	if kind == ruleAllowedCountry {
+		rule = ruleOtherCountry
+	}
+	e.rules.hit(kind, rule)
+	logger.Tracef("Client IP %s refused by %s rule for %s", clientIP, kind, country)
+	return singleton.Decision{
+		Source:     singleton.SourceGeo,
+		Matched:    prefix,
+		Country:    country,
+		Generation: d.Generation,
+		Latency:    d.Latency,
+	}
+}
@@ -0,0 +1,75 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func writeGeoFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "geo.txt")
+	content := "192.0.2.0/24 NL\n198.51.100.0/24 RU\n2001:db8::/32 DE\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewGeoPolicy(t *testing.T) {
+	path := writeGeoFile(t)
+	if g := newGeoPolicy(path, nil, nil); g != nil {
+		t.Error("expected no policy without country rules")
+	}
+	if g := newGeoPolicy("", []string{"RU"}, nil); g != nil {
+		t.Error("expected no policy without a geo file")
+	}
+	if g := newGeoPolicy(path+".missing", []string{"RU"}, nil); g != nil {
+		t.Error("expected no policy when the geo file cannot be loaded")
+	}
+
+	g := newGeoPolicy(path, []string{"ru", "invalid"}, nil)
+	if g == nil || len(g.blocked) != 1 || !g.blocked["RU"] {
+		t.Fatalf("expected RU to be blocked, got %+v", g)
+	}
+}
+
+func TestApplyGeo(t *testing.T) {
+	path := writeGeoFile(t)
+	allowed := singleton.Decision{Allowed: true, Source: singleton.SourceEDL, Generation: "gen-1"}
+
+	e := &EllioMiddleware{geo: newGeoPolicy(path, []string{"RU"}, nil)}
+	d := e.applyGeo("198.51.100.7", allowed)
+	if d.Allowed || d.Source != singleton.SourceGeo || d.Country != "RU" || d.Matched.String() != "198.51.100.0/24" || d.Generation != "gen-1" {
+		t.Errorf("expected a geo block of RU, got %s", d)
+	}
+	if d := e.applyGeo("192.0.2.1", allowed); !d.Allowed || d.Source != singleton.SourceEDL || d.Country != "NL" {
+		t.Errorf("expected NL to pass with its country recorded, got %s", d)
+	}
+
+	// EDL blocks keep their source and gain the country
+	blocked := singleton.Decision{Source: singleton.SourceEDL, Matched: netip.MustParsePrefix("198.51.100.0/24")}
+	if d := e.applyGeo("198.51.100.7", blocked); d.Source != singleton.SourceEDL || d.Country != "RU" {
+		t.Errorf("expected the EDL block to stand, got %s", d)
+	}
+
+	e = &EllioMiddleware{geo: newGeoPolicy(path, nil, []string{"NL"})}
+	if d := e.applyGeo("2001:db8::1", allowed); d.Allowed || d.Source != singleton.SourceGeo || d.Country != "DE" {
+		t.Errorf("expected DE outside allowedCountries to be blocked, got %s", d)
+	}
+	if d := e.applyGeo("192.0.2.1", allowed); !d.Allowed {
+		t.Errorf("expected NL in allowedCountries to pass, got %s", d)
+	}
+	if d := e.applyGeo("203.0.113.1", allowed); !d.Allowed || d.Country != "" {
+		t.Errorf("expected a client missing from the geo file to pass, got %s", d)
+	}
+
+	// Without country rules decisions are untouched
+	e = &EllioMiddleware{}
+	if d := e.applyGeo("198.51.100.7", allowed); d != allowed {
+		t.Errorf("expected no change without country rules, got %s", d)
+	}
+}
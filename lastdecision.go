@@ -0,0 +1,90 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/bounded"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+// lastDecisionTTL is how long the last decision of a client can be looked up
+const lastDecisionTTL = 24 * time.Hour
+
+// Outcomes of a recorded decision, the verdict unless monitored
+const (
+	outcomeAllow      = "allow"
+	outcomeBlock      = "block"
+	outcomeWouldBlock = "would_block"
+)
+
+// lastDecision is the most recent decision made for a client IP, served by
+// the admin last-decision lookup
+type lastDecision struct {
+	Time       time.Time `json:"time"`
+	IP         string    `json:"ip"`
+	Verdict    string    `json:"verdict"` // allow, block or would_block when only monitored
+	Source     string    `json:"source"`
+	Matched    string    `json:"matched,omitempty"` // Entry that matched the client
+	List       string    `json:"list,omitempty"`    // List of a combined EDL that matched
+	ASN        string    `json:"asn,omitempty"`     // AS of the matched entry
+	Country    string    `json:"country,omitempty"` // Country of the client when country rules are configured
+	Generation string    `json:"generation,omitempty"`
+	Instance   string    `json:"instance"` // Middleware instance name
+	Entrypoint string    `json:"entrypoint,omitempty"`
+	Host       string    `json:"host"`
+	Path       string    `json:"path"`
+}
+
+// newLastDecisions keeps the last decision per client IP for the admin lookup
+func newLastDecisions(maxEntries int) *bounded.LRU {
+	if maxEntries <= 0 {
+		maxEntries = defaultTrackerMaxEntries
+	}
+	return bounded.NewLRU("last_decisions", maxEntries, lastDecisionTTL)
+}
+
+// recordDecision keeps the decision made for a request until the client's
+// next one. It is skipped unless the admin surface is enabled and while the
+// memory budget is exceeded.
+func (e *EllioMiddleware) recordDecision(manager *singleton.Manager, req *http.Request, clientIP, outcome string, d singleton.Decision) {
+	if e.lastDecisions == nil || manager.MemoryDegraded() {
+		return
+	}
+	host, path := requestTarget(req)
+	record := &lastDecision{
+		Time:       time.Now().UTC(),
+		IP:         clientIP,
+		Verdict:    outcome,
+		Source:     d.Source,
+		Generation: d.Generation,
+		List:       d.List,
+		ASN:        d.ASN,
+		Country:    d.Country,
+		Instance:   e.name,
+		Entrypoint: e.entrypoint(req),
+		Host:       host,
+		Path:       path,
+	}
+	if d.Matched.IsValid() {
+		record.Matched = d.Matched.String()
+	}
+	// Key by the canonical address, as the lookup does
+	key := clientIP
+	if addr, err := netip.ParseAddr(clientIP); err == nil {
+		key = addr.Unmap().WithZone("").String()
+	}
+	e.lastDecisions.Add(key, record)
+}
+
+// lastDecision looks up the last decision kept for a client IP
+func (e *EllioMiddleware) lastDecision(ip netip.Addr) interface{} {
+	if e.lastDecisions == nil {
+		return nil
+	}
+	if record, ok := e.lastDecisions.Get(ip.String()); ok {
+		return record
+	}
+	return nil
+}
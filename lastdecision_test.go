@@ -0,0 +1,39 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestRecordDecision(t *testing.T) {
+	e := &EllioMiddleware{name: "edge", config: &Config{}}
+	addr := netip.MustParseAddr("203.0.113.7")
+	d := singleton.Decision{Source: singleton.SourceEDL, Matched: netip.MustParsePrefix("203.0.113.0/24"), Generation: "g1"}
+
+	// Nothing is kept without admin endpoints
+	e.recordDecision(nil, httptest.NewRequest("GET", "http://example.com/login", nil), "203.0.113.7", outcomeBlock, d)
+	if e.lastDecision(addr) != nil {
+		t.Fatal("expected no decision without a tracker")
+	}
+
+	e.lastDecisions = newLastDecisions(10)
+	e.recordDecision(nil, httptest.NewRequest("GET", "http://example.com/", nil), "203.0.113.7", outcomeAllow, singleton.Decision{Allowed: true, Source: singleton.SourceEDL})
+	e.recordDecision(nil, httptest.NewRequest("GET", "http://example.com/login?next=/", nil), "::ffff:203.0.113.7", outcomeBlock, d)
+
+	record, ok := e.lastDecision(addr).(*lastDecision)
+	if !ok {
+		t.Fatal("expected a decision for the client")
+	}
+	if record.Verdict != outcomeBlock || record.Source != singleton.SourceEDL || record.Matched != "203.0.113.0/24" || record.Generation != "g1" {
+		t.Errorf("expected the most recent block, got %+v", record)
+	}
+	if record.Instance != "edge" || record.Host != "example.com" || record.Path != "/login" {
+		t.Errorf("unexpected route of the decision: %+v", record)
+	}
+	if e.lastDecision(netip.MustParseAddr("198.51.100.1")) != nil {
+		t.Error("expected no decision for an unknown client")
+	}
+}
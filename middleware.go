@@ -2,28 +2,210 @@ package ELLIO_Traefik_Middleware_Plugin
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"hash/fnv"
+	"html/template"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/netip"
 	"strings"
 	"time"
 
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/admin"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/api"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/backoff"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/bounded"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/iptrie"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/utils"
 )
 
 // init is handled by the logger package
 
 // Config holds the plugin configuration
 type Config struct {
-	BootstrapToken string   `json:"bootstrapToken,omitempty"`
-	LogLevel       string   `json:"logLevel,omitempty"`
-	MachineID      string   `json:"machineID,omitempty"`      // Optional machine ID override (defaults to random UUID)
-	IPStrategy     string   `json:"ipStrategy,omitempty"`     // "direct" (default), "xff", "real-ip", "custom"
-	TrustedHeader  string   `json:"trustedHeader,omitempty"`  // Custom header name when ipStrategy is "custom"
-	TrustedProxies []string `json:"trustedProxies,omitempty"` // List of trusted proxy IPs or CIDR ranges
+	BootstrapToken        string   `json:"bootstrapToken,omitempty"`
+	LogLevel              string   `json:"logLevel,omitempty"`
+	TraceClientIPs        []string `json:"traceClientIPs,omitempty"`        // IPs or CIDR ranges whose requests are trace logged regardless of logLevel
+	TraceClientIPsUntil   string   `json:"traceClientIPsUntil,omitempty"`   // Expiry of traceClientIPs as RFC 3339 time or duration, default "1h"
+	MachineID             string   `json:"machineID,omitempty"`             // Optional machine ID override (defaults to random UUID)
+	IPStrategy            string   `json:"ipStrategy,omitempty"`            // "direct" (default), "xff" (rightmost entry not in trustedProxies), "xff-depth", "real-ip", "custom"
+	Depth                 int      `json:"depth,omitempty"`                 // X-Forwarded-For entry used by "xff-depth", counted from the right starting at 1, as Traefik's ipStrategy.depth
+	TrustedHeader         string   `json:"trustedHeader,omitempty"`         // Custom header name when ipStrategy is "custom"
+	TrustedProxies        []string `json:"trustedProxies,omitempty"`        // List of trusted proxy IPs, CIDR ranges, hostnames or "*"
+	XFFMaxHops            int      `json:"xffMaxHops,omitempty"`            // Rightmost X-Forwarded-For entries considered, default 16
+	XFFMaxBytes           int      `json:"xffMaxBytes,omitempty"`           // Trailing X-Forwarded-For bytes parsed, default 1024
+	TrustedProxiesRefresh string   `json:"trustedProxiesRefresh,omitempty"` // Re-resolution interval for hostname trustedProxies, default "5m"
+	ComponentTypes        []string `json:"componentTypes,omitempty"`        // Accepted JWT component types (defaults to ellio_traefik_middleware_plugin)
+	InitTimeout           string   `json:"initTimeout,omitempty"`           // Bound for bootstrap and initial EDL load, e.g. "45s"
+	BootstrapTimeout      string   `json:"bootstrapTimeout,omitempty"`      // Startup deadline of bootstrap before it is retried in the background, default initTimeout or "30s"
+	AsyncInit             bool     `json:"asyncInit,omitempty"`             // Return from New immediately and initialize in the background
+	ValidateOnly          bool     `json:"validateOnly,omitempty"`          // Bootstrap, fetch the config and load the EDL once, log the result and pass all traffic through
+
+	// Rate limit of event batches shipped to the ELLIO logs API; unset tunes it to the observed event rate
+	LogsRate  int `json:"logsRate,omitempty"`  // Steady-state batches per second, default 100
+	LogsBurst int `json:"logsBurst,omitempty"` // Burst size in batches, default 10 seconds of logsRate
+
+	EncryptEvents bool `json:"encryptEvents,omitempty"` // Encrypt event payloads end-to-end to the deployment key delivered at bootstrap
+
+	MemoryBudgetMB int `json:"memoryBudgetMB,omitempty"` // Memory for the EDL and event buffers; over it updates are refused and tracking disabled, 0 is unbounded
+
+	// Air-gapped deployments load the EDL from a mounted file instead of the ELLIO API
+	EDLFilePath    string `json:"edlFilePath,omitempty"`    // Binary EDL file path or file:// URL; bootstrapToken is not required
+	EDLFileMode    string `json:"edlFileMode,omitempty"`    // "blocklist" (default) or "allowlist"
+	EDLFileRefresh string `json:"edlFileRefresh,omitempty"` // How often the file is checked for changes, default "10s"
+
+	// Local development without an ELLIO tenant: no ELLIO API calls or events, admin endpoints open to private sources, every decision logged
+	DevMode      bool     `json:"devMode,omitempty"`      // Never use in production; bootstrapToken is not required
+	DevBlocklist []string `json:"devBlocklist,omitempty"` // IPs or CIDR ranges blocked in dev mode, e.g. ["203.0.113.0/24"]
+
+	EDLFormat string `json:"edlFormat,omitempty"` // "auto" (default) loads plain-text lists when the EDL is not ELLIOTRIE, "binary" rejects them
+
+	EDLPrecedence string `json:"edlPrecedence,omitempty"` // List that wins for clients on both lists of a combined EDL: "allowlist" (default) or "blocklist"
+
+	ASNTable string `json:"asnTable,omitempty"` // File of "<prefix> <asn>" lines resolving "AS64500" entries of plain-text EDLs, read at startup
+
+	// Event shipping pauses during quiet hours; events are spooled and shipped afterwards
+	QuietHours         []string `json:"quietHours,omitempty"`         // Daily windows such as "01:00-05:00", a window ending before it starts spans midnight
+	QuietHoursTimezone string   `json:"quietHoursTimezone,omitempty"` // IANA time zone of quietHours, default "UTC"
+	QuietSpoolMax      int      `json:"quietSpoolMax,omitempty"`      // Events spooled during quiet hours, newer ones are dropped; default and at most the event buffer size
+	QuietCatchUpRate   int      `json:"quietCatchUpRate,omitempty"`   // Spooled batches shipped per second after quiet hours, default 10
+
+	CacheDir string `json:"cacheDir,omitempty"` // Directory keeping the last loaded EDL, enforced after a restart until the first download completes
+
+	// Full-jitter exponential backoff of EDL downloads, bootstrap calls and event uploads
+	RetryMaxAttempts int    `json:"retryMaxAttempts,omitempty"` // Attempts per call including the first, default 3
+	RetryBaseDelay   string `json:"retryBaseDelay,omitempty"`   // Delay cap before the first retry, doubled per retry; default "2s" for EDL downloads, "1s" otherwise
+	RetryMaxDelay    string `json:"retryMaxDelay,omitempty"`    // Upper bound of any retry delay, default "30s" for EDL downloads, "10s" otherwise
+
+	// TLS of calls to the bootstrap, config, EDL and logs endpoints, e.g. behind a TLS-intercepting proxy
+	CABundle           string `json:"caBundle,omitempty"`           // PEM file path or inline PEM of CAs trusted in addition to the system roots
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"` // Skip certificate verification, for testing only
+	MinTLSVersion      string `json:"minTLSVersion,omitempty"`      // Lowest accepted TLS version, "1.2" or "1.3"
+	ClientCert         string `json:"clientCert,omitempty"`         // PEM file path or inline PEM of the client certificate for endpoints requiring mutual TLS
+	ClientKey          string `json:"clientKey,omitempty"`          // PEM file path or inline PEM of the client private key; files are reloaded when rotated
+
+	AllowOverride []string `json:"allowOverride,omitempty"` // IPs or CIDR ranges always allowed regardless of EDL and local lists, e.g. monitoring probes
+	BlockOverride []string `json:"blockOverride,omitempty"` // IPs or CIDR ranges always blocked, also in allowlist mode; allowOverride wins
+
+	// Traefik ipAllowList (ipWhiteList) middleware chained before this one; contradictory settings fail the configuration
+	UpstreamAllowList     []string `json:"upstreamAllowList,omitempty"`     // Its sourceRange: clients within it passed the allowlist, compared by the client IP of ipStrategy
+	UpstreamAllowListMode string   `json:"upstreamAllowListMode,omitempty"` // "enforce" (default) still checks those clients against ELLIO, "skip" forwards them unchecked
+
+	// Local lists are evaluated before the EDL; the allowlist wins over the blocklist
+	LocalAllowlist    string `json:"localAllowlist,omitempty"`    // File of IPs/CIDRs that are always allowed
+	LocalBlocklist    string `json:"localBlocklist,omitempty"`    // File of IPs/CIDRs that are always blocked
+	LocalListsRefresh string `json:"localListsRefresh,omitempty"` // How often list files are checked for changes, default "10s"
+
+	// Tor exit nodes are blocked after local lists and before the EDL
+	BlockTorExits  bool   `json:"blockTorExits,omitempty"`  // Block clients on the Tor exit node list
+	TorExitListURL string `json:"torExitListURL,omitempty"` // Plain-text list of exit addresses, default the Tor Project's bulk exit list
+	TorExitRefresh string `json:"torExitRefresh,omitempty"` // How often the list is downloaded, default "1h"
+
+	// Country rules refuse clients the EDL allows; overrides and local lists still win
+	GeoFile          string   `json:"geoFile,omitempty"`          // File of "<prefix> <country>" lines locating clients, read at startup
+	BlockedCountries []string `json:"blockedCountries,omitempty"` // ISO 3166 alpha-2 codes of countries always blocked
+	AllowedCountries []string `json:"allowedCountries,omitempty"` // ISO 3166 alpha-2 codes of the only countries allowed; clients not in geoFile are not restricted
+
+	// Admin endpoints under /_ellio/ are enabled by a token or a client certificate requirement
+	AdminToken             string   `json:"adminToken,omitempty"`             // Bearer token for the admin endpoints
+	AdminRequireClientCert bool     `json:"adminRequireClientCert,omitempty"` // Require a client certificate verified by Traefik TLS options
+	AdminClientCertNames   []string `json:"adminClientCertNames,omitempty"`   // Accepted certificate common names or DNS SANs, empty accepts any
+	AdminAllowedSources    []string `json:"adminAllowedSources,omitempty"`    // IPs or CIDR ranges allowed to call the admin endpoints
+	AdminRateLimit         int      `json:"adminRateLimit,omitempty"`         // Requests per minute per client, default 60, -1 disables
+
+	// Prometheus metrics, served when a token is set
+	MetricsPath  string `json:"metricsPath,omitempty"`  // Path of the metrics endpoint, default "/_ellio/metrics"
+	MetricsToken string `json:"metricsToken,omitempty"` // Bearer token for scrapers; adminAllowedSources and adminRateLimit also apply
+
+	FailureMode       string `json:"failureMode,omitempty"`       // While the EDL cannot be enforced: "open" (default) allows traffic, "closed" answers 503, "closed-new" answers 503 to clients not recently allowed
+	EDLMaxStaleness   string `json:"edlMaxStaleness,omitempty"`   // EDL age after which it counts as unavailable for failureMode, e.g. "1h"; unset never expires
+	UnavailableFormat string `json:"unavailableFormat,omitempty"` // 503 body when failing closed: "auto" (default), "json" or "html"
+
+	// Entrypoints are identified by EntrypointHeader when set by a trusted proxy,
+	// otherwise by local listener port such as ":443"
+	EntrypointHeader    string   `json:"entrypointHeader,omitempty"`    // Request header naming the Traefik entrypoint, only read from trustedProxies peers
+	EnforcedEntrypoints []string `json:"enforcedEntrypoints,omitempty"` // Only enforce on these entrypoints, empty enforces everywhere
+
+	// Virtual hosts are matched against the request Host without port; "*.example.com" matches subdomains
+	IncludeHosts []string `json:"includeHosts,omitempty"` // Only enforce on these hosts, empty enforces on all
+	ExcludeHosts []string `json:"excludeHosts,omitempty"` // Never enforce on these hosts, wins over includeHosts
+
+	IPv6AggregatePrefix int `json:"ipv6AggregatePrefix,omitempty"` // Treat IPv6 clients as their covering prefix, e.g. 64; 0 (default) checks the exact address
+
+	DecisionHeader bool `json:"decisionHeader,omitempty"` // Add X-Ellio-Decision with verdict, source and matched entry to responses
+
+	BypassConnect bool `json:"bypassConnect,omitempty"` // Pass CONNECT requests through without EDL checks or events
+
+	EnforcementMode       string `json:"enforcementMode,omitempty"`       // "enforce" (default) or "monitor" to forward listed clients and ship would-block events
+	EnforcementPercentage int    `json:"enforcementPercentage,omitempty"` // Share of listed clients blocked, 1-100 (default 100); the rest are handled as in monitor mode, sticky per client IP
+
+	// Graduated enforcement: listed clients are blocked on sensitive path groups and monitored elsewhere
+	PathGroups          []PathGroup `json:"pathGroups,omitempty"`          // Path groups with sensitivity weights, empty enforces on every path
+	BlockMinSensitivity int         `json:"blockMinSensitivity,omitempty"` // Lowest group sensitivity that is enforced, default 1
+
+	// Block page options
+	SupportEmail          string `json:"supportEmail,omitempty"`          // Contact address shown on the block page
+	SupportURL            string `json:"supportURL,omitempty"`            // Ticketing or contact link shown on the block page
+	BlockPageTemplate     string `json:"blockPageTemplate,omitempty"`     // Custom html/template page, inline HTML or a file path
+	BlockPageShowClientIP bool   `json:"blockPageShowClientIP,omitempty"` // Show the blocked client IP on the block page
+	BlockPageTitle        string `json:"blockPageTitle,omitempty"`        // Custom page title
+	BlockPageLogoURL      string `json:"blockPageLogoURL,omitempty"`      // Custom logo image URL
+	HideBranding          bool   `json:"hideBranding,omitempty"`          // Remove the ELLIO logo and footer link
+
+	// Block response options
+	BlockStatusCode   int    `json:"blockStatusCode,omitempty"`   // Status of block responses, e.g. 404 (stealth) or 429; default 403
+	BlockResponseBody string `json:"blockResponseBody,omitempty"` // Fixed body replacing the block page, e.g. plain text or JSON
+	BlockContentType  string `json:"blockContentType,omitempty"`  // Content-Type of blockResponseBody, default "text/plain; charset=utf-8"
+
+	BlockResponseMode string   `json:"blockResponseMode,omitempty"` // "auto" (default) negotiates HTML or JSON, "html" or "json" force a format
+	APIPaths          []string `json:"apiPaths,omitempty"`          // Path prefixes of API routes that always get JSON block responses in auto mode
+
+	BlockedPreflightCORS string `json:"blockedPreflightCORS,omitempty"` // "deny" (default) or "permissive" for blocked OPTIONS preflights
+
+	// Requests without a usable client IP, e.g. behind proxies known to send broken headers
+	IPMissingAction  string `json:"ipMissingAction,omitempty"`  // "reject" (default) answers 400, "allow" forwards the request
+	IPMissingMessage string `json:"ipMissingMessage,omitempty"` // Body of the 400 answer, default "Unable to determine client IP"
+	IPInvalidAction  string `json:"ipInvalidAction,omitempty"`  // "reject" (default) answers 400, "allow" forwards the request
+	IPInvalidMessage string `json:"ipInvalidMessage,omitempty"` // Body of the 400 answer, default "Invalid IP address"
+
+	// Mode-aware event sampling, rates are fractions in (0, 1]
+	AllowEventSampleRate       float64 `json:"allowEventSampleRate,omitempty"`       // Share of allowed requests reported as access_allowed in any mode, for hit-rate analytics (default 0, off)
+	AllowlistAllowedSampleRate float64 `json:"allowlistAllowedSampleRate,omitempty"` // Share of allowed requests reported in allowlist mode, overrides allowEventSampleRate when set
+	BlocklistBlockedSampleRate float64 `json:"blocklistBlockedSampleRate,omitempty"` // Share of blocked requests reported in blocklist mode (default 1, all)
+
+	// Event detail per blocked IP
+	DetailedFirstBlock bool     `json:"detailedFirstBlock,omitempty"` // Ship a detailed event for the first block of an IP, counter-only events after
+	FirstBlockWindow   string   `json:"firstBlockWindow,omitempty"`   // How long later blocks of an IP count as repeats, default "10m"
+	EventDedupWindow   string   `json:"eventDedupWindow,omitempty"`   // Collapse blocks of an IP within this window into one event with a count, e.g. "1m"; unset ships every block
+	LogCaptureHeaders  []string `json:"logCaptureHeaders,omitempty"`  // Request headers added to block events, e.g. "Referer" or "X-Request-ID"; at most 16, values capped at 256 bytes, credentials never captured
+	EventFlushMin      string   `json:"eventFlushMin,omitempty"`      // Flush interval of events while blocks are rare, default "1s"
+	EventFlushMax      string   `json:"eventFlushMax,omitempty"`      // Flush interval reached as the block rate grows, default "10s"; set to eventFlushMin for a fixed interval
+
+	// Neighborhood escalation: block a whole /24 locally after distinct IPs from it were blocked
+	EscalationThreshold int    `json:"escalationThreshold,omitempty"` // Distinct blocked IPs per /24 that trigger escalation, 0 (default) disables it
+	EscalationWindow    string `json:"escalationWindow,omitempty"`    // Window for counting distinct IPs, default "10m"
+	EscalationTTL       string `json:"escalationTTL,omitempty"`       // How long an escalated /24 stays blocked, default "1h"
+
+	TrackerMaxEntries int `json:"trackerMaxEntries,omitempty"` // Memory ceiling in IPs for each per-IP tracking structure, default 10000
+
+	// EDL verdicts are cached per client, includeHosts pattern and path group
+	DecisionCacheSize int    `json:"decisionCacheSize,omitempty"` // Cached verdicts, 0 (default) checks the EDL on every request
+	DecisionCacheTTL  string `json:"decisionCacheTTL,omitempty"`  // How long a verdict is reused while the EDL is unchanged, default "10s"
+
+	// Infrastructure health checks always bypass the EDL and never generate events
+	HealthCheckUserAgents          []string `json:"healthCheckUserAgents,omitempty"`          // User-Agent substrings, e.g. "ELB-HealthChecker"; only honored from healthCheckSources, as clients can send any User-Agent
+	HealthCheckSources             []string `json:"healthCheckSources,omitempty"`             // Source IPs or CIDR ranges of health checkers; with healthCheckUserAgents a request needs both
+	HealthCheckUserAgentsAnySource bool     `json:"healthCheckUserAgentsAnySource,omitempty"` // Honor healthCheckUserAgents from any source; spoofable, any client can bypass the EDL
+
+	// Paths that skip the IP check entirely, e.g. health checks, ACME challenges and webhooks
+	ExcludedPaths []string `json:"excludedPaths,omitempty"` // Exact paths, prefixes ending in "*" or "regex:" patterns
 }
 
 // CreateConfig creates the default plugin configuration
@@ -36,7 +218,46 @@ type EllioMiddleware struct {
 	next           http.Handler
 	name           string
 	config         *Config
-	trustedProxies []netip.Prefix // Parsed trusted proxy ranges
+	manager        *singleton.Manager // Manager of this instance's deployment, nil if none
+	trustedProxies []netip.Prefix     // Parsed trusted proxy ranges
+	proxyHosts     *proxyResolver     // Trusted proxies given as hostnames, nil if none
+	localAllow     *locallist.FileList
+	localBlock     *locallist.FileList
+	overlay        *locallist.Overlay // Runtime overlay shared through the manager
+	upstream       *upstreamAllowList // Traefik allowlist chained before this middleware, nil if none
+	geo            *geoPolicy         // Country rules, nil when none are configured
+	torExits       *ipmatcher.Matcher // Tor exit nodes, nil unless blockTorExits is set
+	allowOverride  []netip.Prefix     // Always allowed ranges, checked first
+	blockOverride  *iptrie.Trie       // Always blocked ranges, read-only after New, nil if none
+	admin          *admin.Server      // Admin endpoints, nil when disabled
+	readiness      http.Handler       // Readiness probe, only served when failing closed
+	maxStaleness   time.Duration      // EDL age after which failureMode applies, zero disables
+	knownClients   *bounded.LRU       // Recently allowed clients, let through in "closed-new" failure mode
+	lastDecisions  *bounded.LRU       // Last decision per client IP for the admin lookup, nil without admin endpoints
+	verdicts       *bounded.LRU       // EDL verdicts per client and rule scope, nil without decisionCacheSize
+	metrics        *singleton.Metrics // Shared metrics, nil without a manager
+	metricsHandler http.Handler       // Guarded metrics endpoint, nil when disabled
+	staticPage     *staticBlockPage   // Pre-compressed blockResponseBody, nil when unset
+	splicedPage    *splicedBlockPage  // Pre-compressed built-in block page, nil with a custom template
+	pageTemplate   *template.Template // Custom block page template, nil uses the built-in page
+
+	healthCheckAgents  []string       // Lowercased health check User-Agent markers
+	healthCheckSources []netip.Prefix // Parsed health check source ranges
+	healthCheckAnyUA   bool           // User-Agent markers bypass from any source, see healthCheckUserAgentsAnySource
+	excludedPaths      *pathMatcher   // Paths that bypass enforcement, nil if none
+	includeHosts       []string       // Normalized host patterns enforced, empty enforces all
+	excludeHosts       []string       // Normalized host patterns never enforced
+	captureHeaders     []string       // Canonical header names captured in block events
+
+	allowEventRate  float64 // Any mode: share of allowed requests reported
+	allowSampleRate float64 // Allowlist mode: share of allowed requests reported, overrides allowEventRate when set
+	blockSampleRate float64 // Blocklist mode: share of blocked requests reported
+
+	firstBlocks *firstBlockTracker // Tracks already reported IPs, nil unless detailedFirstBlock
+	escalation  *escalator         // Counts blocked IPs per /24, nil unless escalationThreshold is set
+	tracer      *clientTracer      // Selects client IPs for trace logging, nil unless traceClientIPs is set
+	pathRules   *pathRules         // Path sensitivity evaluator, nil unless pathGroups are set
+	rules       *ruleStats         // Hit counters per configured rule, nil without metrics
 }
 
 // New creates a new middleware instance
@@ -45,7 +266,9 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 
 	// Set log level from config
 	logLevel := config.LogLevel
-	if logLevel == "" {
+	if logLevel == "" && config.DevMode {
+		logLevel = "debug"
+	} else if logLevel == "" {
 		logLevel = "info" // Default to info level
 	}
 
@@ -54,15 +277,192 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 		logger.Warnf("Invalid log level '%s', defaulting to info: %v", logLevel, err)
 		level = logger.InfoLevel
 	}
-	logger.SetLevel(level)
+	logger.Configure(level)
+
+	switch config.EnforcementMode {
+	case "":
+		config.EnforcementMode = "enforce"
+	case "enforce", "monitor":
+	default:
+		logger.Warnf("Invalid enforcementMode '%s', defaulting to enforce", config.EnforcementMode)
+		config.EnforcementMode = "enforce"
+	}
+	if config.EnforcementPercentage < 0 || config.EnforcementPercentage > 100 {
+		logger.Warnf("Invalid enforcementPercentage %d, enforcing on all clients", config.EnforcementPercentage)
+		config.EnforcementPercentage = 0
+	}
+	if config.EnforcementPercentage > 0 && config.EnforcementPercentage < 100 && config.EnforcementMode == "enforce" {
+		logger.Infof("Blocking %d%% of listed clients, reporting the rest as would-block", config.EnforcementPercentage)
+	}
+
+	switch config.FailureMode {
+	case "":
+		config.FailureMode = "open"
+	case "open", "closed", "closed-new":
+	default:
+		logger.Warnf("Invalid failureMode '%s', defaulting to open", config.FailureMode)
+		config.FailureMode = "open"
+	}
+	switch config.UnavailableFormat {
+	case "":
+		config.UnavailableFormat = "auto"
+	case "auto", "json", "html":
+	default:
+		logger.Warnf("Invalid unavailableFormat '%s', defaulting to auto", config.UnavailableFormat)
+		config.UnavailableFormat = "auto"
+	}
+
+	if config.BlockStatusCode == 0 {
+		config.BlockStatusCode = http.StatusForbidden
+	} else if config.BlockStatusCode < 400 || config.BlockStatusCode > 599 {
+		logger.Warnf("Invalid blockStatusCode %d, must be 400-599, defaulting to 403", config.BlockStatusCode)
+		config.BlockStatusCode = http.StatusForbidden
+	}
+	switch config.BlockResponseMode {
+	case "":
+		config.BlockResponseMode = "auto"
+	case "auto", "html", "json":
+	default:
+		logger.Warnf("Invalid blockResponseMode '%s', defaulting to auto", config.BlockResponseMode)
+		config.BlockResponseMode = "auto"
+	}
+	if config.BlockContentType == "" {
+		config.BlockContentType = "text/plain; charset=utf-8"
+	}
+
+	switch config.EDLFileMode {
+	case "":
+		config.EDLFileMode = "blocklist"
+	case "blocklist", "allowlist":
+	default:
+		logger.Warnf("Invalid edlFileMode '%s', defaulting to blocklist", config.EDLFileMode)
+		config.EDLFileMode = "blocklist"
+	}
 
-	// Initialize singleton manager on first middleware creation
-	logger.Trace("Calling singleton.Initialize...")
-	if err := singleton.Initialize(config.BootstrapToken, config.MachineID, config.IPStrategy, config.TrustedHeader, config.TrustedProxies); err != nil {
-		logger.Errorf("singleton.Initialize failed: %v", err)
+	config.IPMissingAction = ipErrorAction(config.IPMissingAction, "ipMissingAction")
+	config.IPInvalidAction = ipErrorAction(config.IPInvalidAction, "ipInvalidAction")
+	if config.IPMissingMessage == "" {
+		config.IPMissingMessage = "Unable to determine client IP"
+	}
+	if config.IPInvalidMessage == "" {
+		config.IPInvalidMessage = "Invalid IP address"
+	}
+
+	switch config.EDLFormat {
+	case "":
+		config.EDLFormat = singleton.EDLFormatAuto
+	case singleton.EDLFormatAuto, singleton.EDLFormatBinary:
+	default:
+		logger.Warnf("Invalid edlFormat '%s', defaulting to auto", config.EDLFormat)
+		config.EDLFormat = singleton.EDLFormatAuto
+	}
+
+	switch config.EDLPrecedence {
+	case "":
+		config.EDLPrecedence = singleton.PrecedenceAllowlist
+	case singleton.PrecedenceAllowlist, singleton.PrecedenceBlocklist:
+	default:
+		logger.Warnf("Invalid edlPrecedence '%s', defaulting to allowlist", config.EDLPrecedence)
+		config.EDLPrecedence = singleton.PrecedenceAllowlist
+	}
+
+	if config.IPv6AggregatePrefix < 0 || config.IPv6AggregatePrefix > 128 {
+		logger.Warnf("Invalid ipv6AggregatePrefix %d, checking exact addresses", config.IPv6AggregatePrefix)
+		config.IPv6AggregatePrefix = 0
+	}
+
+	// Set default IP strategy if not specified
+	if config.IPStrategy == "" {
+		config.IPStrategy = "direct"
+	}
+	if config.IPStrategy == "xff-depth" && config.Depth <= 0 {
+		if config.Depth < 0 {
+			logger.Warnf("Invalid depth %d, using the rightmost X-Forwarded-For entry", config.Depth)
+		}
+		config.Depth = 1
+	}
+
+	var initTimeout time.Duration
+	if config.InitTimeout != "" {
+		initTimeout, err = time.ParseDuration(config.InitTimeout)
+		if err != nil || initTimeout < 0 {
+			logger.Warnf("Invalid initTimeout '%s', using defaults: %v", config.InitTimeout, err)
+			initTimeout = 0
+		}
+	}
+
+	opts := singleton.Options{
+		BootstrapToken:     config.BootstrapToken,
+		MachineID:          config.MachineID,
+		ComponentTypes:     config.ComponentTypes,
+		IPStrategy:         config.IPStrategy,
+		TrustedHeader:      config.TrustedHeader,
+		TrustedProxies:     config.TrustedProxies,
+		InitTimeout:        initTimeout,
+		BootstrapTimeout:   parseDurationOr(config.BootstrapTimeout, 0, "bootstrapTimeout"),
+		AsyncInit:          config.AsyncInit,
+		EDLFilePath:        config.EDLFilePath,
+		EDLFileMode:        config.EDLFileMode,
+		EDLFileRefresh:     parseDurationOr(config.EDLFileRefresh, defaultEDLFileRefresh, "edlFileRefresh"),
+		DevMode:            config.DevMode,
+		DevBlocklist:       config.DevBlocklist,
+		EDLFormat:          config.EDLFormat,
+		EDLPrecedence:      config.EDLPrecedence,
+		ASNTablePath:       config.ASNTable,
+		LogsRate:           int64(config.LogsRate),
+		LogsBurst:          int64(config.LogsBurst),
+		EncryptEvents:      config.EncryptEvents,
+		EventDedup:         parseDurationOr(config.EventDedupWindow, 0, "eventDedupWindow"),
+		EventDedupMax:      config.TrackerMaxEntries,
+		EventFlushMin:      parseDurationOr(config.EventFlushMin, 0, "eventFlushMin"),
+		EventFlushMax:      parseDurationOr(config.EventFlushMax, 0, "eventFlushMax"),
+		QuietHours:         config.QuietHours,
+		QuietHoursTimezone: config.QuietHoursTimezone,
+		QuietSpoolMax:      config.QuietSpoolMax,
+		QuietCatchUpRate:   config.QuietCatchUpRate,
+		MemoryBudgetMB:     config.MemoryBudgetMB,
+		CacheDir:           config.CacheDir,
+		Retry: backoff.Policy{
+			Attempts: config.RetryMaxAttempts,
+			Base:     parseDurationOr(config.RetryBaseDelay, 0, "retryBaseDelay"),
+			Max:      parseDurationOr(config.RetryMaxDelay, 0, "retryMaxDelay"),
+		},
+		TLS: api.TLSOptions{
+			CABundle:           config.CABundle,
+			InsecureSkipVerify: config.InsecureSkipVerify,
+			MinVersion:         config.MinTLSVersion,
+			ClientCert:         config.ClientCert,
+			ClientKey:          config.ClientKey,
+		},
+	}
+
+	if config.ValidateOnly {
+		report, err := singleton.Validate(ctx, opts)
+		singleton.LogValidation(report, err)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("validateOnly is set, %s passes all traffic through", name)
+		return next, nil
+	}
+
+	// Instances of one deployment share a manager, other deployments get their own
+	logger.Trace("Calling singleton.Acquire...")
+	manager, err := singleton.Acquire(opts)
+	if err != nil {
+		logger.Errorf("singleton.Acquire failed: %v", err)
 		return nil, err
 	}
-	logger.Trace("singleton.Initialize succeeded")
+	logger.Trace("singleton.Acquire succeeded")
+
+	// Propagate this instance's settings, replacing those of earlier instances
+	// (Traefik recreates middlewares on every dynamic configuration reload)
+	manager.ApplyInstanceConfig(&singleton.InstanceConfig{
+		Name:           name,
+		IPStrategy:     config.IPStrategy,
+		TrustedHeader:  config.TrustedHeader,
+		TrustedProxies: config.TrustedProxies,
+	})
 
 	// Parse trusted proxies
 	var trustedProxies []netip.Prefix
@@ -71,16 +471,217 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 		logger.Infof("Parsed %d trusted proxy ranges", len(trustedProxies))
 	}
 
-	// Set default IP strategy if not specified
-	if config.IPStrategy == "" {
-		config.IPStrategy = "direct"
+	// Resolve trusted proxies given by DNS name
+	var proxyHosts *proxyResolver
+	var hosts []string
+	for _, entry := range config.TrustedProxies {
+		if isHostnameEntry(entry) {
+			hosts = append(hosts, entry)
+		}
+	}
+	if len(hosts) > 0 {
+		var refresh time.Duration
+		if config.TrustedProxiesRefresh != "" {
+			refresh, err = time.ParseDuration(config.TrustedProxiesRefresh)
+			if err != nil {
+				logger.Warnf("Invalid trustedProxiesRefresh '%s', using %v: %v",
+					config.TrustedProxiesRefresh, defaultProxyRefresh, err)
+			}
+		}
+		proxyHosts = newProxyResolver(hosts, refresh)
+		logger.Infof("Resolving %d trusted proxy hostnames", len(hosts))
+	}
+	if config.EntrypointHeader != "" && len(trustedProxies) == 0 && proxyHosts == nil {
+		logger.Warnf("entrypointHeader '%s' is ignored without trustedProxies, entrypoints are identified by listener port", config.EntrypointHeader)
+	}
+
+	// Load local list files
+	var refresh time.Duration
+	if config.LocalListsRefresh != "" {
+		if refresh, err = time.ParseDuration(config.LocalListsRefresh); err != nil {
+			logger.Warnf("Invalid localListsRefresh '%s', using %v: %v",
+				config.LocalListsRefresh, locallist.DefaultPollInterval, err)
+		}
+	}
+	localAllow := loadLocalList(config.LocalAllowlist, "local allowlist", refresh)
+	localBlock := loadLocalList(config.LocalBlocklist, "local blocklist", refresh)
+
+	// Parse health check markers
+	var healthCheckAgents []string
+	for _, ua := range config.HealthCheckUserAgents {
+		if ua = strings.TrimSpace(ua); ua != "" {
+			healthCheckAgents = append(healthCheckAgents, strings.ToLower(ua))
+		}
+	}
+	healthCheckSources := parsePrefixes(config.HealthCheckSources, "health check source")
+	if len(healthCheckAgents) > 0 {
+		switch {
+		case config.HealthCheckUserAgentsAnySource:
+			logger.Warn("healthCheckUserAgentsAnySource is set: any client sending a healthCheckUserAgents marker bypasses the EDL")
+		case len(healthCheckSources) == 0:
+			logger.Warn("healthCheckUserAgents are ignored without healthCheckSources, as any client can send them")
+		}
+	}
+	blockOverrides := parsePrefixes(config.BlockOverride, "block override")
+	upstream, err := newUpstreamAllowList(config, blockOverrides)
+	if err != nil {
+		return nil, err
 	}
 
 	middleware := &EllioMiddleware{
 		next:           next,
 		name:           name,
 		config:         config,
+		manager:        manager,
 		trustedProxies: trustedProxies,
+		proxyHosts:     proxyHosts,
+		localAllow:     localAllow,
+		localBlock:     localBlock,
+		overlay:        manager.Overlay(),
+		upstream:       upstream,
+		geo:            newGeoPolicy(config.GeoFile, config.BlockedCountries, config.AllowedCountries),
+		allowOverride:  parsePrefixes(config.AllowOverride, "allow override"),
+		blockOverride:  newOverrideTrie(blockOverrides),
+
+		healthCheckAgents:  healthCheckAgents,
+		healthCheckSources: healthCheckSources,
+		healthCheckAnyUA:   config.HealthCheckUserAgentsAnySource,
+		excludedPaths:      newPathMatcher(config.ExcludedPaths, "excluded path"),
+		includeHosts:       parseHostPatterns(config.IncludeHosts),
+		excludeHosts:       parseHostPatterns(config.ExcludeHosts),
+		captureHeaders:     parseCaptureHeaders(config.LogCaptureHeaders),
+
+		allowEventRate:  parseSampleRate(config.AllowEventSampleRate, defaultAllowSampleRate, "allowEventSampleRate"),
+		allowSampleRate: parseSampleRate(config.AllowlistAllowedSampleRate, defaultAllowSampleRate, "allowlistAllowedSampleRate"),
+		blockSampleRate: parseSampleRate(config.BlocklistBlockedSampleRate, defaultBlockSampleRate, "blocklistBlockedSampleRate"),
+	}
+
+	if config.BlockTorExits {
+		if config.TorExitListURL == "" {
+			config.TorExitListURL = singleton.DefaultTorExitListURL
+		}
+		refresh := parseDurationOr(config.TorExitRefresh, singleton.DefaultTorExitRefresh, "torExitRefresh")
+		middleware.torExits = manager.TorExits(config.TorExitListURL, refresh)
+	}
+
+	if config.DecisionCacheSize > 0 {
+		ttl := parseDurationOr(config.DecisionCacheTTL, defaultVerdictCacheTTL, "decisionCacheTTL")
+		middleware.verdicts = newVerdictCache(config.DecisionCacheSize, ttl)
+		manager.RegisterTracker("verdicts:"+name, middleware.verdicts.Stats)
+		logger.Infof("Caching up to %d EDL verdicts for %v", config.DecisionCacheSize, ttl)
+	}
+
+	if config.DetailedFirstBlock {
+		window := parseDurationOr(config.FirstBlockWindow, defaultFirstBlockWindow, "firstBlockWindow")
+		middleware.firstBlocks = newFirstBlockTracker(window, config.TrackerMaxEntries)
+		manager.RegisterTracker("first_block:"+name, middleware.firstBlocks.Stats)
+	}
+
+	if config.EscalationThreshold > 0 && middleware.overlay != nil {
+		window := parseDurationOr(config.EscalationWindow, defaultEscalationWindow, "escalationWindow")
+		ttl := parseDurationOr(config.EscalationTTL, defaultEscalationTTL, "escalationTTL")
+		middleware.escalation = newEscalator(config.EscalationThreshold, window, ttl, config.TrackerMaxEntries)
+		manager.RegisterTracker("escalation:"+name, middleware.escalation.Stats)
+		logger.Infof("Escalating to /24 blocks after %d distinct blocked IPs within %v", config.EscalationThreshold, window)
+	}
+
+	if traced := parsePrefixes(config.TraceClientIPs, "trace client IP"); len(traced) > 0 {
+		until := parseTraceUntil(config.TraceClientIPsUntil, time.Now())
+		middleware.tracer = newClientTracer(traced, until)
+		logger.Infof("Tracing requests from %d client IP ranges until %s", len(traced), until.UTC().Format(time.RFC3339))
+	} else if config.DevMode {
+		middleware.tracer = newDevTracer()
+		logger.Info("Dev mode traces the decision on every request")
+	}
+
+	adminSources := parsePrefixes(config.AdminAllowedSources, "admin allowed source")
+	guard := admin.GuardOptions{
+		Token:             config.AdminToken,
+		RequireClientCert: config.AdminRequireClientCert,
+		ClientCertNames:   config.AdminClientCertNames,
+		AllowedSources:    adminSources,
+		RateLimit:         config.AdminRateLimit,
+	}
+	if config.DevMode {
+		guard = devAdminGuard(guard)
+	}
+	middleware.admin = admin.New(admin.Options{
+		Guard:        guard,
+		Overlay:      middleware.overlay,
+		IPv6Prefix:   config.IPv6AggregatePrefix,
+		Audit:        manager.ShipAuditRecord,
+		Status:       func() interface{} { return manager.Status() },
+		LastDecision: middleware.lastDecision,
+		EDL: func() admin.EDLView {
+			// Avoid wrapping a nil export in a non-nil interface
+			if export := manager.ExportEDL(); export != nil {
+				return export
+			}
+			return nil
+		},
+	})
+	if middleware.admin != nil {
+		logger.Infof("Admin endpoints enabled under %s", admin.PathPrefix)
+		middleware.lastDecisions = newLastDecisions(config.TrackerMaxEntries)
+		manager.RegisterTracker("last_decisions:"+name, middleware.lastDecisions.Stats)
+	}
+	middleware.metrics = manager.Metrics()
+	middleware.rules = newRuleStats(middleware.metrics, name)
+	middleware.registerRules(blockOverrides)
+	if config.MetricsPath == "" {
+		config.MetricsPath = defaultMetricsPath
+	}
+	if config.MetricsToken != "" && middleware.metrics != nil {
+		middleware.metricsHandler = admin.Guard(middleware.metrics.Registry, admin.GuardOptions{
+			Token:          config.MetricsToken,
+			AllowedSources: adminSources,
+			RateLimit:      config.AdminRateLimit,
+		})
+		logger.Infof("Metrics endpoint enabled at %s", config.MetricsPath)
+	}
+	if len(config.PathGroups) > 0 {
+		middleware.pathRules = newPathRules(config.PathGroups, config.BlockMinSensitivity, middleware.metrics)
+		if middleware.pathRules != nil {
+			logger.Infof("Graduated enforcement on %d path groups", len(config.PathGroups))
+		}
+	}
+	if config.FailureMode != "open" {
+		maxStaleness := parseDurationOr(config.EDLMaxStaleness, 0, "edlMaxStaleness")
+		middleware.maxStaleness = maxStaleness
+		middleware.readiness = admin.ReadinessHandler(func() (bool, string) {
+			return manager.ReadinessWithin(maxStaleness)
+		})
+		if config.FailureMode == "closed-new" {
+			middleware.knownClients = newKnownClients(config.TrackerMaxEntries)
+			manager.RegisterTracker("known_clients:"+name, middleware.knownClients.Stats)
+		}
+		logger.Infof("Failing %s, readiness probe at %s", config.FailureMode, admin.ReadyPath)
+	}
+
+	if config.BlockPageTemplate != "" && config.BlockResponseBody == "" {
+		tmpl, err := loadBlockPageTemplate(config.BlockPageTemplate)
+		if err != nil {
+			logger.Errorf("Invalid blockPageTemplate, using the built-in page: %v", err)
+		} else {
+			middleware.pageTemplate = tmpl
+		}
+	}
+
+	// Pre-render and compress the block page, around its per-request values
+	// for the built-in page
+	if config.BlockResponseBody != "" {
+		page, err := newStaticResponse([]byte(config.BlockResponseBody), config.BlockContentType, config.BlockStatusCode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blockResponseBody: %w", err)
+		}
+		middleware.staticPage = page
+	} else if middleware.pageTemplate == nil {
+		page, err := newSplicedBlockPage(middleware.blockPageData(""), config.BlockPageShowClientIP, config.BlockStatusCode)
+		if err != nil {
+			logger.Warnf("Failed to pre-render block page, rendering per request: %v", err)
+		} else {
+			middleware.splicedPage = page
+		}
 	}
 
 	logger.Infof("ELLIO middleware ready: %s", name)
@@ -89,6 +690,13 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 
 // ServeHTTP handles incoming requests
 func (e *EllioMiddleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	// Requests are built by Traefik, but adapters and tests may pass a request
+	// without a URL; there is nothing to evaluate or report for those
+	if req.URL == nil {
+		http.Error(rw, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
 	var start time.Time
 	var timings map[string]time.Duration
 	var debugMode bool
@@ -136,16 +744,53 @@ func (e *EllioMiddleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		}
 	}()
 
-	// Get singleton manager instance
+	// Metrics and admin endpoints are served by the middleware itself
+	if e.metricsHandler != nil && req.URL.Path == e.config.MetricsPath {
+		e.metricsHandler.ServeHTTP(rw, req)
+		return
+	}
+	// Readiness probes come from load balancers without admin credentials,
+	// so they are answered before the admin guard claims the path
+	if e.readiness != nil && req.URL.Path == admin.ReadyPath {
+		e.readiness.ServeHTTP(rw, req)
+		return
+	}
+	if e.admin != nil && admin.Matches(req) {
+		e.admin.ServeHTTP(rw, req)
+		return
+	}
+
+	// Excluded paths skip the IP check entirely, even when failing closed
+	if entry, ok := e.excludedPaths.Match(req.URL.Path); ok {
+		e.rules.hit(ruleExcludedPath, entry)
+		logger.Trace("Excluded path, bypassing EDL")
+		e.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Get the deployment manager
 	var managerStart time.Time
 	if debugMode {
 		managerStart = time.Now()
 	}
-	manager := singleton.GetManager()
+	manager := e.manager
 	if debugMode {
 		timings["manager"] = time.Since(managerStart)
 	}
 
+	// Fail closed when the EDL cannot be enforced or is stale. In
+	// "closed-new" mode recently allowed clients keep access.
+	if e.readiness != nil {
+		if ready, reason := manager.ReadinessWithin(e.maxStaleness); !ready {
+			if !e.isKnownClient(req) {
+				logger.Debugf("Cannot enforce EDL (%s), failing closed with 503", reason)
+				e.writeUnavailable(rw, req, reason)
+				return
+			}
+			logger.Tracef("Cannot enforce EDL (%s), allowing known client", reason)
+		}
+	}
+
 	// If manager is not ready or deployment is disabled, allow all traffic
 	if manager == nil {
 		if debugMode {
@@ -178,6 +823,40 @@ func (e *EllioMiddleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Infrastructure health checks bypass enforcement without generating events
+	if kind, rule, ok := e.healthCheck(req); ok {
+		e.rules.hit(kind, rule)
+		logger.Trace("Health check request, bypassing EDL")
+		e.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Only act on the configured entrypoints
+	if entrypoint := e.entrypoint(req); !e.enforcedOn(entrypoint) {
+		e.rules.hit(ruleEntrypoint, strings.ToLower(entrypoint))
+		logger.Trace("Entrypoint not enforced, bypassing EDL")
+		e.next.ServeHTTP(rw, req)
+		return
+	}
+
+	// Only act on the selected virtual hosts
+	kind, pattern, enforced := e.hostRule(req.Host)
+	if kind != "" {
+		e.rules.hit(kind, pattern)
+	}
+	if !enforced {
+		logger.Trace("Host not enforced, bypassing EDL")
+		e.next.ServeHTTP(rw, req)
+		return
+	}
+
+	if req.Method == http.MethodConnect && e.config.BypassConnect {
+		e.rules.hit(ruleBypassConnect, http.MethodConnect)
+		logger.Trace("CONNECT request, bypassing EDL")
+		e.next.ServeHTTP(rw, req)
+		return
+	}
+
 	// Extract client IP
 	var ipExtractStart time.Time
 	if debugMode {
@@ -188,32 +867,62 @@ func (e *EllioMiddleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		timings["ip_extract"] = time.Since(ipExtractStart)
 	}
 	logger.Tracef("Extracted client IP: %s", clientIP)
+	traced := e.tracer.Matches(clientIP)
+	if traced {
+		host, path := requestTarget(req)
+		xff, _ := listHeader(req.Header, "X-Forwarded-For", maxEventHeaderLen)
+		tracef(traced, clientIP, "%s %s%s - remote=%s strategy=%s x_forwarded_for=%q user_agent=%q",
+			req.Method, host, path, req.RemoteAddr, e.config.IPStrategy,
+			xff, firstHeader(req.Header, "User-Agent", maxUserAgentLen))
+	}
 
 	if clientIP == "" {
-		logger.Debug("Empty client IP, returning 400")
-		http.Error(rw, "Unable to determine client IP", http.StatusBadRequest)
+		logger.Debugf("Empty client IP, action %s", e.config.IPMissingAction)
+		e.handleIPError(rw, req, manager, clientIP, logs.EventIPMissing, singleton.Decision{Source: singleton.SourceError})
+		return
+	}
+
+	// Clients that passed the upstream allowlist may skip the checks
+	if rule, skip := e.upstream.Skip(clientIP); skip {
+		e.rules.hit(ruleUpstreamAllowList, rule)
+		tracef(traced, clientIP, "passed upstream allowlist %s, forwarding unchecked", rule)
+		e.next.ServeHTTP(rw, req)
 		return
 	}
 
-	// Check if IP is allowed based on EDL
-	var allowed bool
-	var err error
+	// Local lists take precedence, then check if IP is allowed based on EDL
+	d := e.decide(manager, clientIP, e.verdictScope(req, kind, pattern))
 	if debugMode {
-		ipCheckStart := time.Now()
-		allowed, _, err = manager.IsIPAllowedWithStats(clientIP)
-		checkDuration := time.Since(ipCheckStart)
-		timings["ip_check"] = checkDuration
-	} else {
-		allowed, err = manager.IsIPAllowed(clientIP)
+		timings["ip_check"] = d.Latency
 	}
-	if err != nil {
-		logger.Debugf("IP validation error, returning 400: %v", err)
-		http.Error(rw, "Invalid IP address", http.StatusBadRequest)
+	manager.ObserveDecision(d)
+	tracef(traced, clientIP, "decision %s latency=%v err=%v", d, d.Latency, d.Err)
+	if d.Err != nil {
+		logger.Debugf("IP validation error, action %s: %v", e.config.IPInvalidAction, d.Err)
+		manager.RecordDecisionError(clientIP, e.ipHeader(req), e.config.IPStrategy, d.Err)
+		e.handleIPError(rw, req, manager, clientIP, logs.EventIPInvalid, d)
 		return
 	}
+	if e.config.DecisionHeader {
+		rw.Header().Set(decisionHeaderName, d.String())
+	}
 
-	if allowed {
-		// Fast path for allowed requests - no event creation
+	if d.Allowed {
+		tracef(traced, clientIP, "allowed, forwarding")
+		if e.knownClients != nil && d.Source != singleton.SourceBypass && !manager.MemoryDegraded() {
+			e.knownClients.Add(clientIP, struct{}{})
+		}
+		if e.metrics != nil {
+			e.metrics.Allowed.Inc()
+		}
+		e.recordDecision(manager, req, clientIP, outcomeAllow, d)
+		// Fast path for allowed requests - events only when sampled
+		if e.allowEventRate > 0 || e.allowSampleRate > 0 {
+			mode := manager.GetEDLMode()
+			if rate := e.allowRate(mode); rate > 0 && sampled(rate) {
+				e.sendEvent(manager, req, clientIP, mode, d, rate, "")
+			}
+		}
 		if debugMode {
 			handlerStart := time.Now()
 			e.next.ServeHTTP(rw, req)
@@ -224,37 +933,357 @@ func (e *EllioMiddleware) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	logger.Debug("Request BLOCKED, returning 403")
-	ServeBlockPage(rw)
+	// Listed clients outside a partial rollout are only monitored
+	monitor := e.config.EnforcementMode == "monitor"
+	if !monitor && !inRollout(clientIP, e.config.EnforcementPercentage) {
+		monitor = true
+		tracef(traced, clientIP, "outside the %d%% enforcement rollout", e.config.EnforcementPercentage)
+	}
+
+	// Listed clients are only blocked on sensitive path groups
+	if e.pathRules != nil {
+		_, path := requestTarget(req)
+		group := e.pathRules.Match(path)
+		group.count(!monitor && group.enforced)
+		if !group.enforced && !monitor {
+			monitor = true
+			tracef(traced, clientIP, "path group %s not enforced", group.name)
+		}
+	}
+
+	if monitor {
+		logger.Debug("Request would be BLOCKED, forwarding in monitor mode")
+		tracef(traced, clientIP, "would block, forwarding in monitor mode")
+		if e.metrics != nil {
+			e.metrics.WouldBlock.Inc()
+		}
+		e.recordDecision(manager, req, clientIP, outcomeWouldBlock, d)
+		host, path := requestTarget(req)
+		manager.RecordWouldBlock(clientIP, host, path)
+		e.next.ServeHTTP(rw, req)
+
+		// Would-block events follow the sampling of real blocks
+		mode := manager.GetEDLMode()
+		if rate, ok := e.blockEventRate(mode); ok {
+			event := e.newRequestEvent(req, clientIP, mode, d)
+			event.MarkWouldBlock()
+			event.SetSampleRate(rate)
+			manager.SendBlockEvent(event)
+		}
+		return
+	}
+
+	logger.Debugf("Request BLOCKED, returning %d", e.blockStatus())
+	tracef(traced, clientIP, "blocked, returning %d", e.blockStatus())
+	if e.metrics != nil {
+		e.metrics.Blocked.Inc()
+	}
+	e.recordDecision(manager, req, clientIP, outcomeBlock, d)
+	eventID := e.writeBlockResponse(rw, req, clientIP)
 
-	// Create and send event for blocked request
-	logger.Trace("Preparing log event for blocked request...")
+	// Per-client tracking is skipped while the memory budget is exceeded
+	mode := manager.GetEDLMode()
+	tracking := !manager.MemoryDegraded()
+	if e.escalation != nil && d.Source == singleton.SourceEDL && tracking {
+		e.escalate(manager, clientIP, mode)
+	}
+	if e.firstBlocks != nil && tracking {
+		e.sendFirstOrRepeatEvent(manager, req, clientIP, mode, d, eventID)
+		return
+	}
+	rate, ok := e.blockEventRate(mode)
+	if !ok {
+		logger.Trace("Blocked event not sampled, skipping")
+		return
+	}
+	e.sendEvent(manager, req, clientIP, mode, d, rate, eventID)
+	logger.Trace("ServeHTTP completed for blocked request")
+}
+
+// handleIPError answers or forwards a request without a usable client IP,
+// as configured for eventType, and reports it following the blocklist
+// sample rate
+func (e *EllioMiddleware) handleIPError(rw http.ResponseWriter, req *http.Request, manager *singleton.Manager, clientIP, eventType string, d singleton.Decision) {
+	action, message := e.config.IPMissingAction, e.config.IPMissingMessage
+	if eventType == logs.EventIPInvalid {
+		action, message = e.config.IPInvalidAction, e.config.IPInvalidMessage
+	}
+	if e.metrics != nil {
+		if eventType == logs.EventIPInvalid {
+			e.metrics.IPInvalid.Inc()
+		} else {
+			e.metrics.IPMissing.Inc()
+		}
+	}
+
+	forwarded := action == "allow"
+	if forwarded {
+		e.next.ServeHTTP(rw, req)
+	} else {
+		http.Error(rw, message, http.StatusBadRequest)
+	}
+
+	rate := e.blockRate()
+	if !sampled(rate) {
+		return
+	}
+	event := e.newRequestEvent(req, clientIP, manager.GetEDLMode(), d)
+	event.MarkIPError(eventType, forwarded)
+	event.SetSampleRate(rate)
+	manager.SendBlockEvent(event)
+}
+
+// blockEventRate samples a block event. Blocklist blocks follow
+// blocklistBlockedSampleRate, allowlist blocks are always reported.
+func (e *EllioMiddleware) blockEventRate(mode string) (rate float64, ok bool) {
+	if mode != "blocklist" {
+		return 1, true
+	}
+	rate = e.blockRate()
+	return rate, sampled(rate)
+}
+
+// allowRate is the share of allowed requests reported in the EDL mode.
+// allowlistAllowedSampleRate, when set, takes precedence in allowlist mode.
+func (e *EllioMiddleware) allowRate(mode string) float64 {
+	if on, set := e.manager.Feature(singleton.FeatureEventSampling); set && !on {
+		return defaultAllowSampleRate
+	}
+	if mode == "allowlist" && e.allowSampleRate > 0 {
+		return e.allowSampleRate
+	}
+	return e.allowEventRate
+}
+
+// blockRate is the share of blocked requests reported in blocklist mode
+func (e *EllioMiddleware) blockRate() float64 {
+	if on, set := e.manager.Feature(singleton.FeatureEventSampling); set && !on {
+		return defaultBlockSampleRate
+	}
+	return e.blockSampleRate
+}
+
+// sendEvent creates a block or allow event for the request and hands it to
+// the log shipper. rate is the sampling rate the event was selected with and
+// eventID the ID shown on the block page, if any.
+func (e *EllioMiddleware) sendEvent(manager *singleton.Manager, req *http.Request, clientIP, mode string, d singleton.Decision, rate float64, eventID string) {
+	event := e.newRequestEvent(req, clientIP, mode, d)
+	event.EventID = eventID
+	event.SetSampleRate(rate)
+
+	logger.Trace("Sending event to log shipper")
+	manager.SendBlockEvent(event)
+}
+
+// newRequestEvent creates a block or allow event for a decision on the request
+func (e *EllioMiddleware) newRequestEvent(req *http.Request, clientIP, mode string, d singleton.Decision) *logs.BlockEvent {
+	logger.Trace("Preparing log event...")
+	blocked := !d.Allowed
 
 	scheme := "http"
-	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+	if req.TLS != nil || strings.EqualFold(strings.TrimSpace(firstHeader(req.Header, "X-Forwarded-Proto", maxTokenHeaderLen)), "https") {
 		scheme = "https"
 	}
 
 	// Get direct IP for debugging
 	directIP := getDirectIP(req.RemoteAddr)
+	host, path := requestTarget(req)
+
+	logger.Tracef("Creating event - blocked=%v method=%s host=%s path=%s extractedIP=%s directIP=%s",
+		blocked, req.Method, host, path, clientIP, directIP)
 
-	logger.Tracef("Creating block event - method=%s host=%s path=%s extractedIP=%s directIP=%s",
-		req.Method, req.Host, req.URL.Path, clientIP, directIP)
+	var userAgent string
+	if on, set := e.manager.Feature(singleton.FeatureUserAgentCapture); on || !set {
+		userAgent = eventHeader(req.Header, "User-Agent", maxUserAgentLen)
+	}
 
-	event := logs.NewBlockEvent(
+	newEvent := logs.NewAllowEvent
+	if blocked {
+		newEvent = logs.NewBlockEvent
+	}
+	event := newEvent(
 		clientIP, // extracted IP that was checked
 		directIP, // direct connection IP
 		req.Method,
-		req.Host,
-		req.URL.Path,
+		host,
+		path,
 		scheme,
-		req.Header.Get("User-Agent"),
-		manager.GetEDLMode(),
+		userAgent,
+		mode,
 	)
+	event.Request.Entrypoint = e.entrypoint(req)
+	if blocked && isWriteMethod(req.Method) {
+		length, contentType := requestBodyInfo(req)
+		event.Request.ContentLength = &length
+		event.Request.ContentType = contentType
+	}
+	if blocked && len(e.captureHeaders) > 0 {
+		event.Request.Headers = captureHeaders(req.Header, e.captureHeaders)
+	}
+	event.SetDecision(d.Source, d.Matched, d.Generation)
+	event.Policy.PathGroup = e.pathRules.groupName(path)
+	event.Policy.ASN = d.ASN
+	event.Client.Country = d.Country
+	if prefix, ok := e.aggregatePrefix(clientIP); ok {
+		event.Client.Prefix = prefix.String()
+	}
 
-	logger.Trace("Sending blocked event to log shipper")
+	// Record this instance's extraction settings; they are shipped per event
+	// whenever they differ from the batch-level defaults
+	event.SetExtraction(e.config.IPStrategy, e.config.TrustedHeader)
+	return event
+}
+
+// sendFirstOrRepeatEvent ships a detailed event for the first block of an
+// IP within the window and counter-only events for later blocks. Repeats
+// follow the blocklist sample rate, first blocks are always reported.
+func (e *EllioMiddleware) sendFirstOrRepeatEvent(manager *singleton.Manager, req *http.Request, clientIP, mode string, d singleton.Decision, eventID string) {
+	first, count, start := e.firstBlocks.Observe(clientIP)
+	if first {
+		event := e.newRequestEvent(req, clientIP, mode, d)
+		event.EventID = eventID
+		event.Details = firstBlockDetails(req)
+		manager.SendBlockEvent(event)
+		return
+	}
+
+	rate := 1.0
+	if mode == "blocklist" {
+		if rate = e.blockRate(); !sampled(rate) {
+			return
+		}
+	}
+	event := logs.NewRepeatBlockEvent(clientIP, mode, count, start)
+	event.EventID = eventID
+	event.SetSampleRate(rate)
+	event.SetExtraction(e.config.IPStrategy, e.config.TrustedHeader)
 	manager.SendBlockEvent(event)
-	logger.Trace("ServeHTTP completed for blocked request")
+}
+
+// firstBlockDetails collects the forensic fields of a first block
+func firstBlockDetails(req *http.Request) *logs.FirstBlockDetails {
+	forwardedFor, _ := listHeader(req.Header, "X-Forwarded-For", maxEventHeaderLen)
+	details := &logs.FirstBlockDetails{
+		Query:          req.URL.RawQuery,
+		Protocol:       req.Proto,
+		Referer:        eventHeader(req.Header, "Referer", maxEventHeaderLen),
+		Accept:         eventHeader(req.Header, "Accept", maxEventHeaderLen),
+		AcceptLanguage: eventHeader(req.Header, "Accept-Language", maxEventHeaderLen),
+		ForwardedFor:   sanitizeEventField(forwardedFor, maxEventHeaderLen),
+		ContentLength:  req.ContentLength,
+	}
+	if details.ContentLength < 0 {
+		details.ContentLength = 0
+	}
+	if req.TLS != nil {
+		details.TLSVersion = tls.VersionName(req.TLS.Version)
+		details.TLSServerName = req.TLS.ServerName
+	}
+	return details
+}
+
+// escalate counts an EDL block towards its /24 and, once the threshold is
+// reached, blocks the /24 in the runtime overlay and ships an escalation event
+func (e *EllioMiddleware) escalate(manager *singleton.Manager, clientIP, mode string) {
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return
+	}
+	prefix, count, escalate := e.escalation.Observe(addr)
+	if !escalate {
+		return
+	}
+
+	e.overlay.Block.Add(prefix, e.escalation.ttl)
+	logger.Infof("Escalated %s to a local block for %v after %d distinct blocked IPs", prefix, e.escalation.ttl, count)
+	manager.SendBlockEvent(logs.NewReportEvent("escalation", mode, &logs.EscalationDetails{
+		Prefix:        prefix.String(),
+		DistinctIPs:   count,
+		TriggerIP:     clientIP,
+		WindowSeconds: int64(e.escalation.window / time.Second),
+		TTLSeconds:    int64(e.escalation.ttl / time.Second),
+	}))
+}
+
+// sampled reports whether an event with the given rate should be shipped
+func sampled(rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	return rand.Float64() < rate
+}
+
+// inRollout reports whether a client falls into the enforced share of a
+// partial rollout. Clients are bucketed by a hash of their IP so the same
+// client is consistently blocked or forwarded. percentage outside 1-99
+// enforces on everyone.
+func inRollout(clientIP string, percentage int) bool {
+	if percentage <= 0 || percentage >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(clientIP))
+	return int(h.Sum32()%100) < percentage
+}
+
+// parseSampleRate validates a configured sample rate, falling back to def
+// when it is unset or out of range
+func parseSampleRate(rate, def float64, label string) float64 {
+	if rate == 0 {
+		return def
+	}
+	if rate < 0 || rate > 1 {
+		logger.Warnf("Invalid %s %v, must be between 0 and 1, using %v", label, rate, def)
+		return def
+	}
+	return rate
+}
+
+// ipErrorAction validates the action for requests without a usable client
+// IP, falling back to "reject"
+func ipErrorAction(action, label string) string {
+	switch action {
+	case "":
+		return "reject"
+	case "reject", "allow":
+		return action
+	}
+	logger.Warnf("Invalid %s '%s', defaulting to reject", label, action)
+	return "reject"
+}
+
+// parseDurationOr parses a configured positive duration, falling back to
+// def when it is unset or invalid
+func parseDurationOr(value string, def time.Duration, label string) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		logger.Warnf("Invalid %s '%s', using %v", label, value, def)
+		return def
+	}
+	return d
+}
+
+// blockPageData builds the template variables for a blocked request. Custom
+// templates get every variable and decide themselves what to show.
+func (e *EllioMiddleware) blockPageData(clientIP string) *BlockPageData {
+	data := &BlockPageData{
+		SupportEmail: e.config.SupportEmail,
+		SupportURL:   e.config.SupportURL,
+	}
+	data.RequestID = utils.GenerateUUID()
+	data.EventID = data.RequestID
+	data.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	if e.pageTemplate != nil || e.config.BlockPageShowClientIP {
+		data.ClientIP = clientIP
+	}
+	applyBranding(data, e.config)
+	return data
 }
 
 func (e *EllioMiddleware) extractClientIP(r *http.Request) string {
@@ -262,7 +1291,7 @@ func (e *EllioMiddleware) extractClientIP(r *http.Request) string {
 	directIP := getDirectIP(r.RemoteAddr)
 
 	// If strategy is direct or no trusted proxies configured, return direct IP
-	if e.config.IPStrategy == "direct" || len(e.trustedProxies) == 0 {
+	if e.config.IPStrategy == "direct" || (len(e.trustedProxies) == 0 && e.proxyHosts == nil) {
 		return directIP
 	}
 
@@ -275,21 +1304,33 @@ func (e *EllioMiddleware) extractClientIP(r *http.Request) string {
 	// Extract IP based on configured strategy
 	switch e.config.IPStrategy {
 	case "xff":
-		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-			// X-Forwarded-For can contain multiple IPs, take the first one
-			parts := strings.Split(xff, ",")
-			if len(parts) > 0 {
-				return strings.TrimSpace(parts[0])
+		if xff, over := listHeader(r.Header, "X-Forwarded-For", xffMaxBytes(e.config.XFFMaxBytes)); xff != "" {
+			entries, truncated := splitXFF(xff, e.config.XFFMaxHops, e.config.XFFMaxBytes)
+			if truncated || over {
+				logger.Debugf("Oversized X-Forwarded-For from %s truncated", directIP)
+				if e.manager != nil {
+					e.manager.CountXFFTruncated()
+				}
 			}
+			for i, entry := range entries {
+				entries[i] = stripIPPort(entry)
+			}
+			if len(entries) > 0 {
+				return e.rightmostUntrusted(entries)
+			}
+		}
+	case "xff-depth":
+		if ip, ok := e.xffDepthIP(r, directIP); ok {
+			return ip
 		}
 	case "real-ip":
-		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-			return strings.TrimSpace(realIP)
+		if realIP := stripIPPort(firstHeader(r.Header, "X-Real-IP", maxIPHeaderLen)); realIP != "" {
+			return realIP
 		}
 	case "custom":
 		if e.config.TrustedHeader != "" {
-			if customIP := r.Header.Get(e.config.TrustedHeader); customIP != "" {
-				return strings.TrimSpace(customIP)
+			if customIP := stripIPPort(firstHeader(r.Header, e.config.TrustedHeader, maxIPHeaderLen)); customIP != "" {
+				return customIP
 			}
 		}
 	}
@@ -298,6 +1339,465 @@ func (e *EllioMiddleware) extractClientIP(r *http.Request) string {
 	return directIP
 }
 
+// rightmostUntrusted walks X-Forwarded-For entries from the right, skipping
+// hops within trustedProxies, and returns the first untrusted one: the
+// client as seen by the outermost trusted proxy. Entries left of it may be
+// forged by the client. When every entry is trusted the leftmost is used.
+func (e *EllioMiddleware) rightmostUntrusted(entries []string) string {
+	for i := len(entries) - 1; i > 0; i-- {
+		if !e.isFromTrustedProxy(entries[i]) {
+			return entries[i]
+		}
+	}
+	return entries[0]
+}
+
+// xffDepthIP returns the X-Forwarded-For entry at the configured depth from
+// the right. ok is false when the header has fewer entries, so spoofed
+// entries left of the proxies' own are never used.
+func (e *EllioMiddleware) xffDepthIP(r *http.Request, directIP string) (string, bool) {
+	xff, over := listHeader(r.Header, "X-Forwarded-For", xffMaxBytes(e.config.XFFMaxBytes))
+	if xff == "" {
+		return "", false
+	}
+	// Only the rightmost depth entries are needed, entries left of them are
+	// expected and not counted as truncation
+	entries, _ := splitXFF(xff, e.config.Depth, e.config.XFFMaxBytes)
+	if over {
+		logger.Debugf("Oversized X-Forwarded-For from %s truncated", directIP)
+		if e.manager != nil {
+			e.manager.CountXFFTruncated()
+		}
+	}
+	if len(entries) < e.config.Depth {
+		logger.Debugf("X-Forwarded-For from %s has %d entries, fewer than depth %d", directIP, len(entries), e.config.Depth)
+		return "", false
+	}
+	return stripIPPort(entries[0]), true
+}
+
+// ipHeader returns the raw value of the header the IP strategy reads,
+// empty for the direct strategy
+func (e *EllioMiddleware) ipHeader(r *http.Request) string {
+	switch e.config.IPStrategy {
+	case "xff", "xff-depth":
+		xff, _ := listHeader(r.Header, "X-Forwarded-For", xffMaxBytes(e.config.XFFMaxBytes))
+		return xff
+	case "real-ip":
+		return firstHeader(r.Header, "X-Real-IP", maxIPHeaderLen)
+	case "custom":
+		if e.config.TrustedHeader != "" {
+			return firstHeader(r.Header, e.config.TrustedHeader, maxIPHeaderLen)
+		}
+	}
+	return ""
+}
+
+// decide reaches the verdict on a client. Allow overrides win, then block
+// overrides, then local lists take precedence, then Tor exit nodes are
+// blocked when blockTorExits is set, then the EDL decides on the
+// address or its aggregated IPv6 prefix, and country rules may refuse
+// clients the EDL allowed. With decisionCacheSize, EDL decisions are reused
+// per client and rule scope until the EDL changes.
+func (e *EllioMiddleware) decide(manager *singleton.Manager, clientIP, scope string) singleton.Decision {
+	start := time.Now()
+	if d, ok := e.overrideDecision(clientIP); ok {
+		d.Latency = time.Since(start)
+		logger.Tracef("Client IP %s matched an override - %s", clientIP, d)
+		return d
+	}
+	if d, listed := e.localDecision(clientIP); listed {
+		d.Latency = time.Since(start)
+		logger.Tracef("Client IP %s matched a local list - %s", clientIP, d)
+		return d
+	}
+	if d, listed := e.torExitDecision(clientIP); listed {
+		d.Latency = time.Since(start)
+		logger.Tracef("Client IP %s is a Tor exit node - %s", clientIP, d)
+		return d
+	}
+	client := clientIP
+	prefix, aggregated := e.aggregatePrefix(clientIP)
+	if aggregated {
+		client = prefix.String()
+	}
+	if d, ok := e.cachedDecision(manager, client, scope); ok {
+		d.Latency = time.Since(start)
+		return e.applyGeo(clientIP, d)
+	}
+
+	var version singleton.DecisionVersion
+	if e.verdicts != nil && manager != nil {
+		version = manager.DecisionVersion()
+	}
+	var d singleton.Decision
+	if aggregated {
+		d = manager.DecidePrefix(prefix)
+	} else {
+		d = manager.Decide(clientIP)
+	}
+	e.cacheDecision(manager, client, scope, version, d)
+	return e.applyGeo(clientIP, d)
+}
+
+// overrideDecision allows clients within allowOverride and blocks clients
+// within blockOverride. ok is false when no override covers the IP.
+func (e *EllioMiddleware) overrideDecision(clientIP string) (singleton.Decision, bool) {
+	if len(e.allowOverride) == 0 && e.blockOverride == nil {
+		return singleton.Decision{}, false
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return singleton.Decision{}, false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range e.allowOverride {
+		if prefix.Contains(addr) {
+			e.rules.hit(ruleAllowOverride, prefix.String())
+			return singleton.Decision{Allowed: true, Source: singleton.SourceOverride, Matched: prefix}, true
+		}
+	}
+	if e.blockOverride != nil {
+		if prefix, ok := e.blockOverride.LookupUnsafe(addr); ok {
+			e.rules.hit(ruleBlockOverride, prefix.String())
+			return singleton.Decision{Source: singleton.SourceOverride, Matched: prefix}, true
+		}
+	}
+	return singleton.Decision{}, false
+}
+
+// newOverrideTrie merges static override ranges into a trie, nil if none
+func newOverrideTrie(prefixes []netip.Prefix) *iptrie.Trie {
+	if len(prefixes) == 0 {
+		return nil
+	}
+	trie := iptrie.NewTrie()
+	for _, prefix := range prefixes {
+		trie.Insert(prefix)
+	}
+	return trie
+}
+
+// localDecision checks the runtime overlay and the local list files. Any
+// allow entry wins over block entries. listed is false when no list contains
+// the IP and the EDL decides.
+func (e *EllioMiddleware) localDecision(clientIP string) (d singleton.Decision, listed bool) {
+	if e.localAllow == nil && e.localBlock == nil && e.overlay == nil {
+		return d, false
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return d, false
+	}
+
+	d.Source = singleton.SourceLocal
+	if e.overlay != nil {
+		if d.Matched, listed = e.overlay.Allow.Lookup(addr); listed {
+			e.rules.hit(ruleOverlayAllow, ruleOverlay)
+			d.Allowed = true
+			return d, true
+		}
+	}
+	if e.localAllow != nil {
+		if d.Matched, listed = e.localAllow.Lookup(addr); listed {
+			e.rules.hit(ruleLocalAllow, e.localAllow.Path())
+			d.Allowed = true
+			return d, true
+		}
+	}
+	if e.overlay != nil {
+		if d.Matched, listed = e.overlay.Block.Lookup(addr); listed {
+			e.rules.hit(ruleOverlayBlock, ruleOverlay)
+			return d, true
+		}
+	}
+	if e.localBlock != nil {
+		if d.Matched, listed = e.localBlock.Lookup(addr); listed {
+			e.rules.hit(ruleLocalBlock, e.localBlock.Path())
+			return d, true
+		}
+	}
+	return singleton.Decision{}, false
+}
+
+// torExitDecision blocks clients on the Tor exit list. listed is false when
+// blockTorExits is off or the IP is not an exit node.
+func (e *EllioMiddleware) torExitDecision(clientIP string) (singleton.Decision, bool) {
+	if e.torExits == nil {
+		return singleton.Decision{}, false
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return singleton.Decision{}, false
+	}
+	matched, listed := e.torExits.Lookup(addr.Unmap())
+	if !listed {
+		return singleton.Decision{}, false
+	}
+	e.rules.hit(ruleTorExit, e.config.TorExitListURL)
+	return singleton.Decision{Source: singleton.SourceTorExit, Matched: matched}, true
+}
+
+// aggregatePrefix returns the covering prefix an IPv6 client is checked
+// as when ipv6AggregatePrefix is set or the ipv6_aggregation feature is on.
+// IPv4 clients are not aggregated.
+func (e *EllioMiddleware) aggregatePrefix(clientIP string) (netip.Prefix, bool) {
+	bits := e.config.IPv6AggregatePrefix
+	if on, set := e.manager.Feature(singleton.FeatureIPv6Aggregation); set {
+		switch {
+		case !on:
+			bits = 0
+		case bits <= 0:
+			bits = defaultIPv6AggregatePrefix
+		}
+	}
+	if bits <= 0 || bits >= 128 {
+		return netip.Prefix{}, false
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(addr.WithZone(""), bits).Masked(), true
+}
+
+// loadLocalList loads a local list file, nil when path is empty. A file that
+// cannot be read yet is still watched and picked up once it appears.
+func loadLocalList(path, label string, refresh time.Duration) *locallist.FileList {
+	if path == "" {
+		return nil
+	}
+	list, err := locallist.NewFileList(path, label, refresh)
+	if err != nil {
+		logger.Warnf("Failed to load %s %s, watching for changes: %v", label, path, err)
+	}
+	return list
+}
+
+// decisionHeaderName carries the decision when decisionHeader is enabled
+const decisionHeaderName = "X-Ellio-Decision"
+
+// defaultMetricsPath is where metrics are served unless metricsPath is set
+const defaultMetricsPath = admin.PathPrefix + "metrics"
+
+// defaultEDLFileRefresh is how often edlFilePath is checked for changes
+const defaultEDLFileRefresh = 10 * time.Second
+
+// Event sample rates unless configured, also applied while the config API
+// turns the event_sampling feature off
+const (
+	defaultAllowSampleRate = 0
+	defaultBlockSampleRate = 1
+)
+
+// defaultIPv6AggregatePrefix is used when the config API turns the
+// ipv6_aggregation feature on without ipv6AggregatePrefix being set
+const defaultIPv6AggregatePrefix = 64
+
+const (
+	defaultXFFMaxHops  = 16
+	defaultXFFMaxBytes = 1024
+)
+
+// xffMaxBytes returns the configured X-Forwarded-For byte limit or the default
+func xffMaxBytes(configured int) int {
+	if configured <= 0 {
+		return defaultXFFMaxBytes
+	}
+	return configured
+}
+
+// splitXFF splits an X-Forwarded-For value into trimmed entries, bounded to
+// keep per-request cost constant. Only the trailing maxBytes are parsed and
+// only the rightmost maxHops entries are kept, since entries closest to the
+// proxy are the trustworthy ones. A partial entry cut by the byte limit is
+// dropped. Non-positive limits use the defaults.
+func splitXFF(header string, maxHops, maxBytes int) (entries []string, truncated bool) {
+	if maxHops <= 0 {
+		maxHops = defaultXFFMaxHops
+	}
+	maxBytes = xffMaxBytes(maxBytes)
+
+	if len(header) > maxBytes {
+		truncated = true
+		header = header[len(header)-maxBytes:]
+		if i := strings.IndexByte(header, ','); i >= 0 {
+			header = header[i+1:]
+		} else {
+			header = ""
+		}
+	}
+
+	// Walk right to left so at most maxHops entries are ever materialized
+	for len(header) > 0 && len(entries) < maxHops {
+		i := strings.LastIndexByte(header, ',')
+		if entry := strings.TrimSpace(header[i+1:]); entry != "" {
+			entries = append(entries, entry)
+		}
+		if i < 0 {
+			header = ""
+			break
+		}
+		header = header[:i]
+	}
+	if strings.TrimSpace(header) != "" {
+		truncated = true
+	}
+
+	// Restore left-to-right order
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, truncated
+}
+
+// entrypoint identifies the Traefik entrypoint of the request: the value of
+// EntrypointHeader when configured and sent by a trusted proxy, otherwise
+// ":<port>" of the local listener, or "" when neither is known. Clients can
+// send any header, so it is ignored from other peers.
+func (e *EllioMiddleware) entrypoint(r *http.Request) string {
+	if e.config.EntrypointHeader != "" && e.isFromTrustedProxy(getDirectIP(r.RemoteAddr)) {
+		if name := eventHeader(r.Header, e.config.EntrypointHeader, maxTokenHeaderLen); name != "" {
+			return name
+		}
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+			return ":" + port
+		}
+	}
+	return ""
+}
+
+// enforcedOn reports whether the middleware acts on the given entrypoint.
+// Unknown entrypoints are enforced so a missing header never opens a bypass.
+func (e *EllioMiddleware) enforcedOn(entrypoint string) bool {
+	if len(e.config.EnforcedEntrypoints) == 0 || entrypoint == "" {
+		return true
+	}
+	for _, name := range e.config.EnforcedEntrypoints {
+		if strings.EqualFold(name, entrypoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// enforcedHost reports whether the middleware acts on the request host.
+// excludeHosts wins over includeHosts. Requests without a host are enforced
+// so a missing Host never opens a bypass.
+func (e *EllioMiddleware) enforcedHost(host string) bool {
+	_, _, enforced := e.hostRule(host)
+	return enforced
+}
+
+// hostRule is enforcedHost also returning the rule that decided, kind is
+// empty when no host rule applied
+func (e *EllioMiddleware) hostRule(host string) (kind, pattern string, enforced bool) {
+	if len(e.includeHosts) == 0 && len(e.excludeHosts) == 0 {
+		return "", "", true
+	}
+	host = normalizeHost(host)
+	if host == "" {
+		return "", "", true
+	}
+	for _, pattern := range e.excludeHosts {
+		if matchHost(pattern, host) {
+			return ruleExcludeHost, pattern, false
+		}
+	}
+	if len(e.includeHosts) == 0 {
+		return "", "", true
+	}
+	for _, pattern := range e.includeHosts {
+		if matchHost(pattern, host) {
+			return ruleIncludeHost, pattern, true
+		}
+	}
+	return ruleIncludeHost, ruleUnmatched, false
+}
+
+// parseHostPatterns normalizes configured host patterns, dropping empty ones
+func parseHostPatterns(entries []string) []string {
+	var patterns []string
+	for _, entry := range entries {
+		if entry = normalizeHost(entry); entry != "" {
+			patterns = append(patterns, entry)
+		}
+	}
+	return patterns
+}
+
+// normalizeHost lowercases a Host header value and strips the port,
+// IPv6 brackets and a trailing dot
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return strings.TrimSuffix(host, ".")
+}
+
+// matchHost matches a normalized host against a pattern. "*.example.com"
+// matches any subdomain of example.com but not example.com itself.
+func matchHost(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:]) && len(host) > len(pattern)-1
+	}
+	return pattern == host
+}
+
+// isHealthCheck reports whether the request comes from a configured health checker
+func (e *EllioMiddleware) isHealthCheck(r *http.Request) bool {
+	_, _, ok := e.healthCheck(r)
+	return ok
+}
+
+// healthCheck returns the health check rule matching the request. The
+// User-Agent is client controlled, so a marker only counts from a
+// healthCheckSources address unless healthCheckAnyUA is set. With both
+// markers and sources configured a request needs both.
+func (e *EllioMiddleware) healthCheck(r *http.Request) (kind, rule string, ok bool) {
+	source, fromSource := e.healthCheckSource(r)
+	if len(e.healthCheckAgents) == 0 {
+		if fromSource {
+			return ruleHealthCheckSource, source, true
+		}
+		return "", "", false
+	}
+	if !fromSource && !e.healthCheckAnyUA {
+		return "", "", false
+	}
+
+	ua := strings.ToLower(firstHeader(r.Header, "User-Agent", maxUserAgentLen))
+	for _, marker := range e.healthCheckAgents {
+		if strings.Contains(ua, marker) {
+			return ruleHealthCheckAgent, marker, true
+		}
+	}
+	return "", "", false
+}
+
+// healthCheckSource returns the healthCheckSources range containing the
+// direct peer of the request
+func (e *EllioMiddleware) healthCheckSource(r *http.Request) (string, bool) {
+	if len(e.healthCheckSources) == 0 {
+		return "", false
+	}
+	addr, err := netip.ParseAddr(getDirectIP(r.RemoteAddr))
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range e.healthCheckSources {
+		if prefix.Contains(addr) {
+			return prefix.String(), true
+		}
+	}
+	return "", false
+}
+
 func getDirectIP(remoteAddr string) string {
 	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
 		return host
@@ -305,6 +1805,31 @@ func getDirectIP(remoteAddr string) string {
 	return remoteAddr
 }
 
+// stripIPPort normalizes an address taken from a forwarding header, where
+// proxies may append the client port: "203.0.113.5:4711" and
+// "[2001:db8::1]:443" become "203.0.113.5" and "2001:db8::1". Bare IPv6
+// addresses and values that are no address are returned trimmed, to be
+// rejected by the IP check.
+func stripIPPort(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") {
+		if end := strings.IndexByte(value, ']'); end > 0 {
+			rest := value[end+1:]
+			if rest == "" || rest[0] == ':' {
+				return value[1:end]
+			}
+		}
+		return value
+	}
+	// One colon separates an IPv4 address from its port, IPv6 has several
+	if strings.Count(value, ":") == 1 {
+		if host, _, err := net.SplitHostPort(value); err == nil {
+			return host
+		}
+	}
+	return value
+}
+
 func (e *EllioMiddleware) isFromTrustedProxy(ip string) bool {
 	addr, err := netip.ParseAddr(ip)
 	if err != nil {
@@ -317,15 +1842,35 @@ func (e *EllioMiddleware) isFromTrustedProxy(ip string) bool {
 		}
 	}
 
-	return false
+	return e.proxyHosts != nil && e.proxyHosts.Contains(addr)
 }
 
+// parseTrustedProxies parses the static trustedProxies entries. Hostnames are
+// skipped here and handled by proxyResolver; "*" trusts every source.
 func parseTrustedProxies(proxies []string) []netip.Prefix {
+	var entries []string
+	for _, entry := range proxies {
+		if isHostnameEntry(entry) {
+			continue
+		}
+		if entry == "*" {
+			logger.Warn("trustedProxies contains \"*\": client IP headers are trusted from any source and can be spoofed")
+			entries = append(entries, "0.0.0.0/0", "::/0")
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return parsePrefixes(entries, "trusted proxy")
+}
+
+// parsePrefixes parses IPs, CIDR ranges and the "loopback"/"private" keywords.
+// label names the option in warnings for unparseable entries.
+func parsePrefixes(entries []string, label string) []netip.Prefix {
 	var result []netip.Prefix
 
-	for _, proxy := range proxies {
+	for _, entry := range entries {
 		// Handle special keywords
-		switch strings.ToLower(proxy) {
+		switch strings.ToLower(entry) {
 		case "loopback":
 			// Add loopback ranges
 			if prefix, err := netip.ParsePrefix("127.0.0.0/8"); err == nil {
@@ -353,26 +1898,26 @@ func parseTrustedProxies(proxies []string) []netip.Prefix {
 		}
 
 		// Try to parse as CIDR
-		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
 			result = append(result, prefix)
 			continue
 		}
 
 		// Try to parse as single IP and convert to /32 or /128
-		if addr, err := netip.ParseAddr(proxy); err == nil {
+		if addr, err := netip.ParseAddr(entry); err == nil {
 			if addr.Is4() {
-				if prefix, err := netip.ParsePrefix(proxy + "/32"); err == nil {
+				if prefix, err := netip.ParsePrefix(entry + "/32"); err == nil {
 					result = append(result, prefix)
 				}
 			} else if addr.Is6() {
-				if prefix, err := netip.ParsePrefix(proxy + "/128"); err == nil {
+				if prefix, err := netip.ParsePrefix(entry + "/128"); err == nil {
 					result = append(result, prefix)
 				}
 			}
 			continue
 		}
 
-		logger.Warnf("Failed to parse trusted proxy: %s", proxy)
+		logger.Warnf("Failed to parse %s: %s", label, entry)
 	}
 
 	return result
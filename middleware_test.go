@@ -2,10 +2,24 @@ package ELLIO_Traefik_Middleware_Plugin
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/admin"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/iptrie"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/metrics"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
 )
 
 func TestCreateConfig(t *testing.T) {
@@ -79,6 +93,7 @@ func TestExtractClientIP(t *testing.T) {
 		remoteAddr     string
 		headers        map[string]string
 		ipStrategy     string
+		depth          int
 		trustedHeader  string
 		trustedProxies []string
 		expectedIP     string
@@ -109,6 +124,74 @@ func TestExtractClientIP(t *testing.T) {
 			trustedProxies: []string{"10.0.0.0/8"},
 			expectedIP:     "192.168.1.1", // Falls back to direct IP
 		},
+		{
+			name:           "xff strategy skips trusted hops",
+			remoteAddr:     "10.0.0.1:12345",
+			headers:        map[string]string{"X-Forwarded-For": "198.51.100.9, 203.0.113.1, 10.0.0.3, 10.0.0.2"},
+			ipStrategy:     "xff",
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedIP:     "203.0.113.1", // The entry forged by the client is ignored
+		},
+		{
+			name:           "xff strategy with ports",
+			remoteAddr:     "10.0.0.1:12345",
+			headers:        map[string]string{"X-Forwarded-For": "[2001:db8::1]:443, 10.0.0.2:8080"},
+			ipStrategy:     "xff",
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedIP:     "2001:db8::1",
+		},
+		{
+			name:           "xff-depth strategy with port",
+			remoteAddr:     "10.0.0.1:12345",
+			headers:        map[string]string{"X-Forwarded-For": "203.0.113.5:4711"},
+			ipStrategy:     "xff-depth",
+			depth:          1,
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedIP:     "203.0.113.5",
+		},
+		{
+			name:           "real-ip strategy with port",
+			remoteAddr:     "10.0.0.1:12345",
+			headers:        map[string]string{"X-Real-IP": "203.0.113.5:4711"},
+			ipStrategy:     "real-ip",
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedIP:     "203.0.113.5",
+		},
+		{
+			name:           "xff strategy all hops trusted",
+			remoteAddr:     "10.0.0.1:12345",
+			headers:        map[string]string{"X-Forwarded-For": "10.0.0.5, 10.0.0.2"},
+			ipStrategy:     "xff",
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedIP:     "10.0.0.5",
+		},
+		{
+			name:           "xff-depth strategy",
+			remoteAddr:     "10.0.0.1:12345",
+			headers:        map[string]string{"X-Forwarded-For": "198.51.100.9, 203.0.113.1, 10.0.0.2"},
+			ipStrategy:     "xff-depth",
+			depth:          2,
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedIP:     "203.0.113.1", // The spoofable leftmost entry is ignored
+		},
+		{
+			name:           "xff-depth strategy rightmost",
+			remoteAddr:     "10.0.0.1:12345",
+			headers:        map[string]string{"X-Forwarded-For": "198.51.100.9, 203.0.113.1"},
+			ipStrategy:     "xff-depth",
+			depth:          1,
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedIP:     "203.0.113.1",
+		},
+		{
+			name:           "xff-depth strategy beyond the header",
+			remoteAddr:     "10.0.0.1:12345",
+			headers:        map[string]string{"X-Forwarded-For": "203.0.113.1"},
+			ipStrategy:     "xff-depth",
+			depth:          3,
+			trustedProxies: []string{"10.0.0.0/8"},
+			expectedIP:     "10.0.0.1", // Falls back to direct IP
+		},
 		{
 			name:       "real-ip strategy",
 			remoteAddr: "10.0.0.1:12345",
@@ -153,6 +236,7 @@ func TestExtractClientIP(t *testing.T) {
 			middleware := &EllioMiddleware{
 				config: &Config{
 					IPStrategy:     tt.ipStrategy,
+					Depth:          tt.depth,
 					TrustedHeader:  tt.trustedHeader,
 					TrustedProxies: tt.trustedProxies,
 				},
@@ -242,6 +326,27 @@ func TestGetDirectIP(t *testing.T) {
 	}
 }
 
+func TestStripIPPort(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"203.0.113.5", "203.0.113.5"},
+		{" 203.0.113.5:4711 ", "203.0.113.5"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[2001:db8::1]x", "[2001:db8::1]x"},
+		{"[2001:db8::1", "[2001:db8::1"},
+		{"unknown", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := stripIPPort(tt.value); got != tt.expected {
+			t.Errorf("stripIPPort(%q) = %q, want %q", tt.value, got, tt.expected)
+		}
+	}
+}
+
 func TestServeHTTP_WithoutManager(t *testing.T) {
 	// Test when singleton manager is not initialized
 	middleware := &EllioMiddleware{
@@ -267,6 +372,83 @@ func TestServeHTTP_WithoutManager(t *testing.T) {
 	}
 }
 
+func TestServeHTTP_FailClosedWithoutManager(t *testing.T) {
+	middleware := &EllioMiddleware{
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		name:      "test",
+		config:    &Config{FailureMode: "closed"},
+		readiness: admin.ReadinessHandler(singleton.GetManager().Readiness),
+	}
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "192.168.1.1:12345"
+	rec := httptest.NewRecorder()
+	middleware.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when failing closed without a manager, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Ellio-Reason"); got != singleton.ReasonInitializing {
+		t.Errorf("expected X-Ellio-Reason %q, got %q", singleton.ReasonInitializing, got)
+	}
+
+	req = httptest.NewRequest("GET", admin.ReadyPath, nil)
+	rec = httptest.NewRecorder()
+	middleware.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), singleton.ReasonInitializing) {
+		t.Errorf("expected readiness 503 with reason, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServeHTTP_ReadinessWithAdminToken(t *testing.T) {
+	manager, err := singleton.NewManager(singleton.Options{DevMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Stop()
+
+	for _, tt := range []struct {
+		name      string
+		readiness func() (bool, string)
+		want      int
+	}{
+		{"ready", func() (bool, string) { return manager.ReadinessWithin(0) }, http.StatusOK},
+		{"not ready", singleton.GetManager().Readiness, http.StatusServiceUnavailable},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware := &EllioMiddleware{
+				next:      http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+				name:      "test",
+				config:    &Config{FailureMode: "closed", AdminToken: "secret"},
+				readiness: admin.ReadinessHandler(tt.readiness),
+				admin: admin.New(admin.Options{
+					Guard:   admin.GuardOptions{Token: "secret"},
+					Overlay: locallist.NewOverlay(),
+				}),
+			}
+			if middleware.admin == nil {
+				t.Fatal("expected admin endpoints to be enabled")
+			}
+
+			req := httptest.NewRequest("GET", admin.ReadyPath, nil)
+			rec := httptest.NewRecorder()
+			middleware.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected readiness %d without admin credentials, got %d %s", tt.want, rec.Code, rec.Body.String())
+			}
+
+			// Other admin endpoints stay guarded
+			req = httptest.NewRequest("GET", admin.PathPrefix+"admin/overlay", nil)
+			rec = httptest.NewRecorder()
+			middleware.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("expected admin endpoint 401 without token, got %d", rec.Code)
+			}
+		})
+	}
+}
+
 func TestServeHTTP_PanicRecovery(t *testing.T) {
 	// Test panic recovery
 	middleware := &EllioMiddleware{
@@ -295,3 +477,538 @@ func TestServeHTTP_PanicRecovery(t *testing.T) {
 		t.Errorf("expected status 500 after panic, got %d", rec.Code)
 	}
 }
+
+func TestIsHealthCheck(t *testing.T) {
+	middleware := &EllioMiddleware{
+		config:             &Config{},
+		healthCheckAgents:  []string{"elb-healthchecker", "kube-probe"},
+		healthCheckSources: parsePrefixes([]string{"10.10.0.0/16"}, "health check source"),
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		userAgent  string
+		expected   bool
+	}{
+		{"ALB user agent", "10.10.4.2:1234", "ELB-HealthChecker/2.0", true},
+		{"kubelet probe", "10.10.4.2:1234", "kube-probe/1.29", true},
+		{"spoofed ALB user agent", "203.0.113.1:1234", "ELB-HealthChecker/2.0", false},
+		{"spoofed kubelet probe", "203.0.113.1:1234", "kube-probe/1.29", false},
+		{"health check source without marker", "10.10.4.2:1234", "curl/8.0", false},
+		{"regular client", "203.0.113.1:1234", "Mozilla/5.0", false},
+		{"empty user agent", "203.0.113.1:1234", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/health", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("User-Agent", tt.userAgent)
+
+			if got := middleware.isHealthCheck(req); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsHealthCheck_SingleCriterion(t *testing.T) {
+	sourcesOnly := &EllioMiddleware{
+		config:             &Config{},
+		healthCheckSources: parsePrefixes([]string{"10.10.0.0/16"}, "health check source"),
+	}
+	agentsOnly := &EllioMiddleware{
+		config:            &Config{},
+		healthCheckAgents: []string{"elb-healthchecker"},
+	}
+	anySource := &EllioMiddleware{
+		config:            &Config{},
+		healthCheckAgents: []string{"elb-healthchecker"},
+		healthCheckAnyUA:  true,
+	}
+
+	tests := []struct {
+		name       string
+		middleware *EllioMiddleware
+		remoteAddr string
+		userAgent  string
+		expected   bool
+	}{
+		{"source only", sourcesOnly, "10.10.4.2:1234", "curl/8.0", true},
+		{"source only, other client", sourcesOnly, "203.0.113.1:1234", "ELB-HealthChecker/2.0", false},
+		{"agents without sources are ignored", agentsOnly, "203.0.113.1:1234", "ELB-HealthChecker/2.0", false},
+		{"agents from any source", anySource, "203.0.113.1:1234", "ELB-HealthChecker/2.0", true},
+		{"agents from any source, no marker", anySource, "203.0.113.1:1234", "curl/8.0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/health", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("User-Agent", tt.userAgent)
+
+			if got := tt.middleware.isHealthCheck(req); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestServeHTTP_SpoofedHealthCheckUserAgent(t *testing.T) {
+	manager, err := singleton.NewManager(singleton.Options{DevMode: true, DevBlocklist: []string{"203.0.113.0/24", "10.10.0.0/16"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Stop()
+
+	e := &EllioMiddleware{
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		config:             &Config{IPStrategy: "direct", BlockStatusCode: http.StatusForbidden},
+		manager:            manager,
+		healthCheckAgents:  []string{"elb-healthchecker"},
+		healthCheckSources: parsePrefixes([]string{"10.10.0.0/16"}, "health check source"),
+	}
+	serve := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("User-Agent", "ELB-HealthChecker/2.0")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve("203.0.113.5:4711"); code != http.StatusForbidden {
+		t.Errorf("expected a spoofed health check User-Agent from a listed client to be blocked, got %d", code)
+	}
+	if code := serve("10.10.4.2:4711"); code != http.StatusOK {
+		t.Errorf("expected a health check from a health check source to bypass the EDL, got %d", code)
+	}
+}
+
+func TestParseSampleRate(t *testing.T) {
+	tests := []struct {
+		rate, def, want float64
+	}{
+		{0, 1, 1},
+		{0, 0, 0},
+		{0.25, 1, 0.25},
+		{1, 0, 1},
+		{-0.5, 1, 1},
+		{1.5, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseSampleRate(tt.rate, tt.def, "test"); got != tt.want {
+			t.Errorf("parseSampleRate(%v, %v) = %v, want %v", tt.rate, tt.def, got, tt.want)
+		}
+	}
+}
+
+func TestSampled(t *testing.T) {
+	if !sampled(1) {
+		t.Error("rate 1 must always sample")
+	}
+	if sampled(0) {
+		t.Error("rate 0 must never sample")
+	}
+
+	hits := 0
+	for i := 0; i < 10000; i++ {
+		if sampled(0.5) {
+			hits++
+		}
+	}
+	if hits < 4000 || hits > 6000 {
+		t.Errorf("expected roughly half of events sampled at 0.5, got %d/10000", hits)
+	}
+}
+
+func TestAllowRate(t *testing.T) {
+	e := &EllioMiddleware{allowEventRate: 0.1}
+	if got := e.allowRate("blocklist"); got != 0.1 {
+		t.Errorf("blocklist: expected allowEventSampleRate 0.1, got %v", got)
+	}
+	if got := e.allowRate("allowlist"); got != 0.1 {
+		t.Errorf("allowlist without override: expected 0.1, got %v", got)
+	}
+
+	e.allowSampleRate = 0.5
+	if got := e.allowRate("allowlist"); got != 0.5 {
+		t.Errorf("allowlist: expected allowlistAllowedSampleRate 0.5, got %v", got)
+	}
+	if got := e.allowRate("blocklist"); got != 0.1 {
+		t.Errorf("blocklist must ignore the allowlist rate, got %v", got)
+	}
+}
+
+func TestAllowOverride(t *testing.T) {
+	e := &EllioMiddleware{
+		allowOverride: parsePrefixes([]string{"192.0.2.0/28", "2001:db8::1"}, "allow override"),
+		overlay:       locallist.NewOverlay(),
+	}
+	e.overlay.Block.Add(netip.MustParsePrefix("192.0.2.0/24"), time.Hour)
+
+	// Overrides win over local blocks and never reach the EDL
+	d := e.decide(nil, "192.0.2.5", "")
+	if !d.Allowed || d.Source != singleton.SourceOverride || d.Matched.String() != "192.0.2.0/28" {
+		t.Errorf("expected override allow, got %s", d)
+	}
+	if d, ok := e.overrideDecision("::ffff:192.0.2.5"); !ok || !d.Allowed {
+		t.Error("expected IPv4-mapped address to match the override")
+	}
+	if _, ok := e.overrideDecision("2001:db8::1"); !ok {
+		t.Error("expected IPv6 override to match")
+	}
+	for _, ip := range []string{"192.0.2.20", "2001:db8::2", "garbage"} {
+		if _, ok := e.overrideDecision(ip); ok {
+			t.Errorf("expected no override for %s", ip)
+		}
+	}
+	if d := e.decide(nil, "192.0.2.20", ""); d.Allowed || d.Source != singleton.SourceLocal {
+		t.Errorf("expected local block outside the override, got %s", d)
+	}
+}
+
+func TestBlockOverride(t *testing.T) {
+	dir := t.TempDir()
+	allowPath := filepath.Join(dir, "allow.txt")
+	if err := os.WriteFile(allowPath, []byte("198.51.100.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e := &EllioMiddleware{
+		allowOverride: parsePrefixes([]string{"198.51.100.1"}, "allow override"),
+		blockOverride: newOverrideTrie(parsePrefixes([]string{"198.51.100.0/25", "2001:db8::/32"}, "block override")),
+		localAllow:    loadLocalList(allowPath, "local allowlist", time.Hour),
+	}
+
+	// Block overrides win over local allowlists, allow overrides over both
+	d := e.decide(nil, "198.51.100.7", "")
+	if d.Allowed || d.Source != singleton.SourceOverride || d.Matched.String() != "198.51.100.0/25" {
+		t.Errorf("expected override block, got %s", d)
+	}
+	if d := e.decide(nil, "198.51.100.1", ""); !d.Allowed || d.Source != singleton.SourceOverride {
+		t.Errorf("expected allow override to win, got %s", d)
+	}
+	if d := e.decide(nil, "198.51.100.200", ""); !d.Allowed || d.Source != singleton.SourceLocal {
+		t.Errorf("expected local allow outside the block override, got %s", d)
+	}
+	if d, ok := e.overrideDecision("2001:db8:1::5"); !ok || d.Allowed {
+		t.Errorf("expected IPv6 block override, got %s", d)
+	}
+	if newOverrideTrie(nil) != nil {
+		t.Error("expected no trie without overrides")
+	}
+}
+
+func TestLocalDecision(t *testing.T) {
+	dir := t.TempDir()
+	allowPath := filepath.Join(dir, "allow.txt")
+	blockPath := filepath.Join(dir, "block.txt")
+	if err := os.WriteFile(allowPath, []byte("192.0.2.10\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(blockPath, []byte("192.0.2.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &EllioMiddleware{
+		localAllow: loadLocalList(allowPath, "local allowlist", time.Hour),
+		localBlock: loadLocalList(blockPath, "local blocklist", time.Hour),
+	}
+
+	tests := []struct {
+		ip                   string
+		wantAllowed, wantHit bool
+		wantMatched          string
+	}{
+		{"192.0.2.10", true, true, "192.0.2.10/32"},      // allowlist wins over blocklist
+		{"192.0.2.20", false, true, "192.0.2.0/24"},      // blocklisted
+		{"198.51.100.1", false, false, "invalid Prefix"}, // not listed, EDL decides
+		{"garbage", false, false, "invalid Prefix"},
+	}
+	for _, tt := range tests {
+		d, listed := e.localDecision(tt.ip)
+		if d.Allowed != tt.wantAllowed || listed != tt.wantHit || d.Matched.String() != tt.wantMatched {
+			t.Errorf("localDecision(%s) = %v, %v, %s; want %v, %v, %s",
+				tt.ip, d.Allowed, listed, d.Matched, tt.wantAllowed, tt.wantHit, tt.wantMatched)
+		}
+		if listed && d.Source != singleton.SourceLocal {
+			t.Errorf("expected source local, got %q", d.Source)
+		}
+	}
+
+	// Runtime overlay blocks are honored, file allowlist still wins
+	e.overlay = locallist.NewOverlay()
+	e.overlay.Block.Add(netip.MustParsePrefix("198.51.100.0/24"), time.Hour)
+	e.overlay.Block.Add(netip.MustParsePrefix("192.0.2.10/32"), time.Hour)
+	if d, listed := e.localDecision("198.51.100.1"); d.Allowed || !listed {
+		t.Errorf("expected overlay block, got allowed=%v listed=%v", d.Allowed, listed)
+	}
+	if d, _ := e.localDecision("192.0.2.10"); !d.Allowed {
+		t.Error("expected allowlist to win over overlay block")
+	}
+
+	if loadLocalList("", "local allowlist", 0) != nil {
+		t.Error("expected nil list for empty path")
+	}
+}
+
+func TestSplitXFF(t *testing.T) {
+	long := strings.Repeat("10.0.0.1, ", 200) + "203.0.113.9"
+
+	tests := []struct {
+		name          string
+		header        string
+		maxHops       int
+		maxBytes      int
+		wantFirst     string
+		wantLen       int
+		wantTruncated bool
+	}{
+		{"single", "203.0.113.1", 0, 0, "203.0.113.1", 1, false},
+		{"chain", " 203.0.113.1 , 10.0.0.1,10.0.0.2 ", 0, 0, "203.0.113.1", 3, false},
+		{"empty entries", "203.0.113.1,,  ,10.0.0.1", 0, 0, "203.0.113.1", 2, false},
+		{"hop limit keeps rightmost", "1.1.1.1, 2.2.2.2, 3.3.3.3", 2, 0, "2.2.2.2", 2, true},
+		{"byte limit drops partial entry", "111.111.111.111, 2.2.2.2", 0, 10, "2.2.2.2", 1, true},
+		{"byte limit inside single entry", "111.111.111.111", 0, 5, "", 0, true},
+		{"oversized default limits", long, 0, 0, "10.0.0.1", defaultXFFMaxHops, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, truncated := splitXFF(tt.header, tt.maxHops, tt.maxBytes)
+			if len(entries) != tt.wantLen {
+				t.Fatalf("expected %d entries, got %v", tt.wantLen, entries)
+			}
+			if tt.wantLen > 0 && entries[0] != tt.wantFirst {
+				t.Errorf("expected first entry %q, got %q", tt.wantFirst, entries[0])
+			}
+			if truncated != tt.wantTruncated {
+				t.Errorf("expected truncated=%v, got %v", tt.wantTruncated, truncated)
+			}
+		})
+	}
+
+	// The rightmost entry survives truncation
+	entries, _ := splitXFF(long, 0, 0)
+	if entries[len(entries)-1] != "203.0.113.9" {
+		t.Errorf("expected rightmost entry kept, got %q", entries[len(entries)-1])
+	}
+}
+
+func BenchmarkSplitXFFOversized(b *testing.B) {
+	header := strings.Repeat("10.0.0.1, ", 5000) + "203.0.113.9"
+	for i := 0; i < b.N; i++ {
+		splitXFF(header, 0, 0)
+	}
+}
+
+func TestEntrypointEnforcement(t *testing.T) {
+	e := &EllioMiddleware{
+		config: &Config{
+			EntrypointHeader:    "X-Entrypoint",
+			EnforcedEntrypoints: []string{"websecure", ":8443"},
+		},
+		trustedProxies: parseTrustedProxies([]string{"10.0.0.0/8"}),
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:4711"
+	req.Header.Set("X-Entrypoint", "WebSecure")
+	if ep := e.entrypoint(req); ep != "WebSecure" || !e.enforcedOn(ep) {
+		t.Errorf("expected header entrypoint to be enforced, got %q", ep)
+	}
+
+	req.Header.Set("X-Entrypoint", "internal")
+	if e.enforcedOn(e.entrypoint(req)) {
+		t.Error("expected internal entrypoint to be skipped")
+	}
+
+	// Without the header the local listener port identifies the entrypoint
+	req = httptest.NewRequest("GET", "/", nil)
+	local := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 8443}
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, local))
+	if ep := e.entrypoint(req); ep != ":8443" || !e.enforcedOn(ep) {
+		t.Errorf("expected port entrypoint to be enforced, got %q", ep)
+	}
+
+	// A header from an untrusted peer cannot name a skipped entrypoint
+	req.RemoteAddr = "203.0.113.9:4711"
+	req.Header.Set("X-Entrypoint", "internal")
+	if ep := e.entrypoint(req); ep != ":8443" || !e.enforcedOn(ep) {
+		t.Errorf("expected spoofed header to be ignored, got %q", ep)
+	}
+
+	// Unknown entrypoints are enforced
+	if ep := e.entrypoint(httptest.NewRequest("GET", "/", nil)); ep != "" || !e.enforcedOn(ep) {
+		t.Errorf("expected unknown entrypoint to be enforced, got %q", ep)
+	}
+
+	// No restriction enforces everywhere
+	open := &EllioMiddleware{config: &Config{}}
+	if !open.enforcedOn("internal") {
+		t.Error("expected all entrypoints enforced without enforcedEntrypoints")
+	}
+}
+
+func TestHostEnforcement(t *testing.T) {
+	e := &EllioMiddleware{
+		config:       &Config{},
+		includeHosts: parseHostPatterns([]string{"App.Example.com", "*.shop.example.com."}),
+		excludeHosts: parseHostPatterns([]string{"status.shop.example.com"}),
+	}
+
+	tests := map[string]bool{
+		"app.example.com":              true,
+		"APP.example.com:8443":         true,
+		"eu.shop.example.com":          true,
+		"shop.example.com":             false, // wildcard does not match the apex
+		"status.shop.example.com":      false, // excluded wins
+		"status.shop.example.com.:443": false,
+		"other.example.com":            false,
+		"":                             true, // a missing Host is enforced
+	}
+	for host, want := range tests {
+		if got := e.enforcedHost(host); got != want {
+			t.Errorf("%q: expected %v, got %v", host, want, got)
+		}
+	}
+
+	excludeOnly := &EllioMiddleware{config: &Config{}, excludeHosts: parseHostPatterns([]string{"[2001:db8::1]"})}
+	if excludeOnly.enforcedHost("[2001:db8::1]:443") {
+		t.Error("expected excluded IPv6 host to be skipped")
+	}
+	if !excludeOnly.enforcedHost("app.example.com") {
+		t.Error("expected hosts not excluded to be enforced")
+	}
+	if !(&EllioMiddleware{config: &Config{}}).enforcedHost("any.example.com") {
+		t.Error("expected all hosts enforced without host lists")
+	}
+}
+
+func TestAggregatePrefix(t *testing.T) {
+	e := &EllioMiddleware{config: &Config{IPv6AggregatePrefix: 64}}
+
+	prefix, ok := e.aggregatePrefix("2001:db8:1:2:aaaa:bbbb:cccc:dddd")
+	if !ok || prefix.String() != "2001:db8:1:2::/64" {
+		t.Errorf("expected the client /64, got %v %v", prefix, ok)
+	}
+	for _, ip := range []string{"198.51.100.7", "::ffff:198.51.100.7", "invalid"} {
+		if _, ok := e.aggregatePrefix(ip); ok {
+			t.Errorf("expected %s not to be aggregated", ip)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	event := e.newRequestEvent(req, "2001:db8:1:2::1", "blocklist", singleton.Decision{Source: singleton.SourceEDL})
+	defer logs.ReturnToPool(event)
+	if event.Client.Prefix != "2001:db8:1:2::/64" || event.Client.IP != "2001:db8:1:2::1" {
+		t.Errorf("expected the event to carry address and prefix, got %+v", event.Client)
+	}
+
+	if _, ok := (&EllioMiddleware{config: &Config{}}).aggregatePrefix("2001:db8::1"); ok {
+		t.Error("expected no aggregation by default")
+	}
+}
+
+func TestServeHTTP_MetricsEndpoint(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.Counter("ellio_test_total", "Test.", "").Inc()
+
+	e := &EllioMiddleware{
+		config:         &Config{MetricsPath: defaultMetricsPath},
+		next:           http.NotFoundHandler(),
+		metricsHandler: admin.Guard(registry, admin.GuardOptions{Token: "scrape"}),
+	}
+
+	req := httptest.NewRequest("GET", defaultMetricsPath, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rec.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer scrape")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "ellio_test_total 1") {
+		t.Errorf("expected metrics, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestInRollout(t *testing.T) {
+	for _, pct := range []int{0, 100, -5, 150} {
+		if !inRollout("192.0.2.1", pct) {
+			t.Errorf("expected percentage %d to enforce on every client", pct)
+		}
+	}
+
+	enforced := 0
+	for i := 0; i < 1000; i++ {
+		ip := fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		in := inRollout(ip, 25)
+		if in != inRollout(ip, 25) {
+			t.Fatalf("rollout must be sticky for %s", ip)
+		}
+		if in {
+			enforced++
+		}
+		// Raising the percentage keeps already enforced clients enforced
+		if in && !inRollout(ip, 50) {
+			t.Fatalf("%s left the rollout when it grew", ip)
+		}
+	}
+	if enforced < 180 || enforced > 320 {
+		t.Errorf("expected about 25%% of clients enforced, got %d of 1000", enforced)
+	}
+}
+
+func TestHandleIPError(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	config := &Config{
+		IPMissingAction:  ipErrorAction("", "ipMissingAction"),
+		IPMissingMessage: "no client IP",
+		IPInvalidAction:  ipErrorAction("allow", "ipInvalidAction"),
+	}
+	if config.IPMissingAction != "reject" || ipErrorAction("bogus", "ipInvalidAction") != "reject" {
+		t.Fatalf("expected reject as the default and fallback action")
+	}
+	middleware := &EllioMiddleware{next: next, name: "test", config: config}
+
+	rec := httptest.NewRecorder()
+	middleware.handleIPError(rec, httptest.NewRequest("GET", "/", nil), nil, "", logs.EventIPMissing, singleton.Decision{})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "no client IP") {
+		t.Errorf("expected configured 400 for a missing IP, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	middleware.handleIPError(rec, httptest.NewRequest("GET", "/", nil), nil, "not-an-ip", logs.EventIPInvalid, singleton.Decision{})
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected an invalid IP to be forwarded, got %d", rec.Code)
+	}
+}
+
+func TestTorExitDecision(t *testing.T) {
+	trie := iptrie.NewTrie()
+	trie.Insert(netip.MustParsePrefix("203.0.113.7/32"))
+	exits := ipmatcher.New()
+	exits.Update(trie, 1)
+
+	e := &EllioMiddleware{config: &Config{TorExitListURL: singleton.DefaultTorExitListURL}, torExits: exits}
+	d, listed := e.torExitDecision("::ffff:203.0.113.7")
+	if !listed || d.Allowed || d.Source != singleton.SourceTorExit || d.Matched.String() != "203.0.113.7/32" {
+		t.Errorf("expected the exit node to be blocked, got %s", d)
+	}
+	if _, listed := e.torExitDecision("203.0.113.8"); listed {
+		t.Error("expected other clients not to be listed")
+	}
+
+	e.torExits = nil
+	if _, listed := e.torExitDecision("203.0.113.7"); listed {
+		t.Error("expected no decision without blockTorExits")
+	}
+}
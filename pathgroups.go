@@ -0,0 +1,118 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/metrics"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+const (
+	// defaultPathGroup names paths not covered by any configured group
+	defaultPathGroup = "default"
+	// defaultBlockMinSensitivity is the lowest enforced sensitivity unless configured
+	defaultBlockMinSensitivity = 1
+)
+
+// PathGroup assigns a sensitivity weight to a set of path prefixes
+type PathGroup struct {
+	Name        string   `json:"name,omitempty"`        // Group name used in metrics and events
+	Paths       []string `json:"paths,omitempty"`       // Path prefixes, e.g. "/admin" or "/api/payments"
+	Sensitivity int      `json:"sensitivity,omitempty"` // Weight compared against blockMinSensitivity, unmatched paths have 0
+}
+
+// pathGroup is a configured group with its counters
+type pathGroup struct {
+	name        string
+	sensitivity int
+	enforced    bool
+	blocked     *metrics.Counter // Listed clients blocked on the group, nil without metrics
+	monitored   *metrics.Counter // Listed clients only monitored on the group, nil without metrics
+}
+
+// pathRule maps one prefix to its group
+type pathRule struct {
+	prefix string
+	group  *pathGroup
+}
+
+// pathRules decides per request path whether a listed client is blocked or
+// only monitored. The longest matching prefix picks the group.
+type pathRules struct {
+	rules    []pathRule
+	fallback *pathGroup
+}
+
+// newPathRules builds the evaluator, nil when no group has a path. Groups at
+// or above minSensitivity are enforced, all other paths are monitored.
+func newPathRules(groups []PathGroup, minSensitivity int, mm *singleton.Metrics) *pathRules {
+	if minSensitivity <= 0 {
+		minSensitivity = defaultBlockMinSensitivity
+	}
+	r := &pathRules{fallback: newPathGroup(defaultPathGroup, 0, minSensitivity, mm)}
+	for i, cfg := range groups {
+		name := strings.TrimSpace(cfg.Name)
+		if name == "" {
+			logger.Warnf("Path group %d has no name, skipping", i)
+			continue
+		}
+		group := newPathGroup(name, cfg.Sensitivity, minSensitivity, mm)
+		for _, prefix := range cfg.Paths {
+			if prefix = strings.TrimSpace(prefix); prefix == "" {
+				continue
+			}
+			if !strings.HasPrefix(prefix, "/") {
+				logger.Warnf("Invalid path '%s' in path group %s, must start with /", prefix, name)
+				continue
+			}
+			r.rules = append(r.rules, pathRule{prefix: prefix, group: group})
+		}
+	}
+	if len(r.rules) == 0 {
+		return nil
+	}
+	sort.SliceStable(r.rules, func(i, j int) bool {
+		return len(r.rules[i].prefix) > len(r.rules[j].prefix)
+	})
+	return r
+}
+
+func newPathGroup(name string, sensitivity, minSensitivity int, mm *singleton.Metrics) *pathGroup {
+	g := &pathGroup{name: name, sensitivity: sensitivity, enforced: sensitivity >= minSensitivity}
+	if mm != nil {
+		g.blocked = mm.PathGroup(name, "blocked")
+		g.monitored = mm.PathGroup(name, "monitored")
+	}
+	return g
+}
+
+// Match returns the group of a request path
+func (r *pathRules) Match(path string) *pathGroup {
+	for _, rule := range r.rules {
+		if strings.HasPrefix(path, rule.prefix) {
+			return rule.group
+		}
+	}
+	return r.fallback
+}
+
+// groupName returns the path group of a request path, empty without rules
+func (r *pathRules) groupName(path string) string {
+	if r == nil {
+		return ""
+	}
+	return r.Match(path).name
+}
+
+// count records the action taken on a listed client in the group
+func (g *pathGroup) count(blocked bool) {
+	c := g.monitored
+	if blocked {
+		c = g.blocked
+	}
+	if c != nil {
+		c.Inc()
+	}
+}
@@ -0,0 +1,70 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/metrics"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestPathRules(t *testing.T) {
+	mm := &singleton.Metrics{Registry: metrics.NewRegistry()}
+	r := newPathRules([]PathGroup{
+		{Name: "api", Paths: []string{"/api"}, Sensitivity: 1},
+		{Name: "payments", Paths: []string{"/api/payments", "/checkout"}, Sensitivity: 5},
+		{Name: "", Paths: []string{"/ignored"}, Sensitivity: 9},
+		{Name: "bad", Paths: []string{"relative"}, Sensitivity: 9},
+	}, 3, mm)
+	if r == nil {
+		t.Fatal("expected path rules")
+	}
+
+	tests := []struct {
+		path     string
+		group    string
+		enforced bool
+	}{
+		{"/api/payments/42", "payments", true},
+		{"/checkout", "payments", true},
+		{"/api/users", "api", false},
+		{"/ignored", defaultPathGroup, false},
+		{"/", defaultPathGroup, false},
+	}
+	for _, tt := range tests {
+		g := r.Match(tt.path)
+		if g.name != tt.group || g.enforced != tt.enforced {
+			t.Errorf("%s: expected %s enforced=%v, got %s enforced=%v", tt.path, tt.group, tt.enforced, g.name, g.enforced)
+		}
+	}
+
+	r.Match("/checkout").count(true)
+	r.Match("/api/users").count(false)
+	if v := mm.PathGroup("payments", "blocked").Value(); v != 1 {
+		t.Errorf("expected 1 blocked on payments, got %d", v)
+	}
+	if v := mm.PathGroup("api", "monitored").Value(); v != 1 {
+		t.Errorf("expected 1 monitored on api, got %d", v)
+	}
+
+	if newPathRules([]PathGroup{{Name: "empty"}}, 0, nil) != nil {
+		t.Error("expected no rules without paths")
+	}
+	var none *pathRules
+	if none.groupName("/api") != "" {
+		t.Error("expected no group name without rules")
+	}
+}
+
+func TestPathRulesDefaultSensitivity(t *testing.T) {
+	r := newPathRules([]PathGroup{
+		{Name: "admin", Paths: []string{"/admin"}, Sensitivity: 1},
+		{Name: "public", Paths: []string{"/static"}},
+	}, 0, nil)
+	if !r.Match("/admin/login").enforced {
+		t.Error("expected sensitivity 1 to be enforced by default")
+	}
+	if r.Match("/static/app.js").enforced || r.Match("/other").enforced {
+		t.Error("expected sensitivity 0 paths to be monitored")
+	}
+	r.Match("/admin").count(true) // no metrics, must not panic
+}
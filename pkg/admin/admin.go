@@ -0,0 +1,202 @@
+// Package admin serves the authenticated runtime administration endpoints
+// mounted by the middleware under PathPrefix.
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// PathPrefix is the URL path prefix reserved for plugin endpoints
+const PathPrefix = "/_ellio/"
+
+// maxBodySize bounds admin request bodies
+const maxBodySize = 4096
+
+// Options configures the admin endpoints
+type Options struct {
+	Guard   GuardOptions       // Authentication, source restriction and rate limiting
+	Overlay *locallist.Overlay // Runtime allow/block overlay
+	Audit   AuditFunc          // Receives a record for every mutation, optional
+	Status  StatusFunc         // Reports plugin state, optional
+	EDL     EDLFunc            // Exports the enforced EDL, optional
+
+	LastDecision LastDecisionFunc // Looks up the most recent decision for a client IP, optional
+
+	IPv6Prefix int // Widen longer IPv6 entries to this prefix length, 0 keeps them as given
+}
+
+// Server handles requests under PathPrefix
+type Server struct {
+	overlay      *locallist.Overlay
+	audit        AuditFunc
+	status       StatusFunc
+	edl          EDLFunc
+	lastDecision LastDecisionFunc
+	ipv6Prefix   int
+	mux          *http.ServeMux
+	handler      http.Handler // mux behind the guard
+}
+
+// New creates the admin server. It returns nil when no authentication
+// method is configured, leaving the admin surface disabled.
+func New(opts Options) *Server {
+	if !opts.Guard.Enabled() {
+		return nil
+	}
+
+	s := &Server{
+		overlay:      opts.Overlay,
+		audit:        opts.Audit,
+		status:       opts.Status,
+		edl:          opts.EDL,
+		lastDecision: opts.LastDecision,
+		ipv6Prefix:   opts.IPv6Prefix,
+		mux:          http.NewServeMux(),
+	}
+	s.mux.HandleFunc(PathPrefix+"admin/overlay", s.handleOverlay)
+	s.mux.HandleFunc(PathPrefix+"admin/loglevel", s.handleLogLevel)
+	if s.status != nil {
+		s.mux.HandleFunc(PathPrefix+"admin/status", s.handleStatus)
+	}
+	if s.edl != nil {
+		s.mux.HandleFunc(PathPrefix+"admin/edl", s.handleEDL)
+	}
+	if s.lastDecision != nil {
+		s.mux.HandleFunc(LastDecisionPath, s.handleLastDecision)
+	}
+	s.handler = Guard(s.mux, opts.Guard)
+	return s
+}
+
+// Matches reports whether the request targets the admin surface
+func Matches(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, PathPrefix)
+}
+
+// ServeHTTP checks access and dispatches the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// overlayResponse lists the unexpired overlay entries
+type overlayResponse struct {
+	Allow []locallist.Entry `json:"allow"`
+	Block []locallist.Entry `json:"block"`
+}
+
+// handleOverlay lists (GET), adds (POST) or removes (DELETE) overlay entries.
+//
+// POST body: {"list": "block", "prefix": "203.0.113.0/24", "ttl": "1h"}
+// DELETE query: ?list=block&prefix=203.0.113.0/24
+func (s *Server) handleOverlay(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, overlayResponse{
+			Allow: s.overlay.Allow.Entries(),
+			Block: s.overlay.Block.Entries(),
+		})
+
+	case http.MethodPost:
+		// Decode into a map rather than a tagged struct, Yaegi may ignore tags
+		var body map[string]interface{}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		listName, _ := body["list"].(string)
+		prefixStr, _ := body["prefix"].(string)
+		ttlStr, _ := body["ttl"].(string)
+
+		list := s.overlay.List(listName)
+		if list == nil {
+			writeError(w, http.StatusBadRequest, `list must be "allow" or "block"`)
+			return
+		}
+		prefix, err := locallist.ParsePrefix(prefixStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid prefix")
+			return
+		}
+		prefix = locallist.WidenIPv6(prefix, s.ipv6Prefix)
+		var ttl time.Duration
+		if ttlStr != "" {
+			if ttl, err = time.ParseDuration(ttlStr); err != nil || ttl < 0 {
+				writeError(w, http.StatusBadRequest, "invalid ttl")
+				return
+			}
+		}
+
+		entry := list.Add(prefix, ttl)
+		logger.Infof("Admin: added %s to %s overlay (ttl=%v) from %s", entry.Prefix, listName, ttl, r.RemoteAddr)
+		s.record(r, "overlay_add", map[string]string{
+			"list":   listName,
+			"prefix": entry.Prefix.String(),
+			"ttl":    ttl.String(),
+		})
+		writeJSON(w, http.StatusCreated, entry)
+
+	case http.MethodDelete:
+		listName := r.URL.Query().Get("list")
+		list := s.overlay.List(listName)
+		if list == nil {
+			writeError(w, http.StatusBadRequest, `list must be "allow" or "block"`)
+			return
+		}
+		prefix, err := locallist.ParsePrefix(r.URL.Query().Get("prefix"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid prefix")
+			return
+		}
+		prefix = locallist.WidenIPv6(prefix, s.ipv6Prefix)
+		if !list.Remove(prefix) {
+			writeError(w, http.StatusNotFound, "prefix not in overlay")
+			return
+		}
+		logger.Infof("Admin: removed %s from %s overlay from %s", prefix, listName, r.RemoteAddr)
+		s.record(r, "overlay_remove", map[string]string{
+			"list":   listName,
+			"prefix": prefix.String(),
+		})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// record hands an audit record for a mutation to the audit hook
+func (s *Server) record(r *http.Request, action string, details map[string]string) {
+	if s.audit == nil {
+		return
+	}
+	s.audit(&AuditRecord{
+		Action:     action,
+		Actor:      r.Header.Get("X-Admin-Actor"),
+		RemoteAddr: r.RemoteAddr,
+		Time:       time.Now().UTC(),
+		Details:    details,
+	})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Debugf("Admin: failed to write response: %v", err)
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
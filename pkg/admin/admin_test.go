@@ -0,0 +1,180 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+func doRequest(s *Server, method, target, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNewDisabledWithoutToken(t *testing.T) {
+	if New(Options{Overlay: locallist.NewOverlay()}) != nil {
+		t.Error("expected admin server to be disabled without a token")
+	}
+}
+
+func TestAdminAuthentication(t *testing.T) {
+	s := New(Options{Guard: GuardOptions{Token: "secret"}, Overlay: locallist.NewOverlay()})
+
+	for _, token := range []string{"", "wrong"} {
+		rec := doRequest(s, http.MethodGet, PathPrefix+"admin/overlay", token, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: expected 401, got %d", token, rec.Code)
+		}
+	}
+
+	rec := doRequest(s, http.MethodGet, PathPrefix+"admin/overlay", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 with valid token, got %d", rec.Code)
+	}
+}
+
+func TestAdminOverlayLifecycle(t *testing.T) {
+	overlay := locallist.NewOverlay()
+	s := New(Options{Guard: GuardOptions{Token: "secret"}, Overlay: overlay})
+	path := PathPrefix + "admin/overlay"
+
+	rec := doRequest(s, http.MethodPost, path, "secret", `{"list":"block","prefix":"203.0.113.9/24","ttl":"1h"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !overlay.Block.Contains(netip.MustParseAddr("203.0.113.1")) {
+		t.Error("expected prefix to be blocked after POST")
+	}
+
+	rec = doRequest(s, http.MethodGet, path, "secret", "")
+	var listed overlayResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(listed.Block) != 1 || listed.Block[0].Prefix.String() != "203.0.113.0/24" || listed.Block[0].Expires.IsZero() {
+		t.Errorf("unexpected listing: %+v", listed)
+	}
+
+	rec = doRequest(s, http.MethodDelete, path+"?list=block&prefix=203.0.113.0/24", "secret", "")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if overlay.Block.Contains(netip.MustParseAddr("203.0.113.1")) {
+		t.Error("expected prefix to be unblocked after DELETE")
+	}
+
+	rec = doRequest(s, http.MethodDelete, path+"?list=block&prefix=203.0.113.0/24", "secret", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for missing prefix, got %d", rec.Code)
+	}
+}
+
+func TestAdminOverlayValidation(t *testing.T) {
+	s := New(Options{Guard: GuardOptions{Token: "secret"}, Overlay: locallist.NewOverlay()})
+	path := PathPrefix + "admin/overlay"
+
+	tests := []struct {
+		name, method, target, body string
+		want                       int
+	}{
+		{"bad json", http.MethodPost, path, `{`, http.StatusBadRequest},
+		{"bad list", http.MethodPost, path, `{"list":"grey","prefix":"192.0.2.1"}`, http.StatusBadRequest},
+		{"bad prefix", http.MethodPost, path, `{"list":"block","prefix":"nope"}`, http.StatusBadRequest},
+		{"bad ttl", http.MethodPost, path, `{"list":"allow","prefix":"192.0.2.1","ttl":"-1h"}`, http.StatusBadRequest},
+		{"bad delete list", http.MethodDelete, path + "?list=x&prefix=192.0.2.1", "", http.StatusBadRequest},
+		{"method", http.MethodPut, path, "", http.StatusMethodNotAllowed},
+		{"unknown path", http.MethodGet, PathPrefix + "admin/nope", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(s, tt.method, tt.target, "secret", tt.body)
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminOverlayWidensIPv6(t *testing.T) {
+	overlay := locallist.NewOverlay()
+	s := New(Options{Guard: GuardOptions{Token: "secret"}, Overlay: overlay, IPv6Prefix: 64})
+
+	rec := doRequest(s, http.MethodPost, PathPrefix+"admin/overlay", "secret", `{"list":"block","prefix":"2001:db8:1:2::1234"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !overlay.Block.Contains(netip.MustParseAddr("2001:db8:1:2::beef")) {
+		t.Error("expected the ban to cover the client's /64")
+	}
+
+	rec = doRequest(s, http.MethodDelete, PathPrefix+"admin/overlay?list=block&prefix=2001:db8:1:2::1234", "secret", "")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected removal by any address in the /64, got %d", rec.Code)
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	logger.Configure(logger.InfoLevel)
+	defer logger.ClearOverride("test")
+	s := New(Options{Guard: GuardOptions{Token: "secret"}, Overlay: locallist.NewOverlay()})
+	path := PathPrefix + "admin/loglevel"
+
+	rec := doRequest(s, http.MethodPut, path, "secret", `{"level":"debug","ttl":"1h"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var state logLevelResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if state.Level != "debug" || state.Configured != "info" || !state.Override || state.Expires == nil {
+		t.Errorf("unexpected state %+v", state)
+	}
+	if !logger.IsDebugEnabled() {
+		t.Error("expected debug logging after the override")
+	}
+
+	// Reloaded middlewares set the configured level but keep the override
+	logger.Configure(logger.WarnLevel)
+	if !logger.IsDebugEnabled() {
+		t.Error("expected the override to survive a reconfiguration")
+	}
+
+	for _, body := range []string{`{"level":"loud"}`, `{"level":"debug","ttl":"soon"}`, `not json`} {
+		if rec := doRequest(s, http.MethodPut, path, "secret", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	if rec := doRequest(s, http.MethodDelete, path, "secret", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rec.Code)
+	}
+	if logger.GetLevel() != logger.WarnLevel {
+		t.Errorf("expected the configured warn level after revert, got %s", logger.GetLevel())
+	}
+}
+
+func TestLogLevelOverrideExpires(t *testing.T) {
+	logger.Configure(logger.InfoLevel)
+	logger.Override(logger.TraceLevel, 10*time.Millisecond, "test")
+	deadline := time.Now().Add(time.Second)
+	for logger.IsTraceEnabled() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, active, _ := logger.OverrideState(); active || logger.GetLevel() != logger.InfoLevel {
+		t.Errorf("expected the override to expire, level %s", logger.GetLevel())
+	}
+}
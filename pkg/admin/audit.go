@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
+)
+
+// AuditRecord describes one admin mutation. Records are signed with an
+// HMAC-SHA256 over their JSON encoding without the signature, so the
+// backend can detect tampering in transit or at rest.
+type AuditRecord struct {
+	Action     string            `json:"action"`          // e.g. "overlay_add", "overlay_remove"
+	Actor      string            `json:"actor,omitempty"` // X-Admin-Actor header, free-form operator name
+	RemoteAddr string            `json:"remote_addr"`
+	Time       time.Time         `json:"time"`
+	Details    map[string]string `json:"details,omitempty"`
+	Signature  string            `json:"signature,omitempty"` // Hex HMAC-SHA256, set by Sign
+}
+
+// auditKeyLabel separates the audit signing key from other uses of the
+// deployment secret it is derived from
+const auditKeyLabel = "ellio-audit-v1"
+
+// ErrNoAuditKey is returned by Sign when no signing key is configured
+var ErrNoAuditKey = errors.New("no audit signing key")
+
+// AuditKey derives the audit signing key from a deployment secret, so the
+// secret itself never keys a MAC that leaves the process. It returns nil
+// for an empty secret, as in dev and offline mode.
+func AuditKey(secret []byte) []byte {
+	if len(secret) == 0 {
+		return nil
+	}
+	return crypto.MAC(secret, []byte(auditKeyLabel))
+}
+
+// AuditFunc receives every admin mutation after it has been applied
+type AuditFunc func(record *AuditRecord)
+
+// Sign computes and sets the record signature. An empty key is rejected
+// rather than producing a signature anyone can forge.
+func (r *AuditRecord) Sign(key []byte) error {
+	if len(key) == 0 {
+		return ErrNoAuditKey
+	}
+	mac, err := r.mac(key)
+	if err != nil {
+		return err
+	}
+	r.Signature = hex.EncodeToString(mac)
+	return nil
+}
+
+// Verify reports whether the signature matches the record contents
+func (r *AuditRecord) Verify(key []byte) bool {
+	if len(key) == 0 || r.Signature == "" {
+		return false
+	}
+	given, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return false
+	}
+	mac, err := r.mac(key)
+	if err != nil {
+		return false
+	}
+	return crypto.Equal(given, mac)
+}
+
+// mac hashes the canonical encoding: the record with an empty signature.
+// encoding/json sorts map keys, so Details encode deterministically.
+func (r *AuditRecord) mac(key []byte) ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = ""
+	unsigned.Time = unsigned.Time.UTC()
+	payload, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.MAC(key, payload), nil
+}
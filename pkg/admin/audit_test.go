@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
+)
+
+func TestAuditRecordSignVerify(t *testing.T) {
+	key := []byte("deployment-key")
+	record := &AuditRecord{
+		Action:     "overlay_add",
+		Actor:      "oncall",
+		RemoteAddr: "10.0.0.1:1234",
+		Time:       time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		Details:    map[string]string{"list": "block", "prefix": "203.0.113.0/24"},
+	}
+	if err := record.Sign(key); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if !record.Verify(key) {
+		t.Fatal("expected signature to verify")
+	}
+
+	// Signature survives a JSON round trip, as done by the backend
+	data, _ := json.Marshal(record)
+	var decoded AuditRecord
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if !decoded.Verify(key) {
+		t.Error("expected signature to verify after JSON round trip")
+	}
+
+	if decoded.Verify([]byte("other-key")) {
+		t.Error("signature must not verify with another key")
+	}
+	decoded.Details["prefix"] = "0.0.0.0/0"
+	if decoded.Verify(key) {
+		t.Error("signature must not verify after tampering")
+	}
+}
+
+func TestAuditRecordRequiresKey(t *testing.T) {
+	record := &AuditRecord{Action: "overlay_add", Time: time.Now()}
+	if err := record.Sign(nil); err != ErrNoAuditKey {
+		t.Fatalf("expected ErrNoAuditKey for an empty key, got %v", err)
+	}
+	if record.Signature != "" {
+		t.Errorf("expected no signature, got %q", record.Signature)
+	}
+	if record.Verify(nil) {
+		t.Error("unsigned record must not verify with an empty key")
+	}
+
+	if AuditKey(nil) != nil || AuditKey([]byte{}) != nil {
+		t.Error("expected no audit key for an empty secret")
+	}
+	token := []byte("bootstrap-token")
+	key := AuditKey(token)
+	if len(key) == 0 || string(key) == string(token) {
+		t.Fatalf("expected a derived key distinct from the secret, got %x", key)
+	}
+	if err := record.Sign(key); err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+	if record.Verify(token) {
+		t.Error("signature must not verify with the raw secret")
+	}
+	if !record.Verify(key) {
+		t.Error("expected signature to verify with the derived key")
+	}
+}
+
+func TestAdminMutationsAreAudited(t *testing.T) {
+	var records []*AuditRecord
+	s := New(Options{
+		Guard:   GuardOptions{Token: "secret"},
+		Overlay: locallist.NewOverlay(),
+		Audit:   func(r *AuditRecord) { records = append(records, r) },
+	})
+	path := PathPrefix + "admin/overlay"
+
+	doRequest(s, http.MethodGet, path, "secret", "")
+	doRequest(s, http.MethodPost, path, "secret", `{"list":"block","prefix":"203.0.113.0/24","ttl":"30m"}`)
+	doRequest(s, http.MethodPost, path, "wrong", `{"list":"block","prefix":"198.51.100.0/24"}`)
+	doRequest(s, http.MethodDelete, path+"?list=block&prefix=203.0.113.0/24", "secret", "")
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 audit records for mutations only, got %d", len(records))
+	}
+	if records[0].Action != "overlay_add" || records[0].Details["ttl"] != "30m0s" {
+		t.Errorf("unexpected add record: %+v", records[0])
+	}
+	if records[1].Action != "overlay_remove" || records[1].Details["prefix"] != "203.0.113.0/24" {
+		t.Errorf("unexpected remove record: %+v", records[1])
+	}
+}
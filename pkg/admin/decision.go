@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// LastDecisionPath is the path of the last-decision lookup
+const LastDecisionPath = PathPrefix + "last-decision"
+
+// LastDecisionFunc returns a JSON-encodable record of the most recent
+// decision made for a client IP, nil when none is kept
+type LastDecisionFunc func(ip netip.Addr) interface{}
+
+// handleLastDecision answers "why was I blocked?" for one client (GET):
+// ?ip=203.0.113.7 returns the most recent decision made for it
+func (s *Server) handleLastDecision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	ip, err := netip.ParseAddr(r.URL.Query().Get("ip"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ip must be an IP address")
+		return
+	}
+	decision := s.lastDecision(ip.Unmap().WithZone(""))
+	if decision == nil {
+		writeError(w, http.StatusNotFound, "no recent decision for "+ip.String())
+		return
+	}
+	writeJSON(w, http.StatusOK, decision)
+}
@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestAdminLastDecision(t *testing.T) {
+	s := New(Options{Guard: GuardOptions{Token: "secret"}})
+	if rec := doRequest(s, http.MethodGet, LastDecisionPath+"?ip=203.0.113.7", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a lookup func, got %d", rec.Code)
+	}
+
+	var looked netip.Addr
+	s = New(Options{
+		Guard: GuardOptions{Token: "secret"},
+		LastDecision: func(ip netip.Addr) interface{} {
+			looked = ip
+			if ip.String() != "203.0.113.7" {
+				return nil
+			}
+			return map[string]string{"verdict": "block"}
+		},
+	})
+	if rec := doRequest(s, http.MethodGet, LastDecisionPath+"?ip=203.0.113.7", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rec.Code)
+	}
+	if rec := doRequest(s, http.MethodPost, LastDecisionPath+"?ip=203.0.113.7", "secret", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+	if rec := doRequest(s, http.MethodGet, LastDecisionPath+"?ip=not-an-ip", "secret", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid IP, got %d", rec.Code)
+	}
+	if rec := doRequest(s, http.MethodGet, LastDecisionPath+"?ip=198.51.100.1", "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown IP, got %d", rec.Code)
+	}
+
+	// IPv4-mapped addresses are looked up as IPv4
+	rec := doRequest(s, http.MethodGet, LastDecisionPath+"?ip=::ffff:203.0.113.7", "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if looked.String() != "203.0.113.7" {
+		t.Errorf("expected unmapped lookup, got %s", looked)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if body["verdict"] != "block" {
+		t.Errorf("unexpected body %v", body)
+	}
+}
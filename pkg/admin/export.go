@@ -0,0 +1,173 @@
+package admin
+
+import (
+	"bufio"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/netip"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// EDLView is a consistent view of the enforced EDL
+type EDLView interface {
+	Generation() string              // Generation ID published by the backend, empty when unknown
+	Mode() string                    // blocklist or allowlist
+	Walk(fn func(netip.Prefix) bool) // Prefixes in canonical order, IPv4 first, ascending
+}
+
+// EDLFunc returns the enforced EDL, nil before a list is loaded
+type EDLFunc func() EDLView
+
+// ExportChunkSize is the number of prefixes hashed into one Merkle leaf
+const ExportChunkSize = 1024
+
+// Export headers, the digest is sent as a trailer of the text export
+const (
+	GenerationHeader = "X-EDL-Generation"
+	DigestTrailer    = "X-EDL-SHA256"
+)
+
+// edlSummary describes the enforced EDL without listing it. The text
+// export is one prefix per line, each terminated by a newline; SHA256 is
+// its digest. Leaves are the SHA-256 of ExportChunkSize consecutive lines
+// of it, inner nodes the SHA-256 of the concatenated child digests, an odd
+// node is carried up unchanged. The root of an empty list is the digest of
+// no data.
+type edlSummary struct {
+	Generation string   `json:"generation,omitempty"`
+	Mode       string   `json:"mode,omitempty"`
+	Entries    int64    `json:"entries"`
+	IPv4       int64    `json:"ipv4"`
+	IPv6       int64    `json:"ipv6"`
+	SHA256     string   `json:"sha256"`
+	MerkleRoot string   `json:"merkle_root"`
+	ChunkSize  int      `json:"chunk_size"`
+	Leaves     []string `json:"leaves"`
+}
+
+// handleEDL exports the enforced EDL for reconciliation with the list the
+// backend published (GET). The default format is a JSON summary carrying
+// the digest and Merkle tree of the list, format=text streams the list.
+func (s *Server) handleEDL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "summary" && format != "text" {
+		writeError(w, http.StatusBadRequest, `format must be "summary" or "text"`)
+		return
+	}
+	view := s.edl()
+	if view == nil {
+		writeError(w, http.StatusServiceUnavailable, "no EDL loaded")
+		return
+	}
+
+	if format == "text" {
+		s.streamEDL(w, r, view)
+		return
+	}
+	writeJSON(w, http.StatusOK, summarizeEDL(view))
+}
+
+// streamEDL writes the text export, its digest follows as a trailer
+func (s *Server) streamEDL(w http.ResponseWriter, r *http.Request, view EDLView) {
+	header := w.Header()
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	header.Set("Trailer", DigestTrailer)
+	if generation := view.Generation(); generation != "" {
+		header.Set(GenerationHeader, generation)
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	digest := crypto.NewHash()
+	out := bufio.NewWriter(io.MultiWriter(w, digest))
+	var err error
+	view.Walk(func(prefix netip.Prefix) bool {
+		_, err = out.WriteString(prefix.String() + "\n")
+		return err == nil
+	})
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		logger.Debugf("Admin: failed to stream EDL: %v", err)
+		return
+	}
+	header.Set(DigestTrailer, hex.EncodeToString(digest.Sum(nil)))
+}
+
+// summarizeEDL walks the list once, hashing the text export and its leaves
+func summarizeEDL(view EDLView) edlSummary {
+	summary := edlSummary{
+		Generation: view.Generation(),
+		Mode:       view.Mode(),
+		ChunkSize:  ExportChunkSize,
+		Leaves:     []string{},
+	}
+	digest := crypto.NewHash()
+	var leaf hash.Hash
+	var leaves [][]byte
+	inLeaf := 0
+	view.Walk(func(prefix netip.Prefix) bool {
+		line := []byte(prefix.String() + "\n")
+		digest.Write(line)
+		if leaf == nil {
+			leaf = crypto.NewHash()
+		}
+		leaf.Write(line)
+		if inLeaf++; inLeaf == ExportChunkSize {
+			leaves = append(leaves, leaf.Sum(nil))
+			leaf, inLeaf = nil, 0
+		}
+		summary.Entries++
+		if prefix.Addr().Is4() {
+			summary.IPv4++
+		} else {
+			summary.IPv6++
+		}
+		return true
+	})
+	if leaf != nil {
+		leaves = append(leaves, leaf.Sum(nil))
+	}
+
+	summary.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	for _, l := range leaves {
+		summary.Leaves = append(summary.Leaves, hex.EncodeToString(l))
+	}
+	summary.MerkleRoot = hex.EncodeToString(merkleRoot(leaves))
+	return summary
+}
+
+// merkleRoot folds leaf digests pairwise into the root digest
+func merkleRoot(level [][]byte) []byte {
+	if len(level) == 0 {
+		return crypto.Sum(nil)
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := crypto.NewHash()
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return level[0]
+}
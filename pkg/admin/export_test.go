@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// staticEDL is an EDLView over a fixed prefix list
+type staticEDL struct {
+	generation string
+	prefixes   []netip.Prefix
+}
+
+func (e *staticEDL) Generation() string { return e.generation }
+func (e *staticEDL) Mode() string       { return "blocklist" }
+
+func (e *staticEDL) Walk(fn func(netip.Prefix) bool) {
+	for _, p := range e.prefixes {
+		if !fn(p) {
+			return
+		}
+	}
+}
+
+func sha256Hex(data ...[]byte) string {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestAdminEDLExport(t *testing.T) {
+	path := PathPrefix + "admin/edl"
+
+	s := New(Options{Guard: GuardOptions{Token: "secret"}})
+	if rec := doRequest(s, http.MethodGet, path, "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without an EDL func, got %d", rec.Code)
+	}
+
+	var view EDLView
+	s = New(Options{
+		Guard: GuardOptions{Token: "secret"},
+		EDL:   func() EDLView { return view },
+	})
+	if rec := doRequest(s, http.MethodGet, path, "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rec.Code)
+	}
+	if rec := doRequest(s, http.MethodGet, path, "secret", ""); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 before a list is loaded, got %d", rec.Code)
+	}
+
+	view = &staticEDL{generation: "gen-7", prefixes: []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("198.51.100.7/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}}
+	if rec := doRequest(s, http.MethodPost, path, "secret", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+	if rec := doRequest(s, http.MethodGet, path+"?format=csv", "secret", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", rec.Code)
+	}
+
+	text := "192.0.2.0/24\n198.51.100.7/32\n2001:db8::/32\n"
+	rec := doRequest(s, http.MethodGet, path+"?format=text", "secret", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != text {
+		t.Fatalf("unexpected text export %d: %q", rec.Code, rec.Body.String())
+	}
+	result := rec.Result()
+	if got := result.Header.Get(GenerationHeader); got != "gen-7" {
+		t.Errorf("expected the generation header, got %q", got)
+	}
+	if got := result.Trailer.Get(DigestTrailer); got != sha256Hex([]byte(text)) {
+		t.Errorf("expected the digest trailer of the body, got %q", got)
+	}
+
+	rec = doRequest(s, http.MethodGet, path, "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var summary edlSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if summary.Generation != "gen-7" || summary.Mode != "blocklist" || summary.Entries != 3 || summary.IPv4 != 2 || summary.IPv6 != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if summary.SHA256 != sha256Hex([]byte(text)) {
+		t.Errorf("expected the summary digest to match the text export, got %s", summary.SHA256)
+	}
+	if len(summary.Leaves) != 1 || summary.Leaves[0] != summary.SHA256 || summary.MerkleRoot != summary.SHA256 {
+		t.Errorf("expected a single leaf as the root, got %+v", summary)
+	}
+}
+
+func TestSummarizeEDLMerkle(t *testing.T) {
+	// Three leaves: two full chunks and one partial
+	view := &staticEDL{}
+	var chunks [3]strings.Builder
+	for i := 0; i < 2*ExportChunkSize+5; i++ {
+		p := netip.MustParsePrefix(fmt.Sprintf("10.%d.%d.0/24", i/256, i%256))
+		view.prefixes = append(view.prefixes, p)
+		chunks[i/ExportChunkSize].WriteString(p.String() + "\n")
+	}
+
+	summary := summarizeEDL(view)
+	if summary.Entries != int64(len(view.prefixes)) || len(summary.Leaves) != 3 {
+		t.Fatalf("expected 3 leaves for %d prefixes, got %d", summary.Entries, len(summary.Leaves))
+	}
+	var leaves [3][]byte
+	for i := range chunks {
+		want := sha256Hex([]byte(chunks[i].String()))
+		if summary.Leaves[i] != want {
+			t.Errorf("leaf %d: expected %s, got %s", i, want, summary.Leaves[i])
+		}
+		leaves[i], _ = hex.DecodeString(want)
+	}
+	// The odd third leaf is carried up unchanged
+	pair, _ := hex.DecodeString(sha256Hex(leaves[0], leaves[1]))
+	if want := sha256Hex(pair, leaves[2]); summary.MerkleRoot != want {
+		t.Errorf("expected root %s, got %s", want, summary.MerkleRoot)
+	}
+
+	empty := summarizeEDL(&staticEDL{})
+	if empty.Entries != 0 || len(empty.Leaves) != 0 || empty.MerkleRoot != sha256Hex() || empty.SHA256 != sha256Hex() {
+		t.Errorf("unexpected summary of an empty list %+v", empty)
+	}
+}
@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+)
+
+const (
+	// DefaultRateLimit is the per-client request budget per minute
+	DefaultRateLimit = 60
+	// maxTrackedClients bounds the rate limiter state; it is reset when exceeded
+	maxTrackedClients = 1024
+)
+
+// GuardOptions configures access control for plugin endpoints
+type GuardOptions struct {
+	// Token requires "Authorization: Bearer <token>" when set
+	Token string
+	// RequireClientCert requires a TLS client certificate verified by Traefik
+	// (TLS options with clientAuth). Terminating TLS elsewhere disables it.
+	RequireClientCert bool
+	// ClientCertNames restricts accepted certificates by common name or DNS
+	// SAN. Empty accepts any verified certificate.
+	ClientCertNames []string
+	// AllowedSources restricts callers by direct connection IP. Empty allows all.
+	AllowedSources []netip.Prefix
+	// Open admits callers without authentication, for local development
+	// only. It is meant to be combined with AllowedSources.
+	Open bool
+	// RateLimit is the per-client budget in requests per minute, burst included.
+	// Zero uses DefaultRateLimit, negative disables rate limiting.
+	RateLimit int
+}
+
+// Enabled reports whether any authentication method is configured or the
+// surface is explicitly Open. Source restriction and rate limiting alone do
+// not enable the admin surface.
+func (o GuardOptions) Enabled() bool {
+	return o.Token != "" || o.RequireClientCert || o.Open
+}
+
+// guard enforces GuardOptions in front of a handler
+type guard struct {
+	next http.Handler
+	opts GuardOptions
+
+	mu      sync.Mutex
+	buckets map[string]*logs.LeakyBucket
+}
+
+// Guard wraps next with source restriction, rate limiting and authentication,
+// checked in that order so unauthenticated floods are throttled too.
+func Guard(next http.Handler, opts GuardOptions) http.Handler {
+	if opts.RateLimit == 0 {
+		opts.RateLimit = DefaultRateLimit
+	}
+	return &guard{
+		next:    next,
+		opts:    opts,
+		buckets: make(map[string]*logs.LeakyBucket),
+	}
+}
+
+func (g *guard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client := directIP(r.RemoteAddr)
+
+	if !g.sourceAllowed(client) {
+		logger.Debugf("Admin: rejected request from disallowed source %s", client)
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	if !g.allow(client) {
+		// Buckets refill at least one request per second
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+
+	if !g.authenticated(r) {
+		if g.opts.Token != "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ellio"`)
+		}
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	g.next.ServeHTTP(w, r)
+}
+
+// sourceAllowed checks the direct connection IP against AllowedSources
+func (g *guard) sourceAllowed(client string) bool {
+	if len(g.opts.AllowedSources) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(client)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range g.opts.AllowedSources {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow consumes one request from the client's bucket
+func (g *guard) allow(client string) bool {
+	if g.opts.RateLimit < 0 {
+		return true
+	}
+
+	g.mu.Lock()
+	bucket, ok := g.buckets[client]
+	if !ok {
+		if len(g.buckets) >= maxTrackedClients {
+			g.buckets = make(map[string]*logs.LeakyBucket)
+		}
+		// The bucket refills in whole tokens per second, so budgets below one
+		// per second are approximated by the capacity over a minute
+		rate := int64(g.opts.RateLimit / 60)
+		if rate < 1 {
+			rate = 1
+		}
+		bucket = logs.NewLeakyBucket(int64(g.opts.RateLimit), rate)
+		g.buckets[client] = bucket
+	}
+	g.mu.Unlock()
+
+	return bucket.Allow(1)
+}
+
+// authenticated checks every configured method; all of them must pass
+func (g *guard) authenticated(r *http.Request) bool {
+	if !g.opts.Enabled() {
+		return false
+	}
+	if g.opts.Token != "" && !validToken(r, g.opts.Token) {
+		return false
+	}
+	if g.opts.RequireClientCert && !validClientCert(r, g.opts.ClientCertNames) {
+		return false
+	}
+	return true
+}
+
+// validToken checks the bearer token in constant time
+func validToken(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	given := strings.TrimPrefix(auth, "Bearer ")
+	return crypto.Equal([]byte(given), []byte(token))
+}
+
+// validClientCert requires a verified client certificate, optionally with
+// one of the given names as common name or DNS SAN
+func validClientCert(r *http.Request, names []string) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return false
+	}
+	if len(names) == 0 {
+		return true
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	for _, name := range names {
+		if strings.EqualFold(leaf.Subject.CommonName, name) {
+			return true
+		}
+		for _, dns := range leaf.DNSNames {
+			if strings.EqualFold(dns, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// directIP strips the port from a RemoteAddr
+func directIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func guardRequest(h http.Handler, remoteAddr, token string, state *tls.ConnectionState) int {
+	req := httptest.NewRequest(http.MethodGet, PathPrefix+"admin/overlay", nil)
+	req.RemoteAddr = remoteAddr
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.TLS = state
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// verifiedState returns a TLS state with a verified client certificate
+func verifiedState(cn string, dnsNames ...string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestGuardEnabled(t *testing.T) {
+	if (GuardOptions{AllowedSources: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}).Enabled() {
+		t.Error("source restriction alone must not enable the admin surface")
+	}
+	if !(GuardOptions{RequireClientCert: true}).Enabled() {
+		t.Error("client certificate requirement must enable the admin surface")
+	}
+}
+
+func TestGuardSourceRestriction(t *testing.T) {
+	h := Guard(okHandler, GuardOptions{
+		Token:          "secret",
+		AllowedSources: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	})
+
+	if code := guardRequest(h, "10.1.2.3:5000", "secret", nil); code != http.StatusOK {
+		t.Errorf("expected allowed source to pass, got %d", code)
+	}
+	if code := guardRequest(h, "192.0.2.1:5000", "secret", nil); code != http.StatusForbidden {
+		t.Errorf("expected disallowed source to be rejected, got %d", code)
+	}
+}
+
+func TestGuardOpen(t *testing.T) {
+	h := Guard(okHandler, GuardOptions{
+		Open:           true,
+		AllowedSources: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	})
+
+	if code := guardRequest(h, "10.1.2.3:5000", "", nil); code != http.StatusOK {
+		t.Errorf("expected an unauthenticated caller to pass, got %d", code)
+	}
+	if code := guardRequest(h, "192.0.2.1:5000", "", nil); code != http.StatusForbidden {
+		t.Errorf("expected disallowed source to be rejected, got %d", code)
+	}
+}
+
+func TestGuardRateLimit(t *testing.T) {
+	h := Guard(okHandler, GuardOptions{Token: "secret", RateLimit: 3})
+
+	for i := 0; i < 3; i++ {
+		if code := guardRequest(h, "10.0.0.1:1", "wrong", nil); code != http.StatusUnauthorized {
+			t.Fatalf("request %d: expected 401, got %d", i, code)
+		}
+	}
+	// Failed authentication attempts count against the budget
+	if code := guardRequest(h, "10.0.0.1:1", "secret", nil); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 after budget is spent, got %d", code)
+	}
+	// Other clients have their own budget
+	if code := guardRequest(h, "10.0.0.2:1", "secret", nil); code != http.StatusOK {
+		t.Errorf("expected other client to pass, got %d", code)
+	}
+
+	unlimited := Guard(okHandler, GuardOptions{Token: "secret", RateLimit: -1})
+	for i := 0; i < 100; i++ {
+		if code := guardRequest(unlimited, "10.0.0.1:1", "secret", nil); code != http.StatusOK {
+			t.Fatalf("expected no rate limit, got %d at request %d", code, i)
+		}
+	}
+}
+
+func TestGuardClientCert(t *testing.T) {
+	h := Guard(okHandler, GuardOptions{RequireClientCert: true, ClientCertNames: []string{"ops.example.com"}, RateLimit: -1})
+
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+		want  int
+	}{
+		{"no tls", nil, http.StatusUnauthorized},
+		{"unverified", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"common name", verifiedState("ops.example.com"), http.StatusOK},
+		{"dns san", verifiedState("other", "OPS.example.com"), http.StatusOK},
+		{"wrong name", verifiedState("intruder.example.com"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if code := guardRequest(h, "10.0.0.1:1", "", tt.state); code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, code)
+		}
+	}
+
+	// Token and certificate together require both
+	both := Guard(okHandler, GuardOptions{Token: "secret", RequireClientCert: true, RateLimit: -1})
+	if code := guardRequest(both, "10.0.0.1:1", "secret", nil); code != http.StatusUnauthorized {
+		t.Errorf("expected certificate to be required alongside the token, got %d", code)
+	}
+	if code := guardRequest(both, "10.0.0.1:1", "secret", verifiedState("any")); code != http.StatusOK {
+		t.Errorf("expected token plus certificate to pass, got %d", code)
+	}
+}
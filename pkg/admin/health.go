@@ -0,0 +1,30 @@
+package admin
+
+import "net/http"
+
+// ReadyPath is the readiness probe path
+const ReadyPath = PathPrefix + "ready"
+
+// ReadinessFunc reports whether enforcement is possible, with a reason code
+// when it is not
+type ReadinessFunc func() (ready bool, reason string)
+
+// ReadinessHandler answers 200 when ready and 503 with the reason code
+// otherwise. It is unauthenticated so load balancer health checks can poll
+// it, and reveals nothing beyond the reason code.
+func ReadinessHandler(check ReadinessFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		ready, reason := check()
+		if !ready {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"ready": false, "reason": reason})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ready": true})
+	})
+}
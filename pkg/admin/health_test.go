@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	ready, reason := false, "edl_not_loaded"
+	h := ReadinessHandler(func() (bool, string) { return ready, reason })
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when not ready, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"reason":"edl_not_loaded"`) {
+		t.Errorf("expected reason code in body, got %s", rec.Body.String())
+	}
+
+	ready, reason = true, ""
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ReadyPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 when ready, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, ReadyPath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+}
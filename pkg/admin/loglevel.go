@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// logLevelResponse describes the log level in effect
+type logLevelResponse struct {
+	Level      string     `json:"level"`
+	Configured string     `json:"configured"`
+	Override   bool       `json:"override"`
+	Expires    *time.Time `json:"expires,omitempty"`
+}
+
+// handleLogLevel shows (GET), overrides (PUT or POST) or reverts (DELETE)
+// the log level without a restart.
+//
+// PUT body: {"level": "debug", "ttl": "15m"}; without ttl the override
+// lasts until it is reverted
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, currentLogLevel())
+
+	case http.MethodPut, http.MethodPost:
+		// Decode into a map rather than a tagged struct, Yaegi may ignore tags
+		var body map[string]interface{}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		levelStr, _ := body["level"].(string)
+		ttlStr, _ := body["ttl"].(string)
+
+		level, err := logger.ParseLevel(levelStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "level must be trace, debug, info, warn or error")
+			return
+		}
+		var ttl time.Duration
+		if ttlStr != "" {
+			if ttl, err = time.ParseDuration(ttlStr); err != nil || ttl < 0 {
+				writeError(w, http.StatusBadRequest, "invalid ttl")
+				return
+			}
+		}
+
+		logger.Override(level, ttl, "admin API from "+r.RemoteAddr)
+		s.record(r, "log_level_set", map[string]string{
+			"level": level.String(),
+			"ttl":   ttl.String(),
+		})
+		writeJSON(w, http.StatusOK, currentLogLevel())
+
+	case http.MethodDelete:
+		logger.ClearOverride("admin API from " + r.RemoteAddr)
+		s.record(r, "log_level_reset", nil)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// currentLogLevel reports the logger state
+func currentLogLevel() logLevelResponse {
+	configured, active, expires := logger.OverrideState()
+	resp := logLevelResponse{
+		Level:      logger.GetLevel().String(),
+		Configured: configured.String(),
+		Override:   active,
+	}
+	if !expires.IsZero() {
+		resp.Expires = &expires
+	}
+	return resp
+}
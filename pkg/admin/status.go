@@ -0,0 +1,21 @@
+package admin
+
+import "net/http"
+
+// StatusFunc returns a JSON-encodable snapshot of the plugin state
+type StatusFunc func() interface{}
+
+// handleStatus reports deployment, EDL, token and shipper state (GET)
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	status := s.status()
+	if status == nil {
+		writeError(w, http.StatusServiceUnavailable, "status unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
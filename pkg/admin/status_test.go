@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestAdminStatus(t *testing.T) {
+	path := PathPrefix + "admin/status"
+
+	s := New(Options{Guard: GuardOptions{Token: "secret"}})
+	if rec := doRequest(s, http.MethodGet, path, "secret", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a status func, got %d", rec.Code)
+	}
+
+	s = New(Options{
+		Guard:  GuardOptions{Token: "secret"},
+		Status: func() interface{} { return map[string]interface{}{"state": "active"} },
+	})
+	if rec := doRequest(s, http.MethodGet, path, "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", rec.Code)
+	}
+	if rec := doRequest(s, http.MethodPost, path, "secret", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+
+	rec := doRequest(s, http.MethodGet, path, "secret", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if body["state"] != "active" {
+		t.Errorf("unexpected body %v", body)
+	}
+}
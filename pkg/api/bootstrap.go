@@ -3,17 +3,24 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/backoff"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// DefaultBootstrapRetry is the retry policy of bootstrap calls unless configured
+var DefaultBootstrapRetry = backoff.Policy{Attempts: 3, Base: time.Second, Max: 10 * time.Second}
+
 // BootstrapRequest represents the bootstrap API request
 type BootstrapRequest struct {
 	BootstrapToken   string   `json:"bootstrap_token"`
@@ -32,18 +39,40 @@ type BootstrapClaims struct {
 
 // BootstrapClient handles bootstrap API calls
 type BootstrapClient struct {
+	mu     sync.RWMutex // Guards client and retry against reloads during calls
 	client *http.Client
+	retry  backoff.Policy
 }
 
 // NewBootstrapClient creates a new bootstrap client
 func NewBootstrapClient() *BootstrapClient {
 	return &BootstrapClient{
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		client: HTTPClientFactory(10 * time.Second),
+		retry:  DefaultBootstrapRetry,
 	}
 }
 
+// SetTLSConfig applies cfg to the HTTP client, nil keeps the defaults
+func (c *BootstrapClient) SetTLSConfig(cfg *tls.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ApplyTLS(c.client, cfg)
+}
+
+// SetHTTPClient overrides the HTTP client used for bootstrap calls
+func (c *BootstrapClient) SetHTTPClient(client *http.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client = client
+}
+
+// SetRetry overrides the retry policy, zero fields keep DefaultBootstrapRetry
+func (c *BootstrapClient) SetRetry(p backoff.Policy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retry = p.Or(DefaultBootstrapRetry)
+}
+
 // Bootstrap performs the bootstrap operation with issuer-based URL
 // IMPORTANT: We use manual JWT parsing here due to Yaegi's incompatibility with jwt/v5
 // struct tags. See: https://github.com/traefik/yaegi/discussions/1548
@@ -91,6 +120,28 @@ func (c *BootstrapClient) Bootstrap(ctx context.Context, token string, machineID
 		return nil, err
 	}
 
+	c.mu.RLock()
+	client, retry := c.client, c.retry
+	c.mu.RUnlock()
+
+	var result *BootstrapResponse
+	err = backoff.Retry(ctx, retry, func(attempt int) error {
+		resp, err := c.post(ctx, client, bootstrapURL, body)
+		if err != nil {
+			if !retryable(ctx, err) {
+				return backoff.Permanent(err)
+			}
+			logger.Warnf("Bootstrap attempt %d/%d failed: %v", attempt+1, retry.Attempts, err)
+			return err
+		}
+		result = resp
+		return nil
+	})
+	return result, err
+}
+
+// post sends one bootstrap request
+func (c *BootstrapClient) post(ctx context.Context, client *http.Client, bootstrapURL string, body []byte) (*BootstrapResponse, error) {
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", bootstrapURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
@@ -98,7 +149,7 @@ func (c *BootstrapClient) Bootstrap(ctx context.Context, token string, machineID
 
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.client.Do(httpReq)
+	resp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
@@ -134,3 +185,16 @@ func (c *BootstrapClient) Bootstrap(ctx context.Context, token string, machineID
 
 	return &result, nil
 }
+
+// retryable reports whether a failed call may succeed when repeated.
+// Client errors other than 429 fail the same way again.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	// Use type assertion instead of errors.As to avoid Yaegi issues
+	if apiErr, ok := err.(*APIError); ok {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPClientFactory builds the HTTP client used by the API clients.
+// Tests can replace it to stub backend responses without a network.
+var HTTPClientFactory = func(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+	}
+}
+
+// TLSOptions configures TLS of outbound calls to the ELLIO API, for
+// deployments behind TLS-intercepting proxies, with a private PKI or whose
+// endpoint requires mutual TLS
+type TLSOptions struct {
+	CABundle           string // PEM file path or inline PEM of CAs trusted in addition to the system roots
+	InsecureSkipVerify bool   // Skip certificate verification, for testing only
+	MinVersion         string // Lowest accepted TLS version, "1.2" or "1.3", empty keeps the Go default
+	ClientCert         string // PEM file path or inline PEM of the client certificate chain for mutual TLS
+	ClientKey          string // PEM file path or inline PEM of the client private key
+}
+
+// TLSConfig builds the client TLS configuration, nil when no option is set
+// so the transport defaults apply
+func (o TLSOptions) TLSConfig() (*tls.Config, error) {
+	if o.CABundle == "" && !o.InsecureSkipVerify && o.MinVersion == "" && o.ClientCert == "" && o.ClientKey == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify} //nolint:gosec // Opt-in, documented as testing only
+	if o.MinVersion != "" {
+		version, err := parseTLSVersion(o.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MinVersion = version
+	}
+	if o.CABundle != "" {
+		pool, err := loadCABundle(o.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if o.ClientCert != "" || o.ClientKey != "" {
+		if o.ClientCert == "" || o.ClientKey == "" {
+			return nil, errors.New("clientCert and clientKey must be set together")
+		}
+		loader := &clientCertLoader{certSource: o.ClientCert, keySource: o.ClientKey}
+		if _, err := loader.load(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = loader.get
+	}
+	return cfg, nil
+}
+
+// parseTLSVersion accepts "1.2" or "1.3", optionally prefixed with "TLS"
+func parseTLSVersion(value string) (uint16, error) {
+	v := strings.TrimSpace(strings.ToLower(value))
+	v = strings.TrimPrefix(strings.TrimPrefix(v, "tls"), "v")
+	switch v {
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, errors.New("invalid minTLSVersion '" + value + "', expected 1.2 or 1.3")
+}
+
+// loadCABundle returns the system roots extended with the certificates of
+// bundle, a PEM file path or inline PEM
+func loadCABundle(bundle string) (*x509.CertPool, error) {
+	pem, err := readPEM(bundle, "caBundle")
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("caBundle contains no PEM certificates")
+	}
+	return pool, nil
+}
+
+// clientCertLoader supplies the mutual TLS client certificate. Files are
+// read again when their modification time changes, so certificates rotated
+// on disk are picked up by new connections without a restart.
+type clientCertLoader struct {
+	certSource string // PEM file path or inline PEM
+	keySource  string // PEM file path or inline PEM
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// get implements tls.Config.GetClientCertificate. A failed reload keeps
+// the last good certificate.
+func (l *clientCertLoader) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := l.load()
+	if err != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.cert != nil {
+			return l.cert, nil
+		}
+		return nil, err
+	}
+	return cert, nil
+}
+
+// load returns the certificate, reading the files when they changed
+func (l *clientCertLoader) load() (*tls.Certificate, error) {
+	certMod, err := pemModTime(l.certSource, "clientCert")
+	if err != nil {
+		return nil, err
+	}
+	keyMod, err := pemModTime(l.keySource, "clientKey")
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cert != nil && certMod.Equal(l.certMod) && keyMod.Equal(l.keyMod) {
+		return l.cert, nil
+	}
+	certPEM, err := readPEM(l.certSource, "clientCert")
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := readPEM(l.keySource, "clientKey")
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, errors.New("loading client certificate: " + err.Error())
+	}
+	l.cert, l.certMod, l.keyMod = &cert, certMod, keyMod
+	return l.cert, nil
+}
+
+// isInlinePEM reports whether an option holds PEM rather than a file path
+func isInlinePEM(value string) bool {
+	return strings.Contains(value, "-----BEGIN")
+}
+
+// readPEM returns inline PEM as is or reads the file it names
+func readPEM(value, option string) ([]byte, error) {
+	if isInlinePEM(value) {
+		return []byte(value), nil
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, errors.New("reading " + option + ": " + err.Error())
+	}
+	return data, nil
+}
+
+// pemModTime returns the modification time of a PEM file, zero for inline PEM
+func pemModTime(value, option string) (time.Time, error) {
+	if isInlinePEM(value) {
+		return time.Time{}, nil
+	}
+	info, err := os.Stat(value)
+	if err != nil {
+		return time.Time{}, errors.New("reading " + option + ": " + err.Error())
+	}
+	return info.ModTime(), nil
+}
+
+// ApplyTLS sets cfg on the transport of client. Clients using a custom
+// RoundTripper are left alone, a nil cfg is a no-op.
+func ApplyTLS(client *http.Client, cfg *tls.Config) {
+	if client == nil || cfg == nil {
+		return
+	}
+	switch t := client.Transport.(type) {
+	case nil:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg.Clone()
+		client.Transport = transport
+	case *http.Transport:
+		t.TLSClientConfig = cfg.Clone()
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLSOptions(t *testing.T) {
+	if cfg, err := (TLSOptions{}).TLSConfig(); cfg != nil || err != nil {
+		t.Errorf("expected no TLS config without options, got %v, %v", cfg, err)
+	}
+
+	cfg, err := TLSOptions{MinVersion: "TLS1.3"}.TLSConfig()
+	if err != nil || cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("expected TLS 1.3 minimum, got %v, %v", cfg, err)
+	}
+	for _, bad := range []TLSOptions{
+		{MinVersion: "1.1"},
+		{CABundle: filepath.Join(t.TempDir(), "missing.pem")},
+		{CABundle: "-----BEGIN CERTIFICATE-----\nnot a certificate\n-----END CERTIFICATE-----\n"},
+	} {
+		if _, err := bad.TLSConfig(); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestApplyTLSCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, bundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(opts TLSOptions) error {
+		cfg, err := opts.TLSConfig()
+		if err != nil {
+			t.Fatalf("TLSConfig failed: %v", err)
+		}
+		client := &http.Client{Timeout: 5 * time.Second}
+		ApplyTLS(client, cfg)
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(TLSOptions{MinVersion: "1.2"}); err == nil {
+		t.Error("expected the test CA to be untrusted by default")
+	}
+	if err := get(TLSOptions{CABundle: path}); err != nil {
+		t.Errorf("expected the CA bundle file to be trusted: %v", err)
+	}
+	if err := get(TLSOptions{CABundle: string(bundle)}); err != nil {
+		t.Errorf("expected the inline CA bundle to be trusted: %v", err)
+	}
+	if err := get(TLSOptions{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("expected insecureSkipVerify to connect: %v", err)
+	}
+
+	// Stubbed transports are left alone
+	stub := stubClient(http.StatusOK, "")
+	ApplyTLS(stub, &tls.Config{})
+	if _, ok := stub.Transport.(roundTripFunc); !ok {
+		t.Error("expected a custom RoundTripper to be kept")
+	}
+}
+
+// clientCertPEM returns a self-signed client certificate and its key
+func clientCertPEM(t *testing.T, name string) (certPEM, keyPEM []byte, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), cert
+}
+
+func TestApplyTLSClientCert(t *testing.T) {
+	certPEM, keyPEM, cert := clientCertPEM(t, "deployment-a")
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	var seen string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certPath, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(opts TLSOptions) error {
+		opts.InsecureSkipVerify = true
+		cfg, err := opts.TLSConfig()
+		if err != nil {
+			t.Fatalf("TLSConfig failed: %v", err)
+		}
+		client := &http.Client{Timeout: 5 * time.Second}
+		ApplyTLS(client, cfg)
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(TLSOptions{}); err == nil {
+		t.Error("expected the server to reject a client without a certificate")
+	}
+	if err := get(TLSOptions{ClientCert: certPath, ClientKey: keyPath}); err != nil || seen != "deployment-a" {
+		t.Errorf("expected the certificate files to authenticate, got %q: %v", seen, err)
+	}
+	seen = ""
+	if err := get(TLSOptions{ClientCert: string(certPEM), ClientKey: string(keyPEM)}); err != nil || seen != "deployment-a" {
+		t.Errorf("expected the inline certificate to authenticate, got %q: %v", seen, err)
+	}
+
+	for _, bad := range []TLSOptions{
+		{ClientCert: certPath},
+		{ClientKey: keyPath},
+		{ClientCert: filepath.Join(dir, "missing.crt"), ClientKey: keyPath},
+		{ClientCert: keyPath, ClientKey: certPath},
+	} {
+		if _, err := bad.TLSConfig(); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestClientCertRotation(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client.crt")
+	keyPath := filepath.Join(dir, "client.key")
+	write := func(name string, mod time.Time) {
+		t.Helper()
+		certPEM, keyPEM, _ := clientCertPEM(t, name)
+		if err := os.WriteFile(certPath, certPEM, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{certPath, keyPath} {
+			if err := os.Chtimes(path, mod, mod); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	subject := func(cert *tls.Certificate) string {
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Subject.CommonName
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("first", start)
+	loader := &clientCertLoader{certSource: certPath, keySource: keyPath}
+	cert, err := loader.get(nil)
+	if err != nil || subject(cert) != "first" {
+		t.Fatalf("expected the first certificate, got %v", err)
+	}
+
+	write("second", start.Add(time.Minute))
+	if cert, err = loader.get(nil); err != nil || subject(cert) != "second" {
+		t.Errorf("expected the rotated certificate, got %v", err)
+	}
+
+	// A broken rotation keeps the last good certificate
+	if err := os.WriteFile(keyPath, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = loader.get(nil); err != nil || subject(cert) != "second" {
+		t.Errorf("expected the last good certificate, got %v", err)
+	}
+}
@@ -2,17 +2,36 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
 )
 
+// maxConfigSize bounds config responses
+const maxConfigSize = 1 << 20
+
+// manualDecoding switches EDLConfig decoding to the map-based path
+var manualDecoding atomic.Bool
+
+// SetManualDecoding selects map-based JSON decoding for config responses.
+// Used when the runtime probe detects that struct tags are not honored.
+func SetManualDecoding(enabled bool) {
+	manualDecoding.Store(enabled)
+}
+
 // ConfigClient handles configuration API calls
 type ConfigClient struct {
 	baseURL     string
 	tokenGetter func() string
+	mu          sync.RWMutex // Guards client against reloads during calls
 	client      *http.Client
 }
 
@@ -21,12 +40,24 @@ func NewConfigClient(baseURL string, tokenGetter func() string) *ConfigClient {
 	return &ConfigClient{
 		baseURL:     baseURL,
 		tokenGetter: tokenGetter,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		client:      HTTPClientFactory(10 * time.Second),
 	}
 }
 
+// SetTLSConfig applies cfg to the HTTP client, nil keeps the defaults
+func (c *ConfigClient) SetTLSConfig(cfg *tls.Config) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ApplyTLS(c.client, cfg)
+}
+
+// SetHTTPClient overrides the HTTP client used for config calls
+func (c *ConfigClient) SetHTTPClient(client *http.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client = client
+}
+
 // GetEDLConfig fetches the EDL configuration
 func (c *ConfigClient) GetEDLConfig(ctx context.Context) (*EDLConfig, error) {
 	// Use the config URL directly as provided by bootstrap response
@@ -40,7 +71,11 @@ func (c *ConfigClient) GetEDLConfig(ctx context.Context) (*EDLConfig, error) {
 	token := c.tokenGetter()
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := c.client.Do(req)
+	c.mu.RLock()
+	client := c.client
+	c.mu.RUnlock()
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -69,10 +104,157 @@ func (c *ConfigClient) GetEDLConfig(ctx context.Context) (*EDLConfig, error) {
 		}
 	}
 
-	var config EDLConfig
-	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxConfigSize))
+	if err != nil {
+		return nil, err
+	}
+	return decodeEDLConfig(body)
+}
+
+// decodeEDLConfig decodes a config response tolerating schema changes:
+// unknown keys are ignored and logged, alternative field names are mapped
+// to the current ones and a newer schema version only warns.
+func decodeEDLConfig(body []byte) (*EDLConfig, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
 		return nil, err
 	}
+	changed, unknown := normalizeConfig(raw)
+	if len(unknown) > 0 {
+		logger.Debugf("Config response has unrecognized keys: %s", strings.Join(unknown, ", "))
+	}
+
+	var config *EDLConfig
+	if manualDecoding.Load() {
+		config = decodeEDLConfigManual(raw)
+	} else {
+		normalized := body
+		if changed {
+			var err error
+			if normalized, err = json.Marshal(raw); err != nil {
+				return nil, err
+			}
+		}
+		config = &EDLConfig{}
+		if err := json.Unmarshal(normalized, config); err != nil {
+			return nil, err
+		}
+		// The probe can miss interpreters that ignore tags only in some
+		// cases; a response with content that decoded to nothing is one
+		if implausiblyEmpty(config, raw) {
+			logger.Warn("Config decoded empty despite a populated response, switching to manual decoding")
+			manualDecoding.Store(true)
+			config = decodeEDLConfigManual(raw)
+		}
+	}
+
+	if config.SchemaVersion > ConfigSchemaVersion {
+		logger.Warnf("Config schema version %d is newer than the supported %d, unknown fields are ignored",
+			config.SchemaVersion, ConfigSchemaVersion)
+	}
+	config.RawHash = configHash(body)
+	config.UnknownKeys = unknown
+	return config, nil
+}
+
+// implausiblyEmpty reports whether a struct-decoded config lacks every
+// essential field although the response carried at least one of them
+func implausiblyEmpty(config *EDLConfig, raw map[string]interface{}) bool {
+	if config.DeploymentID != "" || config.Purpose != "" || config.UpdateFrequencySeconds != 0 || len(config.URLs.All()) > 0 {
+		return false
+	}
+	for _, key := range []string{"deployment_id", "purpose", "update_frequency_seconds", "urls"} {
+		if raw[key] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeEDLConfigManual builds an EDLConfig from a generic JSON map
+// without relying on struct tags (Yaegi workaround)
+func decodeEDLConfigManual(raw map[string]interface{}) *EDLConfig {
+	config := &EDLConfig{}
+
+	if v, ok := raw["deployment_id"].(string); ok {
+		config.DeploymentID = v
+	}
+	if v, ok := raw["purpose"].(string); ok {
+		config.Purpose = v
+	}
+	if v, ok := raw["direction"].(string); ok {
+		config.Direction = v
+	}
+	if v, ok := raw["update_frequency_seconds"].(float64); ok {
+		config.UpdateFrequencySeconds = int(v)
+	}
+	if v, ok := raw["firewall_format"].(string); ok {
+		config.FirewallFormat = v
+	}
+
+	config.URLs = decodeEDLURLs(raw["urls"])
+	config.AllowlistURLs = decodeEDLURLs(raw["allowlist_urls"])
+
+	if v, ok := raw["log_level"].(string); ok {
+		config.LogLevel = v
+	}
+	if v, ok := raw["log_level_ttl_seconds"].(float64); ok {
+		config.LogLevelTTLSeconds = int(v)
+	}
+	if v, ok := raw["schema_version"].(float64); ok {
+		config.SchemaVersion = int(v)
+	}
+
+	if features, ok := raw["features"].(map[string]interface{}); ok {
+		config.Features = make(map[string]bool, len(features))
+		for name, v := range features {
+			if on, ok := v.(bool); ok {
+				config.Features[name] = on
+			}
+		}
+	}
 
-	return &config, nil
+	if privacy, ok := raw["privacy"].(map[string]interface{}); ok {
+		config.Privacy = &PrivacyConfig{}
+		if v, ok := privacy["hash_identifiers"].(bool); ok {
+			config.Privacy.HashIdentifiers = v
+		}
+		if v, ok := privacy["salt_id"].(string); ok {
+			config.Privacy.SaltID = v
+		}
+		if v, ok := privacy["salt"].(string); ok {
+			config.Privacy.Salt = v
+		}
+		if v, ok := privacy["overlap_seconds"].(float64); ok {
+			config.Privacy.OverlapSeconds = int(v)
+		}
+	}
+
+	return config
+}
+
+// decodeEDLURLs builds EDLURLs from a decoded JSON object
+func decodeEDLURLs(v interface{}) EDLURLs {
+	var u EDLURLs
+	if urls, ok := v.(map[string]interface{}); ok {
+		u.Combined = stringList(urls["combined"])
+		u.IPv4 = stringList(urls["ipv4"])
+		u.IPv6 = stringList(urls["ipv6"])
+	}
+	return u
+}
+
+// stringList returns the strings of a decoded JSON array
+func stringList(v interface{}) []string {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
 }
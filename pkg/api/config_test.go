@@ -0,0 +1,433 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/backoff"
+)
+
+// roundTripFunc stubs an HTTP transport for tests
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubClient returns an HTTP client that always responds with the given status and body
+func stubClient(status int, body string) *http.Client {
+	return &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: status,
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Header:     make(http.Header),
+				Request:    req,
+			}, nil
+		}),
+	}
+}
+
+// testBootstrapToken is an unsigned JWT with an issuer and component type
+const testBootstrapToken = "eyJhbGciOiJub25lIn0.eyJpc3MiOiJodHRwczovL2FwaS5leGFtcGxlLmNvbSIsImNvbXBvbmVudF90eXBlIjoiZWxsaW9fdHJhZWZpa19taWRkbGV3YXJlX3BsdWdpbiJ9.sig"
+
+func TestGetEDLConfigStatusHandling(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantErr       bool
+		wantPermanent bool
+		wantDisabled  bool
+	}{
+		{
+			name:   "success",
+			status: http.StatusOK,
+			body:   `{"purpose":"blocklist","update_frequency_seconds":60,"urls":{"combined":["https://edl.example.com/list"]}}`,
+		},
+		{
+			name:          "deleted",
+			status:        http.StatusGone,
+			wantErr:       true,
+			wantPermanent: true,
+		},
+		{
+			name:         "disabled",
+			status:       http.StatusForbidden,
+			body:         "disabled",
+			wantErr:      true,
+			wantDisabled: true,
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			body:    "boom",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewConfigClient("https://api.example.com/config", func() string { return "token" })
+			client.SetHTTPClient(stubClient(tt.status, tt.body))
+
+			config, err := client.GetEDLConfig(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if IsPermanentError(err) != tt.wantPermanent {
+				t.Errorf("expected IsPermanentError=%v for %v", tt.wantPermanent, err)
+			}
+			if IsTemporaryDisabled(err) != tt.wantDisabled {
+				t.Errorf("expected IsTemporaryDisabled=%v for %v", tt.wantDisabled, err)
+			}
+			if !tt.wantErr && config.Purpose != "blocklist" {
+				t.Errorf("expected purpose 'blocklist', got %q", config.Purpose)
+			}
+		})
+	}
+}
+
+func TestBootstrapStatusHandling(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		wantErr       bool
+		wantPermanent bool
+		wantDisabled  bool
+	}{
+		{"success", http.StatusOK, false, false, false},
+		{"deleted", http.StatusGone, true, true, false},
+		{"disabled", http.StatusForbidden, true, false, true},
+		{"server error", http.StatusBadGateway, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewBootstrapClient()
+			client.SetHTTPClient(stubClient(tt.status, `{"access_token":"abc","expires_in":3600,"config_url":"https://api.example.com/config"}`))
+			client.SetRetry(backoff.Policy{Base: time.Millisecond})
+
+			resp, err := client.Bootstrap(context.Background(), testBootstrapToken, "machine")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if IsPermanentError(err) != tt.wantPermanent {
+				t.Errorf("expected IsPermanentError=%v for %v", tt.wantPermanent, err)
+			}
+			if IsTemporaryDisabled(err) != tt.wantDisabled {
+				t.Errorf("expected IsTemporaryDisabled=%v for %v", tt.wantDisabled, err)
+			}
+			if !tt.wantErr && resp.AccessToken != "abc" {
+				t.Errorf("expected access token 'abc', got %q", resp.AccessToken)
+			}
+		})
+	}
+}
+
+// TestClientSwapDuringCalls replaces the HTTP clients while calls are in
+// flight, as a configuration reload does; run with -race
+func TestClientSwapDuringCalls(t *testing.T) {
+	config := NewConfigClient("https://api.example.com/config", func() string { return "token" })
+	config.SetHTTPClient(stubClient(http.StatusOK, `{"purpose":"blocklist","urls":{"combined":[]}}`))
+	bootstrap := NewBootstrapClient()
+	bootstrap.SetHTTPClient(stubClient(http.StatusOK, `{"access_token":"abc","expires_in":3600,"config_url":"https://api.example.com/config"}`))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				config.SetHTTPClient(stubClient(http.StatusOK, `{"purpose":"blocklist","urls":{"combined":[]}}`))
+				bootstrap.SetHTTPClient(stubClient(http.StatusOK, `{"access_token":"abc","expires_in":3600,"config_url":"https://api.example.com/config"}`))
+				bootstrap.SetRetry(backoff.Policy{Attempts: 1})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := config.GetEDLConfig(context.Background()); err != nil {
+					t.Errorf("config call failed: %v", err)
+				}
+				if _, err := bootstrap.Bootstrap(context.Background(), testBootstrapToken, "machine"); err != nil {
+					t.Errorf("bootstrap call failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBootstrapRetry(t *testing.T) {
+	var calls int
+	statuses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+	client := NewBootstrapClient()
+	client.SetRetry(backoff.Policy{Base: time.Millisecond, Max: time.Millisecond})
+	client.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		status := statuses[calls]
+		calls++
+		return &http.Response{
+			StatusCode: status,
+			Body:       io.NopCloser(strings.NewReader(`{"access_token":"abc","expires_in":3600}`)),
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	})})
+
+	resp, err := client.Bootstrap(context.Background(), testBootstrapToken, "machine")
+	if err != nil || resp.AccessToken != "abc" {
+		t.Fatalf("expected success on the third attempt, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+
+	// Client errors are not retried
+	calls = 0
+	statuses = []int{http.StatusUnauthorized, http.StatusOK}
+	if _, err := client.Bootstrap(context.Background(), testBootstrapToken, "machine"); err == nil || calls != 1 {
+		t.Errorf("expected a single failed attempt on 401, got %d: %v", calls, err)
+	}
+}
+
+func TestHTTPClientFactoryTimeout(t *testing.T) {
+	original := HTTPClientFactory
+	defer func() { HTTPClientFactory = original }()
+
+	HTTPClientFactory = func(timeout time.Duration) *http.Client {
+		return &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, context.DeadlineExceeded
+			}),
+		}
+	}
+
+	client := NewConfigClient("https://api.example.com/config", func() string { return "token" })
+	_, err := client.GetEDLConfig(context.Background())
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if IsPermanentError(err) || IsTemporaryDisabled(err) {
+		t.Errorf("timeout must not be classified as deployment state: %v", err)
+	}
+}
+
+func TestGetEDLConfigPrivacy(t *testing.T) {
+	body := `{"purpose":"blocklist","urls":{"combined":["https://edl.example.com/list"]},` +
+		`"privacy":{"hash_identifiers":true,"salt_id":"s2","salt":"secret","overlap_seconds":600}}`
+
+	for _, manual := range []bool{false, true} {
+		SetManualDecoding(manual)
+		client := NewConfigClient("https://api.example.com/config", func() string { return "token" })
+		client.SetHTTPClient(stubClient(http.StatusOK, body))
+
+		config, err := client.GetEDLConfig(context.Background())
+		if err != nil {
+			t.Fatalf("manual=%v: unexpected error %v", manual, err)
+		}
+		p := config.Privacy
+		if p == nil || !p.HashIdentifiers || p.SaltID != "s2" || p.Salt != "secret" || p.OverlapSeconds != 600 {
+			t.Errorf("manual=%v: unexpected privacy config %+v", manual, p)
+		}
+	}
+	SetManualDecoding(false)
+}
+
+func TestGetEDLConfigLogLevel(t *testing.T) {
+	body := `{"purpose":"blocklist","log_level":"debug","log_level_ttl_seconds":900}`
+
+	for _, manual := range []bool{false, true} {
+		SetManualDecoding(manual)
+		client := NewConfigClient("https://api.example.com/config", func() string { return "token" })
+		client.SetHTTPClient(stubClient(http.StatusOK, body))
+
+		config, err := client.GetEDLConfig(context.Background())
+		if err != nil {
+			t.Fatalf("manual=%v: unexpected error %v", manual, err)
+		}
+		if config.LogLevel != "debug" || config.LogLevelTTLSeconds != 900 {
+			t.Errorf("manual=%v: unexpected log level %q ttl %d", manual, config.LogLevel, config.LogLevelTTLSeconds)
+		}
+	}
+	SetManualDecoding(false)
+}
+
+func TestGetEDLConfigURLs(t *testing.T) {
+	body := `{"purpose":"blocklist","urls":{"combined":["https://edl.example.com/a"],` +
+		`"ipv4":["https://edl.example.com/v4","https://edl.example.com/a"],"ipv6":["https://edl.example.com/v6"]}}`
+
+	for _, manual := range []bool{false, true} {
+		SetManualDecoding(manual)
+		client := NewConfigClient("https://api.example.com/config", func() string { return "token" })
+		client.SetHTTPClient(stubClient(http.StatusOK, body))
+
+		config, err := client.GetEDLConfig(context.Background())
+		if err != nil {
+			t.Fatalf("manual=%v: unexpected error %v", manual, err)
+		}
+		all := config.URLs.All()
+		want := []string{"https://edl.example.com/a", "https://edl.example.com/v4", "https://edl.example.com/v6"}
+		if len(all) != len(want) {
+			t.Fatalf("manual=%v: expected %v, got %v", manual, want, all)
+		}
+		for i := range want {
+			if all[i] != want[i] {
+				t.Errorf("manual=%v: expected %v, got %v", manual, want, all)
+			}
+		}
+	}
+	SetManualDecoding(false)
+}
+
+func TestGetEDLConfigAllowlistURLs(t *testing.T) {
+	body := `{"purpose":"blocklist","urls":["https://edl.example.com/block"],"allowlistUrls":["https://edl.example.com/allow"]}`
+
+	for _, manual := range []bool{false, true} {
+		SetManualDecoding(manual)
+		client := NewConfigClient("https://api.example.com/config", func() string { return "token" })
+		client.SetHTTPClient(stubClient(http.StatusOK, body))
+
+		config, err := client.GetEDLConfig(context.Background())
+		if err != nil {
+			t.Fatalf("manual=%v: unexpected error %v", manual, err)
+		}
+		if !config.Combined() {
+			t.Errorf("manual=%v: expected a combined config", manual)
+		}
+		if all := config.AllowlistURLs.All(); len(all) != 1 || all[0] != "https://edl.example.com/allow" {
+			t.Errorf("manual=%v: unexpected allowlist URLs %v", manual, all)
+		}
+		if all := config.URLs.All(); len(all) != 1 || all[0] != "https://edl.example.com/block" {
+			t.Errorf("manual=%v: unexpected blocklist URLs %v", manual, all)
+		}
+		if len(config.UnknownKeys) != 0 {
+			t.Errorf("manual=%v: unexpected unknown keys %v", manual, config.UnknownKeys)
+		}
+	}
+	SetManualDecoding(false)
+}
+
+func TestGetEDLConfigSchemaTolerance(t *testing.T) {
+	body := `{"deploymentId":"dep-1","mode":"allowlist","update_frequency":120,` +
+		`"edl_urls":["https://edl.example.com/a"],"version":2,"new_feature":{"enabled":true},` +
+		`"purpose_v2":"ignored"}`
+
+	for _, manual := range []bool{false, true} {
+		SetManualDecoding(manual)
+		client := NewConfigClient("https://api.example.com/config", func() string { return "token" })
+		client.SetHTTPClient(stubClient(http.StatusOK, body))
+
+		config, err := client.GetEDLConfig(context.Background())
+		if err != nil {
+			t.Fatalf("manual=%v: unexpected error %v", manual, err)
+		}
+		if config.DeploymentID != "dep-1" || config.Purpose != "allowlist" || config.UpdateFrequencySeconds != 120 {
+			t.Errorf("manual=%v: aliases not applied: %+v", manual, config)
+		}
+		if all := config.URLs.All(); len(all) != 1 || all[0] != "https://edl.example.com/a" {
+			t.Errorf("manual=%v: expected a bare URL list as combined, got %v", manual, all)
+		}
+		if config.SchemaVersion != 2 {
+			t.Errorf("manual=%v: expected schema version 2, got %d", manual, config.SchemaVersion)
+		}
+		if strings.Join(config.UnknownKeys, ",") != "new_feature,purpose_v2" {
+			t.Errorf("manual=%v: unexpected unknown keys %v", manual, config.UnknownKeys)
+		}
+		if config.RawHash != configHash([]byte(body)) || len(config.RawHash) != 64 {
+			t.Errorf("manual=%v: unexpected raw hash %q", manual, config.RawHash)
+		}
+	}
+	SetManualDecoding(false)
+}
+
+func TestGetEDLConfigFeatures(t *testing.T) {
+	body := `{"purpose":"blocklist","feature_flags":{"event_sampling":true,"ipv6_aggregation":"off",` +
+		`"user_agent_capture":0,"future_flag":"1","broken":{"nested":true}}}`
+
+	for _, manual := range []bool{false, true} {
+		SetManualDecoding(manual)
+		client := NewConfigClient("https://api.example.com/config", func() string { return "token" })
+		client.SetHTTPClient(stubClient(http.StatusOK, body))
+
+		config, err := client.GetEDLConfig(context.Background())
+		if err != nil {
+			t.Fatalf("manual=%v: unexpected error %v", manual, err)
+		}
+		want := map[string]bool{"event_sampling": true, "ipv6_aggregation": false, "user_agent_capture": false, "future_flag": true}
+		if !reflect.DeepEqual(config.Features, want) {
+			t.Errorf("manual=%v: expected features %v, got %v", manual, want, config.Features)
+		}
+	}
+	SetManualDecoding(false)
+
+	raw := map[string]interface{}{"features": []interface{}{"event_sampling"}}
+	if !normalizeFeatures(raw) || raw["features"] != nil {
+		t.Errorf("expected features of the wrong type to be dropped, got %v", raw)
+	}
+}
+
+func TestNormalizeConfigPrefersCanonicalKeys(t *testing.T) {
+	raw := map[string]interface{}{"purpose": "blocklist", "mode": "allowlist"}
+	changed, unknown := normalizeConfig(raw)
+	if !changed || len(unknown) != 0 {
+		t.Errorf("expected alias to be consumed, changed=%v unknown=%v", changed, unknown)
+	}
+	if raw["purpose"] != "blocklist" {
+		t.Errorf("expected the canonical key to win, got %v", raw["purpose"])
+	}
+	if _, ok := raw["mode"]; ok {
+		t.Error("expected the alias key to be removed")
+	}
+}
+
+func TestDecodeEDLConfigPathsAgree(t *testing.T) {
+	body := []byte(`{"deployment_id":"dep-1","purpose":"blocklist","direction":"inbound",` +
+		`"update_frequency_seconds":300,"firewall_format":"elliotrie",` +
+		`"urls":{"combined":["https://edl.example.com/a"],"ipv4":["https://edl.example.com/v4"],"ipv6":["https://edl.example.com/v6"]},` +
+		`"allowlist_urls":{"combined":["https://edl.example.com/allow"]},` +
+		`"privacy":{"hash_identifiers":true,"salt_id":"s1","salt":"c2FsdA==","overlap_seconds":600},` +
+		`"log_level":"debug","log_level_ttl_seconds":900,"schema_version":1,"features":{"event_sampling":false}}`)
+
+	SetManualDecoding(false)
+	structured, err := decodeEDLConfig(body)
+	if err != nil {
+		t.Fatalf("struct decode: %v", err)
+	}
+	SetManualDecoding(true)
+	manual, err := decodeEDLConfig(body)
+	SetManualDecoding(false)
+	if err != nil {
+		t.Fatalf("manual decode: %v", err)
+	}
+
+	if !reflect.DeepEqual(structured, manual) {
+		t.Errorf("decode paths disagree:\nstruct: %+v\nmanual: %+v", structured, manual)
+	}
+	if !reflect.DeepEqual(structured.Privacy, manual.Privacy) || manual.Privacy == nil {
+		t.Errorf("privacy sections disagree: %+v vs %+v", structured.Privacy, manual.Privacy)
+	}
+}
+
+func TestImplausiblyEmpty(t *testing.T) {
+	populated := map[string]interface{}{"purpose": "blocklist"}
+	if !implausiblyEmpty(&EDLConfig{}, populated) {
+		t.Error("expected an empty config from a populated response to be implausible")
+	}
+	if implausiblyEmpty(&EDLConfig{Purpose: "blocklist"}, populated) {
+		t.Error("expected a decoded config to be plausible")
+	}
+	if implausiblyEmpty(&EDLConfig{}, map[string]interface{}{"new_feature": true}) {
+		t.Error("expected an empty config from an empty response to be plausible")
+	}
+}
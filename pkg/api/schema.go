@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// ConfigSchemaVersion is the newest config API schema this plugin knows.
+// Responses without a version are treated as version 1.
+const ConfigSchemaVersion = 1
+
+// configFieldAliases maps canonical config keys to alternative names the
+// backend used or may use. An alias is only read when the canonical key
+// is absent.
+var configFieldAliases = map[string][]string{
+	"deployment_id":            {"deploymentId", "deployment"},
+	"purpose":                  {"mode", "list_type"},
+	"direction":                {"traffic_direction"},
+	"update_frequency_seconds": {"updateFrequencySeconds", "update_frequency", "refresh_seconds"},
+	"firewall_format":          {"firewallFormat", "format"},
+	"urls":                     {"edl_urls", "edlUrls"},
+	"allowlist_urls":           {"allowlistUrls"},
+	"privacy":                  {"privacy_config"},
+	"log_level":                {"logLevel"},
+	"log_level_ttl_seconds":    {"logLevelTtlSeconds", "log_level_ttl"},
+	"schema_version":           {"schemaVersion", "version"},
+	"features":                 {"feature_flags", "featureFlags", "flags"},
+}
+
+// normalizeConfig rewrites alias keys of a decoded config response to
+// their canonical names and brings urls into object form, accepting a bare
+// list or a single URL as the combined list. It reports whether raw was
+// changed and returns the keys it did not recognize, sorted.
+func normalizeConfig(raw map[string]interface{}) (changed bool, unknown []string) {
+	known := make(map[string]bool)
+	for canonical, aliases := range configFieldAliases {
+		known[canonical] = true
+		for _, alias := range aliases {
+			known[alias] = true
+			v, ok := raw[alias]
+			if !ok {
+				continue
+			}
+			if _, exists := raw[canonical]; !exists {
+				raw[canonical] = v
+			}
+			delete(raw, alias)
+			changed = true
+		}
+	}
+
+	for _, key := range []string{"urls", "allowlist_urls"} {
+		switch v := raw[key].(type) {
+		case []interface{}:
+			raw[key] = map[string]interface{}{"combined": v}
+			changed = true
+		case string:
+			raw[key] = map[string]interface{}{"combined": []interface{}{v}}
+			changed = true
+		}
+	}
+
+	if normalizeFeatures(raw) {
+		changed = true
+	}
+
+	for key := range raw {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return changed, unknown
+}
+
+// normalizeFeatures turns feature flag values given as strings or numbers
+// into booleans and drops values that are neither, so one malformed flag
+// does not fail decoding of the whole response. It reports whether raw
+// was changed.
+func normalizeFeatures(raw map[string]interface{}) bool {
+	v, ok := raw["features"]
+	if !ok {
+		return false
+	}
+	features, ok := v.(map[string]interface{})
+	if !ok {
+		logger.Warnf("Ignoring config features of unexpected type %T", v)
+		delete(raw, "features")
+		return true
+	}
+
+	changed := false
+	for name, value := range features {
+		switch flag := value.(type) {
+		case bool:
+			continue
+		case string:
+			on, err := strconv.ParseBool(strings.TrimSpace(flag))
+			if err != nil {
+				switch strings.ToLower(strings.TrimSpace(flag)) {
+				case "on", "enabled":
+					on, err = true, nil
+				case "off", "disabled":
+					on, err = false, nil
+				}
+			}
+			if err == nil {
+				features[name] = on
+				changed = true
+				continue
+			}
+		case float64:
+			features[name] = flag != 0
+			changed = true
+			continue
+		}
+		logger.Warnf("Ignoring config feature %s with invalid value %v", name, value)
+		delete(features, name)
+		changed = true
+	}
+	return changed
+}
+
+// configHash returns the hex SHA-256 of a raw config response
+func configHash(body []byte) string {
+	return hex.EncodeToString(crypto.Sum(body))
+}
@@ -6,6 +6,10 @@ type BootstrapResponse struct {
 	ExpiresIn   int    `json:"expires_in"`
 	ConfigURL   string `json:"config_url"`
 	LogsURL     string `json:"logs_url,omitempty"`
+
+	// X25519 public key (base64) events are encrypted to when encryptEvents is set
+	EventsPublicKey string `json:"events_public_key,omitempty"`
+	EventsKeyID     string `json:"events_key_id,omitempty"`
 }
 
 // EDLConfig represents the EDL configuration
@@ -16,11 +20,65 @@ type EDLConfig struct {
 	UpdateFrequencySeconds int     `json:"update_frequency_seconds"`
 	FirewallFormat         string  `json:"firewall_format"`
 	URLs                   EDLURLs `json:"urls"`
+
+	// AllowlistURLs makes the config combined: URLs is then a blocklist and
+	// both lists are evaluated together, see Combined
+	AllowlistURLs EDLURLs `json:"allowlist_urls,omitempty"`
+
+	Privacy *PrivacyConfig `json:"privacy,omitempty"` // Identifier hashing, nil keeps raw IPs in events
+
+	// Remote log level override, e.g. for support sessions; empty keeps the configured level
+	LogLevel           string `json:"log_level,omitempty"`
+	LogLevelTTLSeconds int    `json:"log_level_ttl_seconds,omitempty"` // Revert after this long, 0 keeps it while set
+
+	SchemaVersion int `json:"schema_version,omitempty"` // Config schema version, 0 when the backend sends none
+
+	// Remote feature flags by name; flags not listed keep the local configuration
+	Features map[string]bool `json:"features,omitempty"`
+
+	// Set by the client, not part of the response
+	RawHash     string   `json:"-"` // Hex SHA-256 of the response body
+	UnknownKeys []string `json:"-"` // Top-level keys this plugin does not recognize
+}
+
+// PrivacyConfig controls hashing of client identifiers in shipped events.
+// Salts are rotated by the backend: a new SaltID replaces the active salt,
+// and the previous one keeps being applied for OverlapSeconds so events
+// can be joined across the rotation boundary.
+type PrivacyConfig struct {
+	HashIdentifiers bool   `json:"hash_identifiers"`
+	SaltID          string `json:"salt_id"`
+	Salt            string `json:"salt"`
+	OverlapSeconds  int    `json:"overlap_seconds,omitempty"` // Default 3600
 }
 
 // EDLURLs contains the EDL URLs
 type EDLURLs struct {
 	Combined []string `json:"combined,omitempty"`
+	IPv4     []string `json:"ipv4,omitempty"` // Lists with only IPv4 entries
+	IPv6     []string `json:"ipv6,omitempty"` // Lists with only IPv6 entries
+}
+
+// Combined reports whether the config carries an allowlist next to a
+// blocklist, evaluated together instead of the single list of Purpose
+func (c *EDLConfig) Combined() bool {
+	return len(c.AllowlistURLs.All()) > 0
+}
+
+// All returns every EDL URL once, combined lists first
+func (u EDLURLs) All() []string {
+	var all []string
+	seen := make(map[string]bool)
+	for _, list := range [][]string{u.Combined, u.IPv4, u.IPv6} {
+		for _, url := range list {
+			if url == "" || seen[url] {
+				continue
+			}
+			seen[url] = true
+			all = append(all, url)
+		}
+	}
+	return all
 }
 
 // APIError represents an API error response
@@ -0,0 +1,139 @@
+// Package asn maps IP prefixes to the autonomous systems announcing them, so
+// EDLs can list "AS64500" style entries next to IPs and CIDR ranges.
+package asn
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
+)
+
+// ErrNoEntries is returned by Parse when no line could be parsed
+var ErrNoEntries = errors.New("no valid prefix-to-ASN entries")
+
+// Table maps prefixes to the ASN announcing them and each ASN to its
+// prefixes. It is not modified after parsing and safe for concurrent reads.
+type Table struct {
+	origin   map[netip.Prefix]uint32
+	prefixes map[uint32][]netip.Prefix
+}
+
+// ParseASN parses an "AS64500" entry, case-insensitively. Bare numbers are
+// not ASNs, they would be ambiguous with IPv4 addresses in integer form.
+func ParseASN(s string) (uint32, bool) {
+	if len(s) < 3 || !strings.EqualFold(s[:2], "AS") {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s[2:], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+// Parse reads one "<prefix> <asn>" pair per line, separated by whitespace or
+// a comma, such as "192.0.2.0/24 AS64500" or "2001:db8::/32,64501". Blank
+// lines and text after '#' are ignored. Unparseable lines are returned in
+// invalid and skipped.
+func Parse(r io.Reader) (t *Table, invalid []string, err error) {
+	t = &Table{
+		origin:   make(map[netip.Prefix]uint32),
+		prefixes: make(map[uint32][]netip.Prefix),
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) != 2 {
+			invalid = append(invalid, line)
+			continue
+		}
+		prefix, perr := locallist.ParsePrefix(fields[0])
+		number, ok := ParseASN(fields[1])
+		if !ok {
+			n, nerr := strconv.ParseUint(fields[1], 10, 32)
+			number, ok = uint32(n), nerr == nil
+		}
+		if perr != nil || !ok {
+			invalid = append(invalid, line)
+			continue
+		}
+		if _, dup := t.origin[prefix]; dup {
+			// The first origin listed wins, a prefix is indexed once
+			continue
+		}
+		t.origin[prefix] = number
+		t.prefixes[number] = append(t.prefixes[number], prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(t.origin) == 0 && len(invalid) > 0 {
+		return nil, invalid, ErrNoEntries
+	}
+	return t, invalid, nil
+}
+
+// Load parses the table file at path
+func Load(path string) (*Table, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Prefixes returns the prefixes announced by asn
+func (t *Table) Prefixes(asn uint32) []netip.Prefix {
+	if t == nil {
+		return nil
+	}
+	return t.prefixes[asn]
+}
+
+// Origin returns the ASN announcing exactly prefix
+func (t *Table) Origin(prefix netip.Prefix) (uint32, bool) {
+	if t == nil {
+		return 0, false
+	}
+	asn, ok := t.origin[prefix]
+	return asn, ok
+}
+
+// Len returns the number of prefixes in the table
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.origin)
+}
+
+// ASNs returns the number of distinct ASNs in the table
+func (t *Table) ASNs() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.prefixes)
+}
+
+// Format formats asn as an "AS64500" entry
+func Format(asn uint32) string {
+	return "AS" + strconv.FormatUint(uint64(asn), 10)
+}
@@ -0,0 +1,70 @@
+package asn
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParseASN(t *testing.T) {
+	cases := map[string]uint32{"AS64500": 64500, "as13335": 13335, "As0": 0}
+	for in, want := range cases {
+		if got, ok := ParseASN(in); !ok || got != want {
+			t.Errorf("ParseASN(%q) = %d, %v; want %d", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "AS", "64500", "AS-1", "AS4294967296", "ASN64500", "192.0.2.1"} {
+		if _, ok := ParseASN(in); ok {
+			t.Errorf("ParseASN(%q) accepted", in)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	input := `# prefix, origin
+192.0.2.0/24 AS64500
+198.51.100.0/24	64500   # tab separated, bare number
+2001:db8::/32,AS64501
+203.0.113.7 AS64502
+192.0.2.0/24 AS64999
+
+not a line
+10.0.0.0/8 ASX
+`
+	table, invalid, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invalid) != 2 {
+		t.Errorf("expected 2 invalid lines, got %q", invalid)
+	}
+	if table.Len() != 4 || table.ASNs() != 3 {
+		t.Errorf("expected 4 prefixes of 3 ASNs, got %d of %d", table.Len(), table.ASNs())
+	}
+
+	if got := table.Prefixes(64500); len(got) != 2 || got[0].String() != "192.0.2.0/24" || got[1].String() != "198.51.100.0/24" {
+		t.Errorf("unexpected prefixes of AS64500: %v", got)
+	}
+	if asn, ok := table.Origin(netip.MustParsePrefix("192.0.2.0/24")); !ok || asn != 64500 {
+		t.Errorf("first origin should win, got %d %v", asn, ok)
+	}
+	if asn, ok := table.Origin(netip.MustParsePrefix("203.0.113.7/32")); !ok || asn != 64502 {
+		t.Errorf("single address should be a host prefix, got %d %v", asn, ok)
+	}
+	if _, ok := table.Origin(netip.MustParsePrefix("192.0.2.0/25")); ok {
+		t.Error("only exact prefixes have an origin")
+	}
+
+	if _, _, err := Parse(strings.NewReader("garbage\n")); !errors.Is(err, ErrNoEntries) {
+		t.Errorf("expected ErrNoEntries, got %v", err)
+	}
+
+	var empty *Table
+	if empty.Len() != 0 || empty.Prefixes(64500) != nil {
+		t.Error("nil table should be empty")
+	}
+	if Format(64500) != "AS64500" {
+		t.Errorf("unexpected format %q", Format(64500))
+	}
+}
@@ -0,0 +1,114 @@
+// Package backoff retries calls to the ELLIO API with full-jitter
+// exponential backoff. Each delay is drawn uniformly between zero and an
+// exponentially growing cap, so replicas restarting together spread their
+// retries instead of hitting the API in lockstep.
+package backoff
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Policy bounds the retries of a call. Zero fields are filled from the
+// defaults of the call site with Or.
+type Policy struct {
+	Attempts int           // Total attempts including the first
+	Base     time.Duration // Delay cap before the first retry, doubled per retry
+	Max      time.Duration // Upper bound of the delay cap
+}
+
+// Or returns p with its zero fields taken from def
+func (p Policy) Or(def Policy) Policy {
+	if p.Attempts <= 0 {
+		p.Attempts = def.Attempts
+	}
+	if p.Base <= 0 {
+		p.Base = def.Base
+	}
+	if p.Max <= 0 {
+		p.Max = def.Max
+	}
+	return p
+}
+
+// Cap returns the upper bound of the delay before the given retry,
+// counting from 1. It is Base doubled per retry and never above Max.
+func (p Policy) Cap(retry int) time.Duration {
+	if p.Base <= 0 || retry < 1 {
+		return 0
+	}
+	max := p.Max
+	if max < p.Base {
+		max = p.Base
+	}
+	limit := p.Base
+	for i := 1; i < retry && limit < max; i++ {
+		limit *= 2
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit
+}
+
+// Delay returns a random delay in [0, Cap(retry)]
+func (p Policy) Delay(retry int) time.Duration {
+	limit := p.Cap(retry)
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+// permanentError stops Retry without further attempts
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Permanent marks an error as not worth retrying. Retry returns the
+// wrapped error unchanged.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retry calls fn until it succeeds, returns a Permanent error or the
+// attempts are used up, sleeping a jittered delay between attempts.
+// attempt counts from 0. The last error is returned, or the context error
+// when ctx ends while waiting.
+func Retry(ctx context.Context, p Policy, fn func(attempt int) error) error {
+	attempts := p.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(p.Delay(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		err = fn(attempt)
+		if err == nil {
+			return nil
+		}
+		// Use type assertion instead of errors.As to avoid Yaegi issues
+		if perm, ok := err.(*permanentError); ok {
+			return perm.err
+		}
+	}
+	return err
+}
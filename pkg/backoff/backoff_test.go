@@ -0,0 +1,109 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicyCap(t *testing.T) {
+	p := Policy{Base: time.Second, Max: 5 * time.Second}
+	want := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for retry, w := range want {
+		if got := p.Cap(retry); got != w {
+			t.Errorf("Cap(%d) = %v, want %v", retry, got, w)
+		}
+	}
+	if got := p.Cap(1000); got != 5*time.Second {
+		t.Errorf("expected a large retry to stay at Max, got %v", got)
+	}
+	if got := (Policy{Base: 3 * time.Second, Max: time.Second}).Cap(2); got != 3*time.Second {
+		t.Errorf("expected Base to win over a smaller Max, got %v", got)
+	}
+}
+
+func TestPolicyDelayJitter(t *testing.T) {
+	p := Policy{Base: 100 * time.Millisecond, Max: time.Second}
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 200; i++ {
+		d := p.Delay(3)
+		if d < 0 || d > 400*time.Millisecond {
+			t.Fatalf("delay %v outside [0, 400ms]", d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 10 {
+		t.Errorf("expected jittered delays, got %d distinct values", len(seen))
+	}
+}
+
+func TestPolicyOr(t *testing.T) {
+	def := Policy{Attempts: 3, Base: time.Second, Max: 10 * time.Second}
+	if got := (Policy{}).Or(def); got != def {
+		t.Errorf("expected defaults, got %+v", got)
+	}
+	got := Policy{Attempts: 5, Max: time.Minute}.Or(def)
+	if got.Attempts != 5 || got.Base != time.Second || got.Max != time.Minute {
+		t.Errorf("expected set fields to be kept, got %+v", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	p := Policy{Attempts: 3, Base: time.Millisecond, Max: time.Millisecond}
+	boom := errors.New("boom")
+
+	calls := 0
+	err := Retry(context.Background(), p, func(attempt int) error {
+		if attempt != calls {
+			t.Errorf("expected attempt %d, got %d", calls, attempt)
+		}
+		calls++
+		return boom
+	})
+	if err != boom || calls != 3 {
+		t.Errorf("expected 3 failed attempts, got %d: %v", calls, err)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), p, func(int) error {
+		calls++
+		if calls < 2 {
+			return boom
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("expected success on the second attempt, got %d: %v", calls, err)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), p, func(int) error {
+		calls++
+		return Permanent(boom)
+	})
+	if err != boom || calls != 1 {
+		t.Errorf("expected a permanent error to stop after one attempt, got %d: %v", calls, err)
+	}
+
+	calls = 0
+	if err := Retry(context.Background(), Policy{}, func(int) error { calls++; return boom }); err != boom || calls != 1 {
+		t.Errorf("expected a zero policy to try once, got %d: %v", calls, err)
+	}
+	if Permanent(nil) != nil {
+		t.Error("expected Permanent(nil) to be nil")
+	}
+}
+
+func TestRetryContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Retry(ctx, Policy{Attempts: 3, Base: time.Hour, Max: time.Hour}, func(int) error {
+		calls++
+		cancel()
+		return errors.New("boom")
+	})
+	if err != context.Canceled || calls != 1 {
+		t.Errorf("expected the context error after one attempt, got %d: %v", calls, err)
+	}
+}
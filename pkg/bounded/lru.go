@@ -0,0 +1,180 @@
+// Package bounded provides memory-bounded structures for per-IP tracking.
+// Every structure has a fixed ceiling, evicts or decays old state instead
+// of growing, and reports its usage through Stats.
+package bounded
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Stats reports the usage of a bounded structure
+type Stats struct {
+	Name      string `json:"name"`
+	Entries   int    `json:"entries"`   // Live entries, or non-zero counters for sketches
+	Capacity  int    `json:"capacity"`  // Configured ceiling
+	Bytes     int    `json:"bytes"`     // Approximate memory held
+	Evictions uint64 `json:"evictions"` // Entries dropped to stay under the ceiling
+	Expired   uint64 `json:"expired"`   // Entries dropped by decay
+}
+
+// approxEntryBytes estimates the cost of one LRU entry: the map slot, the
+// list element and a short IP string key
+const approxEntryBytes = 128
+
+// lruEntry is the payload of a list element
+type lruEntry struct {
+	key     string
+	value   interface{}
+	touched time.Time
+}
+
+// LRU is a least-recently-used cache with a fixed capacity. Entries not
+// touched within ttl decay and are treated as absent.
+type LRU struct {
+	mu       sync.Mutex
+	name     string
+	capacity int
+	ttl      time.Duration // Zero disables decay
+	ll       *list.List    // Front is most recently used
+	items    map[string]*list.Element
+
+	evictions uint64
+	expired   uint64
+
+	now func() time.Time // clock, replaced in tests
+}
+
+// NewLRU creates a cache holding at most capacity entries. A capacity of
+// zero or less is raised to 1.
+func NewLRU(name string, capacity int, ttl time.Duration) *LRU {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRU{
+		name:     name,
+		capacity: capacity,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Get returns the value for key and marks it recently used
+func (c *LRU) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.lookupLocked(key, c.now())
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(*lruEntry).value, true
+}
+
+// Add inserts or replaces the value for key
+func (c *LRU) Add(key string, value interface{}) {
+	c.Update(key, func(interface{}, bool) interface{} { return value })
+}
+
+// Update replaces the value for key with fn(old, found) in one step and
+// returns the new value. fn runs under the cache lock and must not call
+// back into the cache.
+func (c *LRU) Update(key string, fn func(old interface{}, found bool) interface{}) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if el, ok := c.lookupLocked(key, now); ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = fn(entry.value, true)
+		return entry.value
+	}
+
+	value := fn(nil, false)
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, touched: now})
+	for c.ll.Len() > c.capacity {
+		c.removeLocked(c.ll.Back())
+		c.evictions++
+	}
+	return value
+}
+
+// Remove deletes key
+func (c *LRU) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeLocked(el)
+	}
+}
+
+// Len returns the number of entries, including decayed ones not yet dropped
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Expire drops all decayed entries and returns how many were dropped
+func (c *LRU) Expire() int {
+	if c.ttl <= 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	dropped := 0
+	// Least recently used entries are at the back, stop at the first live one
+	for el := c.ll.Back(); el != nil; el = c.ll.Back() {
+		if now.Sub(el.Value.(*lruEntry).touched) < c.ttl {
+			break
+		}
+		c.removeLocked(el)
+		dropped++
+	}
+	c.expired += uint64(dropped)
+	return dropped
+}
+
+// Stats reports the cache usage
+func (c *LRU) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Name:      c.name,
+		Entries:   c.ll.Len(),
+		Capacity:  c.capacity,
+		Bytes:     c.ll.Len() * approxEntryBytes,
+		Evictions: c.evictions,
+		Expired:   c.expired,
+	}
+}
+
+// lookupLocked finds a live entry and moves it to the front. Decayed
+// entries are dropped.
+func (c *LRU) lookupLocked(key string, now time.Time) (*list.Element, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if c.ttl > 0 && now.Sub(entry.touched) >= c.ttl {
+		c.removeLocked(el)
+		c.expired++
+		return nil, false
+	}
+	entry.touched = now
+	c.ll.MoveToFront(el)
+	return el, true
+}
+
+func (c *LRU) removeLocked(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).key)
+}
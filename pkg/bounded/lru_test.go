@@ -0,0 +1,75 @@
+package bounded
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU("test", 2, 0)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Get("a") // b is now least recently used
+	c.Add("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Capacity != 2 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.Bytes == 0 {
+		t.Error("expected a memory estimate")
+	}
+}
+
+func TestLRUDecay(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewLRU("test", 10, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Add("old", 1)
+	now = now.Add(30 * time.Second)
+	c.Add("new", 2)
+	now = now.Add(45 * time.Second)
+
+	if _, ok := c.Get("old"); ok {
+		t.Error("expected old to have decayed")
+	}
+	if _, ok := c.Get("new"); !ok {
+		t.Error("expected new to be live")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if n := c.Expire(); n != 1 {
+		t.Errorf("expected 1 expired entry, got %d", n)
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Expired != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLRUUpdate(t *testing.T) {
+	c := NewLRU("test", 10, 0)
+	incr := func(old interface{}, found bool) interface{} {
+		if !found {
+			return 1
+		}
+		return old.(int) + 1
+	}
+	c.Update("k", incr)
+	if v := c.Update("k", incr); v != 2 {
+		t.Errorf("expected 2, got %v", v)
+	}
+	c.Remove("k")
+	if c.Len() != 0 {
+		t.Error("expected empty cache after Remove")
+	}
+}
@@ -0,0 +1,157 @@
+package bounded
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// CountMin is a count-min sketch: approximate per-key counters in fixed
+// memory. Estimates never undercount and overcount only on collisions.
+// Counters are halved every halfLife so old activity decays.
+type CountMin struct {
+	mu       sync.Mutex
+	name     string
+	width    int
+	depth    int
+	counts   []uint32 // depth rows of width counters
+	halfLife time.Duration
+	next     time.Time // next decay
+
+	decays uint64
+
+	now func() time.Time // clock, replaced in tests
+}
+
+// NewCountMin creates a sketch with depth rows of width counters. A
+// halfLife of zero or less disables decay.
+func NewCountMin(name string, width, depth int, halfLife time.Duration) *CountMin {
+	if width <= 0 {
+		width = 1
+	}
+	if depth <= 0 {
+		depth = 1
+	}
+	s := &CountMin{
+		name:     name,
+		width:    width,
+		depth:    depth,
+		counts:   make([]uint32, width*depth),
+		halfLife: halfLife,
+		now:      time.Now,
+	}
+	if halfLife > 0 {
+		s.next = s.now().Add(halfLife)
+	}
+	return s
+}
+
+// Add increments the counters for key by n and returns the new estimate
+func (s *CountMin) Add(key string, n uint32) uint32 {
+	h1, h2 := hashKey(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.decayLocked()
+	var estimate uint32
+	for row := 0; row < s.depth; row++ {
+		i := s.index(row, h1, h2)
+		if c := s.counts[i] + n; c >= s.counts[i] {
+			s.counts[i] = c
+		} else {
+			s.counts[i] = ^uint32(0) // saturate instead of wrapping
+		}
+		if row == 0 || s.counts[i] < estimate {
+			estimate = s.counts[i]
+		}
+	}
+	return estimate
+}
+
+// Estimate returns the approximate count for key
+func (s *CountMin) Estimate(key string) uint32 {
+	h1, h2 := hashKey(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.decayLocked()
+	var estimate uint32
+	for row := 0; row < s.depth; row++ {
+		if c := s.counts[s.index(row, h1, h2)]; row == 0 || c < estimate {
+			estimate = c
+		}
+	}
+	return estimate
+}
+
+// Decay halves every counter
+func (s *CountMin) Decay() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.halveLocked()
+}
+
+// Stats reports the sketch usage. Entries counts non-zero counters in the
+// first row, an upper bound on the number of distinct live keys.
+func (s *CountMin) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used := 0
+	for _, c := range s.counts[:s.width] {
+		if c > 0 {
+			used++
+		}
+	}
+	return Stats{
+		Name:     s.name,
+		Entries:  used,
+		Capacity: s.width,
+		Bytes:    len(s.counts) * 4,
+		Expired:  s.decays,
+	}
+}
+
+// decayLocked halves the counters once per elapsed halfLife
+func (s *CountMin) decayLocked() {
+	if s.halfLife <= 0 {
+		return
+	}
+	now := s.now()
+	if now.Before(s.next) {
+		return
+	}
+	periods := int64(now.Sub(s.next)/s.halfLife) + 1
+	s.next = s.next.Add(time.Duration(periods) * s.halfLife)
+	if periods > 32 {
+		periods = 32 // every counter is zero by then
+	}
+	s.shiftLocked(uint(periods))
+}
+
+func (s *CountMin) halveLocked() {
+	s.shiftLocked(1)
+}
+
+// shiftLocked divides every counter by 2^n
+func (s *CountMin) shiftLocked(n uint) {
+	for i := range s.counts {
+		s.counts[i] >>= n
+	}
+	s.decays += uint64(n)
+}
+
+// index returns the counter of key in row using double hashing
+func (s *CountMin) index(row int, h1, h2 uint32) int {
+	return row*s.width + int((h1+uint32(row)*h2)%uint32(s.width))
+}
+
+// hashKey derives the two hashes used for double hashing
+func hashKey(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
@@ -0,0 +1,61 @@
+package bounded
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCountMinEstimates(t *testing.T) {
+	s := NewCountMin("test", 1024, 4, 0)
+	for i := 0; i < 100; i++ {
+		s.Add("hot", 1)
+	}
+	for i := 0; i < 500; i++ {
+		s.Add(fmt.Sprintf("cold-%d", i), 1)
+	}
+
+	if got := s.Estimate("hot"); got < 100 {
+		t.Errorf("count-min must not undercount, got %d", got)
+	}
+	if got := s.Estimate("hot"); got > 110 {
+		t.Errorf("estimate too far off for a sparse sketch: %d", got)
+	}
+	if got := s.Estimate("missing"); got > 5 {
+		t.Errorf("expected near-zero estimate for unseen key, got %d", got)
+	}
+
+	stats := s.Stats()
+	if stats.Bytes != 1024*4*4 || stats.Capacity != 1024 || stats.Entries == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCountMinDecay(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewCountMin("test", 64, 2, time.Minute)
+	s.now = func() time.Time { return now }
+	s.next = now.Add(time.Minute)
+
+	s.Add("ip", 64)
+	now = now.Add(time.Minute)
+	if got := s.Estimate("ip"); got != 32 {
+		t.Errorf("expected one halving to 32, got %d", got)
+	}
+	now = now.Add(2 * time.Minute)
+	if got := s.Estimate("ip"); got != 8 {
+		t.Errorf("expected two more halvings to 8, got %d", got)
+	}
+	now = now.Add(time.Hour)
+	if got := s.Estimate("ip"); got != 0 {
+		t.Errorf("expected full decay, got %d", got)
+	}
+}
+
+func TestCountMinSaturates(t *testing.T) {
+	s := NewCountMin("test", 8, 1, 0)
+	s.Add("k", ^uint32(0))
+	if got := s.Add("k", 10); got != ^uint32(0) {
+		t.Errorf("expected saturation, got %d", got)
+	}
+}
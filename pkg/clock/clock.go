@@ -0,0 +1,48 @@
+// Package clock keeps scheduling correct across system clock jumps. The
+// wall clock can be stepped by NTP or an operator, and the monotonic clock
+// stops while a VM is paused or the host is suspended. Deadlines checked on
+// hot paths are kept on the monotonic clock, and work that must not be
+// late, such as refreshing a token before the backend expires it, looks at
+// both clocks.
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// epoch anchors Deadline values to the monotonic clock
+var epoch = time.Now()
+
+// Deadline is a point in time stored atomically for lock-free "is it time
+// yet" checks. Values from time.Now are compared on the monotonic clock, so
+// wall clock steps neither postpone nor hasten it. The zero value has
+// passed.
+type Deadline struct {
+	at atomic.Int64 // Nanoseconds since epoch
+}
+
+// Set schedules the deadline after d from now
+func (dl *Deadline) Set(now time.Time, d time.Duration) {
+	dl.at.Store(int64(now.Sub(epoch) + d))
+}
+
+// Passed reports whether now is at or past the deadline. A deadline more
+// than max away can only come from a clock that stepped backwards since
+// Set, e.g. times without a monotonic reading, and counts as passed.
+func (dl *Deadline) Passed(now time.Time, max time.Duration) bool {
+	left := time.Duration(dl.at.Load()) - now.Sub(epoch)
+	return left <= 0 || left > max
+}
+
+// Until returns the time left from now until t by whichever of the
+// monotonic and the wall clock is further along, so a suspended host or a
+// wall clock stepped forward brings t closer, never further away. It is
+// t.Sub(now) for times without a monotonic reading.
+func Until(now, t time.Time) time.Duration {
+	left := t.Sub(now)
+	if wall := t.Round(0).Sub(now.Round(0)); wall < left {
+		return wall
+	}
+	return left
+}
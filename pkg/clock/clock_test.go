@@ -0,0 +1,57 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadline(t *testing.T) {
+	var dl Deadline
+	now := time.Now()
+	if !dl.Passed(now, time.Minute) {
+		t.Error("expected the zero deadline to have passed")
+	}
+
+	dl.Set(now, time.Minute)
+	if dl.Passed(now, time.Minute) || dl.Passed(now.Add(59*time.Second), time.Minute) {
+		t.Error("expected the deadline to be pending within the minute")
+	}
+	if !dl.Passed(now.Add(time.Minute), time.Minute) {
+		t.Error("expected the deadline to pass after a minute")
+	}
+
+	// Wall clock times without a monotonic reading simulate clock steps
+	wall := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	dl.Set(wall, time.Minute)
+	if !dl.Passed(wall.Add(time.Hour), time.Minute) {
+		t.Error("expected a forward jump to pass the deadline")
+	}
+	if !dl.Passed(wall.Add(-24*time.Hour), time.Minute) {
+		t.Error("expected a backward jump not to postpone the deadline")
+	}
+	if dl.Passed(wall.Add(30*time.Second), time.Minute) {
+		t.Error("expected the deadline to be pending without a jump")
+	}
+}
+
+func TestUntil(t *testing.T) {
+	now := time.Now()
+	if got := Until(now, now.Add(time.Minute)); got != time.Minute {
+		t.Errorf("expected a minute, got %v", got)
+	}
+	if got := Until(now, now.Add(-time.Minute)); got != -time.Minute {
+		t.Errorf("expected a minute overdue, got %v", got)
+	}
+
+	// The wall clock is compared as well: a target whose wall time is
+	// closer than its monotonic reading says is due by the wall clock
+	target := now.Add(time.Hour)
+	if got := Until(now.Round(0).Add(2*time.Hour), target); got != -time.Hour {
+		t.Errorf("expected the wall clock to make the target overdue, got %v", got)
+	}
+
+	wall := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got := Until(wall, wall.Add(time.Hour)); got != time.Hour {
+		t.Errorf("expected an hour between wall clock times, got %v", got)
+	}
+}
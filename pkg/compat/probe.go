@@ -0,0 +1,89 @@
+package compat
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// ErrIncompatibleRuntime indicates the interpreter cannot run the plugin safely
+var ErrIncompatibleRuntime = errors.New("incompatible plugin runtime: atomic value swaps are broken, upgrade Traefik to a release with a newer Yaegi")
+
+// Result holds the outcome of the runtime probes
+type Result struct {
+	StructTagJSON bool // encoding/json honors struct tags
+	ChannelSelect bool // select picks up ready channel receives
+	AtomicValue   bool // atomic.Value round-trips pointers
+}
+
+// probeTarget is decoded with struct tags to detect broken tag handling
+type probeTarget struct {
+	ProbeField string `json:"probe_field"`
+}
+
+// probeBox is stored in an atomic.Value the same way the matcher stores its trie
+type probeBox struct {
+	value int
+}
+
+// Run executes all probes and logs an actionable message for each failure.
+// It returns ErrIncompatibleRuntime only when no compatible code path exists.
+func Run() (Result, error) {
+	result := Result{
+		StructTagJSON: probeStructTagJSON(),
+		ChannelSelect: probeChannelSelect(),
+		AtomicValue:   probeAtomicValue(),
+	}
+
+	if !result.StructTagJSON {
+		logger.Error("Runtime probe: JSON struct tags are not honored by this interpreter, " +
+			"switching to manual config decoding. Consider upgrading Traefik.")
+	}
+	if !result.ChannelSelect {
+		logger.Error("Runtime probe: channel select is unreliable in this interpreter, " +
+			"switching log shipper to polling mode. Consider upgrading Traefik.")
+	}
+	if !result.AtomicValue {
+		logger.Error("Runtime probe: atomic.Value does not round-trip pointers, " +
+			"the IP matcher cannot be updated safely. Upgrade Traefik.")
+		return result, ErrIncompatibleRuntime
+	}
+
+	logger.Tracef("Runtime probes complete - structTagJSON=%v channelSelect=%v atomicValue=%v",
+		result.StructTagJSON, result.ChannelSelect, result.AtomicValue)
+	return result, nil
+}
+
+// probeStructTagJSON checks that encoding/json maps tagged fields
+func probeStructTagJSON() bool {
+	var target probeTarget
+	if err := json.Unmarshal([]byte(`{"probe_field":"ok"}`), &target); err != nil {
+		return false
+	}
+	return target.ProbeField == "ok"
+}
+
+// probeChannelSelect checks that a ready receive wins over the default case
+func probeChannelSelect() bool {
+	ch := make(chan int, 1)
+	ch <- 1
+
+	select {
+	case v := <-ch:
+		return v == 1
+	default:
+		return false
+	}
+}
+
+// probeAtomicValue checks that atomic.Value returns the stored pointer
+func probeAtomicValue() bool {
+	var v atomic.Value
+	box := &probeBox{value: 42}
+	v.Store(box)
+
+	loaded, ok := v.Load().(*probeBox)
+	return ok && loaded == box && loaded.value == 42
+}
@@ -0,0 +1,20 @@
+package compat
+
+import "testing"
+
+func TestRunNative(t *testing.T) {
+	result, err := Run()
+	if err != nil {
+		t.Fatalf("unexpected error on native Go runtime: %v", err)
+	}
+
+	if !result.StructTagJSON {
+		t.Error("expected struct tag JSON probe to pass")
+	}
+	if !result.ChannelSelect {
+		t.Error("expected channel select probe to pass")
+	}
+	if !result.AtomicValue {
+		t.Error("expected atomic value probe to pass")
+	}
+}
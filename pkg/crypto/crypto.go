@@ -0,0 +1,149 @@
+// Package crypto is the single home of the cryptography used by the plugin.
+// Callers go through the package functions, which delegate to a Provider,
+// so FIPS-constrained deployments can swap in a validated implementation.
+// The default provider uses only the Go standard library, which Yaegi
+// interprets on every architecture Traefik is built for.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"hash"
+	"io"
+	"sync/atomic"
+)
+
+// HashSize is the size in bytes of the SHA-256 digests returned by Sum
+const HashSize = sha256.Size
+
+// PublicKey is a key agreement public key, such as the deployment events key
+type PublicKey = ecdh.PublicKey
+
+// AEAD is an authenticated cipher returned by NewAEAD
+type AEAD = cipher.AEAD
+
+// Provider supplies the primitives the plugin is built on. Implementations
+// must keep the algorithms, only the implementation may differ: hashes and
+// signatures are compared with values computed elsewhere.
+type Provider interface {
+	NewHash() hash.Hash                      // SHA-256
+	NewHMAC(key []byte) hash.Hash            // HMAC-SHA-256
+	NewAEAD(key []byte) (cipher.AEAD, error) // AES-GCM, AES-256 with a 32-byte key
+	KeyAgreement() ecdh.Curve                // Curve of the event encryption key, X25519
+	Random() io.Reader                       // Cryptographically secure random source
+}
+
+// standard is the Provider backed by the Go standard library
+type standard struct{}
+
+func (standard) NewHash() hash.Hash {
+	return sha256.New()
+}
+
+func (standard) NewHMAC(key []byte) hash.Hash {
+	return hmac.New(sha256.New, key)
+}
+
+func (standard) NewAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (standard) KeyAgreement() ecdh.Curve {
+	return ecdh.X25519()
+}
+
+func (standard) Random() io.Reader {
+	return rand.Reader
+}
+
+// Standard returns the Provider backed by the Go standard library
+func Standard() Provider {
+	return standard{}
+}
+
+// providerBox keeps atomic.Value stores of one concrete type
+type providerBox struct {
+	p Provider
+}
+
+var current atomic.Value // holds providerBox
+
+// SetProvider replaces the Provider used by the package functions, nil
+// restores Standard. It is meant to be called once at startup.
+func SetProvider(p Provider) {
+	if p == nil {
+		p = Standard()
+	}
+	current.Store(providerBox{p: p})
+}
+
+// Current returns the Provider used by the package functions
+func Current() Provider {
+	if box, ok := current.Load().(providerBox); ok {
+		return box.p
+	}
+	return Standard()
+}
+
+// NewHash returns a SHA-256 hash
+func NewHash() hash.Hash {
+	return Current().NewHash()
+}
+
+// Sum returns the SHA-256 digest of data
+func Sum(data []byte) []byte {
+	h := NewHash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NewHMAC returns an HMAC-SHA-256 keyed with key
+func NewHMAC(key []byte) hash.Hash {
+	return Current().NewHMAC(key)
+}
+
+// MAC returns the HMAC-SHA-256 of data under key
+func MAC(key, data []byte) []byte {
+	h := NewHMAC(key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Equal compares two byte slices in constant time for equal lengths
+func Equal(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// NewAEAD returns an AES-GCM cipher keyed with key
+func NewAEAD(key []byte) (cipher.AEAD, error) {
+	return Current().NewAEAD(key)
+}
+
+// KeyAgreement returns the curve of the event encryption key agreement
+func KeyAgreement() ecdh.Curve {
+	return Current().KeyAgreement()
+}
+
+// Random returns the secure random source
+func Random() io.Reader {
+	return Current().Random()
+}
+
+// RandomBytes returns n bytes from the secure random source
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(Random(), b); err != nil {
+		return nil, errors.New("reading random bytes: " + err.Error())
+	}
+	return b, nil
+}
@@ -0,0 +1,141 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"go/parser"
+	"go/token"
+	"hash"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStandardVectors(t *testing.T) {
+	// FIPS 180-2 "abc"
+	if got := hex.EncodeToString(Sum([]byte("abc"))); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("unexpected SHA-256: %s", got)
+	}
+	// RFC 4231 test case 2
+	if got := hex.EncodeToString(MAC([]byte("Jefe"), []byte("what do ya want for nothing?"))); got != "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Errorf("unexpected HMAC-SHA-256: %s", got)
+	}
+	if len(Sum(nil)) != HashSize {
+		t.Errorf("expected %d byte digests", HashSize)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	if !Equal([]byte("secret"), []byte("secret")) {
+		t.Error("expected equal slices to match")
+	}
+	if Equal([]byte("secret"), []byte("secreT")) || Equal([]byte("secret"), []byte("secret!")) {
+		t.Error("expected different slices not to match")
+	}
+}
+
+func TestAEADAndKeyAgreement(t *testing.T) {
+	key, err := RandomBytes(32)
+	if err != nil || len(key) != 32 {
+		t.Fatalf("RandomBytes failed: %v", err)
+	}
+	aead, err := NewAEAD(key)
+	if err != nil {
+		t.Fatalf("NewAEAD failed: %v", err)
+	}
+	nonce, _ := RandomBytes(aead.NonceSize())
+	plain, err := aead.Open(nil, nonce, aead.Seal(nil, nonce, []byte("events"), nil), nil)
+	if err != nil || string(plain) != "events" {
+		t.Errorf("round trip failed: %q, %v", plain, err)
+	}
+
+	a, err := KeyAgreement().GenerateKey(Random())
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	b, _ := KeyAgreement().GenerateKey(Random())
+	ab, _ := a.ECDH(b.PublicKey())
+	ba, _ := b.ECDH(a.PublicKey())
+	if !bytes.Equal(ab, ba) {
+		t.Error("expected both sides to agree on the shared secret")
+	}
+}
+
+// countingProvider wraps Standard and counts hashes created
+type countingProvider struct {
+	Provider
+	hashes int
+}
+
+func (p *countingProvider) NewHash() hash.Hash {
+	p.hashes++
+	return p.Provider.NewHash()
+}
+
+func TestSetProvider(t *testing.T) {
+	p := &countingProvider{Provider: Standard()}
+	SetProvider(p)
+	defer SetProvider(nil)
+
+	Sum([]byte("abc"))
+	if p.hashes != 1 {
+		t.Errorf("expected the custom provider to be used, got %d hashes", p.hashes)
+	}
+	if Current() != Provider(p) {
+		t.Error("expected Current to return the custom provider")
+	}
+
+	SetProvider(nil)
+	if _, ok := Current().(standard); !ok {
+		t.Error("expected nil to restore the standard provider")
+	}
+}
+
+// allowedImports are the standard library crypto packages code outside
+// pkg/crypto may import: TLS configuration, not primitives
+var allowedImports = map[string]bool{
+	"crypto/tls":  true,
+	"crypto/x509": true,
+}
+
+// TestCryptoIsolated keeps all primitives behind this package. Tests may
+// use the standard library directly to compute reference values.
+func TestCryptoIsolated(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, _ := filepath.Abs(".")
+	fset := token.NewFileSet()
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == self || info.Name() == "vendor" || strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		for _, imp := range f.Imports {
+			name, _ := strconv.Unquote(imp.Path.Value)
+			if (strings.HasPrefix(name, "crypto/") && !allowedImports[name]) || strings.HasPrefix(name, "golang.org/x/crypto") {
+				rel, _ := filepath.Rel(root, path)
+				t.Errorf("%s imports %s, use pkg/crypto instead", rel, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
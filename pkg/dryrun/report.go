@@ -0,0 +1,144 @@
+// Package dryrun accumulates would-block decisions made in monitor mode into
+// a comparison report that stakeholders can review before enforcing.
+package dryrun
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxKeys bounds the distinct prefixes, hosts and paths tracked per window
+	DefaultMaxKeys = 1000
+	// DefaultTopN is the number of entries per dimension in a summary
+	DefaultTopN = 10
+
+	otherKey = "(other)"
+)
+
+// Count is a key with its would-block count
+type Count struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// Summary is a snapshot of the report for one window
+type Summary struct {
+	Since       time.Time `json:"since"`
+	Until       time.Time `json:"until"`
+	WouldBlock  int64     `json:"would_block"`
+	TopPrefixes []Count   `json:"top_prefixes"`
+	TopHosts    []Count   `json:"top_hosts"`
+	TopPaths    []Count   `json:"top_paths"`
+}
+
+// Report counts would-block decisions by client prefix, host and path.
+// Prefixes are /24 for IPv4 and /48 for IPv6. Once a dimension holds maxKeys
+// distinct keys, new keys are counted under "(other)".
+type Report struct {
+	mu       sync.Mutex
+	since    time.Time
+	total    int64
+	prefixes map[string]int64
+	hosts    map[string]int64
+	paths    map[string]int64
+	maxKeys  int
+}
+
+// NewReport creates an empty report
+func NewReport(maxKeys int) *Report {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	r := &Report{maxKeys: maxKeys}
+	r.reset(time.Now())
+	return r
+}
+
+// Record counts a request that would have been blocked
+func (r *Report) Record(clientIP, host, path string) {
+	prefix := clientIP
+	if addr, err := netip.ParseAddr(clientIP); err == nil {
+		bits := 24
+		if !addr.Unmap().Is4() {
+			bits = 48
+		}
+		if p, err := addr.Unmap().Prefix(bits); err == nil {
+			prefix = p.String()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.total++
+	r.add(r.prefixes, prefix)
+	r.add(r.hosts, host)
+	r.add(r.paths, path)
+}
+
+// add increments key, folding new keys into otherKey once the map is full
+func (r *Report) add(counts map[string]int64, key string) {
+	if _, ok := counts[key]; !ok && len(counts) >= r.maxKeys {
+		key = otherKey
+	}
+	counts[key]++
+}
+
+// Snapshot returns the current window without resetting it
+func (r *Report) Snapshot(topN int) *Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.summary(topN, time.Now())
+}
+
+// Rotate returns the current window and starts a new one
+func (r *Report) Rotate(topN int) *Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	summary := r.summary(topN, now)
+	r.reset(now)
+	return summary
+}
+
+func (r *Report) summary(topN int, now time.Time) *Summary {
+	if topN <= 0 {
+		topN = DefaultTopN
+	}
+	return &Summary{
+		Since:       r.since,
+		Until:       now,
+		WouldBlock:  r.total,
+		TopPrefixes: top(r.prefixes, topN),
+		TopHosts:    top(r.hosts, topN),
+		TopPaths:    top(r.paths, topN),
+	}
+}
+
+func (r *Report) reset(now time.Time) {
+	r.since = now
+	r.total = 0
+	r.prefixes = make(map[string]int64)
+	r.hosts = make(map[string]int64)
+	r.paths = make(map[string]int64)
+}
+
+// top returns the n highest counts, ties ordered by key
+func top(counts map[string]int64, n int) []Count {
+	result := make([]Count, 0, len(counts))
+	for key, count := range counts {
+		result = append(result, Count{Key: key, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
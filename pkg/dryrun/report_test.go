@@ -0,0 +1,75 @@
+package dryrun
+
+import "testing"
+
+func TestReportAggregates(t *testing.T) {
+	r := NewReport(0)
+
+	r.Record("203.0.113.10", "example.com", "/login")
+	r.Record("203.0.113.99", "example.com", "/login")
+	r.Record("198.51.100.1", "api.example.com", "/")
+	r.Record("2001:db8:1:2::1", "example.com", "/admin")
+	r.Record("::ffff:203.0.113.5", "example.com", "/login")
+
+	s := r.Snapshot(2)
+	if s.WouldBlock != 5 {
+		t.Errorf("expected 5 would-block decisions, got %d", s.WouldBlock)
+	}
+	if len(s.TopPrefixes) != 2 || s.TopPrefixes[0] != (Count{"203.0.113.0/24", 3}) {
+		t.Errorf("unexpected top prefixes: %+v", s.TopPrefixes)
+	}
+	if s.TopPrefixes[1].Key != "198.51.100.0/24" {
+		t.Errorf("expected ties ordered by key, got %+v", s.TopPrefixes)
+	}
+	if s.TopHosts[0] != (Count{"example.com", 4}) {
+		t.Errorf("unexpected top hosts: %+v", s.TopHosts)
+	}
+	if s.TopPaths[0] != (Count{"/login", 3}) {
+		t.Errorf("unexpected top paths: %+v", s.TopPaths)
+	}
+
+	all := r.Snapshot(10)
+	found := false
+	for _, c := range all.TopPrefixes {
+		if c.Key == "2001:db8:1::/48" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected IPv6 /48 aggregation, got %+v", all.TopPrefixes)
+	}
+}
+
+func TestReportBoundsKeys(t *testing.T) {
+	r := NewReport(2)
+	r.Record("192.0.2.1", "a", "/1")
+	r.Record("192.0.2.1", "b", "/2")
+	r.Record("192.0.2.1", "c", "/3")
+	r.Record("192.0.2.1", "d", "/4")
+
+	s := r.Snapshot(10)
+	if len(s.TopHosts) != 3 {
+		t.Fatalf("expected 2 hosts plus other, got %+v", s.TopHosts)
+	}
+	if s.TopHosts[0] != (Count{otherKey, 2}) {
+		t.Errorf("expected overflow counted as other, got %+v", s.TopHosts)
+	}
+}
+
+func TestReportRotate(t *testing.T) {
+	r := NewReport(0)
+	r.Record("192.0.2.1", "example.com", "/")
+
+	first := r.Rotate(0)
+	if first.WouldBlock != 1 {
+		t.Errorf("expected rotated window to hold 1 decision, got %d", first.WouldBlock)
+	}
+
+	second := r.Snapshot(0)
+	if second.WouldBlock != 0 || len(second.TopHosts) != 0 {
+		t.Errorf("expected fresh window after rotate, got %+v", second)
+	}
+	if second.Since.Before(first.Until) {
+		t.Errorf("new window must start at the end of the previous one")
+	}
+}
@@ -0,0 +1,115 @@
+// Package engine is the stable Go API for embedding ELLIO EDL enforcement
+// outside of Traefik (Caddy modules, custom gateways, plain net/http services).
+//
+// An Engine bundles the token manager, EDL updater, IP matcher and log
+// shipper of one deployment. Unlike the Traefik plugin, which shares a single
+// process-wide instance between all middlewares, every call to New creates an
+// independent Engine that must be stopped by its owner.
+package engine
+
+import (
+	"errors"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+// Options configures an Engine
+type Options struct {
+	// BootstrapToken is the deployment bootstrap JWT (required)
+	BootstrapToken string
+	// MachineID identifies this host; a random ID is generated when empty
+	MachineID string
+	// ComponentTypes lists accepted JWT component types; defaults to the
+	// Traefik plugin component type
+	ComponentTypes []string
+
+	// IPStrategy, TrustedHeader and TrustedProxies describe how the embedding
+	// application extracts client IPs. They are reported with shipped events.
+	IPStrategy     string
+	TrustedHeader  string
+	TrustedProxies []string
+}
+
+// Engine evaluates client IPs against a deployment's EDL and ships block events
+type Engine struct {
+	manager *singleton.Manager
+}
+
+// New bootstraps the deployment, loads the initial EDL and starts the
+// background refresh loops. It blocks until the initial load completes.
+func New(opts Options) (*Engine, error) {
+	manager, err := singleton.NewManager(singleton.Options{
+		BootstrapToken: opts.BootstrapToken,
+		MachineID:      opts.MachineID,
+		ComponentTypes: opts.ComponentTypes,
+		IPStrategy:     opts.IPStrategy,
+		TrustedHeader:  opts.TrustedHeader,
+		TrustedProxies: opts.TrustedProxies,
+	})
+	if err != nil {
+		if manager != nil {
+			manager.Stop()
+		}
+		return nil, err
+	}
+	if manager == nil {
+		return nil, errors.New("engine: manager was not created")
+	}
+
+	return &Engine{manager: manager}, nil
+}
+
+// Enabled reports whether the deployment is active and enforcing.
+// A disabled engine allows every IP.
+func (e *Engine) Enabled() bool {
+	return e.manager.IsDeploymentEnabled()
+}
+
+// IsIPAllowed reports whether the client IP may pass according to the EDL.
+// The decision is passed to registered hooks.
+func (e *Engine) IsIPAllowed(clientIP string) (bool, error) {
+	d := e.manager.Decide(clientIP)
+	e.manager.ObserveDecision(d)
+	return d.Allowed, d.Err
+}
+
+// RegisterHooks adds lifecycle hooks for EDL updates, decisions and state
+// changes. State changes during New happen before hooks can be registered,
+// use State for the current state.
+func (e *Engine) RegisterHooks(h singleton.Hooks) {
+	e.manager.RegisterHooks(h)
+}
+
+// State returns the current engine state, one of the singleton.State constants
+func (e *Engine) State() string {
+	return e.manager.State()
+}
+
+// Mode returns the EDL mode, "blocklist" or "allowlist"
+func (e *Engine) Mode() string {
+	return e.manager.GetEDLMode()
+}
+
+// DeploymentID returns the deployment ID from the bootstrap token
+func (e *Engine) DeploymentID() string {
+	return e.manager.GetDeploymentID()
+}
+
+// DeviceID returns the machine ID reported to the backend
+func (e *Engine) DeviceID() string {
+	return e.manager.GetDeviceID()
+}
+
+// ReportBlock queues a block event for shipping. Create events with
+// logs.NewBlockEvent; ownership passes to the engine.
+func (e *Engine) ReportBlock(event *logs.BlockEvent) {
+	e.manager.SendBlockEvent(event)
+}
+
+// Stop halts background loops and flushes pending events, returning the
+// subsystems that failed to stop in time. An Engine cannot be restarted
+// after Stop.
+func (e *Engine) Stop() error {
+	return e.manager.Stop()
+}
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		errorMsg string
+	}{
+		{
+			name:     "missing bootstrap token",
+			opts:     Options{},
+			errorMsg: "bootstrap token is required",
+		},
+		{
+			name:     "malformed bootstrap token",
+			opts:     Options{BootstrapToken: "not-a-jwt"},
+			errorMsg: "invalid JWT format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.opts)
+			if err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if e != nil {
+				t.Error("expected nil engine on error")
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("expected error to contain %q, got %q", tt.errorMsg, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Package geo maps IP addresses to countries from a prefix file, one
+// "<prefix> <country>" pair per line, such as the ELLIO geo prefix export
+// or a CSV conversion of a GeoIP database.
+package geo
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
+)
+
+// ErrNoEntries is returned by Parse when no line could be parsed
+var ErrNoEntries = errors.New("no valid geo prefix entries")
+
+// entry is a prefix located in a country
+type entry struct {
+	prefix  netip.Prefix
+	country string
+}
+
+// Table looks up the country of an address. Entries are sorted and do not
+// overlap, so a lookup is a binary search. It is not modified after parsing
+// and safe for concurrent reads.
+type Table struct {
+	entries   []entry
+	countries int
+}
+
+// NormalizeCountry returns the upper-case ISO 3166-1 alpha-2 code of s, ok
+// is false when s is not two letters
+func NormalizeCountry(s string) (string, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) != 2 || s[0] < 'A' || s[0] > 'Z' || s[1] < 'A' || s[1] > 'Z' {
+		return "", false
+	}
+	return s, true
+}
+
+// Parse reads one "<prefix> <country>" pair per line, separated by
+// whitespace or a comma, such as "192.0.2.0/24 NL". Blank lines and text
+// after '#' are ignored. Unparseable lines and prefixes overlapping an
+// earlier one are returned in invalid and skipped.
+func Parse(r io.Reader) (t *Table, invalid []string, err error) {
+	var entries []entry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) != 2 {
+			invalid = append(invalid, line)
+			continue
+		}
+		prefix, perr := locallist.ParsePrefix(fields[0])
+		country, ok := NormalizeCountry(fields[1])
+		if perr != nil || !ok {
+			invalid = append(invalid, line)
+			continue
+		}
+		entries = append(entries, entry{prefix: prefix, country: country})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(entries) == 0 && len(invalid) > 0 {
+		return nil, invalid, ErrNoEntries
+	}
+
+	// Stable, so the first of overlapping entries at one address is kept
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].prefix.Addr().Less(entries[j].prefix.Addr())
+	})
+	t = &Table{entries: entries[:0]}
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if n := len(t.entries); n > 0 && t.entries[n-1].prefix.Overlaps(e.prefix) {
+			invalid = append(invalid, e.prefix.String()+" "+e.country)
+			continue
+		}
+		t.entries = append(t.entries, e)
+		if !seen[e.country] {
+			seen[e.country] = true
+			t.countries++
+		}
+	}
+	return t, invalid, nil
+}
+
+// Load parses the prefix file at path
+func Load(path string) (*Table, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Lookup returns the country of addr and the prefix it was found in
+func (t *Table) Lookup(addr netip.Addr) (string, netip.Prefix, bool) {
+	if t == nil {
+		return "", netip.Prefix{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+	// The last entry starting at or before addr is the only one that can cover it
+	i := sort.Search(len(t.entries), func(i int) bool {
+		return addr.Less(t.entries[i].prefix.Addr())
+	}) - 1
+	if i < 0 || !t.entries[i].prefix.Contains(addr) {
+		return "", netip.Prefix{}, false
+	}
+	return t.entries[i].country, t.entries[i].prefix, true
+}
+
+// Len returns the number of prefixes in the table
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.entries)
+}
+
+// Countries returns the number of distinct countries in the table
+func (t *Table) Countries() int {
+	if t == nil {
+		return 0
+	}
+	return t.countries
+}
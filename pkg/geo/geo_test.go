@@ -0,0 +1,68 @@
+package geo
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParseAndLookup(t *testing.T) {
+	input := `# prefix, country
+198.51.100.0/24 nl
+192.0.2.0/24	DE
+2001:db8::/32,US
+192.0.2.128/25 FR     # overlaps 192.0.2.0/24
+203.0.113.7 JP
+
+not a line
+10.0.0.0/8 XYZ
+`
+	table, invalid, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invalid) != 3 {
+		t.Errorf("expected 3 invalid entries, got %q", invalid)
+	}
+	if table.Len() != 4 || table.Countries() != 4 {
+		t.Errorf("expected 4 prefixes of 4 countries, got %d of %d", table.Len(), table.Countries())
+	}
+
+	for ip, want := range map[string]string{
+		"192.0.2.1":           "DE",
+		"192.0.2.200":         "DE",
+		"198.51.100.255":      "NL",
+		"::ffff:198.51.100.1": "NL",
+		"2001:db8::1":         "US",
+		"203.0.113.7":         "JP",
+		"203.0.113.8":         "",
+		"192.0.1.255":         "",
+		"10.0.0.1":            "",
+		"2001:db9::1":         "",
+	} {
+		country, prefix, ok := table.Lookup(netip.MustParseAddr(ip))
+		if country != want || ok != (want != "") || ok && !prefix.Contains(netip.MustParseAddr(ip).Unmap()) {
+			t.Errorf("Lookup(%s) = %q %s %v, want %q", ip, country, prefix, ok, want)
+		}
+	}
+
+	if _, _, err := Parse(strings.NewReader("garbage\n")); !errors.Is(err, ErrNoEntries) {
+		t.Errorf("expected ErrNoEntries, got %v", err)
+	}
+	var empty *Table
+	if _, _, ok := empty.Lookup(netip.MustParseAddr("192.0.2.1")); ok || empty.Len() != 0 {
+		t.Error("nil table should be empty")
+	}
+}
+
+func TestNormalizeCountry(t *testing.T) {
+	if c, ok := NormalizeCountry(" nl "); !ok || c != "NL" {
+		t.Errorf("expected NL, got %q %v", c, ok)
+	}
+	for _, in := range []string{"", "N", "NLD", "N1", "ü!"} {
+		if _, ok := NormalizeCountry(in); ok {
+			t.Errorf("NormalizeCountry(%q) accepted", in)
+		}
+	}
+}
@@ -7,15 +7,20 @@ import (
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/iptrie"
 )
 
-// trieData holds the trie and count together for atomic updates
+// trieData holds the tries and counts together for atomic updates
 type trieData struct {
 	trie  *iptrie.Trie
 	count int64
+
+	// Allowlist evaluated together with trie, nil unless both are loaded
+	allow      *iptrie.Trie
+	allowCount int64
 }
 
 // Matcher provides thread-safe IP address matching using lock-free reads
 type Matcher struct {
-	data atomic.Value // holds *trieData
+	data    atomic.Value  // holds *trieData
+	version atomic.Uint64 // Incremented by every update
 }
 
 // New creates a new IP matcher
@@ -49,13 +54,67 @@ func (m *Matcher) ContainsAddr(addr netip.Addr) bool {
 	return data.trie.ContainsUnsafe(addr)
 }
 
-// Update atomically replaces the IP data with new data
+// Lookup returns the entry covering addr, if any
+func (m *Matcher) Lookup(addr netip.Addr) (netip.Prefix, bool) {
+	data := m.data.Load().(*trieData)
+	return data.trie.LookupUnsafe(addr)
+}
+
+// OverlapsPrefix checks if any entry in the set covers or lies within prefix
+func (m *Matcher) OverlapsPrefix(prefix netip.Prefix) bool {
+	data := m.data.Load().(*trieData)
+	return data.trie.OverlapsUnsafe(prefix)
+}
+
+// LookupAllow returns the allowlist entry covering addr, if any
+func (m *Matcher) LookupAllow(addr netip.Addr) (netip.Prefix, bool) {
+	data := m.data.Load().(*trieData)
+	if data.allow == nil {
+		return netip.Prefix{}, false
+	}
+	return data.allow.LookupUnsafe(addr)
+}
+
+// OverlapsAllowPrefix checks if any allowlist entry covers or lies within prefix
+func (m *Matcher) OverlapsAllowPrefix(prefix netip.Prefix) bool {
+	data := m.data.Load().(*trieData)
+	return data.allow != nil && data.allow.OverlapsUnsafe(prefix)
+}
+
+// Update atomically replaces the IP data with new data, dropping any
+// allowlist
 func (m *Matcher) Update(newTrie *iptrie.Trie, count int64) {
 	// Atomic update - no locks needed
 	m.data.Store(&trieData{
 		trie:  newTrie,
 		count: count,
 	})
+	m.version.Add(1)
+}
+
+// UpdateLists atomically replaces the IP data with a blocklist and an
+// allowlist evaluated together. Lookups of either never see the other one
+// from a different update.
+func (m *Matcher) UpdateLists(block *iptrie.Trie, blockCount int64, allow *iptrie.Trie, allowCount int64) {
+	m.data.Store(&trieData{
+		trie:       block,
+		count:      blockCount,
+		allow:      allow,
+		allowCount: allowCount,
+	})
+	m.version.Add(1)
+}
+
+// Version changes with every update, so results of lookups made before it
+// changed may be stale
+func (m *Matcher) Version() uint64 {
+	return m.version.Load()
+}
+
+// AllowCount returns the number of allowlist entries, 0 without an allowlist
+func (m *Matcher) AllowCount() int64 {
+	data := m.data.Load().(*trieData)
+	return data.allowCount
 }
 
 // Count returns the number of entries in the current IP set
@@ -64,3 +123,10 @@ func (m *Matcher) Count() int64 {
 	data := m.data.Load().(*trieData)
 	return data.count
 }
+
+// Snapshot returns the current trie and its entry count. The trie is
+// read-only and stays valid after later updates.
+func (m *Matcher) Snapshot() (*iptrie.Trie, int64) {
+	data := m.data.Load().(*trieData)
+	return data.trie, data.count
+}
@@ -125,6 +125,47 @@ func TestUpdate(t *testing.T) {
 	if !matcher.Contains("172.16.1.1") {
 		t.Error("expected 172.16.1.1 to be contained after second update")
 	}
+
+	version := matcher.Version()
+	matcher.UpdateLists(trie1, 1, trie2, 2)
+	if matcher.Version() == version {
+		t.Error("expected every update to change the version")
+	}
+}
+
+func TestUpdateLists(t *testing.T) {
+	matcher := New()
+
+	block := iptrie.NewTrie()
+	block.Insert(netip.MustParsePrefix("10.0.0.0/8"))
+	allow := iptrie.NewTrie()
+	allow.Insert(netip.MustParsePrefix("10.1.0.0/16"))
+	matcher.UpdateLists(block, 1, allow, 1)
+
+	if matcher.Count() != 1 || matcher.AllowCount() != 1 {
+		t.Errorf("expected 1 blocklist and 1 allowlist entry, got %d and %d", matcher.Count(), matcher.AllowCount())
+	}
+	if prefix, ok := matcher.LookupAllow(netip.MustParseAddr("10.1.2.3")); !ok || prefix.String() != "10.1.0.0/16" {
+		t.Errorf("expected allowlist match 10.1.0.0/16, got %v %v", prefix, ok)
+	}
+	if _, ok := matcher.LookupAllow(netip.MustParseAddr("10.2.0.1")); ok {
+		t.Error("10.2.0.1 is not on the allowlist")
+	}
+	if !matcher.OverlapsAllowPrefix(netip.MustParsePrefix("10.1.2.0/24")) {
+		t.Error("expected 10.1.2.0/24 to overlap the allowlist")
+	}
+	if !matcher.Contains("10.2.0.1") {
+		t.Error("expected 10.2.0.1 on the blocklist")
+	}
+
+	// A single-list update drops the allowlist
+	matcher.Update(block, 1)
+	if matcher.AllowCount() != 0 {
+		t.Errorf("expected no allowlist entries, got %d", matcher.AllowCount())
+	}
+	if _, ok := matcher.LookupAllow(netip.MustParseAddr("10.1.2.3")); ok {
+		t.Error("expected the allowlist to be dropped")
+	}
 }
 
 func TestCount(t *testing.T) {
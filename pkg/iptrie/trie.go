@@ -209,6 +209,65 @@ func (t *Trie) ContainsUnsafe(addr netip.Addr) bool {
 	return containsV6(t.rootV6, addr)
 }
 
+// LookupUnsafe returns the shortest prefix in the trie that covers addr,
+// without locking - ONLY use when trie is read-only
+func (t *Trie) LookupUnsafe(addr netip.Addr) (netip.Prefix, bool) {
+	current := t.rootV6
+	bits := 128
+	if addr.Is4() {
+		current = t.rootV4
+		bits = 32
+	}
+	bytes := addr.As16()
+	if addr.Is4() {
+		copy(bytes[:4], bytes[12:])
+	}
+
+	for i := 0; ; i++ {
+		if current.isEnd {
+			return netip.PrefixFrom(addr.WithZone(""), i).Masked(), true
+		}
+		if i == bits {
+			return netip.Prefix{}, false
+		}
+		bit := (bytes[i/8] >> uint(7-i%8)) & 1 //nolint:G115 // i%8 < 8, result always positive
+		if current.children[bit] == nil {
+			return netip.Prefix{}, false
+		}
+		current = current.children[bit]
+	}
+}
+
+// OverlapsUnsafe reports whether any prefix in the trie covers or lies
+// within prefix, without locking - ONLY use when trie is read-only.
+// Nodes only exist on the path to inserted prefixes, so reaching a
+// non-empty node for prefix means some entry lies within it.
+func (t *Trie) OverlapsUnsafe(prefix netip.Prefix) bool {
+	prefix = prefix.Masked()
+	addr := prefix.Addr()
+	current := t.rootV6
+	if addr.Is4() {
+		current = t.rootV4
+	}
+	bytes := addr.As16()
+	if addr.Is4() {
+		copy(bytes[:4], bytes[12:])
+	}
+
+	for i := 0; i < prefix.Bits(); i++ {
+		if current.isEnd {
+			return true
+		}
+		bit := (bytes[i/8] >> uint(7-i%8)) & 1 //nolint:G115 // i%8 < 8, result always positive
+		if current.children[bit] == nil {
+			return false
+		}
+		current = current.children[bit]
+	}
+	// Only an empty root has neither an end marker nor children
+	return current.isEnd || current.children[0] != nil || current.children[1] != nil
+}
+
 // BulkLoad creates a new trie from a list of prefixes
 // ASSUMES: Input data is already sorted (IPv4 first, then IPv6, both in ascending order)
 func BulkLoad(prefixes []netip.Prefix) *Trie {
@@ -240,6 +299,43 @@ func BulkLoad(prefixes []netip.Prefix) *Trie {
 	return t
 }
 
+// Merge builds a new trie holding the prefixes of all given tries. The
+// inputs are copied, not shared, and stay unchanged. The count is the sum of
+// the input counts, so entries listed by several tries count once per trie.
+func Merge(tries ...*Trie) *Trie {
+	merged := NewTrie()
+	for _, t := range tries {
+		if t == nil {
+			continue
+		}
+		t.mu.RLock()
+		mergeNode(merged.rootV4, t.rootV4)
+		mergeNode(merged.rootV6, t.rootV6)
+		merged.count += t.count
+		t.mu.RUnlock()
+	}
+	return merged
+}
+
+// mergeNode adds the prefixes below src to dst, allocating missing nodes
+func mergeNode(dst, src *TrieNode) {
+	if src == nil {
+		return
+	}
+	if src.isEnd {
+		dst.isEnd = true
+	}
+	for bit, child := range src.children {
+		if child == nil {
+			continue
+		}
+		if dst.children[bit] == nil {
+			dst.children[bit] = &TrieNode{depth: child.depth}
+		}
+		mergeNode(dst.children[bit], child)
+	}
+}
+
 // insertV4Optimized inserts IPv4 with pre-converted value
 func insertV4Optimized(root *TrieNode, ip uint32, prefixLen int) {
 	current := root
@@ -275,3 +371,122 @@ func insertV6Optimized(root *TrieNode, high, low uint64, prefixLen int) {
 	}
 	current.isEnd = true
 }
+
+// Stats summarizes the distinct prefixes stored in a trie
+type Stats struct {
+	IPv4      int64 // Distinct IPv4 prefixes
+	IPv6      int64 // Distinct IPv6 prefixes
+	IPv4Hosts int64 // IPv4 /32 entries
+	IPv6Hosts int64 // IPv6 /128 entries
+	Nodes     int64 // Allocated nodes of both families, including the roots
+}
+
+// NodeSize approximates the heap bytes held by one trie node
+const NodeSize = 24
+
+// MemoryBytes estimates the heap held by the trie nodes
+func (s Stats) MemoryBytes() int64 {
+	return s.Nodes * NodeSize
+}
+
+// Stats walks the trie and counts its distinct prefixes. It visits every
+// node, so it is meant for load-time reporting, not the request path.
+func (t *Trie) Stats() Stats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var s Stats
+	var nodesV4, nodesV6 int64
+	s.IPv4, s.IPv4Hosts, nodesV4 = countPrefixes(t.rootV4, 32)
+	s.IPv6, s.IPv6Hosts, nodesV6 = countPrefixes(t.rootV6, 128)
+	s.Nodes = nodesV4 + nodesV6
+	return s
+}
+
+// countPrefixes counts end nodes below root, those at hostBits depth and
+// all visited nodes. Depth is tracked during the walk because the binary
+// format cannot store a node depth of 128.
+func countPrefixes(root *TrieNode, hostBits int) (total, hosts, nodes int64) {
+	if root == nil {
+		return 0, 0, 0
+	}
+	stack := []*TrieNode{root}
+	depths := []int{0}
+	for len(stack) > 0 {
+		last := len(stack) - 1
+		node, depth := stack[last], depths[last]
+		stack, depths = stack[:last], depths[:last]
+		nodes++
+		if node.isEnd {
+			total++
+			if depth == hostBits {
+				hosts++
+			}
+		}
+		for _, child := range node.children {
+			if child != nil {
+				stack = append(stack, child)
+				depths = append(depths, depth+1)
+			}
+		}
+	}
+	return total, hosts, nodes
+}
+
+// Walk calls fn for every distinct prefix in the trie until fn returns
+// false. IPv4 prefixes come first, each family in ascending address order
+// with a covering prefix before the prefixes within it, so two tries
+// holding the same prefixes always produce the same sequence.
+func (t *Trie) Walk(fn func(netip.Prefix) bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if walkPrefixes(t.rootV4, 32, fn) {
+		walkPrefixes(t.rootV6, 128, fn)
+	}
+}
+
+// walkPrefixes visits the end nodes below root in pre-order, rebuilding
+// each prefix from the path bits. It returns false when fn stopped the walk.
+func walkPrefixes(root *TrieNode, hostBits int, fn func(netip.Prefix) bool) bool {
+	if root == nil {
+		return true
+	}
+	type frame struct {
+		node  *TrieNode
+		depth int
+		bytes [16]byte
+	}
+	stack := []frame{{node: root}}
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if f.node.isEnd {
+			var addr netip.Addr
+			if hostBits == 32 {
+				addr = netip.AddrFrom4([4]byte{f.bytes[0], f.bytes[1], f.bytes[2], f.bytes[3]})
+			} else {
+				addr = netip.AddrFrom16(f.bytes)
+			}
+			if !fn(netip.PrefixFrom(addr, f.depth)) {
+				return false
+			}
+		}
+		if f.depth == hostBits {
+			continue
+		}
+		// Push the one child first so the zero child is visited first
+		for bit := 1; bit >= 0; bit-- {
+			child := f.node.children[bit]
+			if child == nil {
+				continue
+			}
+			next := frame{node: child, depth: f.depth + 1, bytes: f.bytes}
+			if bit == 1 {
+				next.bytes[f.depth/8] |= 1 << uint(7-f.depth%8) //nolint:G115 // depth%8 < 8, result always positive
+			}
+			stack = append(stack, next)
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package iptrie
 
 import (
 	"net/netip"
+	"strings"
 	"testing"
 )
 
@@ -350,3 +351,146 @@ func BenchmarkContainsIPv4Miss(b *testing.B) {
 		trie.Contains(addr)
 	}
 }
+
+func TestOverlapsUnsafe(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert(netip.MustParsePrefix("2001:db8:1:2::1234/128"))
+	trie.Insert(netip.MustParsePrefix("2001:db8:ff00::/40"))
+	trie.Insert(netip.MustParsePrefix("198.51.100.7/32"))
+
+	tests := []struct {
+		prefix string
+		want   bool
+	}{
+		{"2001:db8:1:2::/64", true},      // contains a listed /128
+		{"2001:db8:1:3::/64", false},     // neighbouring /64
+		{"2001:db8:ff12:1::/64", true},   // covered by a listed /40
+		{"2001:db8:1:2::1234/128", true}, // exact entry
+		{"198.51.100.0/24", true},
+		{"198.51.101.0/24", false},
+	}
+	for _, tt := range tests {
+		if got := trie.OverlapsUnsafe(netip.MustParsePrefix(tt.prefix)); got != tt.want {
+			t.Errorf("OverlapsUnsafe(%s) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+
+	if NewTrie().OverlapsUnsafe(netip.MustParsePrefix("::/0")) {
+		t.Error("expected an empty trie to overlap nothing")
+	}
+}
+
+func TestLookupUnsafe(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert(netip.MustParsePrefix("10.0.0.0/8"))
+	trie.Insert(netip.MustParsePrefix("10.1.0.0/16"))
+	trie.Insert(netip.MustParsePrefix("2001:db8::/32"))
+
+	tests := []struct {
+		addr string
+		want string
+		ok   bool
+	}{
+		{"10.1.2.3", "10.0.0.0/8", true}, // shortest covering prefix
+		{"11.0.0.1", "", false},
+		{"2001:db8:1::1", "2001:db8::/32", true},
+		{"2001:db9::1", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := trie.LookupUnsafe(netip.MustParseAddr(tt.addr))
+		if ok != tt.ok || (ok && got.String() != tt.want) {
+			t.Errorf("LookupUnsafe(%s) = %v %v, want %s %v", tt.addr, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	host := NewTrie()
+	host.Insert(netip.MustParsePrefix("192.0.2.1/32"))
+	if got, ok := host.LookupUnsafe(netip.MustParseAddr("192.0.2.1")); !ok || got.String() != "192.0.2.1/32" {
+		t.Errorf("expected host entry match, got %v %v", got, ok)
+	}
+}
+
+func TestTrieStats(t *testing.T) {
+	trie := NewTrie()
+	for _, p := range []string{"10.0.0.0/8", "192.0.2.1/32", "192.0.2.1/32", "2001:db8::/32", "2001:db8::1/128"} {
+		trie.Insert(netip.MustParsePrefix(p))
+	}
+
+	stats := trie.Stats()
+	// Nodes: both roots, the disjoint IPv4 paths of 8 and 32 bits and the
+	// shared 128 bit IPv6 path
+	want := Stats{IPv4: 2, IPv6: 2, IPv4Hosts: 1, IPv6Hosts: 1, Nodes: 1 + 8 + 32 + 1 + 128}
+	if stats != want {
+		t.Errorf("expected %+v, got %+v", want, stats)
+	}
+	if stats.MemoryBytes() != stats.Nodes*NodeSize {
+		t.Errorf("unexpected memory estimate %d", stats.MemoryBytes())
+	}
+	if trie.Count() != 5 {
+		t.Errorf("expected count 5 including the duplicate, got %d", trie.Count())
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := NewTrie()
+	a.Insert(netip.MustParsePrefix("10.0.0.0/8"))
+	a.Insert(netip.MustParsePrefix("192.0.2.1/32"))
+	b := NewTrie()
+	b.Insert(netip.MustParsePrefix("192.0.2.1/32"))
+	b.Insert(netip.MustParsePrefix("2001:db8::/32"))
+
+	merged := Merge(a, nil, b)
+	for _, ip := range []string{"10.1.2.3", "192.0.2.1", "2001:db8::1"} {
+		if !merged.Contains(netip.MustParseAddr(ip)) {
+			t.Errorf("expected merged trie to contain %s", ip)
+		}
+	}
+	if merged.Contains(netip.MustParseAddr("192.0.2.2")) {
+		t.Error("merged trie must not contain unlisted addresses")
+	}
+	if merged.Count() != 4 {
+		t.Errorf("expected the summed count 4, got %d", merged.Count())
+	}
+	if s := merged.Stats(); s.IPv4 != 2 || s.IPv6 != 1 {
+		t.Errorf("expected the overlapping host once, got %+v", s)
+	}
+
+	// The inputs are copied, not shared
+	merged.Insert(netip.MustParsePrefix("198.51.100.0/24"))
+	if a.Contains(netip.MustParseAddr("198.51.100.1")) || b.Contains(netip.MustParseAddr("198.51.100.1")) {
+		t.Error("inserting into the merged trie must not change the inputs")
+	}
+}
+
+func TestTrieWalk(t *testing.T) {
+	trie := NewTrie()
+	for _, p := range []string{"2001:db8::1/128", "192.0.2.1/32", "10.0.0.0/8", "10.1.0.0/16", "2001:db8::/32", "192.0.2.1/32", "0.0.0.0/0", "128.0.0.0/1"} {
+		trie.Insert(netip.MustParsePrefix(p))
+	}
+
+	var got []string
+	trie.Walk(func(prefix netip.Prefix) bool {
+		got = append(got, prefix.String())
+		return true
+	})
+	want := []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "128.0.0.0/1", "192.0.2.1/32", "2001:db8::/32", "2001:db8::1/128"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Returning false stops the walk, also across families
+	got = got[:0]
+	trie.Walk(func(prefix netip.Prefix) bool {
+		got = append(got, prefix.String())
+		return len(got) < 2
+	})
+	if len(got) != 2 {
+		t.Errorf("expected the walk to stop after 2 prefixes, got %v", got)
+	}
+
+	calls := 0
+	NewTrie().Walk(func(netip.Prefix) bool { calls++; return true })
+	if calls != 0 {
+		t.Errorf("expected no prefixes in an empty trie, got %d", calls)
+	}
+}
@@ -0,0 +1,136 @@
+package locallist
+
+import (
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/clock"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// DefaultPollInterval is how often a watched file's mtime is checked
+const DefaultPollInterval = 10 * time.Second
+
+// FileList is a List loaded from a file and reloaded when the file's
+// modification time or size changes. Change detection uses stat polling
+// (fsnotify is not available under Yaegi) triggered by lookups once the
+// poll interval has passed, so no goroutine outlives the middleware.
+type FileList struct {
+	*List
+
+	path     string
+	label    string
+	interval time.Duration
+
+	nextCheck clock.Deadline // of the next stat
+	checking  atomic.Bool    // true while a background check runs
+
+	mu      sync.Mutex // serializes reloads
+	modTime time.Time
+	size    int64
+}
+
+// NewFileList loads path and returns the list. When the initial load fails
+// the list is still returned (empty) together with the error, and keeps
+// polling so a file created later is picked up.
+func NewFileList(path, label string, interval time.Duration) (*FileList, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	f := &FileList{
+		List:     NewList(),
+		path:     path,
+		label:    label,
+		interval: interval,
+	}
+	_, err := f.Reload()
+	return f, err
+}
+
+// Contains reports whether addr is in the list, scheduling a background
+// change check when the poll interval has elapsed
+func (f *FileList) Contains(addr netip.Addr) bool {
+	_, ok := f.Lookup(addr)
+	return ok
+}
+
+// Lookup returns the prefix covering addr, scheduling a background change
+// check when the poll interval has elapsed
+func (f *FileList) Lookup(addr netip.Addr) (netip.Prefix, bool) {
+	if f.nextCheck.Passed(time.Now(), f.interval) && f.checking.CompareAndSwap(false, true) {
+		go func() {
+			defer f.checking.Store(false)
+			if _, err := f.Reload(); err != nil {
+				logger.Warnf("Failed to reload %s %s: %v", f.label, f.path, err)
+			}
+		}()
+	}
+	return f.List.Lookup(addr)
+}
+
+// Reload re-reads the file when it changed since the last load and reports
+// whether the contents were replaced. On errors the previous contents stay.
+func (f *FileList) Reload() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextCheck.Set(time.Now(), f.interval)
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	prefixes, invalid, err := Parse(file)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range invalid {
+		logger.Warnf("Skipping invalid %s entry in %s: %s", f.label, f.path, line)
+	}
+
+	added, removed := diff(f.List.Prefixes(), prefixes)
+	f.List.Replace(prefixes)
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+
+	logger.Infof("Loaded %s %s: %d entries (+%d -%d)", f.label, f.path, len(prefixes), added, removed)
+	return true, nil
+}
+
+// Path returns the watched file path
+func (f *FileList) Path() string {
+	return f.path
+}
+
+// diff counts prefixes added to and removed from old
+func diff(old, updated []netip.Prefix) (added, removed int) {
+	before := make(map[netip.Prefix]struct{}, len(old))
+	for _, p := range old {
+		before[p] = struct{}{}
+	}
+	after := make(map[netip.Prefix]struct{}, len(updated))
+	for _, p := range updated {
+		after[p] = struct{}{}
+		if _, ok := before[p]; !ok {
+			added++
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			removed++
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,88 @@
+package locallist
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileListReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewFileList(path, "local blocklist", time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !f.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Fatal("expected initial entry to match")
+	}
+
+	// Unchanged file is not reloaded
+	if changed, err := f.Reload(); changed || err != nil {
+		t.Errorf("expected no reload for unchanged file, got changed=%v err=%v", changed, err)
+	}
+
+	if err := os.WriteFile(path, []byte("198.51.100.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the mtime moves even on filesystems with coarse timestamps
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	if changed, err := f.Reload(); !changed || err != nil {
+		t.Fatalf("expected reload after change, got changed=%v err=%v", changed, err)
+	}
+	if f.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("removed entry still matches")
+	}
+	if !f.Contains(netip.MustParseAddr("198.51.100.9")) {
+		t.Error("added entry does not match")
+	}
+}
+
+func TestFileListMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.txt")
+
+	f, err := NewFileList(path, "local allowlist", time.Hour)
+	if err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	if f == nil || f.Len() != 0 {
+		t.Fatal("expected an empty list to be returned")
+	}
+
+	if err := os.WriteFile(path, []byte("192.0.2.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := f.Reload(); !changed || err != nil {
+		t.Fatalf("expected file to be picked up once created, got changed=%v err=%v", changed, err)
+	}
+	if !f.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("expected entry from late file")
+	}
+}
+
+func TestFileListKeepsContentsOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := NewFileList(path, "local blocklist", time.Hour)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Reload(); err == nil {
+		t.Fatal("expected error for removed file")
+	}
+	if !f.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("expected previous contents to be kept")
+	}
+}
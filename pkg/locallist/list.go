@@ -0,0 +1,121 @@
+// Package locallist holds operator-managed IP lists that are evaluated before
+// the EDL, loaded from files on disk and reloaded when the files change.
+package locallist
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// List is a set of prefixes that is replaced atomically, so lookups never
+// take a lock
+type List struct {
+	prefixes atomic.Value // holds []netip.Prefix
+}
+
+// NewList creates an empty list
+func NewList() *List {
+	l := &List{}
+	l.prefixes.Store([]netip.Prefix(nil))
+	return l
+}
+
+// Contains reports whether addr is covered by any prefix in the list
+func (l *List) Contains(addr netip.Addr) bool {
+	_, ok := l.Lookup(addr)
+	return ok
+}
+
+// Lookup returns the first prefix in the list that covers addr
+func (l *List) Lookup(addr netip.Addr) (netip.Prefix, bool) {
+	addr = addr.Unmap()
+	prefixes, _ := l.prefixes.Load().([]netip.Prefix)
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return prefix, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// Replace swaps the list contents
+func (l *List) Replace(prefixes []netip.Prefix) {
+	l.prefixes.Store(prefixes)
+}
+
+// Prefixes returns the current contents
+func (l *List) Prefixes() []netip.Prefix {
+	prefixes, _ := l.prefixes.Load().([]netip.Prefix)
+	return prefixes
+}
+
+// Len returns the number of prefixes in the list
+func (l *List) Len() int {
+	return len(l.Prefixes())
+}
+
+// ParsePrefix parses an IP address or CIDR range. Single addresses become
+// host prefixes (/32 or /128).
+func ParsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// WidenIPv6 returns the covering prefix of length bits for IPv6 prefixes
+// longer than bits, such as the /64 of a single address. IPv4 prefixes,
+// shorter prefixes and bits outside 1-127 are returned unchanged.
+func WidenIPv6(prefix netip.Prefix, bits int) netip.Prefix {
+	if bits <= 0 || bits >= 128 || !prefix.Addr().Is6() || prefix.Addr().Is4In6() || prefix.Bits() <= bits {
+		return prefix
+	}
+	return netip.PrefixFrom(prefix.Addr(), bits).Masked()
+}
+
+// ErrNoEntries is returned by Parse when no line could be parsed
+var ErrNoEntries = errors.New("no valid entries")
+
+// Parse reads one IP or CIDR per line. Blank lines and text after '#' are
+// ignored. Unparseable lines are returned in invalid and skipped.
+func Parse(r io.Reader) (prefixes []netip.Prefix, invalid []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		prefix, perr := ParsePrefix(line)
+		if perr != nil {
+			invalid = append(invalid, line)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(prefixes) == 0 && len(invalid) > 0 {
+		return nil, invalid, ErrNoEntries
+	}
+	return prefixes, invalid, nil
+}
@@ -0,0 +1,82 @@
+package locallist
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `# office ranges
+203.0.113.0/24
+198.51.100.7   # single host
+::ffff:192.0.2.1
+2001:db8::/32
+
+not-an-ip
+10.1.2.3/8
+`
+	prefixes, invalid, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"203.0.113.0/24", "198.51.100.7/32", "192.0.2.1/32", "2001:db8::/32", "10.0.0.0/8"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("expected %d prefixes, got %v", len(want), prefixes)
+	}
+	for i, p := range prefixes {
+		if p.String() != want[i] {
+			t.Errorf("prefix %d: expected %s, got %s", i, want[i], p)
+		}
+	}
+	if len(invalid) != 1 || invalid[0] != "not-an-ip" {
+		t.Errorf("expected one invalid line, got %v", invalid)
+	}
+}
+
+func TestParseOnlyInvalid(t *testing.T) {
+	if _, _, err := Parse(strings.NewReader("garbage\n")); err != ErrNoEntries {
+		t.Errorf("expected ErrNoEntries, got %v", err)
+	}
+	if prefixes, _, err := Parse(strings.NewReader("# empty\n")); err != nil || len(prefixes) != 0 {
+		t.Errorf("expected empty list without error, got %v %v", prefixes, err)
+	}
+}
+
+func TestListContains(t *testing.T) {
+	l := NewList()
+	if l.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("empty list must not match")
+	}
+
+	l.Replace([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")})
+	if !l.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("expected match inside prefix")
+	}
+	if !l.Contains(netip.MustParseAddr("::ffff:192.0.2.1")) {
+		t.Error("expected IPv4-mapped address to match")
+	}
+	if l.Contains(netip.MustParseAddr("192.0.3.1")) {
+		t.Error("unexpected match outside prefix")
+	}
+}
+
+func TestWidenIPv6(t *testing.T) {
+	tests := []struct {
+		prefix string
+		bits   int
+		want   string
+	}{
+		{"2001:db8:1:2::1234/128", 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:2::1234/128", 56, "2001:db8:1::/56"},
+		{"2001:db8::/48", 64, "2001:db8::/48"}, // already wider
+		{"198.51.100.7/32", 24, "198.51.100.7/32"},
+		{"2001:db8:1:2::1234/128", 0, "2001:db8:1:2::1234/128"},
+	}
+	for _, tt := range tests {
+		if got := WidenIPv6(netip.MustParsePrefix(tt.prefix), tt.bits); got.String() != tt.want {
+			t.Errorf("WidenIPv6(%s, %d) = %s, want %s", tt.prefix, tt.bits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package locallist
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/clock"
+)
+
+// evictInterval is the minimum time between lazy eviction passes
+const evictInterval = time.Minute
+
+// Entry is a list entry with an optional expiry
+type Entry struct {
+	Prefix  netip.Prefix `json:"prefix"`
+	Expires time.Time    `json:"expires"` // Zero means the entry never expires
+}
+
+// expired reports whether the entry has expired at now
+func (e Entry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// TTLList is a mutable list whose entries may expire, used for temporary
+// blocks and automatic bans. Reads use a copy-on-write snapshot and skip
+// expired entries; expired entries are dropped on writes and by a lazy
+// eviction pass at most once per evictInterval.
+type TTLList struct {
+	mu        sync.Mutex     // serializes writers
+	entries   atomic.Value   // holds []Entry
+	nextEvict clock.Deadline // of the next lazy eviction
+
+	evictEvery time.Duration    // between lazy eviction passes, 0 disables them
+	now        func() time.Time // clock, replaced in tests
+}
+
+// NewTTLList creates an empty list
+func NewTTLList() *TTLList {
+	l := &TTLList{evictEvery: evictInterval, now: time.Now}
+	l.entries.Store([]Entry(nil))
+	return l
+}
+
+// Add inserts or replaces the entry for prefix. A ttl of zero or less makes
+// the entry permanent.
+func (l *TTLList) Add(prefix netip.Prefix, ttl time.Duration) Entry {
+	entry := Entry{Prefix: prefix.Masked()}
+	if ttl > 0 {
+		entry.Expires = l.now().Add(ttl)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	current := l.load()
+	updated := make([]Entry, 0, len(current)+1)
+	for _, e := range current {
+		if e.Prefix != entry.Prefix && !e.expired(now) {
+			updated = append(updated, e)
+		}
+	}
+	l.entries.Store(append(updated, entry))
+	return entry
+}
+
+// Remove deletes the entry for prefix and reports whether it was present
+func (l *TTLList) Remove(prefix netip.Prefix) bool {
+	prefix = prefix.Masked()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	current := l.load()
+	updated := make([]Entry, 0, len(current))
+	found := false
+	for _, e := range current {
+		if e.Prefix == prefix {
+			found = !e.expired(now)
+			continue
+		}
+		if !e.expired(now) {
+			updated = append(updated, e)
+		}
+	}
+	l.entries.Store(updated)
+	return found
+}
+
+// Contains reports whether an unexpired entry covers addr
+func (l *TTLList) Contains(addr netip.Addr) bool {
+	_, ok := l.Lookup(addr)
+	return ok
+}
+
+// Lookup returns the first unexpired entry prefix that covers addr
+func (l *TTLList) Lookup(addr netip.Addr) (netip.Prefix, bool) {
+	now := l.now()
+	if l.evictEvery > 0 && l.nextEvict.Passed(now, l.evictEvery) {
+		l.nextEvict.Set(now, l.evictEvery)
+		go l.Evict()
+	}
+
+	addr = addr.Unmap()
+	for _, e := range l.load() {
+		if e.Prefix.Contains(addr) && !e.expired(now) {
+			return e.Prefix, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// Evict removes expired entries and returns how many were dropped
+func (l *TTLList) Evict() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	current := l.load()
+	updated := make([]Entry, 0, len(current))
+	for _, e := range current {
+		if !e.expired(now) {
+			updated = append(updated, e)
+		}
+	}
+	if len(updated) == len(current) {
+		return 0
+	}
+	l.entries.Store(updated)
+	return len(current) - len(updated)
+}
+
+// Entries returns the unexpired entries
+func (l *TTLList) Entries() []Entry {
+	now := l.now()
+	current := l.load()
+	result := make([]Entry, 0, len(current))
+	for _, e := range current {
+		if !e.expired(now) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Len returns the number of unexpired entries
+func (l *TTLList) Len() int {
+	return len(l.Entries())
+}
+
+func (l *TTLList) load() []Entry {
+	entries, _ := l.entries.Load().([]Entry)
+	return entries
+}
+
+// Overlay is the runtime allow/block overlay managed through the admin API.
+// It is evaluated before the EDL together with the local list files.
+type Overlay struct {
+	Allow *TTLList
+	Block *TTLList
+}
+
+// NewOverlay creates an empty overlay
+func NewOverlay() *Overlay {
+	return &Overlay{Allow: NewTTLList(), Block: NewTTLList()}
+}
+
+// List returns the overlay list by name ("allow" or "block"), nil otherwise
+func (o *Overlay) List(name string) *TTLList {
+	switch name {
+	case "allow":
+		return o.Allow
+	case "block":
+		return o.Block
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package locallist
+
+import (
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTTLListExpiry(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewTTLList()
+	l.now = func() time.Time { return clock }
+	l.evictEvery = 0 // evict explicitly, not from a background pass
+
+	l.Add(netip.MustParsePrefix("192.0.2.0/24"), time.Minute)
+	l.Add(netip.MustParsePrefix("198.51.100.7/32"), 0)
+
+	if !l.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("expected temporary entry to match before expiry")
+	}
+	if l.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", l.Len())
+	}
+
+	clock = clock.Add(time.Minute)
+	if l.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("expected entry to stop matching at expiry")
+	}
+	if !l.Contains(netip.MustParseAddr("198.51.100.7")) {
+		t.Error("expected permanent entry to keep matching")
+	}
+	if l.Len() != 1 {
+		t.Errorf("expected expired entry hidden from Entries, got %d", l.Len())
+	}
+	if n := l.Evict(); n != 1 {
+		t.Errorf("expected 1 evicted entry, got %d", n)
+	}
+}
+
+func TestTTLListReplaceAndRemove(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewTTLList()
+	l.now = func() time.Time { return clock }
+	l.evictEvery = 0 // evict explicitly, not from a background pass
+
+	// Re-adding an entry replaces its TTL; prefixes are masked
+	l.Add(netip.MustParsePrefix("192.0.2.5/24"), time.Minute)
+	entry := l.Add(netip.MustParsePrefix("192.0.2.0/24"), time.Hour)
+	if entry.Prefix.String() != "192.0.2.0/24" || !entry.Expires.Equal(clock.Add(time.Hour)) {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+	if l.Len() != 1 {
+		t.Fatalf("expected replacement, got %d entries", l.Len())
+	}
+
+	if !l.Remove(netip.MustParsePrefix("192.0.2.0/24")) {
+		t.Error("expected removal to report presence")
+	}
+	if l.Remove(netip.MustParsePrefix("192.0.2.0/24")) {
+		t.Error("expected second removal to report absence")
+	}
+	if l.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("removed entry still matches")
+	}
+
+	// Expired entries count as absent
+	l.Add(netip.MustParsePrefix("203.0.113.0/24"), time.Second)
+	clock = clock.Add(time.Second)
+	if l.Remove(netip.MustParsePrefix("203.0.113.0/24")) {
+		t.Error("expected expired entry to count as absent")
+	}
+}
+
+func TestTTLListEvictionAfterClockJump(t *testing.T) {
+	// Background passes read the clock, so it is shared atomically
+	var clock atomic.Int64
+	clock.Store(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano())
+	l := NewTTLList()
+	l.now = func() time.Time { return time.Unix(0, clock.Load()) }
+
+	// The first lookup schedules the next pass a minute ahead
+	l.Contains(netip.MustParseAddr("198.51.100.1"))
+	if l.nextEvict.Passed(l.now(), l.evictEvery) {
+		t.Fatal("expected the next pass to be scheduled")
+	}
+
+	// A clock stepped back a day must not postpone eviction by a day
+	clock.Add(int64(-24 * time.Hour))
+	if !l.nextEvict.Passed(l.now(), l.evictEvery) {
+		t.Fatal("expected a backward jump to make the eviction pass due")
+	}
+	l.Contains(netip.MustParseAddr("198.51.100.1"))
+	if l.nextEvict.Passed(l.now(), l.evictEvery) {
+		t.Error("expected the next pass to be rescheduled from the stepped clock")
+	}
+}
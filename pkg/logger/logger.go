@@ -89,6 +89,12 @@ func Tracef(format string, args ...interface{}) {
 	}
 }
 
+// ForceTracef logs a formatted trace message regardless of the log level,
+// for selectively traced requests
+func ForceTracef(format string, args ...interface{}) {
+	log.Printf("%s [TRACE] "+format, append([]interface{}{getTimestamp()}, args...)...)
+}
+
 // Debug logs a debug message
 func Debug(args ...interface{}) {
 	if shouldLog(DebugLevel) {
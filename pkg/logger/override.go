@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Runtime level overrides take precedence over the configured level until
+// they are cleared or their TTL expires
+var (
+	overrideMu      sync.Mutex
+	configuredLevel = InfoLevel
+	overridden      bool
+	overrideExpires time.Time   // Zero when the override does not expire
+	overrideTimer   *time.Timer // Reverts the override, nil without a TTL
+)
+
+var levelNames = [...]string{"trace", "debug", "info", "warn", "error"}
+
+// String returns the lowercase name of the level
+func (l LogLevel) String() string {
+	if l < TraceLevel || l > ErrorLevel {
+		return "unknown"
+	}
+	return levelNames[l]
+}
+
+// GetLevel returns the level in effect
+func GetLevel() LogLevel {
+	return LogLevel(currentLevel.Load())
+}
+
+// Configure sets the configured level. An active override stays in effect
+// and the configured level applies once it ends.
+func Configure(level LogLevel) {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	configuredLevel = level
+	if !overridden {
+		SetLevel(level)
+	}
+}
+
+// Override switches the level at runtime. A positive ttl reverts to the
+// configured level afterwards, otherwise the override lasts until cleared.
+func Override(level LogLevel, ttl time.Duration, source string) {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+
+	stopOverrideTimer()
+	previous := GetLevel()
+	overridden = true
+	overrideExpires = time.Time{}
+	if ttl > 0 {
+		overrideExpires = time.Now().Add(ttl)
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			overrideMu.Lock()
+			defer overrideMu.Unlock()
+			if overrideTimer == timer {
+				overrideTimer = nil
+				revertLocked("expired")
+			}
+		})
+		overrideTimer = timer
+	}
+	SetLevel(level)
+	printChange("Log level changed from %s to %s by %s (ttl=%v)", previous, level, source, ttl)
+}
+
+// ClearOverride reverts to the configured level
+func ClearOverride(source string) {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	if overridden {
+		stopOverrideTimer()
+		revertLocked("cleared by " + source)
+	}
+}
+
+// OverrideState reports whether an override is active and when it expires
+func OverrideState() (configured LogLevel, active bool, expires time.Time) {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	return configuredLevel, overridden, overrideExpires
+}
+
+func stopOverrideTimer() {
+	if overrideTimer != nil {
+		overrideTimer.Stop()
+		overrideTimer = nil
+	}
+}
+
+// revertLocked ends the override, overrideMu must be held
+func revertLocked(reason string) {
+	overridden = false
+	overrideExpires = time.Time{}
+	previous := GetLevel()
+	SetLevel(configuredLevel)
+	printChange("Log level reverted from %s to configured %s (%s)", previous, configuredLevel, reason)
+}
+
+// printChange logs a level change regardless of the level, so switching to
+// a quieter level is still recorded
+func printChange(format string, args ...interface{}) {
+	log.Printf("%s [INFO] "+format, append([]interface{}{getTimestamp()}, args...)...)
+}
@@ -22,6 +22,41 @@ func NewRingBuffer(capacity int) *RingBuffer {
 	}
 }
 
+// Capacity returns the number of events the buffer holds at most
+func (rb *RingBuffer) Capacity() int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.capacity
+}
+
+// Resize changes the capacity, keeping the newest events that fit. The
+// events that no longer fit are returned.
+func (rb *RingBuffer) Resize(capacity int) []*BlockEvent {
+	if capacity <= 0 {
+		return nil
+	}
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	events := make([]*BlockEvent, 0, rb.size)
+	for i := 0; i < rb.size; i++ {
+		events = append(events, rb.buffer[(rb.head+i)%rb.capacity])
+	}
+	var evicted []*BlockEvent
+	if len(events) > capacity {
+		evicted = events[:len(events)-capacity]
+		events = events[len(events)-capacity:]
+	}
+
+	rb.buffer = make([]*BlockEvent, capacity)
+	copy(rb.buffer, events)
+	rb.capacity = capacity
+	rb.head = 0
+	rb.size = len(events)
+	rb.tail = rb.size % capacity
+	return evicted
+}
+
 // Add adds an event to the buffer
 func (rb *RingBuffer) Add(event *BlockEvent) bool {
 	rb.mu.Lock()
@@ -0,0 +1,120 @@
+package logs
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultDedupMaxEntries bounds the client IPs with a pending event
+const defaultDedupMaxEntries = 10000
+
+// dedupSlot is a pending event key in arrival order. All windows have the
+// same length, so arrival order is also expiry order.
+type dedupSlot struct {
+	key     string
+	expires time.Time
+}
+
+// Deduplicator collapses repeated block events of one client IP within a
+// window into the first of them, which is held until the window ends and
+// then carries the number of blocks in Count. Request fields are those of
+// the first block. When maxEntries IPs are pending, events of new IPs pass
+// through unchanged instead of growing the table.
+type Deduplicator struct {
+	window     time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	pending map[string]*BlockEvent // Held events keyed by event type and client IP
+	order   []dedupSlot
+	merged  int64 // Events collapsed into a held one
+
+	now func() time.Time // clock, replaced in tests
+}
+
+// NewDeduplicator creates a deduplicator, nil when window is not positive
+func NewDeduplicator(window time.Duration, maxEntries int) *Deduplicator {
+	if window <= 0 {
+		return nil
+	}
+	if maxEntries <= 0 {
+		maxEntries = defaultDedupMaxEntries
+	}
+	return &Deduplicator{
+		window:     window,
+		maxEntries: maxEntries,
+		pending:    make(map[string]*BlockEvent),
+		now:        time.Now,
+	}
+}
+
+// dedupable reports whether an event is a block of a known client
+func dedupable(event *BlockEvent) bool {
+	switch event.EventType {
+	case "access_blocked", "access_would_block":
+		return event.Client.IP != ""
+	}
+	return false
+}
+
+// Add takes the event when it can be deduplicated and reports whether it
+// did. Taken events are either held or merged into a held one and returned
+// to the pool; the caller ships events that were not taken.
+func (d *Deduplicator) Add(event *BlockEvent) bool {
+	if d == nil || !dedupable(event) {
+		return false
+	}
+	key := event.EventType + "\x00" + event.Client.IP
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if held, ok := d.pending[key]; ok {
+		held.Count++
+		d.merged++
+		ReturnToPool(event)
+		return true
+	}
+	if len(d.pending) >= d.maxEntries {
+		return false
+	}
+	event.Count = 1
+	d.pending[key] = event
+	d.order = append(d.order, dedupSlot{key: key, expires: d.now().Add(d.window)})
+	return true
+}
+
+// Expired removes and returns the held events whose window has ended, or
+// all of them
+func (d *Deduplicator) Expired(all bool) []*BlockEvent {
+	if d == nil {
+		return nil
+	}
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for n < len(d.order) && (all || !now.Before(d.order[n].expires)) {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	events := make([]*BlockEvent, 0, n)
+	for _, slot := range d.order[:n] {
+		events = append(events, d.pending[slot.key])
+		delete(d.pending, slot.key)
+	}
+	d.order = append(d.order[:0:0], d.order[n:]...)
+	return events
+}
+
+// Stats returns the number of held events and of events merged into them
+func (d *Deduplicator) Stats() (pending int, merged int64) {
+	if d == nil {
+		return 0, 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending), d.merged
+}
@@ -0,0 +1,140 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeduplicator(t *testing.T) {
+	if NewDeduplicator(0, 0) != nil {
+		t.Fatal("expected no deduplicator without a window")
+	}
+	var disabled *Deduplicator
+	if disabled.Add(NewBlockEvent("192.0.2.1", "", "GET", "example.com", "/", "https", "", "blocklist")) || disabled.Expired(true) != nil {
+		t.Error("expected a nil deduplicator to pass events through")
+	}
+
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDeduplicator(time.Minute, 2)
+	d.now = func() time.Time { return clock }
+
+	first := NewBlockEvent("192.0.2.1", "", "GET", "example.com", "/first", "https", "", "blocklist")
+	if !d.Add(first) {
+		t.Fatal("expected the first block to be held")
+	}
+	for i := 0; i < 4; i++ {
+		if !d.Add(NewBlockEvent("192.0.2.1", "", "GET", "example.com", "/again", "https", "", "blocklist")) {
+			t.Fatal("expected repeated blocks to be merged")
+		}
+	}
+	// Other event types and IPs are not merged into the held block
+	if d.Add(NewAllowEvent("192.0.2.1", "", "GET", "example.com", "/", "https", "", "blocklist")) {
+		t.Error("expected allow events to pass through")
+	}
+	monitor := NewBlockEvent("192.0.2.1", "", "GET", "example.com", "/", "https", "", "blocklist")
+	monitor.MarkWouldBlock()
+	if !d.Add(monitor) {
+		t.Error("expected would-block events to be held separately")
+	}
+	// The table is full, a third key passes through
+	if d.Add(NewBlockEvent("198.51.100.1", "", "GET", "example.com", "/", "https", "", "blocklist")) {
+		t.Error("expected events of new IPs to pass through when the table is full")
+	}
+
+	clock = clock.Add(59 * time.Second)
+	if events := d.Expired(false); len(events) != 0 {
+		t.Fatalf("expected nothing to expire within the window, got %d", len(events))
+	}
+	clock = clock.Add(time.Second)
+	events := d.Expired(false)
+	if len(events) != 2 || events[0] != first {
+		t.Fatalf("expected both held events after the window, got %d", len(events))
+	}
+	if first.Count != 5 || first.Request.Path != "/first" || events[1].Count != 1 {
+		t.Errorf("expected the first block to carry count 5, got %d on %s and %d", first.Count, first.Request.Path, events[1].Count)
+	}
+	if pending, merged := d.Stats(); pending != 0 || merged != 4 {
+		t.Errorf("expected 4 merged and none pending, got %d merged %d pending", merged, pending)
+	}
+
+	// A new window starts with the next block
+	d.Add(NewBlockEvent("192.0.2.1", "", "GET", "example.com", "/", "https", "", "blocklist"))
+	if events := d.Expired(true); len(events) != 1 || events[0].Count != 1 {
+		t.Errorf("expected Expired(true) to release the new window, got %v", events)
+	}
+}
+
+func TestShipperDeduplicates(t *testing.T) {
+	var mu sync.Mutex
+	var shipped []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Events []map[string]interface{} `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err == nil {
+			mu.Lock()
+			shipped = append(shipped, payload.Events...)
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s := NewLogShipper(&keyProvider{url: server.URL}, &LogShipperConfig{BatchSize: 10, FlushInterval: 20 * time.Millisecond, DedupWindow: time.Hour})
+	s.Start()
+	for i := 0; i < 100; i++ {
+		s.SendEvent(NewBlockEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/", "https", "", "blocklist"))
+	}
+	s.SendEvent(NewAllowEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/", "https", "", "blocklist"))
+
+	// Only the allow event ships while the block window is open
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(shipped)
+		mu.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Stopping buffers the held block, which ships after the next start
+	if err := s.Stop(); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if pending, _ := s.dedup.Stats(); pending != 0 {
+		t.Errorf("expected no held events after stop, got %d", pending)
+	}
+	s.Start()
+	defer s.Stop()
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := len(shipped)
+		mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(shipped) != 2 {
+		t.Fatalf("expected 2 shipped events, got %d", len(shipped))
+	}
+	if shipped[0]["event_type"] != "access_allowed" || shipped[0]["count"] != nil {
+		t.Errorf("expected the allow event first without a count, got %v", shipped[0])
+	}
+	if shipped[1]["event_type"] != "access_blocked" || shipped[1]["count"] != float64(100) {
+		t.Errorf("expected one block event with count 100, got %v", shipped[1])
+	}
+	if got := s.GetDeduplicated(); got != 99 {
+		t.Errorf("expected 99 deduplicated events, got %d", got)
+	}
+}
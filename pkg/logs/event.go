@@ -2,6 +2,7 @@ package logs
 
 import (
 	"net/http"
+	"net/netip"
 	"sync"
 	"time"
 )
@@ -10,7 +11,8 @@ import (
 type BlockEvent struct {
 	// Core event info
 	Timestamp time.Time `json:"ts"`
-	EventType string    `json:"event_type"` // Always "access_blocked"
+	EventType string    `json:"event_type"`         // "access_blocked" or "access_allowed"
+	EventID   string    `json:"event_id,omitempty"` // ID shown on the block page, when it has one
 
 	// Request info
 	Request RequestDetails `json:"request"`
@@ -20,7 +22,19 @@ type BlockEvent struct {
 	Policy PolicyInfo `json:"policy"`
 
 	// Response
-	StatusCode int `json:"status_code"` // Always 403
+	StatusCode int `json:"status_code,omitempty"` // 403 for blocks, omitted for allow events
+
+	// Blocks of the client within the deduplication window this event stands
+	// for, including itself; omitted when events are not deduplicated
+	Count int64 `json:"count,omitempty"`
+
+	// Payload of non-request events such as reports, omitted for access events
+	Details interface{} `json:"details,omitempty"`
+
+	// IP extraction settings of the instance that created the event. Copied
+	// into Client at serialization time when they differ from the batch metadata.
+	ipStrategy    string
+	trustedHeader string
 }
 
 type RequestDetails struct {
@@ -28,16 +42,48 @@ type RequestDetails struct {
 	Host   string `json:"host"`
 	Path   string `json:"path"`
 	Scheme string `json:"scheme"`
+
+	Entrypoint string `json:"entrypoint,omitempty"` // Traefik entrypoint name or ":port", when known
+
+	// Declared body metadata of blocked write requests, the body is never captured
+	ContentLength *int64 `json:"content_length,omitempty"` // -1 when unknown, e.g. chunked
+	ContentType   string `json:"content_type,omitempty"`
+
+	// Request headers captured for blocks per logCaptureHeaders, keyed by canonical name
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 type ClientInfo struct {
 	IP        string `json:"ip"`        // The extracted IP that was checked
 	DirectIP  string `json:"direct_ip"` // RemoteAddr for debugging proxy issues
 	UserAgent string `json:"user_agent,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`  // Covering prefix the decision was made on, when IPv6 clients are aggregated
+	Country   string `json:"country,omitempty"` // Country of the client, when country rules are configured
+
+	// Per-event extraction info, only present when it differs from the batch metadata
+	IPStrategy    string `json:"ip_strategy,omitempty"`
+	TrustedHeader string `json:"trusted_header,omitempty"`
+
+	// Set when IP and DirectIP are hashed in privacy mode
+	SaltID   string          `json:"salt_id,omitempty"`
+	Previous *PreviousHashes `json:"previous,omitempty"` // Hashes under the previous salt during a rotation overlap
+}
+
+// PreviousHashes are the client identifiers hashed with the previous salt
+type PreviousHashes struct {
+	SaltID   string `json:"salt_id"`
+	IP       string `json:"ip"`
+	DirectIP string `json:"direct_ip"`
 }
 
 type PolicyInfo struct {
-	Mode string `json:"mode"` // "allowlist" or "blocklist"
+	Mode       string  `json:"mode"`                     // "allowlist" or "blocklist"
+	Generation string  `json:"edl_generation,omitempty"` // Generation ID of the EDL that made the decision
+	Source     string  `json:"source,omitempty"`         // What decided: "edl", "local", "override", "geo", "tor_exit" or "bypass"
+	Matched    string  `json:"matched,omitempty"`        // List entry that matched the client
+	SampleRate float64 `json:"sample_rate,omitempty"`    // Set when the event was sampled, for scaling counts
+	PathGroup  string  `json:"path_group,omitempty"`     // Path group of the request when pathGroups are configured
+	ASN        string  `json:"asn,omitempty"`            // AS of the matched entry when an ASN table is configured, e.g. "AS64500"
 }
 
 // Event pool to reduce allocations
@@ -58,35 +104,231 @@ func NewBlockEvent(
 	userAgent string,
 	edlMode string,
 ) *BlockEvent {
+	event := newEvent(extractedIP, directIP, method, host, path, scheme, userAgent, edlMode)
+	event.EventType = "access_blocked"
+	event.StatusCode = http.StatusForbidden
+	return event
+}
+
+// NewAllowEvent creates an allowed access event using pool. The response
+// status is not known when the event is created, so it is left unset.
+func NewAllowEvent(
+	extractedIP string,
+	directIP string,
+	method string,
+	host string,
+	path string,
+	scheme string,
+	userAgent string,
+	edlMode string,
+) *BlockEvent {
+	event := newEvent(extractedIP, directIP, method, host, path, scheme, userAgent, edlMode)
+	event.EventType = "access_allowed"
+	event.StatusCode = 0
+	return event
+}
+
+// MarkWouldBlock turns a block event into a monitor mode report. The
+// request was forwarded, so the event carries no status code.
+func (e *BlockEvent) MarkWouldBlock() {
+	e.EventType = "access_would_block"
+	e.StatusCode = 0
+}
+
+// Event types of requests without a usable client IP
+const (
+	EventIPMissing = "ip_missing" // No client IP could be extracted
+	EventIPInvalid = "ip_invalid" // The extracted client IP did not parse
+)
+
+// MarkIPError turns a block event into an ip_missing or ip_invalid event.
+// Forwarded requests carry no status code, rejected ones a 400.
+func (e *BlockEvent) MarkIPError(eventType string, forwarded bool) {
+	e.EventType = eventType
+	e.StatusCode = http.StatusBadRequest
+	if forwarded {
+		e.StatusCode = 0
+	}
+}
+
+// NewReportEvent creates an event carrying a report or other non-request
+// payload in Details. Request and client fields are left empty.
+func NewReportEvent(eventType string, edlMode string, details interface{}) *BlockEvent {
+	event := newEvent("", "", "", "", "", "", "", edlMode)
+	event.EventType = eventType
+	event.StatusCode = 0
+	event.Details = details
+	return event
+}
+
+// newEvent takes an event from the pool and fills the request fields
+func newEvent(extractedIP, directIP, method, host, path, scheme, userAgent, edlMode string) *BlockEvent {
 	// Get event from pool
 	event := eventPool.Get().(*BlockEvent)
 
 	// Reset and populate the event
 	event.Timestamp = time.Now().UTC()
-	event.EventType = "access_blocked"
-	event.StatusCode = http.StatusForbidden
+	event.EventID = ""
+	event.Count = 0
 
 	event.Request.Method = method
 	event.Request.Host = host
 	event.Request.Path = path
 	event.Request.Scheme = scheme
+	event.Request.Entrypoint = ""
+	event.Request.ContentLength = nil
+	event.Request.ContentType = ""
+	event.Request.Headers = nil
 
 	event.Client.IP = extractedIP
 	event.Client.DirectIP = directIP
 	event.Client.UserAgent = userAgent
+	event.Client.Prefix = ""
+	event.Client.Country = ""
+	event.Client.SaltID = ""
+	event.Client.Previous = nil
 
 	event.Policy.Mode = edlMode
+	event.Policy.SampleRate = 0
+	event.Policy.Source = ""
+	event.Policy.Matched = ""
+	event.Policy.PathGroup = ""
+	event.Policy.ASN = ""
 
 	return event
 }
 
+// FirstBlockDetails enriches the first block of an IP within a window
+type FirstBlockDetails struct {
+	Query          string `json:"query,omitempty"`
+	Protocol       string `json:"protocol"`
+	Referer        string `json:"referer,omitempty"`
+	Accept         string `json:"accept,omitempty"`
+	AcceptLanguage string `json:"accept_language,omitempty"`
+	ForwardedFor   string `json:"forwarded_for,omitempty"`
+	TLSVersion     string `json:"tls_version,omitempty"`
+	TLSServerName  string `json:"tls_server_name,omitempty"`
+	ContentLength  int64  `json:"content_length,omitempty"`
+}
+
+// RepeatBlockDetails counts the blocks of an IP since its detailed first block
+type RepeatBlockDetails struct {
+	Count       int64     `json:"count"`        // Blocks in the window, including the first
+	WindowStart time.Time `json:"window_start"` // Time of the detailed first block
+}
+
+// NewRepeatBlockEvent creates a counter-only event for an IP that was
+// already reported in detail. Request fields are left empty to keep the
+// payload small during floods.
+func NewRepeatBlockEvent(extractedIP string, edlMode string, count int64, windowStart time.Time) *BlockEvent {
+	event := newEvent(extractedIP, "", "", "", "", "", "", edlMode)
+	event.EventType = "access_blocked_repeat"
+	event.StatusCode = http.StatusForbidden
+	event.Details = &RepeatBlockDetails{Count: count, WindowStart: windowStart.UTC()}
+	return event
+}
+
+// EscalationDetails describes a /24 blocked locally after distinct IPs
+// from it were blocked within a window
+type EscalationDetails struct {
+	Prefix        string `json:"prefix"`
+	DistinctIPs   int    `json:"distinct_ips"`
+	TriggerIP     string `json:"trigger_ip"`
+	WindowSeconds int64  `json:"window_seconds"`
+	TTLSeconds    int64  `json:"ttl_seconds"`
+}
+
+// EDLUpdateDetails summarizes a loaded EDL so the backend can spot list
+// pipeline regressions. Share changes compare with the previous load.
+type EDLUpdateDetails struct {
+	Generation      string   `json:"edl_generation,omitempty"`
+	Entries         int64    `json:"entries"`    // Entries as delivered, including duplicates
+	Duplicates      int64    `json:"duplicates"` // Entries that did not add a distinct prefix
+	IPv4            int64    `json:"ipv4"`       // Distinct IPv4 prefixes
+	IPv6            int64    `json:"ipv6"`       // Distinct IPv6 prefixes
+	HostShare       float64  `json:"host_share"` // Share of /32 and /128 among distinct prefixes
+	IPv4Share       float64  `json:"ipv4_share"` // Share of IPv4 among distinct prefixes
+	HostShareChange float64  `json:"host_share_change,omitempty"`
+	IPv4ShareChange float64  `json:"ipv4_share_change,omitempty"`
+	LoadMillis      int64    `json:"load_ms"`
+	MemoryBytes     int64    `json:"memory_bytes,omitempty"` // Estimated heap held by the trie
+	Format          string   `json:"format,omitempty"`       // "elliotrie", "plain" or "mixed" for merged sources
+	Anomalies       []string `json:"anomalies,omitempty"`    // "duplicates", "host_share_shift", "family_ratio_shift"
+}
+
+// SetDecision records what decided on the request. An invalid matched
+// prefix means no list entry matched.
+func (e *BlockEvent) SetDecision(source string, matched netip.Prefix, generation string) {
+	e.Policy.Source = source
+	e.Policy.Matched = ""
+	if matched.IsValid() {
+		e.Policy.Matched = matched.String()
+	}
+	e.Policy.Generation = generation
+}
+
+// SetSampleRate records the sampling rate the event was selected with.
+// Rates of 1 or more mean the event was not sampled and are not shipped.
+func (e *BlockEvent) SetSampleRate(rate float64) {
+	if rate >= 1 {
+		rate = 0
+	}
+	e.Policy.SampleRate = rate
+}
+
+// SetExtraction records how the client IP of this event was extracted
+func (e *BlockEvent) SetExtraction(ipStrategy, trustedHeader string) {
+	e.ipStrategy = ipStrategy
+	if ipStrategy == "custom" {
+		e.trustedHeader = trustedHeader
+	} else {
+		e.trustedHeader = ""
+	}
+}
+
+// applyExtractionDefaults fills the per-event extraction fields only where
+// they differ from the batch-level defaults, keeping payloads compact
+func (e *BlockEvent) applyExtractionDefaults(metadata *BatchMetadata) {
+	e.Client.IPStrategy = ""
+	e.Client.TrustedHeader = ""
+
+	var defaultStrategy, defaultHeader string
+	if metadata != nil {
+		defaultStrategy = metadata.IPStrategy
+		defaultHeader = metadata.TrustedHeader
+	}
+
+	if e.ipStrategy != "" && e.ipStrategy != defaultStrategy {
+		e.Client.IPStrategy = e.ipStrategy
+	}
+	if e.trustedHeader != defaultHeader {
+		e.Client.TrustedHeader = e.trustedHeader
+	}
+}
+
 // ReturnToPool returns an event to the pool for reuse
 func ReturnToPool(event *BlockEvent) {
 	// Clear sensitive data before returning to pool
 	event.Client.IP = ""
 	event.Client.DirectIP = ""
 	event.Client.UserAgent = ""
+	event.Client.Prefix = ""
+	event.Client.Country = ""
+	event.Client.IPStrategy = ""
+	event.Client.TrustedHeader = ""
+	event.Client.SaltID = ""
+	event.Client.Previous = nil
+	event.ipStrategy = ""
+	event.trustedHeader = ""
 	event.Request.Host = ""
 	event.Request.Path = ""
+	event.Request.Headers = nil
+	event.Policy.Generation = ""
+	event.Policy.Source = ""
+	event.Policy.Matched = ""
+	event.Policy.PathGroup = ""
+	event.Policy.ASN = ""
+	event.Details = nil
+	event.Count = 0
 	eventPool.Put(event)
 }
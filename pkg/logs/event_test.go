@@ -1,6 +1,7 @@
 package logs
 
 import (
+	"encoding/json"
 	"net/http"
 	"testing"
 	"time"
@@ -194,3 +195,135 @@ func BenchmarkNewBlockEventWithoutPool(b *testing.B) {
 		}
 	}
 }
+
+func TestEventExtractionAgainstBatchDefaults(t *testing.T) {
+	shipper := NewLogShipper(nil, &LogShipperConfig{})
+	shipper.SetBatchMetadata(&BatchMetadata{DeviceID: "device", IPStrategy: "xff"})
+
+	sameAsBatch := NewBlockEvent("203.0.113.1", "10.0.0.1", "GET", "a.example.com", "/", "https", "", "blocklist")
+	sameAsBatch.SetExtraction("xff", "")
+
+	custom := NewBlockEvent("203.0.113.2", "10.0.0.2", "GET", "b.example.com", "/", "https", "", "blocklist")
+	custom.SetExtraction("custom", "CF-Connecting-IP")
+
+	payload, err := shipper.eventsToJSON([]*BlockEvent{sameAsBatch, custom}, nil, "")
+	if err != nil {
+		t.Fatalf("eventsToJSON failed: %v", err)
+	}
+
+	var decoded struct {
+		Events []struct {
+			Client map[string]interface{} `json:"client"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+
+	if _, ok := decoded.Events[0].Client["ip_strategy"]; ok {
+		t.Error("event matching batch defaults should omit ip_strategy")
+	}
+	if got := decoded.Events[1].Client["ip_strategy"]; got != "custom" {
+		t.Errorf("expected ip_strategy 'custom', got %v", got)
+	}
+	if got := decoded.Events[1].Client["trusted_header"]; got != "CF-Connecting-IP" {
+		t.Errorf("expected trusted_header 'CF-Connecting-IP', got %v", got)
+	}
+}
+
+func TestNewAllowEvent(t *testing.T) {
+	// Reuse a pooled block event to make sure the status code is reset
+	ReturnToPool(NewBlockEvent("1.2.3.4", "10.0.0.1", "GET", "a", "/", "http", "", "blocklist"))
+
+	event := NewAllowEvent("192.168.1.1", "10.0.0.1", "GET", "example.com", "/", "https", "", "allowlist")
+	defer ReturnToPool(event)
+	event.SetSampleRate(0.1)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to marshal event: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal event: %v", err)
+	}
+	if decoded["event_type"] != "access_allowed" {
+		t.Errorf("expected event_type 'access_allowed', got %v", decoded["event_type"])
+	}
+	if _, ok := decoded["status_code"]; ok {
+		t.Errorf("allow events must not carry a status code, got %v", decoded["status_code"])
+	}
+	policy := decoded["policy"].(map[string]interface{})
+	if policy["sample_rate"] != 0.1 {
+		t.Errorf("expected sample_rate 0.1, got %v", policy["sample_rate"])
+	}
+
+	// Unsampled events omit the rate
+	event.SetSampleRate(1)
+	if event.Policy.SampleRate != 0 {
+		t.Errorf("expected rate 1 to be omitted, got %v", event.Policy.SampleRate)
+	}
+}
+
+func TestMarkWouldBlock(t *testing.T) {
+	event := NewBlockEvent("192.168.1.1", "10.0.0.1", "GET", "example.com", "/", "https", "", "blocklist")
+	defer ReturnToPool(event)
+	event.MarkWouldBlock()
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("failed to marshal event: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal event: %v", err)
+	}
+	if decoded["event_type"] != "access_would_block" {
+		t.Errorf("expected event_type 'access_would_block', got %v", decoded["event_type"])
+	}
+	if _, ok := decoded["status_code"]; ok {
+		t.Errorf("forwarded requests must not carry a status code, got %v", decoded["status_code"])
+	}
+}
+
+func TestMarkIPError(t *testing.T) {
+	event := NewBlockEvent("bad", "192.0.2.1", "GET", "example.com", "/", "http", "", "blocklist")
+	event.MarkIPError(EventIPInvalid, false)
+	if event.EventType != "ip_invalid" || event.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected rejected event %s/%d", event.EventType, event.StatusCode)
+	}
+	event.MarkIPError(EventIPMissing, true)
+	if event.EventType != "ip_missing" || event.StatusCode != 0 {
+		t.Errorf("unexpected forwarded event %s/%d", event.EventType, event.StatusCode)
+	}
+}
+
+func TestNewRepeatBlockEvent(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := NewRepeatBlockEvent("192.168.1.1", "blocklist", 7, start)
+	defer ReturnToPool(event)
+
+	if event.EventType != "access_blocked_repeat" {
+		t.Errorf("expected event type access_blocked_repeat, got %s", event.EventType)
+	}
+	if event.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status 403, got %d", event.StatusCode)
+	}
+	if event.Request.Path != "" || event.Client.UserAgent != "" {
+		t.Error("repeat events must not carry request details")
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	details, _ := decoded["details"].(map[string]interface{})
+	if details["count"] != float64(7) || details["window_start"] != "2025-01-01T00:00:00Z" {
+		t.Errorf("unexpected details %v", decoded["details"])
+	}
+}
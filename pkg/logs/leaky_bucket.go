@@ -12,6 +12,8 @@ type LeakyBucket struct {
 	refillRate int64 // tokens per second
 	lastRefill time.Time
 	mu         sync.Mutex
+
+	now func() time.Time // clock, replaced in tests
 }
 
 // NewLeakyBucket creates a new leaky bucket rate limiter
@@ -21,6 +23,7 @@ func NewLeakyBucket(capacity, refillRate int64) *LeakyBucket {
 		tokens:     capacity,
 		refillRate: refillRate,
 		lastRefill: time.Now(),
+		now:        time.Now,
 	}
 }
 
@@ -39,14 +42,60 @@ func (lb *LeakyBucket) Allow(tokens int64) bool {
 	return false
 }
 
-// refill adds tokens based on time elapsed
+// TakeUpTo consumes up to n tokens and returns how many were granted
+func (lb *LeakyBucket) TakeUpTo(n int64) int64 {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	lb.refill()
+
+	granted := minInt64(n, lb.tokens)
+	if granted < 0 {
+		granted = 0
+	}
+	lb.tokens -= granted
+	return granted
+}
+
+// SetRate changes the capacity and refill rate, keeping accumulated tokens
+// within the new capacity
+func (lb *LeakyBucket) SetRate(capacity, refillRate int64) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	lb.refill()
+	lb.capacity = capacity
+	lb.refillRate = refillRate
+	lb.tokens = minInt64(lb.tokens, capacity)
+}
+
+// Rate returns the current capacity and refill rate
+func (lb *LeakyBucket) Rate() (capacity, refillRate int64) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.capacity, lb.refillRate
+}
+
+// refill adds tokens based on time elapsed. Times from time.Now elapse on
+// the monotonic clock; a clock that went backwards restarts the refill from
+// now instead of stalling it until the clock catches up.
 func (lb *LeakyBucket) refill() {
-	now := time.Now()
+	now := lb.now()
 	elapsed := now.Sub(lb.lastRefill)
-	tokensToAdd := int64(elapsed.Seconds() * float64(lb.refillRate))
+	if elapsed < 0 {
+		lb.lastRefill = now
+		return
+	}
 
-	if tokensToAdd > 0 {
-		lb.tokens = minInt64(lb.capacity, lb.tokens+tokensToAdd)
+	// Fill up before converting so a long gap cannot overflow
+	add := elapsed.Seconds() * float64(lb.refillRate)
+	if add >= float64(lb.capacity-lb.tokens) {
+		lb.tokens = lb.capacity
+		lb.lastRefill = now
+		return
+	}
+	if tokensToAdd := int64(add); tokensToAdd > 0 {
+		lb.tokens += tokensToAdd
 		lb.lastRefill = now
 	}
 }
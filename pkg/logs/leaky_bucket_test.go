@@ -0,0 +1,40 @@
+package logs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeakyBucketClockJumps(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	lb := NewLeakyBucket(4, 2)
+	lb.now = func() time.Time { return clock }
+	lb.lastRefill = clock
+
+	if got := lb.TakeUpTo(10); got != 4 {
+		t.Fatalf("expected the full burst, got %d", got)
+	}
+	clock = clock.Add(time.Second)
+	if got := lb.TakeUpTo(10); got != 2 {
+		t.Errorf("expected 2 tokens after a second, got %d", got)
+	}
+
+	// A clock stepped back a day must not stall the refill for a day
+	clock = clock.Add(-24 * time.Hour)
+	if got := lb.TakeUpTo(10); got != 0 {
+		t.Errorf("expected no tokens right after the jump, got %d", got)
+	}
+	clock = clock.Add(time.Second)
+	if got := lb.TakeUpTo(10); got != 2 {
+		t.Errorf("expected the refill to continue after a backward jump, got %d", got)
+	}
+
+	// A jump forward, e.g. after a VM resume, fills the bucket without overflowing
+	clock = clock.Add(100 * 365 * 24 * time.Hour)
+	if got := lb.TakeUpTo(10); got != 4 {
+		t.Errorf("expected a full bucket after a forward jump, got %d", got)
+	}
+	if wait := lb.WaitTime(1); wait != 500*time.Millisecond {
+		t.Errorf("expected half a second for the next token, got %v", wait)
+	}
+}
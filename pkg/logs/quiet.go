@@ -0,0 +1,98 @@
+package logs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultCatchUpRate is how many spooled batches are shipped per second
+// after a quiet window unless configured
+const defaultCatchUpRate = 10
+
+// quietWindow is a daily window in minutes since midnight. A window whose
+// end is before its start spans midnight.
+type quietWindow struct {
+	start, end int
+}
+
+// contains reports whether minute of the day falls in the window
+func (w quietWindow) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// QuietHours pauses event shipping during daily windows, for metered links
+// or maintenance of the ingestion side. Events are spooled in the shipper
+// buffer while quiet and shipped at a bounded catch-up rate afterwards.
+type QuietHours struct {
+	windows  []quietWindow
+	location *time.Location
+
+	now func() time.Time // clock, replaced in tests
+}
+
+// ParseQuietHours parses daily "HH:MM-HH:MM" windows in the time zone
+// named by tz, UTC when empty. It returns nil without windows.
+func ParseQuietHours(specs []string, tz string) (*QuietHours, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	location := time.UTC
+	if tz != "" {
+		var err error
+		if location, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("invalid quiet hours time zone %q: %w", tz, err)
+		}
+	}
+	q := &QuietHours{location: location, now: time.Now}
+	for _, spec := range specs {
+		from, to, ok := strings.Cut(strings.TrimSpace(spec), "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid quiet hours window %q, expected HH:MM-HH:MM", spec)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours window %q: %w", spec, err)
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours window %q: %w", spec, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("invalid quiet hours window %q: empty window", spec)
+		}
+		q.windows = append(q.windows, quietWindow{start: start, end: end})
+	}
+	return q, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight; "24:00" ends a
+// window at midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err == nil {
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	if strings.TrimSpace(s) == "24:00" {
+		return 24 * 60, nil
+	}
+	return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+}
+
+// Active reports whether shipping is paused now, false for nil quiet hours
+func (q *QuietHours) Active() bool {
+	if q == nil {
+		return false
+	}
+	now := q.now().In(q.location)
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range q.windows {
+		if w.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
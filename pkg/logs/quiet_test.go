@@ -0,0 +1,106 @@
+package logs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	if q, err := ParseQuietHours(nil, ""); q != nil || err != nil {
+		t.Errorf("expected no quiet hours, got %v %v", q, err)
+	}
+	for _, spec := range []string{"01:00", "25:00-02:00", "01:00-01:00", "1am-2am"} {
+		if _, err := ParseQuietHours([]string{spec}, ""); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+	if _, err := ParseQuietHours([]string{"01:00-02:00"}, "Nowhere/Invalid"); err == nil {
+		t.Error("expected an invalid time zone to be rejected")
+	}
+
+	if _, err := ParseQuietHours([]string{"20:00-24:00"}, ""); err != nil {
+		t.Errorf("expected a window ending at midnight, got %v", err)
+	}
+
+	q, err := ParseQuietHours([]string{"22:30-02:00", " 12:00 - 13:00 "}, "UTC")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for clock, want := range map[string]bool{
+		"22:29": false,
+		"22:30": true,
+		"23:59": true,
+		"01:59": true,
+		"02:00": false,
+		"11:59": false,
+		"12:00": true,
+		"12:59": true,
+		"13:00": false,
+	} {
+		at, _ := time.Parse("15:04", clock)
+		q.now = func() time.Time { return time.Date(2025, 1, 1, at.Hour(), at.Minute(), 0, 0, time.UTC) }
+		if got := q.Active(); got != want {
+			t.Errorf("Active at %s = %v, want %v", clock, got, want)
+		}
+	}
+
+	var none *QuietHours
+	if none.Active() {
+		t.Error("nil quiet hours are never active")
+	}
+}
+
+func TestShipperQuietHours(t *testing.T) {
+	var received atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	quiet, err := ParseQuietHours([]string{"01:00-02:00"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 1, 1, 1, 30, 0, 0, time.UTC)
+	quiet.now = func() time.Time { return now }
+
+	s := NewLogShipper(&keyProvider{url: server.URL}, &LogShipperConfig{
+		BatchSize:     1,
+		FlushInterval: time.Second,
+		QuietHours:    quiet,
+		SpoolMax:      3,
+		CatchUpRate:   2,
+	})
+	event := func() *BlockEvent {
+		return NewBlockEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/", "https", "", "blocklist")
+	}
+
+	s.updateQuiet()
+	for i := 0; i < 4; i++ {
+		s.shipBatch([]*BlockEvent{event()})
+	}
+	s.processBufferedEvents()
+	if received.Load() != 0 || s.buffer.Size() != 3 {
+		t.Fatalf("expected 3 events spooled and none shipped, got %d spooled and %d batches", s.buffer.Size(), received.Load())
+	}
+	if _, dropped := s.GetStats(); dropped != 1 {
+		t.Errorf("expected the event beyond the spool limit dropped, got %d", dropped)
+	}
+
+	// After the window the spool is shipped at the catch-up rate
+	now = now.Add(time.Hour)
+	s.updateQuiet()
+	s.processBufferedEvents()
+	if received.Load() != 2 || s.buffer.Size() != 1 {
+		t.Errorf("expected 2 batches shipped at the catch-up rate, got %d with %d left", received.Load(), s.buffer.Size())
+	}
+	s.processBufferedEvents()
+	s.processBufferedEvents()
+	if received.Load() != 3 || s.catchingUp {
+		t.Errorf("expected the spool shipped and catch-up finished, got %d batches catchingUp=%v", received.Load(), s.catchingUp)
+	}
+}
@@ -0,0 +1,84 @@
+package logs
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
+)
+
+// SealAlgorithm identifies the event encryption scheme: an ephemeral X25519
+// key agreement with the deployment key, SHA-256 key derivation and
+// AES-256-GCM. Only the holder of the deployment private key can decrypt.
+const SealAlgorithm = "X25519-SHA256-A256GCM"
+
+// EventsKeyProvider is implemented by token providers that deliver the
+// public key events are encrypted with
+type EventsKeyProvider interface {
+	GetEventsKey() (keyID, publicKey string)
+}
+
+// SealedEvents is the encrypted events array of a batch
+type SealedEvents struct {
+	Algorithm  string `json:"alg"`
+	KeyID      string `json:"kid,omitempty"`
+	Ephemeral  string `json:"epk"` // Base64 ephemeral X25519 public key
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// ParseEventsKey decodes a base64 X25519 public key
+func ParseEventsKey(encoded string) (*crypto.PublicKey, error) {
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, errors.New("events public key not available")
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		if raw, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("invalid events public key encoding: %w", err)
+		}
+	}
+	return crypto.KeyAgreement().NewPublicKey(raw)
+}
+
+// sealEvents encrypts the serialized events array to the recipient key
+func sealEvents(plaintext []byte, recipient *crypto.PublicKey, keyID string) (*SealedEvents, error) {
+	ephemeral, err := crypto.KeyAgreement().GenerateKey(crypto.Random())
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newSealCipher(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := crypto.RandomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SealedEvents{
+		Algorithm:  SealAlgorithm,
+		KeyID:      keyID,
+		Ephemeral:  base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, []byte(SealAlgorithm))),
+	}, nil
+}
+
+// newSealCipher derives the AES-256-GCM cipher from the shared secret,
+// binding it to both public keys
+func newSealCipher(shared, ephemeral, recipient []byte) (crypto.AEAD, error) {
+	h := crypto.NewHash()
+	h.Write([]byte(SealAlgorithm))
+	h.Write(shared)
+	h.Write(ephemeral)
+	h.Write(recipient)
+	return crypto.NewAEAD(h.Sum(nil))
+}
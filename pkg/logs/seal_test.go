@@ -0,0 +1,127 @@
+package logs
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// keyProvider serves a logs URL, token and events key
+type keyProvider struct {
+	url, keyID, key string
+}
+
+func (p *keyProvider) GetToken() string   { return "token" }
+func (p *keyProvider) GetLogsURL() string { return p.url }
+func (p *keyProvider) GetEventsKey() (string, string) {
+	return p.keyID, p.key
+}
+
+// openEvents decrypts sealed events with the deployment private key
+func openEvents(t *testing.T, sealed *SealedEvents, priv *ecdh.PrivateKey) []byte {
+	t.Helper()
+	decode := func(s string) []byte {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("invalid base64: %v", err)
+		}
+		return b
+	}
+	epk, err := ecdh.X25519().NewPublicKey(decode(sealed.Ephemeral))
+	if err != nil {
+		t.Fatalf("invalid ephemeral key: %v", err)
+	}
+	shared, err := priv.ECDH(epk)
+	if err != nil {
+		t.Fatalf("ECDH failed: %v", err)
+	}
+	gcm, err := newSealCipher(shared, epk.Bytes(), priv.PublicKey().Bytes())
+	if err != nil {
+		t.Fatalf("cipher failed: %v", err)
+	}
+	plaintext, err := gcm.Open(nil, decode(sealed.Nonce), decode(sealed.Ciphertext), []byte(SealAlgorithm))
+	if err != nil {
+		t.Fatalf("decryption failed: %v", err)
+	}
+	return plaintext
+}
+
+func TestSealEventsRoundTrip(t *testing.T) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParseEventsKey(base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()))
+	if err != nil {
+		t.Fatalf("ParseEventsKey failed: %v", err)
+	}
+
+	sealed, err := sealEvents([]byte(`[{"ip":"192.0.2.1"}]`), pub, "k1")
+	if err != nil {
+		t.Fatalf("sealEvents failed: %v", err)
+	}
+	if sealed.Algorithm != SealAlgorithm || sealed.KeyID != "k1" {
+		t.Errorf("unexpected envelope %+v", sealed)
+	}
+	if got := string(openEvents(t, sealed, priv)); got != `[{"ip":"192.0.2.1"}]` {
+		t.Errorf("unexpected plaintext %s", got)
+	}
+
+	for _, bad := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParseEventsKey(bad); err == nil {
+			t.Errorf("expected error for key %q", bad)
+		}
+	}
+}
+
+func TestShipBatchEncrypted(t *testing.T) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	provider := &keyProvider{url: server.URL}
+	s := NewLogShipper(provider, &LogShipperConfig{EncryptEvents: true})
+	event := func() *BlockEvent {
+		return NewBlockEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/admin", "https", "", "blocklist")
+	}
+
+	// Without a key nothing is sent and the events stay buffered
+	s.shipBatch([]*BlockEvent{event()})
+	if body != nil {
+		t.Fatalf("expected no request without a key, got %s", body)
+	}
+	if s.buffer.Size() != 1 {
+		t.Fatalf("expected the event to be re-buffered, got %d", s.buffer.Size())
+	}
+
+	provider.keyID = "k1"
+	provider.key = base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes())
+	s.shipBatch(s.buffer.DrainAll())
+
+	var payload BatchPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("invalid payload %s: %v", body, err)
+	}
+	if payload.Events != nil || payload.EncryptedEvents == nil || payload.EncryptedEvents.KeyID != "k1" {
+		t.Fatalf("expected only encrypted events, got %s", body)
+	}
+	var events []map[string]interface{}
+	if err := json.Unmarshal(openEvents(t, payload.EncryptedEvents, priv), &events); err != nil {
+		t.Fatalf("invalid decrypted events: %v", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("expected 1 event, got %d", len(events))
+	}
+}
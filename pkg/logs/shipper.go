@@ -3,24 +3,45 @@ package logs
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/backoff"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
 )
 
 const (
 	defaultBatchSize     = 1000
 	defaultFlushInterval = 10 * time.Second
-	maxRetries           = 3
-	initialBackoff       = 1 * time.Second
-	maxBackoff           = 10 * time.Second
+
+	defaultBucketCapacity = 10000
+	defaultRefillRate     = 100
+
+	// Adaptive bucket tuning follows a slow moving average of the event rate
+	bucketTuneInterval = time.Minute
+	bucketTuneWeight   = 0.2 // Weight of the latest interval in the average
+	bucketBurstSeconds = 60  // Burst capacity in seconds of the tuned rate
+
+	// Adaptive flushing follows a fast moving average of the batched events
+	flushRateWeight = 0.5 // Weight of the latest flush interval in the average
+
+	// Server-provided event quota, sent on logs endpoint responses
+	quotaRateHeader  = "X-Event-Quota-Rate"  // Events per second allowed for the deployment, 0 lifts the quota
+	quotaBurstHeader = "X-Event-Quota-Burst" // Optional burst size in events, defaults to 60s of rate
 )
 
+// defaultSendRetry is the retry policy of batch uploads unless configured
+var defaultSendRetry = backoff.Policy{Attempts: 3, Base: time.Second, Max: 10 * time.Second}
+
 // TokenProvider provides access token and logs URL
 type TokenProvider interface {
 	GetToken() string
@@ -30,15 +51,17 @@ type TokenProvider interface {
 // BatchMetadata contains metadata about the middleware configuration
 type BatchMetadata struct {
 	DeviceID       string   `json:"device_id"`
-	IPStrategy     string   `json:"ip_strategy,omitempty"`     // "direct", "xff", "real-ip", "custom"
+	IPStrategy     string   `json:"ip_strategy,omitempty"`     // "direct", "xff", "xff-depth", "real-ip", "custom"
 	TrustedHeader  string   `json:"trusted_header,omitempty"`  // Only if strategy is "custom"
 	TrustedProxies []string `json:"trusted_proxies,omitempty"` // Only if configured
 }
 
-// BatchPayload wraps events with metadata
+// BatchPayload wraps events with metadata. With encryption the events
+// array is replaced by EncryptedEvents and metadata stays readable.
 type BatchPayload struct {
-	BatchMetadata *BatchMetadata `json:"batch_metadata"`
-	Events        []*BlockEvent  `json:"events"`
+	BatchMetadata   *BatchMetadata `json:"batch_metadata"`
+	Events          []*BlockEvent  `json:"events,omitempty"`
+	EncryptedEvents *SealedEvents  `json:"encrypted_events,omitempty"`
 }
 
 // LogShipper handles batching and shipping of events
@@ -46,34 +69,87 @@ type LogShipper struct {
 	client        *http.Client
 	tokenProvider TokenProvider
 	bucket        *LeakyBucket
+	adaptive      bool // Tune bucket to the observed event rate
+
+	// Adaptive tuning state, only touched by processEvents
+	received  int64   // Events handed to SendEvent, read and reset atomically
+	eventRate float64 // Moving average of events per second, negative until the first sample
+	lastTune  time.Time
+
+	// Per-event quota from the backend, nil until one is announced. When the
+	// quota is exceeded batches are downsampled instead of dropped blindly.
+	quota   *LeakyBucket
+	quotaMu sync.RWMutex
+
+	dedup *Deduplicator // Collapses repeated blocks of an IP, nil when disabled
+
+	// Quiet hours, nil when shipping is never paused. quietActive and
+	// catchingUp are only touched by processEvents.
+	quiet       *QuietHours
+	spoolMax    int  // Events spooled while quiet, at most the buffer capacity
+	catchUpRate int  // Spooled batches shipped per second after a quiet window
+	quietActive bool // Shipping was paused at the last flush
+	catchingUp  bool // The spool of a quiet window is being shipped
 
 	eventChan chan *BlockEvent
 	buffer    *RingBuffer
 
-	batchSize     int
-	flushInterval time.Duration
+	// Events awaiting pollEvents in polling mode, at most eventChanSize
+	pending   []*BlockEvent
+	pendingMu sync.Mutex
 
-	wg     sync.WaitGroup
-	ctx    context.Context
-	cancel context.CancelFunc
+	batchSize     int
+	flushInterval time.Duration // Interval until the next flush, between minFlush and maxFlush
+	minFlush      time.Duration // Configured FlushInterval
+	maxFlush      time.Duration // Upper bound of adaptive flushing, not above minFlush when fixed
+	pollingMode   bool          // Hand events to pollEvents through pending instead of eventChan
+	encrypt       bool          // Encrypt the events array to the deployment key
+	retry         backoff.Policy
+
+	// Adaptive flushing state, only touched by processEvents
+	flushEvents int64     // Events batched since the last flush
+	flushRate   float64   // Moving average of batched events per second, negative until the first sample
+	lastFlush   time.Time // Time of the last flush
+
+	// Lifecycle; a stopped shipper is restarted with a fresh context and
+	// channel. runMu guards eventChan, ctx, cancel and the flags.
+	runMu   sync.RWMutex
+	running bool
+	stopped bool  // eventChan is closed, events go to the buffer until restarted
+	stopErr error // Result of the last Stop
+	wg      sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
 
 	// Batch metadata
 	batchMetadata *BatchMetadata
 	metaMu        sync.RWMutex
 
 	// Stats
-	eventsShipped int64
-	eventsDropped int64
-	mu            sync.Mutex
+	eventsShipped    int64
+	eventsDropped    int64
+	eventsSampledOut int64 // Discarded by quota downsampling
+	mu               sync.Mutex
 }
 
 // LogShipperConfig holds configuration for the log shipper
 type LogShipperConfig struct {
-	BatchSize      int
-	FlushInterval  time.Duration
-	BucketCapacity int64
-	RefillRate     int64
-	BufferSize     int
+	BatchSize        int
+	FlushInterval    time.Duration // Interval between flushes, the lower bound when adaptive
+	MaxFlushInterval time.Duration // Adaptive flushing stretches the interval up to this as the event rate grows, 0 keeps it fixed
+	BucketCapacity   int64         // Burst size in batches
+	RefillRate       int64         // Steady-state batches per second
+	Adaptive         bool          // Tune capacity and rate to the observed event rate
+	BufferSize       int
+	PollingMode      bool           // Set when the runtime probe finds channel select unreliable
+	EncryptEvents    bool           // Encrypt events to the key from EventsKeyProvider, holding them until one is available
+	Retry            backoff.Policy // Retries of a failed upload, zero fields keep the defaults
+	TLSConfig        *tls.Config    // TLS settings of uploads, nil keeps the defaults
+	DedupWindow      time.Duration  // Collapse repeated blocks of a client IP within this window into one event, 0 disables
+	DedupMaxEntries  int            // Client IPs with a held event, default 10000
+	QuietHours       *QuietHours    // Daily windows during which events are spooled instead of shipped, nil disables
+	SpoolMax         int            // Events spooled during quiet hours, default and at most BufferSize
+	CatchUpRate      int            // Spooled batches shipped per second after quiet hours, default 10
 }
 
 // SetBatchMetadata updates the batch metadata for all future shipments
@@ -83,6 +159,13 @@ func (s *LogShipper) SetBatchMetadata(metadata *BatchMetadata) {
 	s.metaMu.Unlock()
 }
 
+// GetBatchMetadata returns the metadata attached to shipped batches
+func (s *LogShipper) GetBatchMetadata() *BatchMetadata {
+	s.metaMu.RLock()
+	defer s.metaMu.RUnlock()
+	return s.batchMetadata
+}
+
 // NewLogShipper creates a new log shipper
 func NewLogShipper(tokenProvider TokenProvider, config *LogShipperConfig) *LogShipper {
 	if config.BatchSize <= 0 {
@@ -92,14 +175,17 @@ func NewLogShipper(tokenProvider TokenProvider, config *LogShipperConfig) *LogSh
 		config.FlushInterval = defaultFlushInterval
 	}
 	if config.BucketCapacity <= 0 {
-		config.BucketCapacity = 10000
+		config.BucketCapacity = defaultBucketCapacity
 	}
 	if config.RefillRate <= 0 {
-		config.RefillRate = 100
+		config.RefillRate = defaultRefillRate
 	}
 	if config.BufferSize <= 0 {
 		config.BufferSize = 10000
 	}
+	if config.CatchUpRate <= 0 {
+		config.CatchUpRate = defaultCatchUpRate
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -110,30 +196,80 @@ func NewLogShipper(tokenProvider TokenProvider, config *LogShipperConfig) *LogSh
 				MaxIdleConns:        10,
 				IdleConnTimeout:     30 * time.Second,
 				MaxIdleConnsPerHost: 2,
+				TLSClientConfig:     config.TLSConfig,
 			},
 		},
 		tokenProvider: tokenProvider,
 		bucket:        NewLeakyBucket(config.BucketCapacity, config.RefillRate),
-		eventChan:     make(chan *BlockEvent, 1000),
+		adaptive:      config.Adaptive,
+		eventRate:     -1,
+		lastTune:      time.Now(),
+		eventChan:     make(chan *BlockEvent, eventChanSize),
 		buffer:        NewRingBuffer(config.BufferSize),
 		batchSize:     config.BatchSize,
 		flushInterval: config.FlushInterval,
+		minFlush:      config.FlushInterval,
+		maxFlush:      config.MaxFlushInterval,
+		flushRate:     -1,
+		pollingMode:   config.PollingMode,
+		encrypt:       config.EncryptEvents,
+		retry:         config.Retry.Or(defaultSendRetry),
+		dedup:         NewDeduplicator(config.DedupWindow, config.DedupMaxEntries),
+		quiet:         config.QuietHours,
+		spoolMax:      config.SpoolMax,
+		catchUpRate:   config.CatchUpRate,
 		ctx:           ctx,
 		cancel:        cancel,
 	}
 }
 
-// Start begins processing events
+// eventChanSize is the capacity of the channel between SendEvent and the
+// processing loop, and of the pending events in polling mode
+const eventChanSize = 1000
+
+// pollInterval is how long pollEvents sleeps between drains
+const pollInterval = 100 * time.Millisecond
+
+// Start begins processing events. Starting a running shipper is a no-op;
+// a stopped shipper resumes with the events buffered since.
 func (s *LogShipper) Start() {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if s.running {
+		return
+	}
+	if s.stopped {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+		s.eventChan = make(chan *BlockEvent, eventChanSize)
+		s.stopped = false
+		s.stopErr = nil
+	}
+	s.running = true
+
 	logger.Trace("Starting log shipper")
 	s.wg.Add(1)
-	go s.processEvents()
+	if s.pollingMode {
+		go s.pollEvents(s.ctx)
+	} else {
+		go s.processEvents(s.ctx, s.eventChan)
+	}
 }
 
-// Stop gracefully stops the shipper
+// Stop gracefully stops the shipper. It is safe to call more than once;
+// later calls return the result of the first until the shipper is
+// started again.
 func (s *LogShipper) Stop() error {
+	s.runMu.Lock()
+	if s.stopped {
+		err := s.stopErr
+		s.runMu.Unlock()
+		return err
+	}
+	s.stopped = true
+	s.running = false
 	s.cancel()
 	close(s.eventChan)
+	s.runMu.Unlock()
 
 	done := make(chan struct{})
 	go func() {
@@ -141,22 +277,61 @@ func (s *LogShipper) Stop() error {
 		close(done)
 	}()
 
+	var err error
 	select {
 	case <-done:
+		// Held events join the buffer instead of waiting for their window
+		s.rebuffer(s.dedup.Expired(true))
 		s.flushBuffer()
-		return nil
 	case <-time.After(5 * time.Second):
-		return errors.New("timeout waiting for log shipper to stop")
+		err = errors.New("timeout waiting for log shipper to stop")
 	}
+
+	s.runMu.Lock()
+	s.stopErr = err
+	s.runMu.Unlock()
+	return err
 }
 
-// SendEvent sends an event for shipping
+// SendEvent sends an event for shipping. Events sent while the shipper is
+// stopped are buffered for the next start. With deduplication, blocks are
+// held until their window ends.
 func (s *LogShipper) SendEvent(event *BlockEvent) {
-	select {
-	case s.eventChan <- event:
-		// Event sent successfully
+	if s.dedup.Add(event) {
+		return
+	}
+	s.enqueue(event)
+}
+
+// enqueue hands an event to the processing loop, or the buffer when the
+// loop cannot take it
+func (s *LogShipper) enqueue(event *BlockEvent) {
+	if s.adaptive {
+		atomic.AddInt64(&s.received, 1)
+	}
+
+	s.runMu.RLock()
+	sent := false
+	switch {
+	case s.stopped:
+	case s.pollingMode:
+		s.pendingMu.Lock()
+		if len(s.pending) < eventChanSize {
+			s.pending = append(s.pending, event)
+			sent = true
+		}
+		s.pendingMu.Unlock()
 	default:
-		// Channel full, add to buffer
+		select {
+		case s.eventChan <- event:
+			sent = true
+		default:
+		}
+	}
+	s.runMu.RUnlock()
+
+	if !sent {
+		// Channel full or shipper stopped, add to buffer
 		if !s.buffer.Add(event) {
 			s.mu.Lock()
 			s.eventsDropped++
@@ -167,13 +342,16 @@ func (s *LogShipper) SendEvent(event *BlockEvent) {
 	}
 }
 
-// processEvents handles batching and shipping
-func (s *LogShipper) processEvents() {
+// processEvents handles batching and shipping until ctx is done or events
+// is closed
+func (s *LogShipper) processEvents(ctx context.Context, events chan *BlockEvent) {
 	defer s.wg.Done()
 
 	logger.Tracef("Log shipper goroutine started - batchSize=%d flushInterval=%v",
 		s.batchSize, s.flushInterval)
 
+	s.flushEvents = 0
+	s.lastFlush = time.Now()
 	flushTicker := time.NewTicker(s.flushInterval)
 	defer flushTicker.Stop()
 
@@ -185,13 +363,21 @@ func (s *LogShipper) processEvents() {
 
 	for {
 		select {
-		case <-s.ctx.Done():
+		case <-ctx.Done():
 			if len(batch) > 0 {
 				s.shipBatch(batch)
 			}
 			return
 
-		case event := <-s.eventChan:
+		case event, ok := <-events:
+			if !ok {
+				// Closed by Stop
+				if len(batch) > 0 {
+					s.shipBatch(batch)
+				}
+				return
+			}
+			s.flushEvents++
 			batch = append(batch, event)
 
 			if len(batch) >= s.batchSize {
@@ -200,18 +386,17 @@ func (s *LogShipper) processEvents() {
 			}
 
 		case <-flushTicker.C:
-			if len(batch) > 0 {
-				s.shipBatch(batch)
-				batch = make([]*BlockEvent, 0, s.batchSize)
+			interval := s.flushInterval
+			batch = s.flush(batch)
+			if s.flushInterval != interval {
+				flushTicker.Reset(s.flushInterval)
 			}
-			// Process buffered events
-			s.processBufferedEvents()
 
 		case <-checkTicker.C:
 			// Try to read events directly - workaround for Yaegi channel issues
 			for i := 0; i < 100; i++ {
 				select {
-				case event, ok := <-s.eventChan:
+				case event, ok := <-events:
 					if !ok {
 						if len(batch) > 0 {
 							s.shipBatch(batch)
@@ -219,6 +404,7 @@ func (s *LogShipper) processEvents() {
 						return
 					}
 
+					s.flushEvents++
 					batch = append(batch, event)
 
 					if len(batch) >= s.batchSize {
@@ -233,16 +419,272 @@ func (s *LogShipper) processEvents() {
 	}
 }
 
-// processBufferedEvents drains and ships buffered events
+// pollEvents handles batching and shipping like processEvents, for
+// runtimes where channel select is unreliable. It never selects: it sleeps
+// for pollInterval, then takes the pending events and flushes when due,
+// until ctx is done.
+func (s *LogShipper) pollEvents(ctx context.Context) {
+	defer s.wg.Done()
+
+	logger.Tracef("Log shipper polling goroutine started - batchSize=%d flushInterval=%v",
+		s.batchSize, s.flushInterval)
+
+	s.flushEvents = 0
+	s.lastFlush = time.Now()
+	nextFlush := s.lastFlush.Add(s.flushInterval)
+	batch := make([]*BlockEvent, 0, s.batchSize)
+
+	for {
+		// Stop sets stopped before cancelling, so nothing is pending after
+		// the last drain
+		done := ctx.Err() != nil
+		for _, event := range s.takePending() {
+			s.flushEvents++
+			batch = append(batch, event)
+			if len(batch) >= s.batchSize {
+				s.shipBatch(batch)
+				batch = make([]*BlockEvent, 0, s.batchSize)
+			}
+		}
+		if done {
+			if len(batch) > 0 {
+				s.shipBatch(batch)
+			}
+			return
+		}
+
+		if now := time.Now(); !now.Before(nextFlush) {
+			batch = s.flush(batch)
+			nextFlush = now.Add(s.flushInterval)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// takePending removes and returns the events pending in polling mode
+func (s *LogShipper) takePending() []*BlockEvent {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	events := s.pending
+	s.pending = nil
+	return events
+}
+
+// flush ships the batch along with expired and buffered events, then
+// adapts the bucket and the flush interval. It returns the emptied batch.
+func (s *LogShipper) flush(batch []*BlockEvent) []*BlockEvent {
+	s.updateQuiet()
+	batch = s.appendExpired(batch)
+	if len(batch) > 0 {
+		s.shipBatch(batch)
+		batch = make([]*BlockEvent, 0, s.batchSize)
+	}
+	// Process buffered events
+	s.processBufferedEvents()
+	if s.adaptive {
+		s.tuneBucket(time.Now())
+	}
+	if next := s.adaptFlush(time.Now()); next != s.flushInterval {
+		logger.Tracef("Flushing events every %v", next)
+		s.flushInterval = next
+	}
+	return batch
+}
+
+// appendExpired moves the deduplicated events whose window ended into
+// batch, shipping full batches on the way
+func (s *LogShipper) appendExpired(batch []*BlockEvent) []*BlockEvent {
+	for _, event := range s.dedup.Expired(false) {
+		if s.adaptive {
+			atomic.AddInt64(&s.received, 1)
+		}
+		s.flushEvents++
+		batch = append(batch, event)
+		if len(batch) >= s.batchSize {
+			s.shipBatch(batch)
+			batch = make([]*BlockEvent, 0, s.batchSize)
+		}
+	}
+	return batch
+}
+
+// tuneBucket folds the events received since the last tuning into the
+// moving average and resizes the bucket to match, at most once per
+// bucketTuneInterval
+func (s *LogShipper) tuneBucket(now time.Time) {
+	elapsed := now.Sub(s.lastTune)
+	if elapsed < 0 {
+		// The clock went backwards, measure from now on
+		atomic.StoreInt64(&s.received, 0)
+		s.lastTune = now
+		return
+	}
+	if elapsed < bucketTuneInterval {
+		return
+	}
+	observed := float64(atomic.SwapInt64(&s.received, 0)) / elapsed.Seconds()
+	s.lastTune = now
+
+	if s.eventRate < 0 {
+		s.eventRate = observed
+	} else {
+		s.eventRate += bucketTuneWeight * (observed - s.eventRate)
+	}
+
+	capacity, rate := adaptiveBucket(s.eventRate, s.batchSize, s.minFlush)
+	if c, r := s.bucket.Rate(); c != capacity || r != rate {
+		logger.Debugf("Tuned log shipping to %d batches/s, burst %d, for %.1f events/s", rate, capacity, s.eventRate)
+		s.bucket.SetRate(capacity, rate)
+	}
+}
+
+// adaptiveBucket sizes the batch rate limit for an event rate: twice the
+// batches the rate needs plus one per flush interval, so small deployments
+// always flush on time, capped at the default rate so large deployments
+// stay within ingestion limits. The burst covers bucketBurstSeconds.
+func adaptiveBucket(eventRate float64, batchSize int, flushInterval time.Duration) (capacity, rate int64) {
+	needed := 2*eventRate/float64(batchSize) + 1/flushInterval.Seconds()
+	rate = int64(math.Ceil(needed))
+	if rate < 1 {
+		rate = 1
+	}
+	if rate > defaultRefillRate {
+		rate = defaultRefillRate
+	}
+	return rate * bucketBurstSeconds, rate
+}
+
+// adaptFlush folds the events batched since the last flush into the moving
+// average and returns the interval until the next flush. A fixed interval
+// is returned unchanged.
+func (s *LogShipper) adaptFlush(now time.Time) time.Duration {
+	if s.maxFlush <= s.minFlush {
+		return s.flushInterval
+	}
+	elapsed := now.Sub(s.lastFlush)
+	events := s.flushEvents
+	s.lastFlush = now
+	s.flushEvents = 0
+	if elapsed <= 0 {
+		// The clock went backwards, measure from now on
+		return s.flushInterval
+	}
+
+	observed := float64(events) / elapsed.Seconds()
+	if s.flushRate < 0 {
+		s.flushRate = observed
+	} else {
+		s.flushRate += flushRateWeight * (observed - s.flushRate)
+	}
+	return adaptiveFlushInterval(s.flushRate, s.batchSize, s.minFlush, s.maxFlush)
+}
+
+// adaptiveFlushInterval stretches the flush interval from lo toward hi as
+// the event rate grows: rare events are shipped with low latency, while at
+// rates filling a batch within hi the interval reaches hi so partial
+// batches are rarely sent. Full batches are shipped right away either way.
+func adaptiveFlushInterval(eventRate float64, batchSize int, lo, hi time.Duration) time.Duration {
+	fill := eventRate * hi.Seconds() / float64(batchSize)
+	if fill >= 1 {
+		return hi
+	}
+	if fill <= 0 {
+		return lo
+	}
+	interval := lo + time.Duration(fill*float64(hi-lo))
+	// Round to avoid resetting the ticker for insignificant changes
+	return interval.Round(100 * time.Millisecond)
+}
+
+// BufferCapacity returns how many events are held while they cannot be shipped
+func (s *LogShipper) BufferCapacity() int {
+	return s.buffer.Capacity()
+}
+
+// ResizeBuffer changes the event buffer capacity. Buffered events that no
+// longer fit are dropped, oldest first.
+func (s *LogShipper) ResizeBuffer(capacity int) {
+	evicted := s.buffer.Resize(capacity)
+	if len(evicted) == 0 {
+		return
+	}
+	s.mu.Lock()
+	s.eventsDropped += int64(len(evicted))
+	s.mu.Unlock()
+	for _, event := range evicted {
+		ReturnToPool(event)
+	}
+}
+
+// GetBucket returns the current batch burst capacity and rate
+func (s *LogShipper) GetBucket() (capacity, rate int64) {
+	return s.bucket.Rate()
+}
+
+// processBufferedEvents drains and ships buffered events, one batch per
+// flush or up to the catch-up rate while shipping the spool of quiet hours
 func (s *LogShipper) processBufferedEvents() {
-	events := s.buffer.Drain(s.batchSize)
-	if len(events) > 0 {
+	if s.quietActive {
+		return
+	}
+	batches := 1
+	if s.catchingUp {
+		batches = int(math.Ceil(float64(s.catchUpRate) * s.flushInterval.Seconds()))
+	}
+	for i := 0; i < batches; i++ {
+		events := s.buffer.Drain(s.batchSize)
+		if len(events) == 0 {
+			s.catchingUp = false
+			return
+		}
 		s.shipBatch(events)
 	}
 }
 
+// updateQuiet pauses and resumes shipping at the edges of quiet hours
+func (s *LogShipper) updateQuiet() {
+	active := s.quiet.Active()
+	if active == s.quietActive {
+		return
+	}
+	s.quietActive = active
+	if active {
+		logger.Info("Quiet hours started, spooling events")
+		return
+	}
+	s.catchingUp = true
+	logger.Infof("Quiet hours ended, shipping %d spooled events", s.buffer.Size())
+}
+
+// spool holds the events of a batch during quiet hours, dropping those
+// beyond the spool limit
+func (s *LogShipper) spool(events []*BlockEvent) {
+	limit := s.buffer.Capacity()
+	if s.spoolMax > 0 && s.spoolMax < limit {
+		limit = s.spoolMax
+	}
+	var dropped int64
+	for _, event := range events {
+		if s.buffer.Size() >= limit || !s.buffer.Add(event) {
+			dropped++
+			ReturnToPool(event)
+		}
+	}
+	if dropped > 0 {
+		s.mu.Lock()
+		s.eventsDropped += dropped
+		s.mu.Unlock()
+		logger.Warnf("Event spool full during quiet hours, dropped %d events", dropped)
+	}
+}
+
 // shipBatch sends a batch of events
 func (s *LogShipper) shipBatch(events []*BlockEvent) {
+	if s.quiet.Active() {
+		logger.Tracef("Quiet hours, spooling batch of %d events", len(events))
+		s.spool(events)
+		return
+	}
 	logger.Tracef("Shipping batch of %d events", len(events))
 
 	// Rate limiting
@@ -255,19 +697,29 @@ func (s *LogShipper) shipBatch(events []*BlockEvent) {
 	if !s.bucket.Allow(1) {
 		// Rate limited, re-buffer events
 		logger.Warn("Rate limited, re-buffering events")
-		for _, event := range events {
-			if !s.buffer.Add(event) {
-				s.mu.Lock()
-				s.eventsDropped++
-				s.mu.Unlock()
-				ReturnToPool(event) // Return to pool if dropped
-			}
+		s.rebuffer(events)
+		return
+	}
+
+	var key *crypto.PublicKey
+	var keyID string
+	if s.encrypt {
+		var err error
+		if key, keyID, err = s.eventsKey(); err != nil {
+			// Never ship telemetry in the clear, keep it until a key arrives
+			logger.Warnf("Cannot encrypt batch of %d events, re-buffering: %v", len(events), err)
+			s.rebuffer(events)
+			return
 		}
+	}
+
+	events = s.applyQuota(events)
+	if len(events) == 0 {
 		return
 	}
 
 	// Convert to JSON payload with metadata
-	payload, err := s.eventsToJSON(events)
+	payload, err := s.eventsToJSON(events, key, keyID)
 	if err != nil {
 		logger.Errorf("Failed to convert events to JSON: %v", err)
 		s.mu.Lock()
@@ -284,15 +736,7 @@ func (s *LogShipper) shipBatch(events []*BlockEvent) {
 	err = s.sendWithRetry(payload)
 	if err != nil {
 		logger.Warnf("Failed to ship batch of %d events: %v", len(events), err)
-		// Re-buffer failed events
-		for _, event := range events {
-			if !s.buffer.Add(event) {
-				s.mu.Lock()
-				s.eventsDropped++
-				s.mu.Unlock()
-				ReturnToPool(event) // Return to pool if dropped
-			}
-		}
+		s.rebuffer(events)
 	} else {
 		s.mu.Lock()
 		s.eventsShipped += int64(len(events))
@@ -306,26 +750,38 @@ func (s *LogShipper) shipBatch(events []*BlockEvent) {
 	}
 }
 
-// sendWithRetry attempts to send payload with exponential backoff
-func (s *LogShipper) sendWithRetry(payload []byte) error {
-	var lastErr error
-	backoff := initialBackoff
-
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
-			time.Sleep(backoff)
-			backoff = minDuration(backoff*2, maxBackoff)
-		}
-
-		err := s.send(payload)
-		if err == nil {
-			return nil
+// rebuffer returns events to the buffer, dropping those that do not fit
+func (s *LogShipper) rebuffer(events []*BlockEvent) {
+	for _, event := range events {
+		if !s.buffer.Add(event) {
+			s.mu.Lock()
+			s.eventsDropped++
+			s.mu.Unlock()
+			ReturnToPool(event) // Return to pool if dropped
 		}
+	}
+}
 
-		lastErr = err
+// eventsKey returns the deployment key events are encrypted with
+func (s *LogShipper) eventsKey() (*crypto.PublicKey, string, error) {
+	provider, ok := s.tokenProvider.(EventsKeyProvider)
+	if !ok {
+		return nil, "", errors.New("token provider does not deliver an events key")
 	}
+	keyID, encoded := provider.GetEventsKey()
+	key, err := ParseEventsKey(encoded)
+	return key, keyID, err
+}
+
+// sendWithRetry attempts to send payload with full-jitter backoff
+func (s *LogShipper) sendWithRetry(payload []byte) error {
+	s.runMu.RLock()
+	ctx := s.ctx
+	s.runMu.RUnlock()
 
-	return lastErr
+	return backoff.Retry(ctx, s.retry, func(int) error {
+		return s.send(payload)
+	})
 }
 
 // send performs the actual HTTP request
@@ -340,7 +796,11 @@ func (s *LogShipper) send(payload []byte) error {
 		return errors.New("access token not available")
 	}
 
-	req, err := http.NewRequestWithContext(s.ctx, "POST", logsURL, bytes.NewReader(payload))
+	s.runMu.RLock()
+	ctx := s.ctx
+	s.runMu.RUnlock()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", logsURL, bytes.NewReader(payload))
 	if err != nil {
 		return err
 	}
@@ -354,6 +814,8 @@ func (s *LogShipper) send(payload []byte) error {
 	}
 	defer resp.Body.Close()
 
+	s.updateQuota(resp.Header)
+
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		return nil
 	}
@@ -362,6 +824,114 @@ func (s *LogShipper) send(payload []byte) error {
 	return errors.New("server responded with: " + string(bodyBytes))
 }
 
+// updateQuota adjusts the event quota from logs endpoint response headers
+func (s *LogShipper) updateQuota(header http.Header) {
+	rateValue := header.Get(quotaRateHeader)
+	if rateValue == "" {
+		return
+	}
+
+	rate, err := strconv.ParseInt(rateValue, 10, 64)
+	if err != nil || rate < 0 {
+		logger.Debugf("Ignoring invalid %s header %q", quotaRateHeader, rateValue)
+		return
+	}
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	if rate == 0 {
+		if s.quota != nil {
+			logger.Info("Event quota lifted by backend")
+			s.quota = nil
+		}
+		return
+	}
+
+	burst := rate * 60
+	if b, err := strconv.ParseInt(header.Get(quotaBurstHeader), 10, 64); err == nil && b > 0 {
+		burst = b
+	}
+
+	if s.quota == nil {
+		logger.Infof("Event quota announced by backend: %d events/s, burst %d", rate, burst)
+		s.quota = NewLeakyBucket(burst, rate)
+		return
+	}
+	if c, r := s.quota.Rate(); c != burst || r != rate {
+		logger.Infof("Event quota changed by backend: %d events/s, burst %d", rate, burst)
+		s.quota.SetRate(burst, rate)
+	}
+}
+
+// applyQuota downsamples a batch to what the event quota allows. Kept events
+// are spread evenly over the batch and carry the sampling rate so the backend
+// can scale counts back up; the rest are returned to the pool.
+func (s *LogShipper) applyQuota(events []*BlockEvent) []*BlockEvent {
+	s.quotaMu.RLock()
+	quota := s.quota
+	s.quotaMu.RUnlock()
+	if quota == nil {
+		return events
+	}
+
+	total := int64(len(events))
+	granted := quota.TakeUpTo(total)
+	if granted == total {
+		return events
+	}
+
+	fraction := float64(granted) / float64(total)
+	kept := make([]*BlockEvent, 0, granted)
+	next := int64(0)
+	for i, event := range events {
+		// Keep event i when it is the next evenly spaced index
+		if next < granted && int64(i) == next*total/granted {
+			rate := event.Policy.SampleRate
+			if rate == 0 {
+				rate = 1
+			}
+			event.Policy.SampleRate = rate * fraction
+			kept = append(kept, event)
+			next++
+			continue
+		}
+		ReturnToPool(event)
+	}
+
+	s.mu.Lock()
+	s.eventsSampledOut += total - granted
+	s.mu.Unlock()
+	logger.Debugf("Event quota exceeded, shipping %d of %d events", granted, total)
+
+	return kept
+}
+
+// GetQuota returns the backend event quota, zero when none is in effect
+func (s *LogShipper) GetQuota() (rate, burst int64) {
+	s.quotaMu.RLock()
+	defer s.quotaMu.RUnlock()
+	if s.quota == nil {
+		return 0, 0
+	}
+	burst, rate = s.quota.Rate()
+	return rate, burst
+}
+
+// GetDeduplicated returns how many events were merged into a held event
+// by deduplication
+func (s *LogShipper) GetDeduplicated() int64 {
+	_, merged := s.dedup.Stats()
+	return merged
+}
+
+// GetSampledOut returns how many events were discarded by quota downsampling
+func (s *LogShipper) GetSampledOut() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.eventsSampledOut
+}
+
 // flushBuffer sends all buffered events
 func (s *LogShipper) flushBuffer() {
 	events := s.buffer.DrainAll()
@@ -375,16 +945,31 @@ func (s *LogShipper) flushBuffer() {
 	}
 }
 
-// eventsToJSON converts events to JSON payload with metadata
-func (s *LogShipper) eventsToJSON(events []*BlockEvent) ([]byte, error) {
+// eventsToJSON converts events to JSON payload with metadata. The events
+// array is encrypted when key is set.
+func (s *LogShipper) eventsToJSON(events []*BlockEvent, key *crypto.PublicKey, keyID string) ([]byte, error) {
 	s.metaMu.RLock()
 	metadata := s.batchMetadata
 	s.metaMu.RUnlock()
 
+	for _, event := range events {
+		event.applyExtractionDefaults(metadata)
+	}
+
 	payload := BatchPayload{
 		BatchMetadata: metadata,
 		Events:        events,
 	}
+	if key != nil {
+		plaintext, err := json.Marshal(events)
+		if err != nil {
+			return nil, err
+		}
+		if payload.EncryptedEvents, err = sealEvents(plaintext, key, keyID); err != nil {
+			return nil, err
+		}
+		payload.Events = nil
+	}
 
 	return json.Marshal(payload)
 }
@@ -395,11 +980,3 @@ func (s *LogShipper) GetStats() (shipped, dropped int64) {
 	defer s.mu.Unlock()
 	return s.eventsShipped, s.eventsDropped
 }
-
-// minDuration returns the minimum of two durations
-func minDuration(a, b time.Duration) time.Duration {
-	if a < b {
-		return a
-	}
-	return b
-}
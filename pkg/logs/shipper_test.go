@@ -0,0 +1,331 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUpdateQuotaFromHeaders(t *testing.T) {
+	s := NewLogShipper(nil, &LogShipperConfig{})
+
+	header := make(http.Header)
+	s.updateQuota(header)
+	if rate, _ := s.GetQuota(); rate != 0 {
+		t.Fatalf("expected no quota without headers, got %d", rate)
+	}
+
+	header.Set(quotaRateHeader, "5")
+	s.updateQuota(header)
+	if rate, burst := s.GetQuota(); rate != 5 || burst != 300 {
+		t.Errorf("expected 5/s with default burst 300, got %d/s burst %d", rate, burst)
+	}
+
+	header.Set(quotaBurstHeader, "20")
+	s.updateQuota(header)
+	if rate, burst := s.GetQuota(); rate != 5 || burst != 20 {
+		t.Errorf("expected 5/s burst 20, got %d/s burst %d", rate, burst)
+	}
+
+	header.Set(quotaRateHeader, "invalid")
+	s.updateQuota(header)
+	if rate, _ := s.GetQuota(); rate != 5 {
+		t.Errorf("invalid header must keep the quota, got %d", rate)
+	}
+
+	header.Set(quotaRateHeader, "0")
+	s.updateQuota(header)
+	if rate, _ := s.GetQuota(); rate != 0 {
+		t.Errorf("expected quota lifted, got %d", rate)
+	}
+}
+
+func TestApplyQuotaDownsamples(t *testing.T) {
+	s := NewLogShipper(nil, &LogShipperConfig{})
+	s.quota = NewLeakyBucket(4, 1)
+
+	events := make([]*BlockEvent, 10)
+	for i := range events {
+		events[i] = NewBlockEvent("1.2.3.4", "10.0.0.1", "GET", "example.com", "/", "https", "", "blocklist")
+	}
+	events[0].SetSampleRate(0.5)
+
+	kept := s.applyQuota(events)
+	if len(kept) != 4 {
+		t.Fatalf("expected 4 events within quota, got %d", len(kept))
+	}
+	if kept[0].Policy.SampleRate != 0.2 {
+		t.Errorf("expected combined sample rate 0.2, got %v", kept[0].Policy.SampleRate)
+	}
+	if kept[1].Policy.SampleRate != 0.4 {
+		t.Errorf("expected sample rate 0.4, got %v", kept[1].Policy.SampleRate)
+	}
+	if got := s.GetSampledOut(); got != 6 {
+		t.Errorf("expected 6 sampled out events, got %d", got)
+	}
+
+	// Quota exhausted: nothing is shipped
+	if kept := s.applyQuota([]*BlockEvent{NewBlockEvent("1.2.3.4", "", "GET", "", "/", "http", "", "blocklist")}); len(kept) != 0 {
+		t.Errorf("expected exhausted quota to ship nothing, got %d", len(kept))
+	}
+
+	// Without a quota batches pass through untouched
+	s.quota = nil
+	if kept := s.applyQuota(events[:3]); len(kept) != 3 {
+		t.Errorf("expected batch untouched without quota, got %d", len(kept))
+	}
+}
+
+func TestAdaptiveBucket(t *testing.T) {
+	tests := []struct {
+		eventRate float64
+		rate      int64
+	}{
+		{0, 1},        // idle deployments still flush every interval
+		{50, 2},       // one batch a second plus headroom
+		{2000, 41},    // 20 batches a second, doubled, plus one
+		{100000, 100}, // capped at the default rate
+	}
+	for _, tt := range tests {
+		capacity, rate := adaptiveBucket(tt.eventRate, 100, time.Second)
+		if rate != tt.rate || capacity != rate*bucketBurstSeconds {
+			t.Errorf("%v events/s: expected %d batches/s, got %d burst %d", tt.eventRate, tt.rate, rate, capacity)
+		}
+	}
+}
+
+func TestTuneBucket(t *testing.T) {
+	s := NewLogShipper(nil, &LogShipperConfig{BatchSize: 100, FlushInterval: time.Second, Adaptive: true})
+	start := s.lastTune
+
+	for i := 0; i < 6000; i++ {
+		s.SendEvent(NewBlockEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/", "https", "", "blocklist"))
+		select {
+		case <-s.eventChan:
+		default:
+		}
+	}
+
+	s.tuneBucket(start.Add(time.Second)) // too early, ignored
+	if capacity, rate := s.GetBucket(); capacity != defaultBucketCapacity || rate != defaultRefillRate {
+		t.Fatalf("expected defaults before the first interval, got %d burst %d", rate, capacity)
+	}
+
+	// 6000 events in a minute are 100/s: 2 batches plus 1 per flush
+	s.tuneBucket(start.Add(time.Minute))
+	if capacity, rate := s.GetBucket(); rate != 3 || capacity != 3*bucketBurstSeconds {
+		t.Errorf("expected 3 batches/s after the first sample, got %d burst %d", rate, capacity)
+	}
+
+	// A quiet minute only moves the average part of the way
+	s.tuneBucket(start.Add(2 * time.Minute))
+	if s.eventRate != 80 {
+		t.Errorf("expected moving average of 80 events/s, got %v", s.eventRate)
+	}
+}
+
+func TestAdaptiveFlushInterval(t *testing.T) {
+	tests := []struct {
+		eventRate float64
+		interval  time.Duration
+	}{
+		{0, time.Second},             // rare blocks are shipped right away
+		{1, 1900 * time.Millisecond}, // a tenth of a batch within the max
+		{5, 5500 * time.Millisecond}, // half a batch within the max
+		{10, 10 * time.Second},       // a full batch within the max
+		{1000, 10 * time.Second},     // full batches ship on their own
+	}
+	for _, tt := range tests {
+		if got := adaptiveFlushInterval(tt.eventRate, 100, time.Second, 10*time.Second); got != tt.interval {
+			t.Errorf("%v events/s: expected %v, got %v", tt.eventRate, tt.interval, got)
+		}
+	}
+}
+
+func TestAdaptFlush(t *testing.T) {
+	s := NewLogShipper(nil, &LogShipperConfig{BatchSize: 100, FlushInterval: time.Second, MaxFlushInterval: 10 * time.Second})
+	start := time.Now()
+	s.lastFlush = start
+
+	// 10 events/s fill a batch within the max
+	s.flushEvents = 10
+	next := s.adaptFlush(start.Add(time.Second))
+	if next != 10*time.Second || s.flushEvents != 0 {
+		t.Fatalf("expected the max interval at 10 events/s, got %v with %d events pending", next, s.flushEvents)
+	}
+	s.flushInterval = next
+
+	// Blocks stop: the average halves on each quiet flush
+	next = s.adaptFlush(start.Add(11 * time.Second))
+	if s.flushRate != 5 || next != 5500*time.Millisecond {
+		t.Errorf("expected 5 events/s and 5.5s after a quiet flush, got %v and %v", s.flushRate, next)
+	}
+	for i := 0; i < 20; i++ {
+		next = s.adaptFlush(start.Add(time.Duration(12+i) * time.Second))
+	}
+	if next != time.Second {
+		t.Errorf("expected the min interval once blocks stopped, got %v", next)
+	}
+
+	// Without a max above the min the interval is fixed
+	fixed := NewLogShipper(nil, &LogShipperConfig{BatchSize: 100, FlushInterval: time.Second})
+	fixed.flushEvents = 1000
+	if next := fixed.adaptFlush(time.Now().Add(time.Second)); next != time.Second {
+		t.Errorf("expected a fixed interval, got %v", next)
+	}
+}
+
+func TestResizeBuffer(t *testing.T) {
+	s := NewLogShipper(nil, &LogShipperConfig{BufferSize: 4})
+	for i := 0; i < 4; i++ {
+		s.buffer.Add(NewBlockEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/"+string(rune('a'+i)), "https", "", "blocklist"))
+	}
+
+	s.ResizeBuffer(2)
+	if s.BufferCapacity() != 2 {
+		t.Fatalf("expected capacity 2, got %d", s.BufferCapacity())
+	}
+	if _, dropped := s.GetStats(); dropped != 2 {
+		t.Errorf("expected the 2 oldest events dropped, got %d", dropped)
+	}
+	kept := s.buffer.DrainAll()
+	if len(kept) != 2 || kept[0].Request.Path != "/c" || kept[1].Request.Path != "/d" {
+		t.Errorf("expected the newest events kept in order, got %d", len(kept))
+	}
+
+	// Growing keeps everything and the buffer stays usable
+	s.buffer.Add(NewBlockEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/e", "https", "", "blocklist"))
+	s.ResizeBuffer(8)
+	for i := 0; i < 8; i++ {
+		s.buffer.Add(NewBlockEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/f", "https", "", "blocklist"))
+	}
+	if s.buffer.Size() != 8 {
+		t.Errorf("expected a full buffer of 8, got %d", s.buffer.Size())
+	}
+}
+
+func TestShipperRestart(t *testing.T) {
+	var received atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err == nil {
+			if events, ok := payload["events"].([]interface{}); ok {
+				received.Add(int64(len(events)))
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s := NewLogShipper(&keyProvider{url: server.URL}, &LogShipperConfig{BatchSize: 1, FlushInterval: 20 * time.Millisecond})
+	waitFor := func(want int64) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for received.Load() < want && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got := received.Load(); got != want {
+			t.Fatalf("expected %d shipped events, got %d", want, got)
+		}
+	}
+	event := func() *BlockEvent {
+		return NewBlockEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/", "https", "", "blocklist")
+	}
+
+	for cycle := int64(1); cycle <= 3; cycle++ {
+		s.Start()
+		s.Start() // no-op while running
+		s.SendEvent(event())
+		waitFor(2*cycle - 1)
+
+		if err := s.Stop(); err != nil {
+			t.Fatalf("cycle %d: stop failed: %v", cycle, err)
+		}
+		if err := s.Stop(); err != nil {
+			t.Fatalf("cycle %d: second stop failed: %v", cycle, err)
+		}
+
+		// Events sent while stopped are shipped after the next start
+		s.SendEvent(event())
+		if s.buffer.Size() != 1 {
+			t.Fatalf("cycle %d: expected the event to be buffered while stopped, got %d", cycle, s.buffer.Size())
+		}
+		s.Start()
+		waitFor(2 * cycle)
+		if err := s.Stop(); err != nil {
+			t.Fatalf("cycle %d: stop failed: %v", cycle, err)
+		}
+	}
+}
+
+func TestTuneBucketClockJump(t *testing.T) {
+	s := NewLogShipper(nil, &LogShipperConfig{BatchSize: 100, FlushInterval: time.Second, Adaptive: true})
+	start := s.lastTune
+
+	// A clock stepped back restarts the interval rather than waiting for
+	// the clock to catch up with the last tuning
+	s.tuneBucket(start.Add(-time.Hour))
+	if !s.lastTune.Equal(start.Add(-time.Hour)) {
+		t.Fatalf("expected the tuning to restart at the stepped clock, got %v", s.lastTune)
+	}
+	s.tuneBucket(start.Add(-time.Hour + time.Minute))
+	if s.eventRate != 0 {
+		t.Errorf("expected a tuning one interval after the jump, got rate %v", s.eventRate)
+	}
+}
+
+func TestShipperPollingMode(t *testing.T) {
+	var shipped int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Events []json.RawMessage `json:"events"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err == nil {
+			atomic.AddInt64(&shipped, int64(len(payload.Events)))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	s := NewLogShipper(&keyProvider{url: server.URL}, &LogShipperConfig{BatchSize: 10, FlushInterval: 20 * time.Millisecond, PollingMode: true})
+	s.Start()
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			s.SendEvent(NewBlockEvent("192.0.2.1", "192.0.2.1", "GET", "example.com", "/", "https", "", "blocklist"))
+		}
+	}
+	waitShipped := func(want int64) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt64(&shipped) < want && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got := atomic.LoadInt64(&shipped); got != want {
+			t.Fatalf("expected %d events shipped, got %d", want, got)
+		}
+	}
+
+	// Full batches and the partial one ship without touching the channel
+	send(25)
+	if n := len(s.eventChan); n != 0 {
+		t.Errorf("expected polling mode to bypass the channel, %d events queued", n)
+	}
+	waitShipped(25)
+
+	// Stopping drains the pending events; they and events sent while
+	// stopped are buffered for the next start
+	send(5)
+	if err := s.Stop(); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if pending := s.takePending(); len(pending) != 0 {
+		t.Errorf("expected no pending events after stop, got %d", len(pending))
+	}
+	send(3)
+	s.Start()
+	defer s.Stop()
+	waitShipped(33)
+}
@@ -0,0 +1,225 @@
+// Package metrics implements the few Prometheus metric types the plugin
+// needs and renders them in the Prometheus text exposition format. It uses
+// only the standard library so it can run under Yaegi.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the Prometheus text exposition format content type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	v atomic.Int64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add adds n to the counter
+func (c *Counter) Add(n int64) {
+	c.v.Add(n)
+}
+
+// Value returns the current count
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+// Histogram counts observations into fixed buckets
+type Histogram struct {
+	bounds  []float64      // Upper bounds, ascending
+	counts  []atomic.Int64 // Per bucket, non-cumulative, last is +Inf
+	count   atomic.Int64
+	sumBits atomic.Uint64 // float64 sum stored as bits
+}
+
+// NewHistogram creates a histogram with the given ascending upper bounds
+func NewHistogram(bounds []float64) *Histogram {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+	return &Histogram{
+		bounds: b,
+		counts: make([]atomic.Int64, len(b)+1),
+	}
+}
+
+// Observe records a value
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	for {
+		old := h.sumBits.Load()
+		if h.sumBits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() int64 {
+	return h.count.Load()
+}
+
+// series is one labeled time series of a family
+type series struct {
+	labels string // Rendered label set such as `decision="allowed"`, may be empty
+	value  func() float64
+	hist   *Histogram
+}
+
+// family is a named metric with its series
+type family struct {
+	name   string
+	help   string
+	typ    string // "counter", "gauge" or "histogram"
+	series []series
+}
+
+// Registry holds metric families and renders them
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	byName   map[string]*family
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*family)}
+}
+
+// Counter registers a counter series. Series sharing a name are grouped
+// into one family and must differ in labels.
+func (r *Registry) Counter(name, help, labels string) *Counter {
+	c := &Counter{}
+	r.add(name, help, "counter", series{labels: labels, value: func() float64 { return float64(c.Value()) }})
+	return c
+}
+
+// CounterFunc registers a counter series read from fn at scrape time
+func (r *Registry) CounterFunc(name, help, labels string, fn func() float64) {
+	r.add(name, help, "counter", series{labels: labels, value: fn})
+}
+
+// GaugeFunc registers a gauge series read from fn at scrape time
+func (r *Registry) GaugeFunc(name, help, labels string, fn func() float64) {
+	r.add(name, help, "gauge", series{labels: labels, value: fn})
+}
+
+// Histogram registers a histogram with the given bucket upper bounds
+func (r *Registry) Histogram(name, help string, bounds []float64) *Histogram {
+	h := NewHistogram(bounds)
+	r.add(name, help, "histogram", series{hist: h})
+	return h
+}
+
+func (r *Registry) add(name, help, typ string, s series) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.byName[name]
+	if !ok {
+		f = &family{name: name, help: help, typ: typ}
+		r.byName[name] = f
+		r.families = append(r.families, f)
+	}
+	f.series = append(f.series, s)
+}
+
+// WriteTo renders all families in the Prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]*family, len(r.families))
+	copy(families, r.families)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	for _, f := range families {
+		fmt.Fprintf(cw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(cw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.series {
+			if s.hist != nil {
+				writeHistogram(cw, f.name, s.hist)
+				continue
+			}
+			fmt.Fprintf(cw, "%s%s %s\n", f.name, braces(s.labels), formatFloat(s.value()))
+		}
+	}
+	return cw.n, bw.Flush()
+}
+
+// ServeHTTP serves the metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	if req.Method == http.MethodHead {
+		return
+	}
+	_, _ = r.WriteTo(w)
+}
+
+// writeHistogram renders cumulative buckets, sum and count
+func writeHistogram(w io.Writer, name string, h *Histogram) {
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i].Load()
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), cumulative)
+	}
+	cumulative += h.counts[len(h.bounds)].Load()
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, cumulative)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(math.Float64frombits(h.sumBits.Load())))
+	fmt.Fprintf(w, "%s_count %d\n", name, cumulative)
+}
+
+// Label renders a single label pair with an escaped value
+func Label(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return name + `="` + value + `"`
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter tracks bytes written for WriteTo
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryRendering(t *testing.T) {
+	r := NewRegistry()
+	allowed := r.Counter("ellio_requests_total", "Requests by decision.", Label("decision", "allowed"))
+	blocked := r.Counter("ellio_requests_total", "Requests by decision.", Label("decision", "blocked"))
+	r.GaugeFunc("ellio_edl_entries", "Entries in the loaded EDL.", "", func() float64 { return 42 })
+	h := r.Histogram("ellio_lookup_duration_seconds", "Lookup latency.", []float64{0.001, 0.01})
+
+	allowed.Add(3)
+	blocked.Inc()
+	h.Observe(0.0005)
+	h.Observe(0.001)
+	h.Observe(0.5)
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	text := out.String()
+
+	for _, want := range []string{
+		"# TYPE ellio_requests_total counter\n",
+		`ellio_requests_total{decision="allowed"} 3` + "\n",
+		`ellio_requests_total{decision="blocked"} 1` + "\n",
+		"# TYPE ellio_edl_entries gauge\nellio_edl_entries 42\n",
+		`ellio_lookup_duration_seconds_bucket{le="0.001"} 2` + "\n",
+		`ellio_lookup_duration_seconds_bucket{le="0.01"} 2` + "\n",
+		`ellio_lookup_duration_seconds_bucket{le="+Inf"} 3` + "\n",
+		"ellio_lookup_duration_seconds_sum 0.5015\n",
+		"ellio_lookup_duration_seconds_count 3\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "# TYPE ellio_requests_total") != 1 {
+		t.Error("expected series of one name to share a family header")
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	if got := Label("name", "a\"b\\c\nd"); got != `name="a\"b\\c\nd"` {
+		t.Errorf("unexpected escaping %s", got)
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("ellio_test_total", "Test.", "").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != ContentType {
+		t.Errorf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "ellio_test_total 1") {
+		t.Errorf("unexpected body %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+}
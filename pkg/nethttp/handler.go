@@ -0,0 +1,101 @@
+// Package nethttp provides a standard net/http middleware backed by an
+// ELLIO engine, for Go services that do not run inside Traefik.
+package nethttp
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+)
+
+// Engine is the subset of *engine.Engine used by Handler
+type Engine interface {
+	Enabled() bool
+	IsIPAllowed(clientIP string) (bool, error)
+	Mode() string
+	ReportBlock(event *logs.BlockEvent)
+}
+
+// Options configures Handler
+type Options struct {
+	// Engine makes the allow/block decisions (required), usually an *engine.Engine
+	Engine Engine
+	// ClientIP extracts the client IP from a request. Defaults to the
+	// connection's remote address; set it when running behind proxies.
+	ClientIP func(r *http.Request) string
+	// Blocked writes the response for blocked requests. Defaults to a plain 403.
+	Blocked http.Handler
+	// DisableEvents stops block events from being shipped
+	DisableEvents bool
+}
+
+// Handler returns middleware that rejects requests whose client IP is not
+// allowed by the engine's EDL. Requests pass through untouched while the
+// engine is disabled.
+func Handler(next http.Handler, opts Options) http.Handler {
+	clientIP := opts.ClientIP
+	if clientIP == nil {
+		clientIP = RemoteIP
+	}
+
+	blocked := opts.Blocked
+	if blocked == nil {
+		blocked = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if opts.Engine == nil || !opts.Engine.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		if ip == "" {
+			http.Error(w, "Unable to determine client IP", http.StatusBadRequest)
+			return
+		}
+
+		allowed, err := opts.Engine.IsIPAllowed(ip)
+		if err != nil {
+			http.Error(w, "Invalid IP address", http.StatusBadRequest)
+			return
+		}
+		if allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		blocked.ServeHTTP(w, r)
+
+		if opts.DisableEvents {
+			return
+		}
+
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		opts.Engine.ReportBlock(logs.NewBlockEvent(
+			ip,
+			RemoteIP(r),
+			r.Method,
+			r.Host,
+			r.URL.Path,
+			scheme,
+			r.Header.Get("User-Agent"),
+			opts.Engine.Mode(),
+		))
+	})
+}
+
+// RemoteIP returns the host part of the request's remote address
+func RemoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
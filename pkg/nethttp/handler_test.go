@@ -0,0 +1,109 @@
+package nethttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/engine"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+)
+
+// The real engine must satisfy the interface used by Handler
+var _ Engine = (*engine.Engine)(nil)
+
+// fakeEngine blocks the IPs in its set
+type fakeEngine struct {
+	enabled bool
+	blocked map[string]bool
+	events  []*logs.BlockEvent
+}
+
+func (f *fakeEngine) Enabled() bool { return f.enabled }
+
+func (f *fakeEngine) IsIPAllowed(clientIP string) (bool, error) {
+	if clientIP == "bogus" {
+		return false, errors.New("invalid IP")
+	}
+	return !f.blocked[clientIP], nil
+}
+
+func (f *fakeEngine) Mode() string { return "blocklist" }
+
+func (f *fakeEngine) ReportBlock(event *logs.BlockEvent) {
+	f.events = append(f.events, event)
+}
+
+func TestHandler(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		enabled      bool
+		remoteAddr   string
+		expectStatus int
+		expectEvents int
+	}{
+		{"allowed IP", true, "198.51.100.1:1234", http.StatusOK, 0},
+		{"blocked IP", true, "203.0.113.9:1234", http.StatusForbidden, 1},
+		{"engine disabled", false, "203.0.113.9:1234", http.StatusOK, 0},
+		{"invalid IP", true, "bogus", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eng := &fakeEngine{
+				enabled: tt.enabled,
+				blocked: map[string]bool{"203.0.113.9": true},
+			}
+			handler := Handler(okHandler, Options{Engine: eng})
+
+			req := httptest.NewRequest("GET", "/resource", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectStatus {
+				t.Errorf("expected status %d, got %d", tt.expectStatus, rec.Code)
+			}
+			if len(eng.events) != tt.expectEvents {
+				t.Fatalf("expected %d events, got %d", tt.expectEvents, len(eng.events))
+			}
+			if tt.expectEvents > 0 && eng.events[0].Client.IP != "203.0.113.9" {
+				t.Errorf("expected event for 203.0.113.9, got %s", eng.events[0].Client.IP)
+			}
+		})
+	}
+}
+
+func TestHandlerCustomOptions(t *testing.T) {
+	eng := &fakeEngine{enabled: true, blocked: map[string]bool{"203.0.113.9": true}}
+
+	handler := Handler(http.NotFoundHandler(), Options{
+		Engine: eng,
+		ClientIP: func(r *http.Request) string {
+			return r.Header.Get("X-Client-IP")
+		},
+		Blocked: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+		DisableEvents: true,
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Client-IP", "203.0.113.9")
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("expected custom blocked handler status, got %d", rec.Code)
+	}
+	if len(eng.events) != 0 {
+		t.Errorf("expected no events with DisableEvents, got %d", len(eng.events))
+	}
+}
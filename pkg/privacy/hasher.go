@@ -0,0 +1,125 @@
+// Package privacy hashes client identifiers before they leave the host.
+// Salts are delivered and rotated by the backend; during an overlap window
+// after a rotation, identifiers are hashed with both the new and the
+// previous salt so the backend can join events across the boundary.
+package privacy
+
+import (
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// DefaultOverlap is how long the previous salt stays in use after a rotation
+const DefaultOverlap = time.Hour
+
+// hashBytes is the length of the truncated HMAC in bytes
+const hashBytes = 16
+
+// salt is a backend-issued salt and its ID
+type salt struct {
+	id    string
+	value []byte
+}
+
+// state is an immutable snapshot of the salts in use
+type state struct {
+	enabled       bool
+	current       salt
+	previous      salt      // Empty when no rotation is in its overlap window
+	previousUntil time.Time // End of the overlap window
+}
+
+// Hashed is an identifier hashed with the active salt and, during an
+// overlap window, with the previous salt
+type Hashed struct {
+	SaltID         string
+	Value          string
+	PreviousSaltID string // Empty outside overlap windows
+	Previous       string
+}
+
+// Hasher hashes identifiers with the current salts. Reads are lock-free.
+type Hasher struct {
+	mu    sync.Mutex   // serializes Update
+	state atomic.Value // holds *state
+
+	now func() time.Time // clock, replaced in tests
+}
+
+// NewHasher creates a disabled hasher
+func NewHasher() *Hasher {
+	h := &Hasher{now: time.Now}
+	h.state.Store(&state{})
+	return h
+}
+
+// Update applies the privacy settings from the config API. A new salt ID
+// rotates the active salt and keeps the old one for overlap. Hashing is
+// only enabled when a salt is present.
+func (h *Hasher) Update(enabled bool, saltID, saltValue string, overlap time.Duration) {
+	if overlap <= 0 {
+		overlap = DefaultOverlap
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	old := h.load()
+	next := &state{
+		enabled:       enabled && saltID != "" && saltValue != "",
+		current:       salt{id: saltID, value: []byte(saltValue)},
+		previous:      old.previous,
+		previousUntil: old.previousUntil,
+	}
+	if enabled && !next.enabled {
+		logger.Warn("Identifier hashing requested without a salt, events keep raw IPs")
+	}
+
+	if old.current.id != "" && saltID != "" && old.current.id != saltID {
+		next.previous = old.current
+		next.previousUntil = h.now().Add(overlap)
+		logger.Infof("Hashing salt rotated from %s to %s, overlap until %s",
+			old.current.id, saltID, next.previousUntil.UTC().Format(time.RFC3339))
+	}
+	if next.previous.id == saltID {
+		next.previous = salt{} // rotated back to a salt still in its overlap window
+	}
+
+	h.state.Store(next)
+}
+
+// Enabled reports whether identifiers should be hashed
+func (h *Hasher) Enabled() bool {
+	return h.load().enabled
+}
+
+// Hash hashes value with the active salt and, within the overlap window,
+// the previous salt. Empty values stay empty.
+func (h *Hasher) Hash(value string) Hashed {
+	s := h.load()
+	result := Hashed{SaltID: s.current.id}
+	if value == "" {
+		return result
+	}
+	result.Value = mac(s.current.value, value)
+
+	if s.previous.id != "" && h.now().Before(s.previousUntil) {
+		result.PreviousSaltID = s.previous.id
+		result.Previous = mac(s.previous.value, value)
+	}
+	return result
+}
+
+func (h *Hasher) load() *state {
+	return h.state.Load().(*state)
+}
+
+// mac returns the truncated hex HMAC-SHA256 of value under key
+func mac(key []byte, value string) string {
+	return hex.EncodeToString(crypto.MAC(key, []byte(value))[:hashBytes])
+}
@@ -0,0 +1,71 @@
+package privacy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHasherDisabledByDefault(t *testing.T) {
+	h := NewHasher()
+	if h.Enabled() {
+		t.Error("expected hashing to be disabled until configured")
+	}
+	h.Update(true, "", "", 0)
+	if h.Enabled() {
+		t.Error("expected hashing to stay disabled without a salt")
+	}
+}
+
+func TestHasherHash(t *testing.T) {
+	h := NewHasher()
+	h.Update(true, "s1", "secret", 0)
+
+	a := h.Hash("192.0.2.1")
+	if a.SaltID != "s1" || len(a.Value) != 2*hashBytes {
+		t.Fatalf("unexpected hash %+v", a)
+	}
+	if a.Value == "192.0.2.1" || h.Hash("192.0.2.1").Value != a.Value {
+		t.Error("expected a stable hash that differs from the input")
+	}
+	if a.PreviousSaltID != "" {
+		t.Error("expected no previous hash without a rotation")
+	}
+	if h.Hash("").Value != "" {
+		t.Error("expected empty values to stay empty")
+	}
+}
+
+func TestHasherRotationOverlap(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := NewHasher()
+	h.now = func() time.Time { return now }
+
+	h.Update(true, "s1", "old", 0)
+	before := h.Hash("192.0.2.1")
+
+	h.Update(true, "s2", "new", 10*time.Minute)
+	during := h.Hash("192.0.2.1")
+	if during.SaltID != "s2" || during.Value == before.Value {
+		t.Errorf("expected the new salt to be active, got %+v", during)
+	}
+	if during.PreviousSaltID != "s1" || during.Previous != before.Value {
+		t.Errorf("expected the previous hash to match pre-rotation events, got %+v", during)
+	}
+
+	// Re-applying the same config must not restart the overlap
+	h.Update(true, "s2", "new", 10*time.Minute)
+	now = now.Add(10 * time.Minute)
+	if after := h.Hash("192.0.2.1"); after.PreviousSaltID != "" {
+		t.Errorf("expected the overlap to end, got %+v", after)
+	}
+}
+
+func TestHasherRotateBack(t *testing.T) {
+	h := NewHasher()
+	h.Update(true, "s1", "a", 0)
+	h.Update(true, "s2", "b", 0)
+	h.Update(true, "s1", "a", 0)
+	if got := h.Hash("192.0.2.1"); got.SaltID != "s1" || got.PreviousSaltID != "s2" {
+		t.Errorf("expected s2 to become the previous salt, got %+v", got)
+	}
+}
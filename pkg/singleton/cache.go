@@ -0,0 +1,300 @@
+package singleton
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// cacheManifestFile describes the cached EDL of a deployment
+const cacheManifestFile = "manifest.json"
+
+// cachedSource is one EDL source recorded in the cache manifest
+type cachedSource struct {
+	URL        string
+	File       string // Payload file name within the cache directory
+	Generation string
+	Allowlist  bool // Source of the allowlist of a combined EDL
+}
+
+// edlCacheManifest is the decoded cache manifest
+type edlCacheManifest struct {
+	Mode    string
+	SavedAt time.Time
+	Sources []cachedSource
+}
+
+// deploymentCacheDir returns the cache directory of a deployment below dir
+func deploymentCacheDir(dir, deploymentID string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, deploymentID)
+	if name == "" {
+		name = "default"
+	}
+	return filepath.Join(dir, "ellio-"+name)
+}
+
+// cacheFileName names the payload file of a source URL
+func cacheFileName(url string) string {
+	sum := crypto.Sum([]byte(url))
+	return "source-" + hex.EncodeToString(sum[:8]) + ".edl"
+}
+
+// SetCacheDir makes the updater keep the payload of every loaded source in
+// dir, together with a manifest, so a restart can enforce the last list
+// before the first download completes. Empty disables the cache.
+func (u *EDLUpdater) SetCacheDir(dir string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.cacheDir = dir
+}
+
+// cachePayloadFile creates a temporary file receiving a download, nil when
+// the cache is disabled or the file cannot be created
+func (u *EDLUpdater) cachePayloadFile() *os.File {
+	u.mu.RLock()
+	dir := u.cacheDir
+	u.mu.RUnlock()
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		logger.Warnf("EDL cache disabled for this download: %v", err)
+		return nil
+	}
+	f, err := os.CreateTemp(dir, "download-*.tmp")
+	if err != nil {
+		logger.Warnf("EDL cache disabled for this download: %v", err)
+		return nil
+	}
+	return f
+}
+
+// closeCacheFile closes a payload copy made by cachePayloadFile and returns
+// its path, or removes it and returns "" when the download failed
+func closeCacheFile(f *os.File, downloadErr error) string {
+	if f == nil {
+		return ""
+	}
+	closeErr := f.Close()
+	if downloadErr != nil || closeErr != nil {
+		_ = os.Remove(f.Name())
+		return ""
+	}
+	return f.Name()
+}
+
+// saveCache moves the payloads of newly loaded sources into place and
+// rewrites the manifest. Sources loaded from an unchanged generation keep
+// their cached payload.
+func (u *EDLUpdater) saveCache(p *pendingEDL) {
+	u.mu.RLock()
+	dir := u.cacheDir
+	u.mu.RUnlock()
+	if dir == "" {
+		return
+	}
+
+	sources := make([]interface{}, 0, len(p.sources))
+	for i, src := range p.sources {
+		name := cacheFileName(src.url)
+		if res := p.results[i]; p.errs[i] == nil && res.cacheFile != "" {
+			if err := os.Rename(res.cacheFile, filepath.Join(dir, name)); err != nil {
+				logger.Warnf("Failed to cache EDL from %s: %v", src.url, err)
+				continue
+			}
+			res.cacheFile = ""
+		}
+		u.mu.RLock()
+		generation := src.generation
+		allowlist := u.allowlist[src.url]
+		u.mu.RUnlock()
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			continue
+		}
+		entry := map[string]interface{}{
+			"url":        src.url,
+			"file":       name,
+			"generation": generation,
+		}
+		if allowlist {
+			entry["list"] = "allowlist"
+		}
+		sources = append(sources, entry)
+	}
+
+	mode := ""
+	if u.manager != nil {
+		mode = u.manager.GetEDLMode()
+	}
+	manifest := map[string]interface{}{
+		"mode":     mode,
+		"saved_at": time.Now().UTC().Format(time.RFC3339),
+		"sources":  sources,
+	}
+	data, err := json.Marshal(manifest)
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(dir, cacheManifestFile), data)
+	}
+	if err != nil {
+		logger.Warnf("Failed to write EDL cache manifest: %v", err)
+		return
+	}
+	logger.Debugf("EDL cache updated in %s", dir)
+}
+
+// discardCacheFiles removes the temporary payloads of results that were
+// not moved into the cache
+func (p *pendingEDL) discardCacheFiles() {
+	for _, res := range p.results {
+		if res != nil && res.cacheFile != "" {
+			_ = os.Remove(res.cacheFile)
+			res.cacheFile = ""
+		}
+	}
+}
+
+// writeFileAtomic replaces path with data through a temporary file
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readCacheManifest reads the manifest in dir. It is decoded into a map,
+// Yaegi may ignore struct tags.
+func readCacheManifest(dir string) (*edlCacheManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, cacheManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	manifest := &edlCacheManifest{}
+	manifest.Mode, _ = raw["mode"].(string)
+	if v, ok := raw["saved_at"].(string); ok {
+		manifest.SavedAt, _ = time.Parse(time.RFC3339, v)
+	}
+	items, _ := raw["sources"].([]interface{})
+	for _, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var src cachedSource
+		src.URL, _ = entry["url"].(string)
+		src.File, _ = entry["file"].(string)
+		src.Generation, _ = entry["generation"].(string)
+		list, _ := entry["list"].(string)
+		src.Allowlist = list == "allowlist"
+		if src.URL == "" || src.File == "" || filepath.Base(src.File) != src.File {
+			continue
+		}
+		manifest.Sources = append(manifest.Sources, src)
+	}
+	if len(manifest.Sources) == 0 {
+		return nil, errors.New("EDL cache manifest lists no sources")
+	}
+	return manifest, nil
+}
+
+// loadCachedEDL enforces the cached EDL of the deployment while the
+// manager initializes. It reports whether a cached list was loaded.
+func (m *Manager) loadCachedEDL() bool {
+	manifest, err := readCacheManifest(m.cacheDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("Ignoring EDL cache in %s: %v", m.cacheDir, err)
+		}
+		return false
+	}
+
+	urls := make([]string, 0, len(manifest.Sources))
+	var allowURLs []string
+	for _, src := range manifest.Sources {
+		urls = append(urls, src.URL)
+		if src.Allowlist {
+			allowURLs = append(allowURLs, src.URL)
+		}
+	}
+	mode := "blocklist"
+	switch manifest.Mode {
+	case "allowlist":
+		mode = "allowlist"
+	case EDLModeCombined:
+		mode = EDLModeCombined
+	default:
+		allowURLs = nil
+	}
+	if mode == EDLModeCombined && len(allowURLs) == 0 {
+		logger.Warnf("Ignoring EDL cache in %s: combined EDL without allowlist sources", m.cacheDir)
+		return false
+	}
+
+	m.mu.Lock()
+	m.edlMode = mode
+	m.mu.Unlock()
+
+	updater := m.newEDLUpdater(urls, defaultEDLUpdateFrequency)
+	updater.SetAllowlist(allowURLs)
+	if err := updater.loadCache(m.cacheDir, manifest); err != nil {
+		logger.Warnf("Ignoring EDL cache in %s: %v", m.cacheDir, err)
+		return false
+	}
+
+	m.mu.Lock()
+	m.edlUpdater = updater
+	m.edlURLs = urls
+	m.edlAllowURLs = allowURLs
+	m.edlUpdateFreq = defaultEDLUpdateFrequency
+	m.mu.Unlock()
+	m.cacheLoaded.Store(true)
+	logger.Infof("Enforcing the cached %s EDL saved at %s (%d entries) until the first download completes",
+		mode, manifest.SavedAt.Format(time.RFC3339), m.matcher.Count())
+	return true
+}
+
+// loadCache loads the cached payloads listed in manifest into the matcher.
+// Sources keep the cached generations, so the first download skips parsing
+// when the backend still serves them.
+func (u *EDLUpdater) loadCache(dir string, manifest *edlCacheManifest) error {
+	p := &pendingEDL{start: time.Now()}
+	u.mu.RLock()
+	p.sources = u.sources
+	u.mu.RUnlock()
+
+	p.results = make([]*edlResult, len(p.sources))
+	p.errs = make([]error, len(p.sources))
+	for i, src := range p.sources {
+		p.errs[i] = errors.New("not cached")
+		for _, cached := range manifest.Sources {
+			if cached.URL != src.url {
+				continue
+			}
+			res, err := u.fetchFile(filepath.Join(dir, cached.File), "")
+			if err == nil {
+				res.generation = cached.Generation
+			}
+			p.results[i], p.errs[i] = res, err
+			break
+		}
+	}
+	return u.apply(p)
+}
@@ -0,0 +1,83 @@
+package singleton
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+)
+
+func TestEDLCacheRoundTrip(t *testing.T) {
+	dir := deploymentCacheDir(t.TempDir(), "dep/1")
+	url := "https://edl.example.com/list"
+	downloads := 0
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			downloads++
+			header := make(http.Header)
+			header.Set(EDLGenerationHeader, "gen-1")
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader([]byte("203.0.113.0/24\n"))),
+				Header:     header,
+				Request:    req,
+			}, nil
+		}),
+	}
+
+	first := &Manager{matcher: ipmatcher.New(), cacheDir: dir, edlMode: "blocklist"}
+	updater := first.newEDLUpdater([]string{url}, 0)
+	updater.SetHTTPClient(client)
+	if err := updater.updateNow(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, cacheFileName(url))); err != nil {
+		t.Fatalf("expected the payload to be cached: %v", err)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(tmp) != 0 {
+		t.Errorf("expected no temporary files, got %v", tmp)
+	}
+
+	// A restarted manager enforces the cached list while initializing
+	restarted := &Manager{matcher: ipmatcher.New(), cacheDir: dir}
+	if !restarted.loadCachedEDL() {
+		t.Fatal("expected the cached EDL to load")
+	}
+	if d := restarted.Decide("203.0.113.9"); d.Allowed || d.Source != SourceEDL {
+		t.Errorf("expected a block from the cached EDL, got %s", d)
+	}
+	if g := restarted.GetEDLGeneration(); g != "gen-1" {
+		t.Errorf("expected the cached generation, got %q", g)
+	}
+
+	// The first download of the cached generation skips parsing
+	restarted.edlUpdater.SetHTTPClient(client)
+	if err := restarted.edlUpdater.updateNow(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, count := restarted.edlUpdater.GetStatus(); count != 1 {
+		t.Errorf("expected only the cache load to count as an update, got %d", count)
+	}
+	if downloads != 2 {
+		t.Errorf("expected 2 downloads, got %d", downloads)
+	}
+}
+
+func TestLoadCachedEDLMissing(t *testing.T) {
+	m := &Manager{matcher: ipmatcher.New(), cacheDir: filepath.Join(t.TempDir(), "none")}
+	if m.loadCachedEDL() {
+		t.Error("expected no cached EDL")
+	}
+	if m.IsDeploymentEnabled() {
+		t.Error("expected the deployment to stay disabled while initializing without a cache")
+	}
+	if _, ok := m.matcher.Lookup(netip.MustParseAddr("203.0.113.9")); ok {
+		t.Error("expected an empty matcher")
+	}
+}
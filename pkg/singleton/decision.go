@@ -0,0 +1,155 @@
+package singleton
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/asn"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// Decision sources
+const (
+	SourceEDL      = "edl"      // The EDL decided
+	SourceLocal    = "local"    // A local list file or the runtime overlay decided
+	SourceOverride = "override" // A static allow or block override matched
+	SourceGeo      = "geo"      // A geographic rule decided
+	SourceTorExit  = "tor_exit" // The Tor exit node list decided
+	SourceBypass   = "bypass"   // Enforcement did not apply, e.g. the deployment is disabled
+	SourceError    = "error"    // No verdict could be made, see Err
+)
+
+// EDLModeCombined evaluates an allowlist and a blocklist together. A client
+// on one list gets its verdict, clients on both lists or on neither get the
+// verdict of the precedence list.
+const EDLModeCombined = "combined"
+
+// Precedence of the lists of a combined EDL
+const (
+	PrecedenceAllowlist = "allowlist" // Blocklist enforcement, allowlisted clients are exempt
+	PrecedenceBlocklist = "blocklist" // Allowlist enforcement, blocklisted clients are refused anyway
+)
+
+// Decision is the verdict on a client together with why it was reached
+type Decision struct {
+	Allowed    bool
+	Source     string        // One of the Source constants
+	Matched    netip.Prefix  // Entry that matched the client, invalid when none did
+	Generation string        // EDL generation in effect, empty when unknown
+	List       string        // List of a combined EDL that matched, empty otherwise
+	ASN        string        // AS announcing the matched entry per the ASN table, e.g. "AS64500"
+	Country    string        // Country of the client per the geo file, empty without country rules
+	Latency    time.Duration // Time spent reaching the verdict
+	Err        error         // Set when Source is SourceError
+}
+
+// Verdict returns "allow" or "block"
+func (d Decision) Verdict() string {
+	if d.Allowed {
+		return "allow"
+	}
+	return "block"
+}
+
+// String formats the decision for logs and response headers
+func (d Decision) String() string {
+	s := d.Verdict() + "; source=" + d.Source
+	if d.Matched.IsValid() {
+		s += "; matched=" + d.Matched.String()
+	}
+	if d.List != "" {
+		s += "; list=" + d.List
+	}
+	if d.ASN != "" {
+		s += "; asn=" + d.ASN
+	}
+	if d.Country != "" {
+		s += "; country=" + d.Country
+	}
+	return s
+}
+
+// Decide checks a client IP against the EDL
+func (m *Manager) Decide(clientIP string) Decision {
+	start := time.Now()
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return Decision{Source: SourceError, Err: err, Latency: time.Since(start)}
+	}
+	// IPv4-mapped IPv6 clients are checked against the IPv4 entries
+	addr = addr.Unmap()
+	m.countFamily(addr)
+	return m.decide(start, clientIP, func(allowlist bool) (netip.Prefix, bool) {
+		if allowlist {
+			return m.matcher.LookupAllow(addr)
+		}
+		return m.matcher.Lookup(addr)
+	})
+}
+
+// DecidePrefix checks a client aggregated to prefix, such as the /64 of an
+// IPv6 address. The client counts as listed when any EDL entry covers or
+// lies within the prefix; the prefix itself is reported as matched.
+func (m *Manager) DecidePrefix(prefix netip.Prefix) Decision {
+	m.countFamily(prefix.Addr())
+	return m.decide(time.Now(), prefix.String(), func(allowlist bool) (netip.Prefix, bool) {
+		if allowlist {
+			return prefix, m.matcher.OverlapsAllowPrefix(prefix)
+		}
+		return prefix, m.matcher.OverlapsPrefix(prefix)
+	})
+}
+
+// decide applies the list mode to a lookup of the blocklist, or of the
+// allowlist of a combined EDL. In blocklist mode a match blocks, in
+// allowlist mode a match allows.
+func (m *Manager) decide(start time.Time, client string, lookup func(allowlist bool) (netip.Prefix, bool)) Decision {
+	if !m.IsDeploymentEnabled() {
+		return Decision{Allowed: true, Source: SourceBypass, Latency: time.Since(start)}
+	}
+
+	m.mu.RLock()
+	mode, precedence := m.edlMode, m.edlPrecedence
+	m.mu.RUnlock()
+
+	d := Decision{Source: SourceEDL, Generation: m.GetEDLGeneration()}
+	if mode == EDLModeCombined {
+		d.Allowed, d.Matched, d.List = decideCombined(precedence, lookup)
+	} else {
+		matched, inList := lookup(false)
+		if inList {
+			d.Matched = matched
+		}
+		d.Allowed = (mode == "blocklist") != inList
+	}
+	if number, ok := m.asnTable.Origin(d.Matched); ok {
+		d.ASN = asn.Format(number)
+	}
+	d.Latency = time.Since(start)
+	if logger.IsDebugEnabled() {
+		logger.Debugf("IP_CHECK %s - %s latency=%v", client, d, d.Latency)
+	}
+	return d
+}
+
+// decideCombined looks a client up on the precedence list first; a match
+// there decides. Otherwise a match on the other list decides, and clients
+// on neither get the verdict of the precedence list.
+func decideCombined(precedence string, lookup func(allowlist bool) (netip.Prefix, bool)) (allowed bool, matched netip.Prefix, list string) {
+	allowFirst := precedence != PrecedenceBlocklist
+	if prefix, ok := lookup(allowFirst); ok {
+		return allowFirst, prefix, listName(allowFirst)
+	}
+	if prefix, ok := lookup(!allowFirst); ok {
+		return !allowFirst, prefix, listName(!allowFirst)
+	}
+	return allowFirst, netip.Prefix{}, ""
+}
+
+// listName names the allowlist or the blocklist
+func listName(allowlist bool) string {
+	if allowlist {
+		return "allowlist"
+	}
+	return "blocklist"
+}
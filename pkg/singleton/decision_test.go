@@ -0,0 +1,172 @@
+package singleton
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/asn"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/iptrie"
+)
+
+// newDecisionManager returns an enabled manager with the given EDL entries
+func newDecisionManager(mode string, entries ...string) *Manager {
+	trie := iptrie.NewTrie()
+	for _, entry := range entries {
+		trie.Insert(netip.MustParsePrefix(entry))
+	}
+	m := &Manager{matcher: ipmatcher.New(), edlMode: mode, deploymentEnabled: true}
+	m.matcher.Update(trie, int64(len(entries)))
+	m.ready.Store(true)
+	return m
+}
+
+func TestDecide(t *testing.T) {
+	m := newDecisionManager("blocklist", "203.0.113.0/24", "2001:db8:1:2::1/128")
+
+	d := m.Decide("203.0.113.7")
+	if d.Allowed || d.Source != SourceEDL || d.Matched.String() != "203.0.113.0/24" {
+		t.Errorf("expected EDL block on 203.0.113.0/24, got %s", d)
+	}
+	if d.String() != "block; source=edl; matched=203.0.113.0/24" {
+		t.Errorf("unexpected formatting %q", d.String())
+	}
+
+	d = m.Decide("198.51.100.1")
+	if !d.Allowed || d.Source != SourceEDL || d.Matched.IsValid() {
+		t.Errorf("expected unmatched allow, got %s", d)
+	}
+
+	d = m.Decide("not-an-ip")
+	if d.Source != SourceError || d.Err == nil || d.Allowed {
+		t.Errorf("expected error decision, got %s err=%v", d, d.Err)
+	}
+
+	d = m.DecidePrefix(netip.MustParsePrefix("2001:db8:1:2::/64"))
+	if d.Allowed || d.Matched.String() != "2001:db8:1:2::/64" {
+		t.Errorf("expected aggregated block, got %s", d)
+	}
+
+	if allowed, err := m.IsIPAllowed("203.0.113.7"); allowed || err != nil {
+		t.Errorf("IsIPAllowed must follow Decide, got %v %v", allowed, err)
+	}
+}
+
+func TestDecideAllowlistAndBypass(t *testing.T) {
+	m := newDecisionManager("allowlist", "192.0.2.0/24")
+	if d := m.Decide("192.0.2.1"); !d.Allowed || d.Matched.String() != "192.0.2.0/24" {
+		t.Errorf("expected allowlisted client to pass, got %s", d)
+	}
+	if d := m.Decide("198.51.100.1"); d.Allowed {
+		t.Errorf("expected unlisted client to be blocked, got %s", d)
+	}
+
+	m.deploymentEnabled = false
+	if d := m.Decide("198.51.100.1"); !d.Allowed || d.Source != SourceBypass {
+		t.Errorf("expected bypass while disabled, got %s", d)
+	}
+}
+
+func TestDecideASN(t *testing.T) {
+	m := newDecisionManager("blocklist", "192.0.2.0/24", "203.0.113.0/24")
+	table, _, err := asn.Parse(strings.NewReader("192.0.2.0/24 AS64500\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.asnTable = table
+
+	d := m.Decide("192.0.2.1")
+	if d.ASN != "AS64500" || d.String() != "block; source=edl; matched=192.0.2.0/24; asn=AS64500" {
+		t.Errorf("expected the AS of the matched entry, got %s", d)
+	}
+	if d := m.Decide("203.0.113.1"); d.ASN != "" {
+		t.Errorf("expected no AS for an entry outside the table, got %s", d)
+	}
+	if d := m.Decide("198.51.100.1"); d.ASN != "" {
+		t.Errorf("expected no AS without a match, got %s", d)
+	}
+}
+
+func TestDecideIPv6Only(t *testing.T) {
+	entries := []string{"203.0.113.0/24", "198.51.100.7/32"}
+	m := newDecisionManager("blocklist", entries...)
+	trie, count := m.matcher.Snapshot()
+	m.setEDLFamilies(summarizeEDL("", trie, count, 0, nil))
+
+	// IPv4-mapped clients are IPv4 clients
+	if d := m.Decide("::ffff:203.0.113.7"); d.Allowed || d.Matched.String() != "203.0.113.0/24" {
+		t.Errorf("expected mapped client to match the IPv4 entry, got %s", d)
+	}
+	if m.FamilyMismatch() {
+		t.Error("a mapped IPv4 client is no IPv6 traffic")
+	}
+
+	m = newDecisionManager("blocklist", entries...)
+	m.setEDLFamilies(summarizeEDL("", trie, count, 0, nil))
+	for _, ip := range []string{"2001:db8::1", "2001:db8::2"} {
+		if d := m.Decide(ip); !d.Allowed || d.Matched.IsValid() {
+			t.Errorf("expected unmatched IPv6 client %s to pass, got %s", ip, d)
+		}
+	}
+	if !m.FamilyMismatch() || !m.familyWarned.Load() {
+		t.Error("expected a family mismatch for IPv6-only traffic against an IPv4-only EDL")
+	}
+
+	// An EDL with IPv6 entries clears the flag and re-arms the warning
+	v6 := iptrie.NewTrie()
+	v6.Insert(netip.MustParsePrefix("2001:db8::/32"))
+	m.setEDLFamilies(summarizeEDL("", v6, 1, 0, nil))
+	if m.FamilyMismatch() || m.familyWarned.Load() {
+		t.Error("expected no mismatch once the EDL has IPv6 entries")
+	}
+
+	// Any IPv4 client means the deployment is not IPv6-only
+	m.setEDLFamilies(summarizeEDL("", trie, count, 0, nil))
+	m.Decide("192.0.2.1")
+	if m.FamilyMismatch() {
+		t.Error("expected no mismatch with IPv4 traffic")
+	}
+}
+
+func TestDecideCombined(t *testing.T) {
+	block := iptrie.NewTrie()
+	block.Insert(netip.MustParsePrefix("203.0.113.0/24"))
+	allow := iptrie.NewTrie()
+	allow.Insert(netip.MustParsePrefix("203.0.113.7/32"))
+	allow.Insert(netip.MustParsePrefix("192.0.2.0/24"))
+	m := &Manager{matcher: ipmatcher.New(), edlMode: EDLModeCombined, edlPrecedence: PrecedenceAllowlist, deploymentEnabled: true}
+	m.matcher.UpdateLists(block, 1, allow, 2)
+	m.ready.Store(true)
+
+	tests := []struct {
+		precedence string
+		ip         string
+		allowed    bool
+		list       string
+	}{
+		{PrecedenceAllowlist, "203.0.113.7", true, "allowlist"}, // On both lists
+		{PrecedenceAllowlist, "203.0.113.8", false, "blocklist"},
+		{PrecedenceAllowlist, "192.0.2.1", true, "allowlist"},
+		{PrecedenceAllowlist, "198.51.100.1", true, ""}, // On neither
+		{PrecedenceBlocklist, "203.0.113.7", false, "blocklist"},
+		{PrecedenceBlocklist, "203.0.113.8", false, "blocklist"},
+		{PrecedenceBlocklist, "192.0.2.1", true, "allowlist"},
+		{PrecedenceBlocklist, "198.51.100.1", false, ""},
+	}
+	for _, tt := range tests {
+		m.edlPrecedence = tt.precedence
+		d := m.Decide(tt.ip)
+		if d.Allowed != tt.allowed || d.List != tt.list || d.Source != SourceEDL {
+			t.Errorf("%s precedence, %s: expected allowed=%v list=%q, got %s", tt.precedence, tt.ip, tt.allowed, tt.list, d)
+		}
+	}
+
+	m.edlPrecedence = PrecedenceAllowlist
+	if d := m.Decide("203.0.113.7"); d.String() != "allow; source=edl; matched=203.0.113.7/32; list=allowlist" {
+		t.Errorf("unexpected formatting %q", d.String())
+	}
+	if d := m.DecidePrefix(netip.MustParsePrefix("192.0.2.0/28")); !d.Allowed || d.List != "allowlist" {
+		t.Errorf("expected aggregated allowlist match, got %s", d)
+	}
+}
@@ -0,0 +1,121 @@
+package singleton
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDecisionErrors is how many recent decision errors are kept
+const maxDecisionErrors = 32
+
+// Bounds of the redacted inputs kept with decision errors
+const (
+	maxRedactedToken = 48  // Bytes kept of each unparsable header entry
+	maxRedactedInput = 160 // Bytes kept of a whole redacted input
+)
+
+// DecisionError records a request for which no verdict could be made
+type DecisionError struct {
+	Time     time.Time `json:"time"`
+	Strategy string    `json:"strategy"`         // IP strategy in effect
+	Input    string    `json:"input"`            // Client IP as extracted, redacted
+	Header   string    `json:"header,omitempty"` // Raw IP header of the strategy, redacted
+	Error    string    `json:"error"`
+}
+
+// decisionErrorRing keeps the most recent decision errors. The zero value
+// is ready to use.
+type decisionErrorRing struct {
+	mu      sync.Mutex
+	entries []DecisionError
+	next    int   // Slot the next error is written to once the ring is full
+	total   int64 // Errors recorded since start
+}
+
+func (r *decisionErrorRing) add(e DecisionError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.total++
+	if len(r.entries) < maxDecisionErrors {
+		r.entries = append(r.entries, e)
+		return
+	}
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % maxDecisionErrors
+}
+
+// list returns the kept errors, newest first, and the total recorded
+func (r *decisionErrorRing) list() ([]DecisionError, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]DecisionError, 0, len(r.entries))
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		out = append(out, r.entries[(r.next+i)%len(r.entries)])
+	}
+	return out, r.total
+}
+
+// RecordDecisionError keeps a decision error for the status endpoint.
+// input is the extracted client IP and header the raw value of the header
+// it came from, empty for the direct strategy.
+func (m *Manager) RecordDecisionError(input, header, strategy string, err error) {
+	if m == nil || err == nil {
+		return
+	}
+	m.decisionErrors.add(DecisionError{
+		Time:     time.Now(),
+		Strategy: strategy,
+		Input:    redactInput(input),
+		Header:   redactInput(header),
+		Error:    err.Error(),
+	})
+}
+
+// RecentDecisionErrors returns the most recent decision errors, newest
+// first, and how many were recorded since start
+func (m *Manager) RecentDecisionErrors() ([]DecisionError, int64) {
+	if m == nil {
+		return nil, 0
+	}
+	return m.decisionErrors.list()
+}
+
+// redactInput prepares a client-supplied IP header value for display.
+// Entries that parse as addresses are widened to their /24 or /48 so that
+// client IPs are not exposed; the unparsable entries, which are what an
+// operator needs to see, are kept but truncated and quoted when they
+// contain non-printable bytes.
+func redactInput(s string) string {
+	if s == "" {
+		return ""
+	}
+	parts := strings.Split(s, ",")
+	for i, part := range parts {
+		token := strings.TrimSpace(part)
+		if addr, err := netip.ParseAddr(token); err == nil {
+			addr = addr.Unmap()
+			bits := 24
+			if addr.Is6() {
+				bits = 48
+			}
+			prefix, _ := addr.Prefix(bits)
+			parts[i] = prefix.String()
+			continue
+		}
+		if len(token) > maxRedactedToken {
+			token = token[:maxRedactedToken] + "..."
+		}
+		if quoted := strconv.Quote(token); quoted[1:len(quoted)-1] != token {
+			token = quoted
+		}
+		parts[i] = token
+	}
+	out := strings.Join(parts, ", ")
+	if len(out) > maxRedactedInput {
+		out = out[:maxRedactedInput] + "..."
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+package singleton
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecordDecisionError(t *testing.T) {
+	m := &Manager{}
+	for i := 0; i < maxDecisionErrors+5; i++ {
+		m.RecordDecisionError("bad", "", "direct", errors.New("invalid"))
+	}
+	m.RecordDecisionError("latest", "", "direct", errors.New("invalid"))
+
+	recent, total := m.RecentDecisionErrors()
+	if total != maxDecisionErrors+6 {
+		t.Errorf("expected total %d, got %d", maxDecisionErrors+6, total)
+	}
+	if len(recent) != maxDecisionErrors {
+		t.Fatalf("expected %d kept errors, got %d", maxDecisionErrors, len(recent))
+	}
+	if recent[0].Input != "latest" {
+		t.Errorf("expected newest first, got %q", recent[0].Input)
+	}
+
+	var nilManager *Manager
+	nilManager.RecordDecisionError("bad", "", "direct", errors.New("invalid"))
+}
+
+func TestRedactInput(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"203.0.113.7", "203.0.113.0/24"},
+		{"unknown, 203.0.113.7", "unknown, 203.0.113.0/24"},
+		{"2001:db8:1:2::5", "2001:db8:1::/48"},
+		{"::ffff:198.51.100.9", "198.51.100.0/24"},
+		{"bad\x00ip", `"bad\x00ip"`},
+		{strings.Repeat("a", 60), strings.Repeat("a", maxRedactedToken) + "..."},
+	}
+	for _, tt := range tests {
+		if got := redactInput(tt.in); got != tt.want {
+			t.Errorf("redactInput(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if got := redactInput(strings.Repeat("x,", 200)); len(got) > maxRedactedInput+3 {
+		t.Errorf("expected output bounded to %d bytes, got %d", maxRedactedInput, len(got))
+	}
+}
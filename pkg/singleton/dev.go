@@ -0,0 +1,47 @@
+package singleton
+
+import (
+	"strings"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// devDeploymentID names the deployment of dev mode managers
+const devDeploymentID = "dev"
+
+// startDev enforces the inline DevBlocklist for local development. Like an
+// offline manager it never contacts the ELLIO API and ships no events, but
+// the list is fixed for the lifetime of the manager and may be empty.
+func (m *Manager) startDev(opts Options) (err error) {
+	defer func() {
+		m.mu.Lock()
+		m.initErr = err
+		m.mu.Unlock()
+		m.ready.Store(true)
+		m.refreshState()
+		logger.Tracef("Manager ready (dev mode) - err=%v", err)
+	}()
+
+	m.mu.Lock()
+	m.offline = true
+	m.dev = true
+	m.deploymentID = devDeploymentID
+	m.deploymentEnabled = true
+	m.edlMode = "blocklist"
+	m.mu.Unlock()
+
+	logger.Warn("Dev mode is enabled, the ELLIO API is not used; do not run it in production")
+	if len(opts.DevBlocklist) == 0 {
+		logger.Info("Dev mode without devBlocklist, allowing all clients")
+		return nil
+	}
+
+	trie, count, err := parsePlainEDL(strings.NewReader(strings.Join(opts.DevBlocklist, "\n")), m.asnTable)
+	if err != nil {
+		logger.Errorf("Invalid devBlocklist: %v", err)
+		return err
+	}
+	m.matcher.Update(trie, count)
+	logger.Infof("Dev mode blocking %d devBlocklist entries", count)
+	return nil
+}
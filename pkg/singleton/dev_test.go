@@ -0,0 +1,54 @@
+package singleton
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewManagerDev(t *testing.T) {
+	m, err := NewManager(Options{DevMode: true, DevBlocklist: []string{"203.0.113.0/24", "2001:db8::1"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer m.Stop()
+
+	if ready, reason := m.Readiness(); !ready {
+		t.Errorf("expected ready, got reason %q", reason)
+	}
+	if d := m.Decide("203.0.113.7"); d.Allowed || d.Source != SourceEDL || d.Matched.String() != "203.0.113.0/24" {
+		t.Errorf("expected a devBlocklist block, got %s", d)
+	}
+	if d := m.Decide("192.0.2.1"); !d.Allowed {
+		t.Errorf("expected clients off the devBlocklist to pass, got %s", d)
+	}
+
+	status := m.Status()
+	if !status.DevMode || !status.Offline || status.DeploymentID != devDeploymentID || status.Token != nil || status.Shipper.Enabled {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if status.EDL == nil || status.EDL.Entries != 2 {
+		t.Errorf("expected 2 EDL entries, got %+v", status.EDL)
+	}
+
+	// Without a list every client passes
+	empty, err := NewManager(Options{DevMode: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer empty.Stop()
+	if d := empty.Decide("203.0.113.7"); !d.Allowed {
+		t.Errorf("expected an empty devBlocklist to allow, got %s", d)
+	}
+
+	if _, err := NewManager(Options{DevMode: true, DevBlocklist: []string{"not-an-ip"}}); err == nil {
+		t.Error("expected an error for a devBlocklist without valid entries")
+	}
+}
+
+func TestDeploymentKeyDev(t *testing.T) {
+	a := deploymentKey(Options{DevMode: true, DevBlocklist: []string{"203.0.113.0/24"}})
+	b := deploymentKey(Options{DevMode: true, DevBlocklist: []string{"198.51.100.0/24"}})
+	if a == b || !strings.HasPrefix(a, devDeploymentID+"-") {
+		t.Errorf("expected distinct dev keys per list, got %q and %q", a, b)
+	}
+}
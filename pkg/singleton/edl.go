@@ -1,59 +1,163 @@
 package singleton
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/api"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/asn"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/backoff"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/iptrie"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
 )
 
-// EDLUpdater manages EDL fetching and updating
+// EDLUpdater manages EDL fetching and updating. Each URL is a source with
+// its own trie; the matcher holds the merge of all source tries.
 type EDLUpdater struct {
-	url             string
+	urls            []string
 	updateFrequency time.Duration
 	matcher         *ipmatcher.Matcher
 	client          *http.Client
-	manager         *Manager // Reference to manager for cache clearing
+	manager         *Manager        // Reference to manager for cache clearing
+	format          string          // Accepted payload format, EDLFormatAuto unless set
+	cacheDir        string          // Directory loaded payloads are kept in, empty disables the cache (guarded by mu)
+	retry           backoff.Policy  // Retries of a failed download (guarded by mu)
+	allowlist       map[string]bool // URLs of the allowlist of a combined config, the others are the blocklist (guarded by mu)
+	asnTable        *asn.Table      // Resolves ASN entries of plain-text lists, nil when none is configured (guarded by mu)
 
 	mu          sync.RWMutex
+	sources     []*edlSource // One per URL, in the order of urls
 	lastUpdate  time.Time
 	lastError   error
 	updateCount int64
+	generation  string                 // Generation ID of the loaded list, empty if the backend sends none
+	summary     *logs.EDLUpdateDetails // Statistics of the last parsed list
 
-	stopCh        chan struct{}
+	loop          lifecycle     // Background update loop
 	reconfigureCh chan struct{} // Signal to restart update loop
 }
 
-// NewEDLUpdater creates a new EDL updater
-func NewEDLUpdater(url string, updateFrequency time.Duration, matcher *ipmatcher.Matcher, manager *Manager) *EDLUpdater {
+// EDLGenerationHeader carries the backend's content-addressed list generation ID
+const EDLGenerationHeader = "X-EDL-Generation"
+
+// EDLChecksumHeader carries the hex or base64 SHA-256 of the EDL payload
+// after content decoding. When present the download is verified before
+// the list is loaded.
+const EDLChecksumHeader = "X-Content-SHA256"
+
+// defaultEDLRetry is the retry policy of EDL downloads unless configured
+var defaultEDLRetry = backoff.Policy{Attempts: 3, Base: 2 * time.Second, Max: 30 * time.Second}
+
+// FileURLPrefix marks an EDL URL that names a local file instead of an HTTP endpoint
+const FileURLPrefix = "file://"
+
+// EDL payload formats. EDLFormatAuto accepts ELLIOTRIE and falls back to the
+// plain-text parser for anything else, easing migration from generic list
+// URLs; EDLFormatBinary rejects payloads without the ELLIOTRIE header.
+const (
+	EDLFormatAuto   = "auto"
+	EDLFormatBinary = "binary"
+
+	// Formats recorded per loaded list
+	FormatELLIOTRIE = "elliotrie"
+	FormatPlain     = "plain"
+	formatMixed     = "mixed" // Merged sources of different formats
+)
+
+// EDLHTTPClientFactory builds the HTTP client used for EDL downloads.
+// Tests can replace it to stub EDL responses without a network.
+var EDLHTTPClientFactory = func() *http.Client {
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        10,
+			IdleConnTimeout:     30 * time.Second,
+			DisableCompression:  true,
+			MaxIdleConnsPerHost: 2,
+		},
+	}
+}
+
+// edlSource tracks one EDL URL of an updater (guarded by the updater's mu)
+type edlSource struct {
+	url        string
+	trie       *iptrie.Trie // Last loaded list, nil before the first successful load
+	count      int64
+	bytes      int64  // Memory estimate of trie, only computed with several sources
+	format     string // Format of the loaded list, FormatELLIOTRIE or FormatPlain
+	generation string
+	lastUpdate time.Time
+	lastError  error
+}
+
+// EDLSourceStatus reports the state of one EDL URL
+type EDLSourceStatus struct {
+	URL        string    `json:"url"`
+	List       string    `json:"list,omitempty"` // allowlist or blocklist of a combined config
+	Generation string    `json:"generation,omitempty"`
+	Entries    int64     `json:"entries"`
+	Format     string    `json:"format,omitempty"`
+	LastUpdate time.Time `json:"last_update"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// NewEDLUpdater creates a new EDL updater for one or more EDL URLs
+func NewEDLUpdater(urls []string, updateFrequency time.Duration, matcher *ipmatcher.Matcher, manager *Manager) *EDLUpdater {
 	return &EDLUpdater{
-		url:             url,
+		urls:            urls,
+		sources:         newEDLSources(urls, nil),
 		updateFrequency: updateFrequency,
 		matcher:         matcher,
 		manager:         manager,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        10,
-				IdleConnTimeout:     30 * time.Second,
-				DisableCompression:  true,
-				MaxIdleConnsPerHost: 2,
-			},
-		},
-		stopCh:        make(chan struct{}),
-		reconfigureCh: make(chan struct{}, 1),
+		format:          EDLFormatAuto,
+		retry:           defaultEDLRetry,
+		client:          EDLHTTPClientFactory(),
+		reconfigureCh:   make(chan struct{}, 1),
+	}
+}
+
+// newEDLSources builds the sources for urls, keeping the state of sources
+// in previous whose URL is still listed
+func newEDLSources(urls []string, previous []*edlSource) []*edlSource {
+	sources := make([]*edlSource, 0, len(urls))
+	for _, url := range urls {
+		src := &edlSource{url: url}
+		for _, old := range previous {
+			if old.url == url {
+				src = old
+				break
+			}
+		}
+		sources = append(sources, src)
 	}
+	return sources
 }
 
 // Start performs initial EDL fetch
 func (u *EDLUpdater) Start(ctx context.Context) error {
-	if u.url == "" {
+	u.mu.RLock()
+	empty := len(u.urls) == 0
+	u.mu.RUnlock()
+	if empty {
 		return errors.New("EDL URL is empty")
 	}
 
@@ -65,61 +169,325 @@ func (u *EDLUpdater) Start(ctx context.Context) error {
 	return nil
 }
 
-// StartUpdateLoop starts the background update loop
+// maxPrefetchLead caps how early the next EDL is downloaded before the
+// update boundary; minPrefetchFrequency disables prefetching for short
+// intervals where the overlap would not help
+const (
+	maxPrefetchLead      = 30 * time.Second
+	minPrefetchFrequency = 10 * time.Second
+)
+
+// prefetchLead returns how long before each update boundary the next EDL is
+// downloaded and parsed, a tenth of the interval capped at maxPrefetchLead
+func prefetchLead(freq time.Duration) time.Duration {
+	if freq < minPrefetchFrequency {
+		return 0
+	}
+	lead := freq / 10
+	if lead > maxPrefetchLead {
+		lead = maxPrefetchLead
+	}
+	return lead
+}
+
+// pendingEDL is a prefetched EDL waiting for the update boundary
+type pendingEDL struct {
+	sources []*edlSource // Sources the fetch was made for
+	results []*edlResult // Per source, nil where the fetch failed
+	errs    []error      // Per source
+	loaded  string       // Generation the fetch was made against
+	start   time.Time
+}
+
+// StartUpdateLoop starts the background update loop unless it is already
+// running; a loop ended by Stop can be started again. The next list is
+// prefetched shortly before each update boundary so large lists are already
+// parsed when the matcher is swapped.
 func (u *EDLUpdater) StartUpdateLoop(ctx context.Context) {
+	stopCh, ok := u.loop.start()
+	if !ok {
+		logger.Trace("EDL update loop already running")
+		return
+	}
+	go func() {
+		defer u.loop.finish(stopCh)
+		u.updateLoop(ctx, stopCh)
+	}()
+}
+
+// updateLoop runs the update loop until ctx is done or stopCh is closed
+func (u *EDLUpdater) updateLoop(ctx context.Context, stopCh chan struct{}) {
 	for {
 		u.mu.RLock()
 		freq := u.updateFrequency
 		u.mu.RUnlock()
 
-		ticker := time.NewTicker(freq)
+		lead := prefetchLead(freq)
+		next := time.Now().Add(freq)
+		var pending *pendingEDL
 
 		// Inner loop with current configuration
 		running := true
 		for running {
+			boundary := time.NewTimer(time.Until(next))
+			var prefetchC <-chan time.Time
+			var prefetch *time.Timer
+			if lead > 0 && pending == nil {
+				prefetch = time.NewTimer(time.Until(next.Add(-lead)))
+				prefetchC = prefetch.C
+			}
+
 			select {
 			case <-ctx.Done():
-				ticker.Stop()
-				return
-			case <-u.stopCh:
-				ticker.Stop()
-				return
+				running = false
+			case <-stopCh:
+				running = false
 			case <-u.reconfigureCh:
 				// Configuration changed, restart with new settings
-				ticker.Stop()
 				running = false
 				logger.Trace("EDL updater reconfiguring with new settings")
-			case <-ticker.C:
-				if err := u.updateNow(ctx); err != nil {
+			case <-prefetchC:
+				pending = u.prefetch(ctx)
+				logger.Tracef("EDL prefetched %v before the update boundary", time.Until(next))
+			case <-boundary.C:
+				var err error
+				if pending != nil {
+					err = u.swap(ctx, pending)
+				} else {
+					err = u.updateNow(ctx)
+				}
+				if err != nil {
 					logger.Errorf("EDL update failed: %v", err)
 				}
+				pending = nil
+				next = next.Add(freq)
+				if now := time.Now(); next.Before(now) {
+					// Fell behind, e.g. a slow download; keep the interval from now
+					next = now.Add(freq)
+				}
 			}
+
+			boundary.Stop()
+			if prefetch != nil {
+				prefetch.Stop()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-stopCh:
+			return
+		default:
 		}
 	}
 }
 
 // updateNow performs an immediate EDL update
 func (u *EDLUpdater) updateNow(ctx context.Context) error {
-	start := time.Now()
+	return u.apply(u.prefetch(ctx))
+}
 
-	trie, count, err := u.fetchWithRetry(ctx)
-	if err != nil {
+// prefetch downloads and parses all sources in parallel without touching
+// the matcher
+func (u *EDLUpdater) prefetch(ctx context.Context) *pendingEDL {
+	p := &pendingEDL{start: time.Now()}
+
+	u.mu.RLock()
+	p.loaded = u.generation
+	p.sources = u.sources
+	loaded := make([]string, len(p.sources))
+	for i, src := range p.sources {
+		loaded[i] = src.generation
+	}
+	u.mu.RUnlock()
+
+	p.results = make([]*edlResult, len(p.sources))
+	p.errs = make([]error, len(p.sources))
+	var wg sync.WaitGroup
+	for i, src := range p.sources {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			p.results[i], p.errs[i] = u.fetchShared(ctx, url, loaded[i])
+		}(i, src.url)
+	}
+	wg.Wait()
+	return p
+}
+
+// swap applies a prefetched EDL at the update boundary. The fetch is redone
+// when another update changed the loaded generation in the meantime.
+func (u *EDLUpdater) swap(ctx context.Context, p *pendingEDL) error {
+	if p.loaded != u.Generation() {
+		p.discardCacheFiles()
+		return u.updateNow(ctx)
+	}
+	return u.apply(p)
+}
+
+// apply swaps a fetched EDL into the matcher and records the outcome. A
+// source whose fetch failed keeps contributing its last loaded list; the
+// update only fails when no source could be fetched.
+func (u *EDLUpdater) apply(p *pendingEDL) error {
+	defer p.discardCacheFiles()
+	start := p.start
+	url := u.label()
+
+	// Candidate state per source: the fetched list or the loaded one. The
+	// allowlist sources of a combined config are merged separately.
+	n := len(p.sources)
+	tries := make([]*iptrie.Trie, 0, n)
+	var allowTries []*iptrie.Trie
+	var allowCount int64
+	counts := make([]int64, n)
+	sizes := make([]int64, n)
+	generations := make([]string, n)
+	formats := make([]string, n)
+	var failed []error
+	parsed := false
+
+	u.mu.RLock()
+	previous := u.summary
+	loaded := u.generation
+	combined := len(u.allowlist) > 0
+	for i, src := range p.sources {
+		trie, count, size, generation, format := src.trie, src.count, src.bytes, src.generation, src.format
+		if err := p.errs[i]; err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", src.url, err))
+		} else if res := p.results[i]; !res.unchanged {
+			trie, count, size, generation = res.trie, res.count, 0, res.generation
+			if res.format != format {
+				logFormatChange(src.url, res.format)
+			}
+			format = res.format
+			parsed = true
+		}
+		if n > 1 && size == 0 && trie != nil {
+			// Source tries are kept next to the merged one
+			size = trie.Stats().MemoryBytes()
+		}
+		switch {
+		case trie == nil:
+		case u.allowlist[src.url]:
+			allowTries = append(allowTries, trie)
+			allowCount += count
+			count = 0
+		default:
+			tries = append(tries, trie)
+		}
+		counts[i], sizes[i], generations[i], formats[i] = count, size, generation, format
+	}
+	u.mu.RUnlock()
+
+	var err error
+	if len(failed) == 1 && n == 1 {
+		err = failed[0]
+	} else if len(failed) > 0 {
+		err = fmt.Errorf("%d of %d EDL sources failed, first: %w", len(failed), n, failed[0])
+	}
+	now := time.Now()
+
+	// A combined config is only enforced with both of its lists, one alone
+	// would allow or block far more than intended
+	unusable := len(failed) == n
+	if !unusable && combined && (len(tries) == 0 || len(allowTries) == 0) {
+		missing := "allowlist"
+		if len(tries) == 0 {
+			missing = "blocklist"
+		}
+		err, unusable = fmt.Errorf("combined EDL has no %s loaded", missing), true
+	}
+
+	if unusable {
 		u.mu.Lock()
 		u.lastError = err
+		for i, src := range p.sources {
+			src.lastError = p.errs[i]
+		}
 		u.mu.Unlock()
+		u.manager.notifyEDLUpdated(EDLUpdate{URL: url, Generation: u.Generation(), Err: err})
 		return err
 	}
+	if err != nil {
+		logger.Warnf("EDL update incomplete, failed sources keep their last list: %v", err)
+	}
+
+	generation := strings.Join(generations, ",")
+	if !parsed && generation == loaded {
+		u.mu.Lock()
+		u.lastUpdate = now
+		u.lastError = err
+		u.recordSources(p, now)
+		u.mu.Unlock()
+		logger.Debugf("EDL generation %s unchanged, skipped parsing", generation)
+		u.manager.notifyEDLUpdated(EDLUpdate{URL: url, Generation: generation, Unchanged: true})
+		return nil
+	}
 
-	// Update the matcher
-	u.matcher.Update(trie, count)
+	// Several sources are merged into a trie of their own; a single source
+	// trie is used as is
+	trie := iptrie.NewTrie()
+	var count, sourceBytes int64
+	for i := range counts {
+		count += counts[i]
+		sourceBytes += sizes[i]
+	}
+	switch {
+	case len(tries) == 1 && n == 1:
+		trie = tries[0]
+	case len(tries) > 0:
+		trie = iptrie.Merge(tries...)
+	}
+	var allow *iptrie.Trie
+	if combined {
+		allow = iptrie.Merge(allowTries...)
+		sourceBytes += allow.Stats().MemoryBytes()
+	}
+	duration := time.Since(start)
+	summary := summarizeEDL(generation, trie, count, duration, previous)
+	summary.Format = mergedFormat(formats)
 
+	// Keep the loaded list when the new one does not fit the memory budget
+	if err := u.manager.checkMemoryBudget(summary.MemoryBytes + sourceBytes); err != nil {
+		logger.Errorf("Refusing EDL update: %v", err)
+		u.mu.Lock()
+		u.lastError = err
+		u.mu.Unlock()
+		u.manager.notifyEDLUpdated(EDLUpdate{URL: url, Generation: u.Generation(), Err: err})
+		return err
+	}
+
+	// Update the matcher under the lock so the generation always describes
+	// the list being enforced
 	u.mu.Lock()
-	u.lastUpdate = time.Now()
-	u.lastError = nil
+	if combined {
+		u.matcher.UpdateLists(trie, count, allow, allowCount)
+	} else {
+		u.matcher.Update(trie, count)
+	}
+	u.lastUpdate = now
+	u.lastError = err
 	u.updateCount++
+	u.generation = generation
+	u.summary = summary
+	u.recordSources(p, now)
+	for i, src := range p.sources {
+		if res := p.results[i]; p.errs[i] == nil && !res.unchanged {
+			src.trie, src.count, src.bytes, src.generation = res.trie, res.count, sizes[i], res.generation
+			src.format = res.format
+		}
+	}
 	u.mu.Unlock()
+	u.saveCache(p)
+	u.manager.setEDLFamilies(summary)
 
-	duration := time.Since(start)
+	if len(summary.Anomalies) > 0 {
+		logger.Warnf("EDL load anomalies: %s (entries=%d duplicates=%d host_share=%.2f ipv4_share=%.2f)",
+			strings.Join(summary.Anomalies, ", "), summary.Entries, summary.Duplicates,
+			summary.HostShare, summary.IPv4Share)
+	}
+	u.manager.notifyEDLUpdated(EDLUpdate{URL: url, Generation: generation, Summary: summary})
 	if count == 0 {
 		logger.Infof("EDL updated with empty list in %v", duration)
 	} else {
@@ -138,67 +506,348 @@ func (u *EDLUpdater) updateNow(ctx context.Context) error {
 	return nil
 }
 
-// fetchWithRetry fetches EDL with retry logic
-func (u *EDLUpdater) fetchWithRetry(ctx context.Context) (*iptrie.Trie, int64, error) {
-	var lastErr error
-	maxAttempts := 3
+// logFormatChange reports the format a source serves when it differs from
+// the last loaded list
+func logFormatChange(url, format string) {
+	if format == FormatPlain {
+		logger.Infof("EDL source %s serves a plain-text list, loading it in compatibility mode; the ELLIOTRIE format loads faster", url)
+		return
+	}
+	logger.Debugf("EDL source %s serves the %s format", url, format)
+}
 
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		if attempt > 0 {
-			// Wait before retry
-			select {
-			case <-ctx.Done():
-				return nil, 0, ctx.Err()
-			case <-time.After(time.Duration(attempt) * 2 * time.Second):
-			}
+// mergedFormat names the format of a list merged from sources, empty for
+// sources that never loaded
+func mergedFormat(formats []string) string {
+	merged := ""
+	for _, format := range formats {
+		switch {
+		case format == "" || format == merged:
+		case merged == "":
+			merged = format
+		default:
+			return formatMixed
 		}
+	}
+	return merged
+}
 
-		trie, count, err := u.fetch(ctx)
-		if err == nil {
-			return trie, count, nil
+// recordSources stores the fetch outcome of each source. Callers hold u.mu.
+func (u *EDLUpdater) recordSources(p *pendingEDL, now time.Time) {
+	for i, src := range p.sources {
+		src.lastError = p.errs[i]
+		if p.errs[i] == nil {
+			src.lastUpdate = now
 		}
+	}
+}
 
-		lastErr = err
-		logger.Warnf("EDL fetch attempt %d/%d failed: %v", attempt+1, maxAttempts, err)
+// label names the sources in hook notifications, comma separated
+func (u *EDLUpdater) label() string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return strings.Join(u.urls, ",")
+}
+
+// edlResult carries a fetch result, possibly shared between updaters
+type edlResult struct {
+	trie       *iptrie.Trie
+	count      int64
+	format     string // FormatELLIOTRIE or FormatPlain, empty when unchanged
+	generation string
+	unchanged  bool   // generation matched the loaded one, trie is nil
+	cacheFile  string // Temporary copy of the payload for the EDL cache, if any
+}
+
+// fetchShared coalesces concurrent fetches of the same URL so that parallel
+// updaters started together download and parse the list only once. The trie
+// is read-only once built, so sharing it between matchers is safe. The key
+// includes the loaded generation because an unchanged result is only
+// meaningful to updaters holding that generation.
+func (u *EDLUpdater) fetchShared(ctx context.Context, url, loaded string) (*edlResult, error) {
+	val, err, shared := fetchGroup.Do("edl:"+url+"#"+loaded, func() (interface{}, error) {
+		return u.fetchWithRetry(ctx, url, loaded)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		logger.Trace("EDL fetch coalesced with an in-flight download")
+	}
+	return val.(*edlResult), nil
+}
+
+// fetchWithRetry fetches EDL with full-jitter backoff between attempts
+func (u *EDLUpdater) fetchWithRetry(ctx context.Context, url, loaded string) (*edlResult, error) {
+	u.mu.RLock()
+	policy := u.retry
+	u.mu.RUnlock()
+	if strings.HasPrefix(url, FileURLPrefix) {
+		policy.Attempts = 1 // A missing or corrupt file does not heal within seconds
 	}
 
-	return nil, 0, lastErr
+	var res *edlResult
+	err := backoff.Retry(ctx, policy, func(attempt int) error {
+		var err error
+		if res, err = u.fetch(ctx, url, loaded); err != nil {
+			logger.Warnf("EDL fetch attempt %d/%d failed: %v", attempt+1, policy.Attempts, err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
-// fetch performs a single EDL fetch
-func (u *EDLUpdater) fetch(ctx context.Context) (*iptrie.Trie, int64, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", u.url, nil)
+// fetch performs a single EDL fetch. When the response carries the same
+// generation ID as the loaded list the body is discarded without parsing.
+func (u *EDLUpdater) fetch(ctx context.Context, url, loaded string) (*edlResult, error) {
+	if strings.HasPrefix(url, FileURLPrefix) {
+		return u.fetchFile(strings.TrimPrefix(url, FileURLPrefix), loaded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	resp, err := u.client.Do(req)
+	// The transport does not negotiate compression, gzip is requested and
+	// decoded here so stubbed and custom clients behave the same
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	u.mu.RLock()
+	client := u.client
+	u.mu.RUnlock()
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, 0, errors.New("unexpected status: " + string(body))
+		return nil, errors.New("unexpected status: " + string(body))
+	}
+
+	generation := resp.Header.Get(EDLGenerationHeader)
+	if generation != "" && generation == loaded {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return &edlResult{generation: generation, unchanged: true}, nil
+	}
+
+	body := io.Reader(resp.Body)
+	switch encoding := strings.ToLower(resp.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, errors.New("invalid gzip EDL: " + err.Error())
+		}
+		defer gz.Close()
+		body = gz
+	default:
+		return nil, errors.New("unsupported EDL content encoding: " + encoding)
+	}
+
+	// The cache keeps a copy of the decoded payload
+	cache := u.cachePayloadFile()
+	if cache != nil {
+		body = io.TeeReader(body, cache)
+	}
+	trie, count, format, err := u.readEDL(body, resp.Header.Get(EDLChecksumHeader), cache != nil)
+	cacheFile := closeCacheFile(cache, err)
+	if err != nil {
+		return nil, err
+	}
+	return &edlResult{trie: trie, count: count, format: format, generation: generation, cacheFile: cacheFile}, nil
+}
+
+// readEDL parses a downloaded EDL and verifies it against checksum, the
+// EDLChecksumHeader value, when one was sent. The body is read to the end
+// when verifying or when drain is set, the parser may stop before it.
+func (u *EDLUpdater) readEDL(body io.Reader, checksum string, drain bool) (*iptrie.Trie, int64, string, error) {
+	var want []byte
+	hasher := crypto.NewHash()
+	if checksum != "" {
+		var err error
+		if want, err = parseChecksum(checksum); err != nil {
+			return nil, 0, "", err
+		}
+		body = io.TeeReader(body, hasher)
 	}
 
-	return u.parseEDL(resp.Body)
+	trie, count, format, err := u.parseEDL(body)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if want != nil || drain {
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return nil, 0, "", err
+		}
+	}
+	if want != nil {
+		if got := hasher.Sum(nil); !bytes.Equal(got, want) {
+			return nil, 0, "", fmt.Errorf("EDL checksum mismatch: got %x, want %x", got, want)
+		}
+	}
+	return trie, count, format, nil
 }
 
-// parseEDL parses the EDL response (binary format only)
-func (u *EDLUpdater) parseEDL(r io.Reader) (*iptrie.Trie, int64, error) {
-	// Fast binary format parsing
-	trie, count, err := iptrie.LoadBinaryTrie(r)
+// parseChecksum decodes an EDLChecksumHeader value, hex or base64
+func parseChecksum(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	sum, err := hex.DecodeString(value)
 	if err != nil {
-		return nil, 0, err
+		sum, err = base64.StdEncoding.DecodeString(value)
+	}
+	if err != nil || len(sum) != crypto.HashSize {
+		return nil, errors.New("invalid " + EDLChecksumHeader + " header: " + value)
+	}
+	return sum, nil
+}
+
+// fetchFile loads the EDL from a local file. The generation is derived from
+// the file's mtime and size so an unchanged file is not parsed again.
+func (u *EDLUpdater) fetchFile(path, loaded string) (*edlResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	generation := fmt.Sprintf("file-%d-%d", info.ModTime().UnixNano(), info.Size())
+	if generation == loaded {
+		return &edlResult{generation: generation, unchanged: true}, nil
+	}
+
+	trie, count, format, err := u.parseEDL(f)
+	if err != nil {
+		return nil, err
+	}
+	return &edlResult{trie: trie, count: count, format: format, generation: generation}, nil
+}
+
+// parseEDL parses the EDL response and returns the format it was in.
+// ELLIOTRIE binary payloads are detected by their magic header. In
+// EDLFormatAuto anything else is read as a newline-delimited list of IPs and
+// CIDR ranges so third-party and hand-maintained lists work too; in
+// EDLFormatBinary it fails with iptrie.ErrInvalidMagic.
+func (u *EDLUpdater) parseEDL(r io.Reader) (*iptrie.Trie, int64, string, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(iptrie.MagicHeader))
+
+	u.mu.RLock()
+	strict := u.format == EDLFormatBinary
+	table := u.asnTable
+	u.mu.RUnlock()
+
+	var trie *iptrie.Trie
+	var count int64
+	var err error
+	format := FormatELLIOTRIE
+	switch {
+	case string(magic) == iptrie.MagicHeader:
+		// Fast binary format parsing
+		trie, count, err = iptrie.LoadBinaryTrie(br)
+	case strict:
+		err = iptrie.ErrInvalidMagic
+	default:
+		format = FormatPlain
+		trie, count, err = parsePlainEDL(br, table)
+	}
+	if err != nil {
+		return nil, 0, "", err
 	}
 
 	if count == 0 {
 		logger.Warn("EDL is empty - no IP addresses found")
 	}
 
-	return trie, count, nil
+	return trie, count, format, nil
+}
+
+// parsePlainEDL builds a trie from one IP or CIDR per line. Lines naming an
+// ASN, such as "AS64500", are expanded to the prefixes table lists for it.
+// Comments after '#' and blank lines are ignored, unparseable lines are
+// skipped with a warning.
+func parsePlainEDL(r io.Reader, table *asn.Table) (*iptrie.Trie, int64, error) {
+	prefixes, invalid, err := locallist.Parse(r)
+	if err != nil && !errors.Is(err, locallist.ErrNoEntries) {
+		return nil, 0, fmt.Errorf("EDL is neither ELLIOTRIE nor a plain-text IP list: %w", err)
+	}
+	// A list of ASNs alone is only valid when any of them resolve
+	prefixes, invalid = expandASNs(prefixes, invalid, table)
+	if err != nil && len(prefixes) == 0 {
+		return nil, 0, fmt.Errorf("EDL is neither ELLIOTRIE nor a plain-text IP list: %w", err)
+	}
+	if len(invalid) > 0 {
+		logger.Warnf("Skipped %d invalid plain-text EDL lines, first: %q", len(invalid), invalid[0])
+	}
+
+	// BulkLoad expects IPv4 before IPv6, both in ascending order
+	sort.Slice(prefixes, func(i, j int) bool {
+		a, b := prefixes[i], prefixes[j]
+		if a.Addr().Is4() != b.Addr().Is4() {
+			return a.Addr().Is4()
+		}
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+
+	trie := iptrie.BulkLoad(prefixes)
+	logger.Debugf("Loaded plain-text EDL with %d entries", len(prefixes))
+	return trie, trie.Count(), nil
+}
+
+// expandASNs appends the prefixes of the ASN entries among invalid to
+// prefixes and returns the lines that are still invalid. ASNs unknown to
+// table are dropped with a warning, as the list itself is valid.
+func expandASNs(prefixes []netip.Prefix, invalid []string, table *asn.Table) ([]netip.Prefix, []string) {
+	var asns, unknown int
+	remaining := invalid[:0]
+	seen := make(map[netip.Prefix]bool)
+	for _, line := range invalid {
+		number, ok := asn.ParseASN(line)
+		if !ok {
+			remaining = append(remaining, line)
+			continue
+		}
+		asns++
+		announced := table.Prefixes(number)
+		if len(announced) == 0 {
+			unknown++
+			continue
+		}
+		if len(seen) == 0 {
+			for _, p := range prefixes {
+				seen[p] = true
+			}
+		}
+		for _, p := range announced {
+			if !seen[p] {
+				seen[p] = true
+				prefixes = append(prefixes, p)
+			}
+		}
+	}
+	switch {
+	case asns > 0 && table == nil:
+		logger.Warnf("Skipped %d ASN entries of a plain-text EDL, asnTable is not configured", asns)
+	case unknown > 0:
+		logger.Warnf("Skipped %d of %d ASN entries of a plain-text EDL not found in the ASN table", unknown, asns)
+	case asns > 0:
+		logger.Debugf("Expanded %d ASN entries of a plain-text EDL", asns)
+	}
+	return prefixes, remaining
 }
 
 // GetStatus returns the current status
@@ -208,14 +857,38 @@ func (u *EDLUpdater) GetStatus() (time.Time, error, int64) {
 	return u.lastUpdate, u.lastError, u.updateCount
 }
 
-// Reconfigure updates the EDL URL and update frequency
-func (u *EDLUpdater) Reconfigure(url string, updateFrequency time.Duration) {
-	u.mu.Lock()
-	defer u.mu.Unlock()
+// Generation returns the generation ID of the loaded list
+func (u *EDLUpdater) Generation() string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.generation
+}
 
-	// Update configuration
-	u.url = url
-	u.updateFrequency = updateFrequency
+// Sources returns the status of each EDL URL
+func (u *EDLUpdater) Sources() []EDLSourceStatus {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	status := make([]EDLSourceStatus, 0, len(u.sources))
+	for _, src := range u.sources {
+		s := EDLSourceStatus{URL: src.url, Generation: src.generation, Entries: src.count, Format: src.format, LastUpdate: src.lastUpdate}
+		if len(u.allowlist) > 0 {
+			s.List = "blocklist"
+			if u.allowlist[src.url] {
+				s.List = "allowlist"
+			}
+		}
+		if src.lastError != nil {
+			s.Error = src.lastError.Error()
+		}
+		status = append(status, s)
+	}
+	return status
+}
+
+// Reconfigure updates the EDL URLs and update frequency. Sources whose URL
+// is kept retain their loaded list.
+func (u *EDLUpdater) Reconfigure(urls []string, updateFrequency time.Duration) {
+	u.configure(urls, updateFrequency)
 
 	// Signal the update loop to restart with new settings
 	select {
@@ -225,7 +898,7 @@ func (u *EDLUpdater) Reconfigure(url string, updateFrequency time.Duration) {
 		// Channel already has a signal, that's fine
 	}
 
-	// Trigger immediate update with new URL
+	// Trigger immediate update with new URLs
 	go func() {
 		if err := u.updateNow(context.Background()); err != nil {
 			logger.Errorf("EDL update after reconfiguration failed: %v", err)
@@ -233,7 +906,93 @@ func (u *EDLUpdater) Reconfigure(url string, updateFrequency time.Duration) {
 	}()
 }
 
-// Stop stops the updater
+// configure replaces the URLs and update frequency without triggering an
+// update. Sources whose URL is kept retain their loaded list.
+func (u *EDLUpdater) configure(urls []string, updateFrequency time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.urls = urls
+	u.sources = newEDLSources(urls, u.sources)
+	u.updateFrequency = updateFrequency
+}
+
+// SetAllowlist marks the URLs of the allowlist of a combined config; the
+// other URLs form the blocklist. Empty makes all URLs one list again. It
+// takes effect with the next update, which merges the lists again even
+// when no source changed.
+func (u *EDLUpdater) SetAllowlist(urls []string) {
+	allowlist := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		allowlist[url] = true
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	changed := len(allowlist) != len(u.allowlist)
+	for url := range allowlist {
+		changed = changed || !u.allowlist[url]
+	}
+	if !changed {
+		return
+	}
+	u.allowlist = nil
+	if len(allowlist) > 0 {
+		u.allowlist = allowlist
+	}
+	u.generation = ""
+}
+
+// SetASNTable sets the table resolving ASN entries of plain-text lists,
+// nil drops ASN entries. It applies from the next parsed list.
+func (u *EDLUpdater) SetASNTable(table *asn.Table) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.asnTable = table
+}
+
+// SetFormat sets the accepted payload format, EDLFormatAuto or EDLFormatBinary
+func (u *EDLUpdater) SetFormat(format string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.format = format
+}
+
+// SetRetry overrides the download retry policy, zero fields keep the defaults
+func (u *EDLUpdater) SetRetry(p backoff.Policy) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.retry = p.Or(defaultEDLRetry)
+}
+
+// SetTLSConfig applies cfg to the download client, nil keeps the defaults
+func (u *EDLUpdater) SetTLSConfig(cfg *tls.Config) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	api.ApplyTLS(u.client, cfg)
+}
+
+// SetHTTPClient overrides the HTTP client used for EDL downloads
+func (u *EDLUpdater) SetHTTPClient(client *http.Client) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.client = client
+}
+
+// Stop stops the update loop. It is safe to call more than once, and
+// StartUpdateLoop starts a new loop afterwards.
 func (u *EDLUpdater) Stop() {
-	close(u.stopCh)
+	u.loop.stop()
+}
+
+// sameURLs reports whether two URL lists are equal, order included
+func sameURLs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,511 @@
+package singleton
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/asn"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/iptrie"
+)
+
+// emptyTrieBody returns an ELLIOTRIE payload with no nodes
+func emptyTrieBody(t *testing.T) []byte {
+	t.Helper()
+	header := iptrie.TrieHeader{
+		Version:  iptrie.FormatVersion,
+		IPv4Root: 0xFFFFFFFF,
+		IPv6Root: 0xFFFFFFFF,
+	}
+	copy(header.Magic[:], iptrie.MagicHeader)
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, &header); err != nil {
+		t.Fatalf("failed to encode trie header: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// edlServer returns a client serving an empty trie with the given generation
+func edlServer(t *testing.T, generation *string) *http.Client {
+	body := emptyTrieBody(t)
+	return &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			header := make(http.Header)
+			if *generation != "" {
+				header.Set(EDLGenerationHeader, *generation)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader(body)),
+				Header:     header,
+				Request:    req,
+			}, nil
+		}),
+	}
+}
+
+func TestEDLUpdaterSkipsUnchangedGeneration(t *testing.T) {
+	generation := "gen-1"
+	u := NewEDLUpdater([]string{"https://edl.example.com/list"}, 0, ipmatcher.New(), nil)
+	u.SetHTTPClient(edlServer(t, &generation))
+
+	steps := []struct {
+		generation string
+		wantParsed int64
+	}{
+		{"gen-1", 1}, // first load always parses
+		{"gen-1", 1}, // same generation is not parsed again
+		{"gen-2", 2}, // new generation parses
+		{"", 3},      // no generation header parses every time
+		{"", 4},
+	}
+
+	for i, step := range steps {
+		generation = step.generation
+		if err := u.updateNow(context.Background()); err != nil {
+			t.Fatalf("step %d: update failed: %v", i, err)
+		}
+		_, _, parsed := u.GetStatus()
+		if parsed != step.wantParsed {
+			t.Errorf("step %d: expected %d parses, got %d", i, step.wantParsed, parsed)
+		}
+		if u.Generation() != step.generation {
+			t.Errorf("step %d: expected generation %q, got %q", i, step.generation, u.Generation())
+		}
+	}
+}
+
+func TestEDLUpdaterFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "edl.bin")
+	if err := os.WriteFile(path, emptyTrieBody(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	u := NewEDLUpdater([]string{FileURLPrefix + path}, 0, ipmatcher.New(), nil)
+
+	update := func(wantParsed int64) {
+		t.Helper()
+		if err := u.updateNow(context.Background()); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+		if _, _, parsed := u.GetStatus(); parsed != wantParsed {
+			t.Errorf("expected %d parses, got %d", wantParsed, parsed)
+		}
+	}
+
+	update(1)
+	update(1) // unchanged file is not parsed again
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	update(2)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.updateNow(context.Background()); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestEDLUpdaterMergesSources(t *testing.T) {
+	dir := t.TempDir()
+	v4 := filepath.Join(dir, "v4.txt")
+	v6 := filepath.Join(dir, "v6.txt")
+	if err := os.WriteFile(v4, []byte("192.0.2.1\n198.51.100.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(v6, []byte("2001:db8::/32\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	matcher := ipmatcher.New()
+	u := NewEDLUpdater([]string{FileURLPrefix + v4, FileURLPrefix + v6}, 0, matcher, nil)
+	if err := u.updateNow(context.Background()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	for _, ip := range []string{"192.0.2.1", "198.51.100.7", "2001:db8::1"} {
+		if !matcher.Contains(ip) {
+			t.Errorf("expected merged list to contain %s", ip)
+		}
+	}
+	if matcher.Count() != 3 {
+		t.Errorf("expected 3 entries, got %d", matcher.Count())
+	}
+	if sources := u.Sources(); sources[0].Format != FormatPlain || u.summary.Format != FormatPlain {
+		t.Errorf("expected the plain-text format to be recorded, got %+v", sources)
+	}
+
+	// A failing source keeps its last list, the others still update
+	if err := os.Remove(v6); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(v4, []byte("203.0.113.5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(v4, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.updateNow(context.Background()); err != nil {
+		t.Fatalf("expected a partial update to succeed, got %v", err)
+	}
+	if !matcher.Contains("203.0.113.5") || matcher.Contains("192.0.2.1") || !matcher.Contains("2001:db8::1") {
+		t.Error("expected the new IPv4 list merged with the last IPv6 list")
+	}
+	sources := u.Sources()
+	if len(sources) != 2 || sources[0].Error != "" || sources[1].Error == "" || sources[1].Entries != 1 {
+		t.Errorf("unexpected source status %+v", sources)
+	}
+	if _, err, _ := u.GetStatus(); err == nil {
+		t.Error("expected the failed source in the updater status")
+	}
+
+	// Dropping the failed source rebuilds the matcher without its list
+	u.mu.Lock()
+	u.urls = u.urls[:1]
+	u.sources = newEDLSources(u.urls, u.sources)
+	u.mu.Unlock()
+	if err := u.updateNow(context.Background()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if matcher.Contains("2001:db8::1") || !matcher.Contains("203.0.113.5") {
+		t.Error("expected only the remaining source after reconfiguration")
+	}
+
+	if err := os.Remove(v4); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.updateNow(context.Background()); err == nil {
+		t.Error("expected an error when every source fails")
+	}
+}
+
+func TestEDLUpdaterCombinedLists(t *testing.T) {
+	dir := t.TempDir()
+	block := filepath.Join(dir, "block.txt")
+	allow := filepath.Join(dir, "allow.txt")
+	if err := os.WriteFile(block, []byte("203.0.113.0/24\n198.51.100.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(allow, []byte("203.0.113.7\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	matcher := ipmatcher.New()
+	u := NewEDLUpdater([]string{FileURLPrefix + block, FileURLPrefix + allow}, 0, matcher, nil)
+	u.SetAllowlist([]string{FileURLPrefix + allow})
+	if err := u.updateNow(context.Background()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if matcher.Count() != 2 || matcher.AllowCount() != 1 {
+		t.Errorf("expected 2 blocklist and 1 allowlist entries, got %d and %d", matcher.Count(), matcher.AllowCount())
+	}
+	if _, ok := matcher.LookupAllow(netip.MustParseAddr("203.0.113.7")); !ok {
+		t.Error("expected 203.0.113.7 on the allowlist")
+	}
+	if _, ok := matcher.LookupAllow(netip.MustParseAddr("203.0.113.8")); ok {
+		t.Error("blocklist entries must not be on the allowlist")
+	}
+	if sources := u.Sources(); sources[0].List != "blocklist" || sources[1].List != "allowlist" {
+		t.Errorf("expected the list of each source in the status, got %+v", sources)
+	}
+
+	// Unmarking the allowlist merges all sources into one list again,
+	// although no source changed
+	u.SetAllowlist(nil)
+	if err := u.updateNow(context.Background()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if matcher.Count() != 3 || matcher.AllowCount() != 0 {
+		t.Errorf("expected one list of 3 entries, got %d and %d", matcher.Count(), matcher.AllowCount())
+	}
+
+	// A combined EDL is not enforced without its allowlist
+	fresh := ipmatcher.New()
+	u = NewEDLUpdater([]string{FileURLPrefix + block, FileURLPrefix + filepath.Join(dir, "missing.txt")}, 0, fresh, nil)
+	u.SetAllowlist([]string{FileURLPrefix + filepath.Join(dir, "missing.txt")})
+	if err := u.updateNow(context.Background()); err == nil {
+		t.Error("expected an error without the allowlist")
+	}
+	if fresh.Count() != 0 {
+		t.Errorf("expected the blocklist alone not to be enforced, got %d entries", fresh.Count())
+	}
+}
+
+func TestNewManagerOffline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "edl.bin")
+	if err := os.WriteFile(path, emptyTrieBody(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(Options{EDLFilePath: path, EDLFileMode: "allowlist"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer m.Stop()
+
+	if ready, reason := m.Readiness(); !ready {
+		t.Errorf("expected ready, got reason %q", reason)
+	}
+	if m.GetEDLMode() != "allowlist" {
+		t.Errorf("expected allowlist mode, got %q", m.GetEDLMode())
+	}
+	if d := m.Decide("203.0.113.7"); d.Allowed || d.Source != SourceEDL {
+		t.Errorf("expected EDL block for an IP missing from an empty allowlist, got %s", d)
+	}
+
+	status := m.Status()
+	if !status.Ready || !status.Offline || status.Mode != "allowlist" || status.Token != nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if status.EDL == nil || status.EDL.LastUpdate == nil || len(status.EDL.Sources) != 1 {
+		t.Errorf("unexpected EDL status %+v", status.EDL)
+	}
+
+	if _, err := NewManager(Options{EDLFilePath: path + ".missing"}); err == nil {
+		t.Error("expected error for a missing EDL file")
+	}
+}
+
+func TestParseEDLPlainText(t *testing.T) {
+	list := `# hand-maintained list
+2001:db8::/32
+203.0.113.0/24 # scanners
+198.51.100.7
+
+not-an-ip
+`
+	u := NewEDLUpdater([]string{"https://edl.example.com/list.txt"}, 0, ipmatcher.New(), nil)
+	trie, count, format, err := u.parseEDL(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 3 || format != FormatPlain {
+		t.Errorf("expected 3 plain-text entries, got %d in %q", count, format)
+	}
+
+	for ip, want := range map[string]bool{
+		"203.0.113.9":  true,
+		"198.51.100.7": true,
+		"198.51.100.8": false,
+		"2001:db8::1":  true,
+		"2001:db9::1":  false,
+	} {
+		if got := trie.Contains(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if _, _, _, err := u.parseEDL(strings.NewReader("<html>not a list</html>\n")); err == nil {
+		t.Error("expected error for a payload with no valid entries")
+	}
+	if _, count, format, err := u.parseEDL(bytes.NewReader(emptyTrieBody(t))); err != nil || count != 0 || format != FormatELLIOTRIE {
+		t.Errorf("expected empty binary trie, got count=%d format=%q err=%v", count, format, err)
+	}
+
+	// Without compatibility mode plain text is rejected
+	u.SetFormat(EDLFormatBinary)
+	if _, _, _, err := u.parseEDL(strings.NewReader(list)); !errors.Is(err, iptrie.ErrInvalidMagic) {
+		t.Errorf("expected ErrInvalidMagic in binary mode, got %v", err)
+	}
+	if _, _, _, err := u.parseEDL(bytes.NewReader(emptyTrieBody(t))); err != nil {
+		t.Errorf("expected binary mode to load ELLIOTRIE, got %v", err)
+	}
+}
+
+func TestParseEDLASNEntries(t *testing.T) {
+	table, _, err := asn.Parse(strings.NewReader("192.0.2.0/24 AS64500\n2001:db8::/32 AS64500\n198.51.100.0/24 AS64501\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := "AS64500\nas64501\nAS64999\n192.0.2.0/24\n203.0.113.7\n"
+
+	u := NewEDLUpdater([]string{"https://edl.example.com/list.txt"}, 0, ipmatcher.New(), nil)
+	trie, count, _, err := u.parseEDL(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 2 || trie.Contains(netip.MustParseAddr("198.51.100.1")) {
+		t.Errorf("expected ASN entries to be skipped without a table, got %d entries", count)
+	}
+	if _, _, _, err := u.parseEDL(strings.NewReader("AS64500\n")); err == nil {
+		t.Error("expected error for a list of unresolvable ASNs")
+	}
+
+	u.SetASNTable(table)
+	trie, count, _, err = u.parseEDL(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// 192.0.2.0/24 is listed both directly and through AS64500
+	if count != 4 {
+		t.Errorf("expected 4 entries, got %d", count)
+	}
+	for ip, want := range map[string]bool{
+		"192.0.2.9":    true,
+		"2001:db8::1":  true,
+		"198.51.100.1": true,
+		"203.0.113.7":  true,
+		"203.0.113.8":  false,
+	} {
+		if got := trie.Contains(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestEDLUpdaterGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write([]byte("203.0.113.0/24\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	encoding := "gzip"
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Accept-Encoding") != "gzip" {
+				t.Errorf("expected gzip to be requested, got %q", req.Header.Get("Accept-Encoding"))
+			}
+			header := make(http.Header)
+			header.Set("Content-Encoding", encoding)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader(compressed.Bytes())),
+				Header:     header,
+				Request:    req,
+			}, nil
+		}),
+	}
+
+	matcher := ipmatcher.New()
+	u := NewEDLUpdater([]string{"https://edl.example.com/list"}, 0, matcher, nil)
+	u.SetHTTPClient(client)
+	if err := u.updateNow(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := matcher.Lookup(netip.MustParseAddr("203.0.113.9")); !ok {
+		t.Error("expected the decompressed list to be loaded")
+	}
+
+	encoding = "br"
+	if err := u.updateNow(context.Background()); err == nil {
+		t.Error("expected an error for an unsupported content encoding")
+	}
+}
+
+func TestEDLUpdaterChecksum(t *testing.T) {
+	body := emptyTrieBody(t)
+	sum := sha256.Sum256(body)
+
+	var checksum string
+	client := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			header := make(http.Header)
+			header.Set(EDLChecksumHeader, checksum)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader(body)),
+				Header:     header,
+				Request:    req,
+			}, nil
+		}),
+	}
+	u := NewEDLUpdater([]string{"https://edl.example.com/list"}, 0, ipmatcher.New(), nil)
+	u.SetHTTPClient(client)
+
+	tests := []struct {
+		checksum string
+		wantErr  bool
+	}{
+		{hex.EncodeToString(sum[:]), false},
+		{base64.StdEncoding.EncodeToString(sum[:]), false},
+		{strings.Repeat("00", sha256.Size), true},
+		{"not-a-checksum", true},
+	}
+	for _, tt := range tests {
+		checksum = tt.checksum
+		res, err := u.fetch(context.Background(), "https://edl.example.com/list", "")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checksum %q: expected error=%v, got %v", tt.checksum, tt.wantErr, err)
+		}
+		if err == nil && res.trie == nil {
+			t.Errorf("checksum %q: expected a parsed trie", tt.checksum)
+		}
+	}
+}
+
+func TestPrefetchLead(t *testing.T) {
+	tests := []struct {
+		freq time.Duration
+		want time.Duration
+	}{
+		{5 * time.Second, 0},
+		{time.Minute, 6 * time.Second},
+		{time.Hour, maxPrefetchLead},
+	}
+	for _, tt := range tests {
+		if got := prefetchLead(tt.freq); got != tt.want {
+			t.Errorf("prefetchLead(%v) = %v, want %v", tt.freq, got, tt.want)
+		}
+	}
+}
+
+func TestEDLUpdaterPrefetchThenSwap(t *testing.T) {
+	generation := "gen-1"
+	u := NewEDLUpdater([]string{"https://edl.example.com/list"}, 0, ipmatcher.New(), nil)
+	u.SetHTTPClient(edlServer(t, &generation))
+
+	if err := u.updateNow(context.Background()); err != nil {
+		t.Fatalf("initial update failed: %v", err)
+	}
+
+	// A prefetch parses the new list but leaves the loaded one in place
+	generation = "gen-2"
+	pending := u.prefetch(context.Background())
+	if pending.errs[0] != nil {
+		t.Fatalf("prefetch failed: %v", pending.errs[0])
+	}
+	if u.Generation() != "gen-1" {
+		t.Errorf("prefetch must not swap the list, generation is %q", u.Generation())
+	}
+
+	if err := u.swap(context.Background(), pending); err != nil {
+		t.Fatalf("swap failed: %v", err)
+	}
+	if u.Generation() != "gen-2" {
+		t.Errorf("expected generation gen-2 after swap, got %q", u.Generation())
+	}
+
+	// A prefetch made against an outdated generation is fetched again
+	generation = "gen-3"
+	stale := u.prefetch(context.Background())
+	stale.loaded = "gen-0"
+	generation = "gen-4"
+	if err := u.swap(context.Background(), stale); err != nil {
+		t.Fatalf("swap failed: %v", err)
+	}
+	if u.Generation() != "gen-4" {
+		t.Errorf("expected refetched generation gen-4, got %q", u.Generation())
+	}
+}
@@ -0,0 +1,61 @@
+package singleton
+
+import (
+	"math"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/iptrie"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+)
+
+const (
+	// duplicateAnomalyShare flags loads where more than this share of the
+	// delivered entries were duplicates
+	duplicateAnomalyShare = 0.01
+	// shareShiftAnomaly flags host or IPv4 share changes larger than this
+	// between consecutive loads
+	shareShiftAnomaly = 0.2
+)
+
+// summarizeEDL computes load statistics and anomaly flags for a parsed EDL.
+// previous is the summary of the last load, nil on the first one.
+func summarizeEDL(generation string, trie *iptrie.Trie, count int64, took time.Duration, previous *logs.EDLUpdateDetails) *logs.EDLUpdateDetails {
+	stats := trie.Stats()
+	distinct := stats.IPv4 + stats.IPv6
+
+	summary := &logs.EDLUpdateDetails{
+		Generation:  generation,
+		Entries:     count,
+		IPv4:        stats.IPv4,
+		IPv6:        stats.IPv6,
+		LoadMillis:  took.Milliseconds(),
+		MemoryBytes: stats.MemoryBytes(),
+	}
+	if count > distinct {
+		summary.Duplicates = count - distinct
+	}
+	if distinct > 0 {
+		summary.HostShare = float64(stats.IPv4Hosts+stats.IPv6Hosts) / float64(distinct)
+		summary.IPv4Share = float64(stats.IPv4) / float64(distinct)
+	}
+
+	if count > 0 && float64(summary.Duplicates)/float64(count) > duplicateAnomalyShare {
+		summary.Anomalies = append(summary.Anomalies, "duplicates")
+	}
+	if previous != nil && distinct > 0 && previous.IPv4+previous.IPv6 > 0 {
+		summary.HostShareChange = summary.HostShare - previous.HostShare
+		summary.IPv4ShareChange = summary.IPv4Share - previous.IPv4Share
+		if math.Abs(summary.HostShareChange) > shareShiftAnomaly {
+			summary.Anomalies = append(summary.Anomalies, "host_share_shift")
+		}
+		if math.Abs(summary.IPv4ShareChange) > shareShiftAnomaly {
+			summary.Anomalies = append(summary.Anomalies, "family_ratio_shift")
+		}
+	}
+	return summary
+}
+
+// reportEDLUpdate ships the summary of a loaded EDL
+func (m *Manager) reportEDLUpdate(summary *logs.EDLUpdateDetails) {
+	m.SendBlockEvent(logs.NewReportEvent("edl_update", m.GetEDLMode(), summary))
+}
@@ -0,0 +1,60 @@
+package singleton
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/iptrie"
+)
+
+func buildTrie(prefixes ...string) *iptrie.Trie {
+	trie := iptrie.NewTrie()
+	for _, p := range prefixes {
+		trie.Insert(netip.MustParsePrefix(p))
+	}
+	return trie
+}
+
+func hasAnomaly(anomalies []string, name string) bool {
+	for _, a := range anomalies {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSummarizeEDL(t *testing.T) {
+	first := buildTrie("192.0.2.1/32", "192.0.2.1/32", "198.51.100.0/24", "2001:db8::/32")
+	summary := summarizeEDL("gen-1", first, first.Count(), time.Second, nil)
+
+	if summary.Entries != 4 || summary.Duplicates != 1 || summary.IPv4 != 2 || summary.IPv6 != 1 {
+		t.Errorf("unexpected counts %+v", summary)
+	}
+	if summary.HostShare < 0.33 || summary.HostShare > 0.34 {
+		t.Errorf("expected host share 1/3, got %v", summary.HostShare)
+	}
+	if !hasAnomaly(summary.Anomalies, "duplicates") {
+		t.Errorf("expected duplicates anomaly, got %v", summary.Anomalies)
+	}
+	if summary.LoadMillis != 1000 {
+		t.Errorf("expected load_ms 1000, got %d", summary.LoadMillis)
+	}
+
+	// Only IPv6 host entries: both shares shift by more than the threshold
+	second := buildTrie("2001:db8::1/128", "2001:db8::2/128", "2001:db8::3/128")
+	next := summarizeEDL("gen-2", second, second.Count(), 0, summary)
+	if !hasAnomaly(next.Anomalies, "host_share_shift") || !hasAnomaly(next.Anomalies, "family_ratio_shift") {
+		t.Errorf("expected share shift anomalies, got %v", next.Anomalies)
+	}
+	if hasAnomaly(next.Anomalies, "duplicates") {
+		t.Errorf("unexpected duplicates anomaly, got %v", next.Anomalies)
+	}
+
+	// A stable list has no anomalies
+	same := summarizeEDL("gen-3", second, second.Count(), 0, next)
+	if len(same.Anomalies) != 0 || same.HostShareChange != 0 {
+		t.Errorf("expected no anomalies for an unchanged list, got %+v", same)
+	}
+}
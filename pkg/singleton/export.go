@@ -0,0 +1,62 @@
+package singleton
+
+import (
+	"net/netip"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/iptrie"
+)
+
+// EDLExport is a consistent view of the enforced EDL, used by the admin
+// export to let external tooling reconcile it with the published list
+type EDLExport struct {
+	generation string
+	mode       string
+	trie       *iptrie.Trie
+}
+
+// ExportEDL returns the enforced EDL together with its generation, nil
+// before a list has been loaded. A cached list enforced while initializing
+// is exported as well.
+func (m *Manager) ExportEDL() *EDLExport {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	updater := m.edlUpdater
+	mode := m.edlMode
+	m.mu.RUnlock()
+	if updater == nil {
+		return nil
+	}
+
+	// The updater swaps the matcher and the generation under its lock
+	updater.mu.RLock()
+	trie, _ := updater.matcher.Snapshot()
+	generation := updater.generation
+	loaded := updater.updateCount > 0
+	updater.mu.RUnlock()
+	if !loaded || trie == nil {
+		return nil
+	}
+	// Only the blocklist of a combined EDL is exported
+	if mode == EDLModeCombined {
+		mode = "blocklist"
+	}
+	return &EDLExport{generation: generation, mode: mode, trie: trie}
+}
+
+// Generation returns the generation ID of the exported list, empty when
+// the EDL API did not send one
+func (x *EDLExport) Generation() string {
+	return x.generation
+}
+
+// Mode returns the EDL mode, blocklist or allowlist
+func (x *EDLExport) Mode() string {
+	return x.mode
+}
+
+// Walk calls fn for every prefix in canonical order until fn returns false
+func (x *EDLExport) Walk(fn func(netip.Prefix) bool) {
+	x.trie.Walk(fn)
+}
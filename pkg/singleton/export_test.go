@@ -0,0 +1,51 @@
+package singleton
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+)
+
+func TestExportEDL(t *testing.T) {
+	m := &Manager{matcher: ipmatcher.New(), edlMode: "blocklist"}
+	if m.ExportEDL() != nil {
+		t.Error("expected no export without an updater")
+	}
+
+	path := filepath.Join(t.TempDir(), "edl.txt")
+	if err := os.WriteFile(path, []byte("2001:db8::/32\n198.51.100.0/24\n192.0.2.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m.edlUpdater = m.newEDLUpdater([]string{FileURLPrefix + path}, 0)
+	if m.ExportEDL() != nil {
+		t.Error("expected no export before the first load")
+	}
+	if err := m.edlUpdater.updateNow(context.Background()); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	export := m.ExportEDL()
+	if export == nil {
+		t.Fatal("expected an export after the load")
+	}
+	if export.Mode() != "blocklist" || export.Generation() != m.edlUpdater.Generation() {
+		t.Errorf("unexpected export mode %q generation %q", export.Mode(), export.Generation())
+	}
+	var got []string
+	export.Walk(func(prefix netip.Prefix) bool {
+		got = append(got, prefix.String())
+		return true
+	})
+	if want := "192.0.2.1/32 198.51.100.0/24 2001:db8::/32"; strings.Join(got, " ") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+
+	if (*Manager)(nil).ExportEDL() != nil {
+		t.Error("expected a nil manager to export nothing")
+	}
+}
@@ -0,0 +1,52 @@
+package singleton
+
+import (
+	"net/netip"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+)
+
+// countFamily counts an EDL check by the address family of the client. The
+// first IPv6 check against an EDL without IPv6 entries, while no IPv4
+// client has been seen, logs a warning: the deployment looks IPv6-only and
+// the EDL cannot match any of its clients.
+func (m *Manager) countFamily(addr netip.Addr) {
+	if addr.Is4() {
+		m.ipv4Checks.Add(1)
+		return
+	}
+	m.ipv6Checks.Add(1)
+	if m.FamilyMismatch() && m.familyWarned.CompareAndSwap(false, true) {
+		logger.Warnf("All traffic is IPv6 but the %s EDL has only IPv4 entries, no client can match it; check the EDL covers IPv6",
+			m.GetEDLMode())
+	}
+}
+
+// CountCachedCheck counts a decision reused from a cache like the EDL check
+// it stands for
+func (m *Manager) CountCachedCheck(addr netip.Addr) {
+	m.countFamily(addr.Unmap())
+}
+
+// setEDLFamilies records whether a newly loaded EDL lacks IPv6 entries. A
+// list with IPv6 entries re-arms the mismatch warning for later lists.
+func (m *Manager) setEDLFamilies(summary *logs.EDLUpdateDetails) {
+	if m == nil || summary == nil {
+		return
+	}
+	ipv4Only := summary.IPv4 > 0 && summary.IPv6 == 0
+	m.edlIPv4Only.Store(ipv4Only)
+	if !ipv4Only {
+		m.familyWarned.Store(false)
+	}
+}
+
+// FamilyMismatch reports whether all clients checked so far are IPv6 while
+// the EDL has only IPv4 entries, so no client can match it
+func (m *Manager) FamilyMismatch() bool {
+	if m == nil {
+		return false
+	}
+	return m.edlIPv4Only.Load() && m.ipv6Checks.Load() > 0 && m.ipv4Checks.Load() == 0
+}
@@ -0,0 +1,96 @@
+package singleton
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// Feature flags the config API can toggle per deployment, so the backend
+// can roll out behaviors gradually across the fleet. A flag the response
+// does not list keeps the behavior of the local configuration.
+const (
+	FeatureEventSampling    = "event_sampling"     // Off ignores the configured sample rates and reports events at the defaults
+	FeatureIPv6Aggregation  = "ipv6_aggregation"   // On checks IPv6 clients by prefix, off by exact address
+	FeatureUserAgentCapture = "user_agent_capture" // Off omits the User-Agent from events
+)
+
+// featureSet holds the flags of one config response, never modified once stored
+type featureSet struct {
+	flags map[string]bool
+}
+
+// applyFeatures replaces the feature flags with those of a config
+// response. The set is swapped as a whole so requests never see a mix of
+// two responses; a response without flags clears them.
+func (m *Manager) applyFeatures(flags map[string]bool) {
+	next := &featureSet{flags: make(map[string]bool, len(flags))}
+	for name, on := range flags {
+		next.flags[name] = on
+	}
+	previous, _ := m.features.Swap(next).(*featureSet)
+
+	if changes := featureChanges(previous, next); len(changes) > 0 {
+		logger.Infof("Feature flags changed by config API: %s", strings.Join(changes, ", "))
+	}
+}
+
+// featureChanges describes the flags that differ between two sets, sorted
+func featureChanges(previous, next *featureSet) []string {
+	var old map[string]bool
+	if previous != nil {
+		old = previous.flags
+	}
+	var changes []string
+	for name, on := range next.flags {
+		if was, ok := old[name]; !ok || was != on {
+			changes = append(changes, name+"="+onOff(on))
+		}
+	}
+	for name := range old {
+		if _, ok := next.flags[name]; !ok {
+			changes = append(changes, name+"=local")
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// Feature returns a flag set through the config API. set is false when the
+// config API does not mention the flag, or for a nil manager, and the
+// local configuration applies.
+func (m *Manager) Feature(name string) (on, set bool) {
+	if m == nil {
+		return false, false
+	}
+	fs, ok := m.features.Load().(*featureSet)
+	if !ok {
+		return false, false
+	}
+	on, set = fs.flags[name]
+	return on, set
+}
+
+// Features returns a copy of the flags set through the config API
+func (m *Manager) Features() map[string]bool {
+	if m == nil {
+		return nil
+	}
+	fs, ok := m.features.Load().(*featureSet)
+	if !ok || len(fs.flags) == 0 {
+		return nil
+	}
+	flags := make(map[string]bool, len(fs.flags))
+	for name, on := range fs.flags {
+		flags[name] = on
+	}
+	return flags
+}
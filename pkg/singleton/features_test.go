@@ -0,0 +1,57 @@
+package singleton
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	m := &Manager{}
+	if _, set := m.Feature(FeatureEventSampling); set {
+		t.Error("expected no flags before a config response")
+	}
+
+	m.applyFeatures(map[string]bool{FeatureEventSampling: false, FeatureIPv6Aggregation: true})
+	if on, set := m.Feature(FeatureEventSampling); !set || on {
+		t.Errorf("expected event_sampling off, got on=%v set=%v", on, set)
+	}
+	if on, set := m.Feature(FeatureIPv6Aggregation); !set || !on {
+		t.Errorf("expected ipv6_aggregation on, got on=%v set=%v", on, set)
+	}
+	if _, set := m.Feature(FeatureUserAgentCapture); set {
+		t.Error("expected unlisted flags to keep the local configuration")
+	}
+
+	flags := m.Features()
+	flags[FeatureEventSampling] = true
+	if on, _ := m.Feature(FeatureEventSampling); on {
+		t.Error("expected Features to return a copy")
+	}
+
+	// A response without flags clears them
+	m.applyFeatures(nil)
+	if m.Features() != nil {
+		t.Errorf("expected no flags, got %v", m.Features())
+	}
+
+	var nilManager *Manager
+	if _, set := nilManager.Feature(FeatureEventSampling); set || nilManager.Features() != nil {
+		t.Error("expected no flags for a nil manager")
+	}
+}
+
+func TestFeatureChanges(t *testing.T) {
+	previous := &featureSet{flags: map[string]bool{"a": true, "b": true, "c": false}}
+	next := &featureSet{flags: map[string]bool{"a": true, "b": false, "d": true}}
+	got := strings.Join(featureChanges(previous, next), ",")
+	if got != "b=off,c=local,d=on" {
+		t.Errorf("unexpected changes %q", got)
+	}
+	if changes := featureChanges(nil, &featureSet{}); changes != nil {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+	if !reflect.DeepEqual(featureChanges(nil, next), []string{"a=on", "b=off", "d=on"}) {
+		t.Errorf("unexpected initial changes %v", featureChanges(nil, next))
+	}
+}
@@ -0,0 +1,53 @@
+package singleton
+
+import "sync"
+
+// flightCall is an in-progress or completed flightGroup call
+type flightCall struct {
+	wg   sync.WaitGroup
+	val  interface{}
+	err  error
+	dups int // callers waiting on this call, guarded by flightGroup.mu
+}
+
+// flightGroup coalesces concurrent calls with the same key so that only one
+// runs and the others wait for and share its result (singleflight). Used to
+// avoid duplicate bootstrap, config and EDL downloads when several managers
+// or middleware instances start at the same time.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// fetchGroup is shared by all managers in the process
+var fetchGroup flightGroup
+
+// Do runs fn once for all concurrent callers with the same key. shared is
+// true when the result was produced by another caller's fn.
+func (g *flightGroup) Do(key string, fn func() (interface{}, error)) (val interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+
+	c.val, c.err = fn()
+	return c.val, c.err, false
+}
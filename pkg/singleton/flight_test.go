@@ -0,0 +1,88 @@
+package singleton
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupCoalescesConcurrentCalls(t *testing.T) {
+	var g flightGroup
+	var calls int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]interface{}, callers)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _, _ = g.Do("edl:https://edl.example.com", func() (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			close(started)
+			<-release
+			return "list", nil
+		})
+	}()
+	<-started
+
+	var sharedCount int32
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var shared bool
+			results[i], _, shared = g.Do("edl:https://edl.example.com", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				return "duplicate", nil
+			})
+			if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+		}(i)
+	}
+
+	// Release the leader only once every other caller is waiting on it
+	for {
+		g.mu.Lock()
+		dups := g.calls["edl:https://edl.example.com"].dups
+		g.mu.Unlock()
+		if dups == callers-1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected fn to run once, ran %d times", n)
+	}
+	if n := atomic.LoadInt32(&sharedCount); n != callers-1 {
+		t.Errorf("expected %d shared results, got %d", callers-1, n)
+	}
+	for i, r := range results {
+		if r != "list" {
+			t.Errorf("caller %d got %v, want shared result", i, r)
+		}
+	}
+}
+
+func TestFlightGroupSharesErrorsAndForgetsKey(t *testing.T) {
+	var g flightGroup
+	errFetch := errors.New("fetch failed")
+
+	if _, err, _ := g.Do("config:x", func() (interface{}, error) { return nil, errFetch }); err != errFetch {
+		t.Fatalf("expected fetch error, got %v", err)
+	}
+
+	// A completed call must not be cached: the next call runs fn again
+	val, err, shared := g.Do("config:x", func() (interface{}, error) { return "ok", nil })
+	if err != nil || val != "ok" || shared {
+		t.Errorf("expected fresh call result, got val=%v err=%v shared=%v", val, err, shared)
+	}
+}
@@ -0,0 +1,171 @@
+package singleton
+
+import (
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+)
+
+// Manager states reported to Hooks.OnStateChange
+const (
+	StateInitializing = "initializing"
+	StateActive       = "active"   // EDL is enforced
+	StateDegraded     = "degraded" // EDL is enforced, but the memory budget shrank buffers or refused an update
+	StateDisabled     = "disabled" // Deployment temporarily disabled on the backend
+	StateInactive     = "inactive" // Deployment deleted or without an EDL, traffic is allowed
+	StateFailed       = "failed"   // Initialization failed, traffic is allowed
+)
+
+// Hooks receives lifecycle notifications from the Manager. Subsystems such as
+// metrics register hooks instead of being called by the Manager directly.
+// Hooks run synchronously on the update and request paths and must not block.
+type Hooks interface {
+	OnEDLUpdated(update EDLUpdate)
+	OnDecision(d Decision)
+	OnStateChange(change StateChange)
+}
+
+// EDLUpdate describes an EDL update attempt
+type EDLUpdate struct {
+	URL        string
+	Generation string                 // Generation of the list in use after the attempt
+	Unchanged  bool                   // The backend reported the loaded generation, nothing was parsed
+	Summary    *logs.EDLUpdateDetails // Statistics of a newly parsed list, nil otherwise
+	Err        error
+}
+
+// StateChange describes a transition between manager states
+type StateChange struct {
+	From string
+	To   string
+}
+
+// HookFuncs implements Hooks with optional functions, nil fields are skipped
+type HookFuncs struct {
+	EDLUpdated  func(update EDLUpdate)
+	Decision    func(d Decision)
+	StateChange func(change StateChange)
+}
+
+func (h HookFuncs) OnEDLUpdated(update EDLUpdate) {
+	if h.EDLUpdated != nil {
+		h.EDLUpdated(update)
+	}
+}
+
+func (h HookFuncs) OnDecision(d Decision) {
+	if h.Decision != nil {
+		h.Decision(d)
+	}
+}
+
+func (h HookFuncs) OnStateChange(change StateChange) {
+	if h.StateChange != nil {
+		h.StateChange(change)
+	}
+}
+
+// RegisterHooks adds hooks that are notified from now on. The hook list is
+// replaced copy-on-write so notifying never takes a lock.
+func (m *Manager) RegisterHooks(h Hooks) {
+	if m == nil || h == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, _ := m.hooks.Load().([]Hooks)
+	next := make([]Hooks, len(current), len(current)+1)
+	copy(next, current)
+	m.hooks.Store(append(next, h))
+}
+
+// registeredHooks returns the current hooks
+func (m *Manager) registeredHooks() []Hooks {
+	if m == nil {
+		return nil
+	}
+	hooks, _ := m.hooks.Load().([]Hooks)
+	return hooks
+}
+
+// ObserveDecision notifies hooks of the final decision on a request,
+// including decisions made by local lists outside the Manager
+func (m *Manager) ObserveDecision(d Decision) {
+	for _, h := range m.registeredHooks() {
+		h.OnDecision(d)
+	}
+}
+
+// notifyEDLUpdated notifies hooks of an EDL update attempt
+func (m *Manager) notifyEDLUpdated(update EDLUpdate) {
+	for _, h := range m.registeredHooks() {
+		h.OnEDLUpdated(update)
+	}
+}
+
+// State returns the current manager state
+func (m *Manager) State() string {
+	if m == nil || !m.ready.Load() {
+		return StateInitializing
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	switch {
+	case m.temporarilyDisabled:
+		return StateDisabled
+	case m.deploymentEnabled && m.degraded.Load():
+		return StateDegraded
+	case m.deploymentEnabled:
+		return StateActive
+	case m.initErr != nil:
+		return StateFailed
+	}
+	return StateInactive
+}
+
+// refreshState notifies hooks when the state differs from the last one reported
+func (m *Manager) refreshState() {
+	state := m.State()
+	m.mu.Lock()
+	previous := m.lastState
+	if previous == "" {
+		previous = StateInitializing
+	}
+	m.lastState = state
+	m.mu.Unlock()
+
+	if state == previous {
+		return
+	}
+	logger.Debugf("Manager state changed from %s to %s", previous, state)
+	change := StateChange{From: previous, To: state}
+	for _, h := range m.registeredHooks() {
+		h.OnStateChange(change)
+	}
+}
+
+// metricsHooks feeds the shared Prometheus metrics
+func metricsHooks(mm *Metrics) Hooks {
+	return HookFuncs{
+		EDLUpdated: func(update EDLUpdate) {
+			if update.Err != nil {
+				mm.EDLUpdateFailure.Inc()
+			} else {
+				mm.EDLUpdateSuccess.Inc()
+			}
+		},
+		Decision: func(d Decision) {
+			mm.Lookup.Observe(d.Latency.Seconds())
+		},
+	}
+}
+
+// reportHooks ships the summary of each newly parsed EDL
+func reportHooks(m *Manager) Hooks {
+	return HookFuncs{
+		EDLUpdated: func(update EDLUpdate) {
+			if update.Summary != nil {
+				m.reportEDLUpdate(update.Summary)
+			}
+		},
+	}
+}
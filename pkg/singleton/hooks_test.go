@@ -0,0 +1,76 @@
+package singleton
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHooks(t *testing.T) {
+	m := &Manager{}
+
+	var updates []EDLUpdate
+	var decisions []Decision
+	var changes []StateChange
+	m.RegisterHooks(HookFuncs{
+		EDLUpdated:  func(u EDLUpdate) { updates = append(updates, u) },
+		Decision:    func(d Decision) { decisions = append(decisions, d) },
+		StateChange: func(c StateChange) { changes = append(changes, c) },
+	})
+	// Partial hooks only receive what they implement
+	m.RegisterHooks(HookFuncs{})
+	m.RegisterHooks(nil)
+
+	m.notifyEDLUpdated(EDLUpdate{Err: errors.New("boom")})
+	m.ObserveDecision(Decision{Allowed: true, Source: SourceLocal, Latency: time.Microsecond})
+	if len(updates) != 1 || updates[0].Err == nil {
+		t.Errorf("unexpected updates %+v", updates)
+	}
+	if len(decisions) != 1 || decisions[0].Source != SourceLocal {
+		t.Errorf("unexpected decisions %+v", decisions)
+	}
+
+	// Only transitions are reported
+	m.refreshState()
+	if len(changes) != 0 {
+		t.Fatalf("expected no change while initializing, got %+v", changes)
+	}
+	m.ready.Store(true)
+	m.deploymentEnabled = true
+	m.refreshState()
+	m.refreshState()
+	m.temporarilyDisabled = true
+	m.refreshState()
+
+	want := []StateChange{
+		{From: StateInitializing, To: StateActive},
+		{From: StateActive, To: StateDisabled},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("change %d: expected %+v, got %+v", i, want[i], changes[i])
+		}
+	}
+
+	var nilManager *Manager
+	nilManager.RegisterHooks(HookFuncs{})
+	nilManager.ObserveDecision(Decision{})
+	if nilManager.State() != StateInitializing {
+		t.Errorf("expected nil manager to be initializing, got %s", nilManager.State())
+	}
+}
+
+func TestStateFailedAndInactive(t *testing.T) {
+	m := &Manager{}
+	m.ready.Store(true)
+	if m.State() != StateInactive {
+		t.Errorf("expected inactive, got %s", m.State())
+	}
+	m.initErr = errors.New("bootstrap failed")
+	if m.State() != StateFailed {
+		t.Errorf("expected failed, got %s", m.State())
+	}
+}
@@ -0,0 +1,52 @@
+package singleton
+
+import "sync"
+
+// lifecycle tracks a background loop so it can be started and stopped any
+// number of times. Each run gets a fresh stop channel; starting a running
+// loop and stopping a stopped one are no-ops.
+type lifecycle struct {
+	mu      sync.Mutex
+	running bool
+	stopCh  chan struct{} // Stop channel of the current run
+}
+
+// start marks the loop running and returns the stop channel of the new run.
+// ok is false when a run is already in progress.
+func (l *lifecycle) start() (stopCh chan struct{}, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running {
+		return nil, false
+	}
+	l.running = true
+	l.stopCh = make(chan struct{})
+	return l.stopCh, true
+}
+
+// stop ends the current run, if any
+func (l *lifecycle) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.running {
+		return
+	}
+	close(l.stopCh)
+	l.running = false
+}
+
+// finish records that the run owning stopCh exited on its own
+func (l *lifecycle) finish(stopCh chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopCh == stopCh {
+		l.running = false
+	}
+}
+
+// isRunning reports whether a run is in progress
+func (l *lifecycle) isRunning() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running
+}
@@ -0,0 +1,97 @@
+package singleton
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+)
+
+// waitStopped waits for a loop to report it is no longer running
+func waitStopped(t *testing.T, l *lifecycle) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for l.isRunning() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if l.isRunning() {
+		t.Fatal("expected the loop to stop")
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	var l lifecycle
+	l.stop() // stopping a loop that never ran is a no-op
+
+	first, ok := l.start()
+	if !ok {
+		t.Fatal("expected the first start to succeed")
+	}
+	if _, ok := l.start(); ok {
+		t.Error("expected a second start to be refused while running")
+	}
+	l.stop()
+	l.stop()
+	select {
+	case <-first:
+	default:
+		t.Fatal("expected stop to close the run's channel")
+	}
+
+	second, ok := l.start()
+	if !ok || second == first {
+		t.Fatal("expected a restart with a fresh channel")
+	}
+
+	// A run that ended on its own can be started again, and finishing an
+	// older run does not affect the current one
+	l.finish(second)
+	third, ok := l.start()
+	if !ok {
+		t.Fatal("expected a start after the run finished")
+	}
+	l.finish(second)
+	if !l.isRunning() {
+		t.Error("finishing an old run must not end the current one")
+	}
+	l.stop()
+	select {
+	case <-third:
+	default:
+		t.Error("expected stop to close the current run's channel")
+	}
+}
+
+func TestLoopsRestartAfterStop(t *testing.T) {
+	u := NewEDLUpdater([]string{"https://edl.example.com"}, time.Hour, ipmatcher.New(), nil)
+	tm := NewTokenManager("token", "machine")
+
+	for cycle := 0; cycle < 3; cycle++ {
+		u.StartUpdateLoop(context.Background())
+		u.StartUpdateLoop(context.Background())
+		tm.StartRefreshLoop(context.Background())
+		tm.StartRefreshLoop(context.Background())
+		if !u.loop.isRunning() || !tm.loop.isRunning() {
+			t.Fatalf("cycle %d: expected both loops to run", cycle)
+		}
+
+		u.Stop()
+		u.Stop()
+		tm.Stop()
+		tm.Stop()
+		waitStopped(t, &u.loop)
+		waitStopped(t, &tm.loop)
+	}
+
+	// A loop ended by its context is restartable too
+	ctx, cancel := context.WithCancel(context.Background())
+	u.StartUpdateLoop(ctx)
+	cancel()
+	waitStopped(t, &u.loop)
+	u.StartUpdateLoop(context.Background())
+	if !u.loop.isRunning() {
+		t.Error("expected a restart after the context ended the loop")
+	}
+	u.Stop()
+}
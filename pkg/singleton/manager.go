@@ -2,336 +2,903 @@ package singleton
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
-	"net/netip"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/admin"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/api"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/asn"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/backoff"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/bounded"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/compat"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/dryrun"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/locallist"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/privacy"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/utils"
 )
 
-var (
-	instance *Manager
-	once     sync.Once
-	initErr  error
+// DefaultComponentType is the only component type accepted when none are configured
+const DefaultComponentType = "ellio_traefik_middleware_plugin"
+
+// defaultBootstrapTimeout is the startup deadline of bootstrap unless configured
+const defaultBootstrapTimeout = 30 * time.Second
+
+// defaultBootstrapRetry spaces the background bootstrap retries after the
+// startup deadline passed. Attempts are not limited.
+var defaultBootstrapRetry = backoff.Policy{Base: 5 * time.Second, Max: 5 * time.Minute}
+
+// defaultEDLUpdateFrequency applies when the config API sends no frequency
+const defaultEDLUpdateFrequency = 5 * time.Minute
+
+// Bounds of the adaptive event flush interval unless configured
+const (
+	defaultEventFlushMin = 1 * time.Second
+	defaultEventFlushMax = 10 * time.Second
 )
 
 type Manager struct {
 	mu                  sync.RWMutex
 	bootstrapToken      string
+	auditKey            []byte // Derived from bootstrapToken, nil without one
 	tokenManager        *TokenManager
 	edlUpdater          *EDLUpdater
 	matcher             *ipmatcher.Matcher
 	logShipper          *logs.LogShipper
 	deploymentEnabled   bool
-	temporarilyDisabled bool          // True when deployment is temporarily disabled (403)
-	disabledCheckTime   time.Time     // Next time to check if deployment is re-enabled
-	edlMode             string        // "blocklist" or "allowlist"
-	edlURL              string        // Current EDL URL
-	edlUpdateFreq       time.Duration // Current update frequency
+	temporarilyDisabled bool           // True when deployment is temporarily disabled (403)
+	disabledCheckTime   time.Time      // Next time to check if deployment is re-enabled
+	edlMode             string         // "blocklist", "allowlist" or "combined"
+	edlURLs             []string       // Current EDL URLs
+	edlAllowURLs        []string       // Allowlist part of edlURLs in combined mode
+	edlPrecedence       string         // List deciding clients on both lists in combined mode, "allowlist" or "blocklist"
+	edlUpdateFreq       time.Duration  // Current update frequency
+	edlFormat           string         // Accepted EDL payload format, EDLFormatAuto or EDLFormatBinary
+	asnTable            *asn.Table     // Resolves ASN entries of plain-text EDLs, nil when not configured
+	torExits            *torExitList   // Tor exit list, nil until an instance enables blockTorExits (guarded by mu)
+	retry               backoff.Policy // Configured retry caps of API calls, zero fields keep per-call defaults
+	tlsConfig           *tls.Config    // TLS settings of outbound API calls, nil keeps the defaults
 	deviceID            string
-	deploymentID        string // Deployment ID from JWT
+	deploymentID        string                          // Deployment ID from JWT
+	runtimeProbe        compat.Result                   // Interpreter capability probe results
+	instanceConfig      atomic.Value                    // holds *InstanceConfig of the most recently configured instance
+	instances           map[string]trackedInstance      // Instance configs of the current generation keyed by middleware name (guarded by mu)
+	instanceGeneration  uint64                          // Current configuration generation, see instanceGenerationGap (guarded by mu)
+	lastInstanceApply   time.Time                       // When an instance config was last applied (guarded by mu)
+	configConflict      atomic.Bool                     // True when current instances disagree on IP extraction settings
+	now                 func() time.Time                // clock, replaced in tests; nil uses time.Now
+	ready               atomic.Bool                     // True once initialization has finished (successfully or not)
+	initErr             error                           // Initialization error, if any (guarded by mu)
+	bootstrapRetrying   atomic.Bool                     // Bootstrap missed the startup deadline and is retried in the background
+	overlay             *locallist.Overlay              // Runtime allow/block overlay managed via the admin API
+	xffTruncated        atomic.Int64                    // Requests whose X-Forwarded-For exceeded the parsing limits
+	ipv4Checks          atomic.Int64                    // EDL checks of IPv4 clients
+	ipv6Checks          atomic.Int64                    // EDL checks of IPv6 clients
+	edlIPv4Only         atomic.Bool                     // The loaded EDL has IPv4 entries but no IPv6 ones
+	familyWarned        atomic.Bool                     // The family mismatch was logged for the loaded EDL
+	decisionErrors      decisionErrorRing               // Recent requests no verdict could be made for
+	dryRun              *dryrun.Report                  // Monitor mode comparison report, created on first would-block (guarded by mu)
+	trackers            map[string]func() bounded.Stats // Usage reporters of bounded per-IP structures (guarded by mu)
+	privacy             *privacy.Hasher                 // Identifier hashing, configured by the config API
+	remoteLogLevel      string                          // Log level last pushed through the config API
+	configHash          string                          // SHA-256 of the last config response (guarded by mu)
+	configSchema        int                             // Schema version of the last config response (guarded by mu)
+	features            atomic.Value                    // holds *featureSet of the last config response
+	metrics             *Metrics                        // Prometheus metrics shared by all instances
+	hooks               atomic.Value                    // holds []Hooks, replaced on registration
+	lastState           string                          // State last reported to hooks (guarded by mu)
+	offline             bool                            // EDL is loaded from a local file, there is no token manager
+	dev                 bool                            // Dev mode enforces the inline DevBlocklist, there is no EDL updater
+	memoryBudget        int64                           // Bytes the EDL and buffers may use, 0 is unbounded
+	degraded            atomic.Bool                     // The memory budget forced shrunk buffers or a refused EDL
+	cacheDir            string                          // Deployment directory of the EDL cache, empty when disabled
+	cacheLoaded         atomic.Bool                     // A cached EDL is enforced while initializing
 	stopCh              chan struct{}
+	stopOnce            sync.Once
+	stopErr             error         // Result of the first Stop
 	disabledRetryCh     chan struct{} // Channel to trigger retry for disabled deployment
 }
 
-// Initialize creates and starts the singleton manager
-func Initialize(bootstrapToken, machineID string, ipStrategy string, trustedHeader string, trustedProxies []string) error {
-	logger.Trace("Initialize called")
-	once.Do(func() {
-		logger.Trace("Inside once.Do")
-		if bootstrapToken == "" {
-			logger.Error("Bootstrap token is empty")
-			initErr = errors.New("bootstrap token is required")
-			return
-		}
+// Options configures a Manager
+type Options struct {
+	BootstrapToken string
+	MachineID      string   // Optional, a random ID is generated when empty
+	ComponentTypes []string // Accepted JWT component types, defaults to DefaultComponentType
+
+	// IP extraction settings reported in batch metadata
+	IPStrategy     string
+	TrustedHeader  string
+	TrustedProxies []string
+
+	// InitTimeout bounds config fetch and the initial EDL load, and
+	// bootstrap unless BootstrapTimeout is set. Zero keeps the default
+	// (unbounded EDL load).
+	InitTimeout time.Duration
+	// BootstrapTimeout is the startup deadline of bootstrap, default 30s.
+	// Bootstrap failing within it is retried in the background; the manager
+	// stays initializing until it succeeds.
+	BootstrapTimeout time.Duration
+	// AsyncInit returns from NewManager right after token validation and
+	// finishes initialization in the background; traffic is allowed until ready
+	AsyncInit bool
+
+	// EDLFilePath loads the EDL from a local file (binary format) instead of
+	// the ELLIO API. No bootstrap token is needed and no events are shipped.
+	EDLFilePath    string
+	EDLFileMode    string        // "blocklist" (default) or "allowlist"
+	EDLFileRefresh time.Duration // How often the file is checked for changes, default 10s
+
+	// DevMode is for trying the middleware locally without an ELLIO tenant:
+	// no ELLIO API calls are made, no events are shipped, and the inline
+	// DevBlocklist of IPs and CIDRs is enforced as a blocklist EDL.
+	// No bootstrap token is needed.
+	DevMode      bool
+	DevBlocklist []string
+
+	// EDLFormat is EDLFormatAuto (default) to load plain-text lists when the
+	// EDL is not ELLIOTRIE, or EDLFormatBinary to reject them
+	EDLFormat string
+
+	// EDLPrecedence decides clients on both lists of a combined EDL,
+	// PrecedenceAllowlist (default) or PrecedenceBlocklist
+	EDLPrecedence string
+
+	// ASNTablePath is a prefix-to-ASN table file, one "<prefix> <asn>" per
+	// line, resolving "AS64500" entries of plain-text EDLs to the prefixes
+	// of the AS. It is read once at startup; without it ASN entries are
+	// skipped with a warning.
+	ASNTablePath string
+
+	// Rate limit of batches shipped to the logs API. When both are zero the
+	// limit is tuned to the observed event rate.
+	LogsRate  int64 // Steady-state batches per second, default 100
+	LogsBurst int64 // Burst size in batches, default 10 seconds of LogsRate
+
+	// EncryptEvents encrypts shipped events to the public key delivered at
+	// bootstrap. Events are held, not sent in the clear, while no key is known.
+	EncryptEvents bool
+
+	// EventDedup collapses repeated blocks of a client IP within the window
+	// into one event carrying a count, bounded to EventDedupMax client IPs.
+	// Zero ships every block.
+	EventDedup    time.Duration
+	EventDedupMax int
+
+	// Events are flushed every EventFlushMin while blocks are rare, and the
+	// interval stretches toward EventFlushMax as the block rate grows, for
+	// larger batches and fewer requests. Defaults are 1s and 10s; a max not
+	// above the min keeps the interval fixed.
+	EventFlushMin time.Duration
+	EventFlushMax time.Duration
+
+	// QuietHours are daily "HH:MM-HH:MM" windows in QuietHoursTimezone
+	// (default UTC) during which events are spooled instead of shipped, up
+	// to QuietSpoolMax events. Afterwards the spool is shipped at
+	// QuietCatchUpRate batches per second.
+	QuietHours         []string
+	QuietHoursTimezone string
+	QuietSpoolMax      int
+	QuietCatchUpRate   int
+
+	// MemoryBudgetMB bounds the memory of the EDL trie and event buffers.
+	// Oversized EDL updates are refused and buffers shrunk instead of
+	// risking an OOM kill of Traefik. Zero is unbounded.
+	MemoryBudgetMB int
+
+	// CacheDir keeps the last loaded EDL on disk. At startup it is enforced
+	// until the first download completes, instead of allowing all traffic.
+	// Ignored with EDLFilePath.
+	CacheDir string
+
+	// Retry caps the full-jitter backoff of EDL downloads, bootstrap calls
+	// and event uploads. Zero fields keep the defaults of each call.
+	Retry backoff.Policy
+
+	// TLS configures the clients of the bootstrap, config, EDL and logs
+	// endpoints, e.g. with a private CA bundle or a client certificate for
+	// mutual TLS
+	TLS api.TLSOptions
+}
 
-		logger.Trace("Creating manager instance")
-		manager := &Manager{
-			bootstrapToken:  bootstrapToken,
-			matcher:         ipmatcher.New(),
-			stopCh:          make(chan struct{}),
-			disabledRetryCh: make(chan struct{}, 1),
-		}
+// NewManager creates and starts a manager that is independent of the
+// deployment registry. The returned manager may be non-nil together
+// with an error when initialization failed after it was created.
+func NewManager(opts Options) (*Manager, error) {
+	// Probe for known interpreter limitations before anything relies on them
+	probe, err := compat.Run()
+	if err != nil {
+		return nil, err
+	}
+	api.SetManualDecoding(!probe.StructTagJSON)
 
-		// Set instance early to avoid race condition
-		// Even if initialization fails later, we have a valid (but disabled) manager
-		logger.Trace("Setting global instance")
-		instance = manager
+	if opts.BootstrapToken == "" && opts.EDLFilePath == "" && !opts.DevMode {
+		logger.Error("Bootstrap token is empty")
+		return nil, errors.New("bootstrap token is required")
+	}
 
-		// Use provided machine ID or generate random one
-		if machineID != "" {
-			manager.deviceID = machineID
-			logger.Infof("Using provided machine ID: %s", machineID)
-		} else {
-			manager.deviceID = utils.GenerateMachineID()
-			logger.Infof("Generated random machine ID: %s", manager.deviceID)
-		}
+	tlsConfig, err := opts.TLS.TLSConfig()
+	if err != nil {
+		logger.Errorf("Invalid TLS options: %v", err)
+		return nil, err
+	}
+	if opts.TLS.InsecureSkipVerify {
+		logger.Warn("insecureSkipVerify is set, ELLIO API certificates are not verified")
+	}
+	if opts.TLS.ClientCert != "" {
+		logger.Info("Using a client certificate for mutual TLS with the ELLIO API")
+	}
 
-		// Initialize token manager
-		manager.tokenManager = NewTokenManager(bootstrapToken, manager.deviceID)
+	logger.Trace("Creating manager instance")
+	manager := &Manager{
+		bootstrapToken:  opts.BootstrapToken,
+		auditKey:        admin.AuditKey([]byte(opts.BootstrapToken)),
+		matcher:         ipmatcher.New(),
+		stopCh:          make(chan struct{}),
+		disabledRetryCh: make(chan struct{}, 1),
+		runtimeProbe:    probe,
+		overlay:         locallist.NewOverlay(),
+		privacy:         privacy.NewHasher(),
+		memoryBudget:    int64(opts.MemoryBudgetMB) << 20,
+		edlFormat:       EDLFormatAuto,
+		edlPrecedence:   PrecedenceAllowlist,
+		retry:           opts.Retry,
+		tlsConfig:       tlsConfig,
+	}
+	if opts.EDLFormat == EDLFormatBinary {
+		manager.edlFormat = EDLFormatBinary
+	}
+	if opts.EDLPrecedence == PrecedenceBlocklist {
+		manager.edlPrecedence = PrecedenceBlocklist
+	}
+	if opts.ASNTablePath != "" {
+		manager.asnTable = loadASNTable(opts.ASNTablePath)
+	}
+	manager.metrics = newMetrics(manager)
+	manager.RegisterHooks(metricsHooks(manager.metrics))
+	manager.RegisterHooks(reportHooks(manager))
+
+	// Use provided machine ID or generate random one
+	if opts.MachineID != "" {
+		manager.deviceID = opts.MachineID
+		logger.Infof("Using provided machine ID: %s", opts.MachineID)
+	} else {
+		manager.deviceID = utils.GenerateMachineID()
+		logger.Infof("Generated random machine ID: %s", manager.deviceID)
+	}
 
-		// Parse JWT to validate component_type and issuer
-		claims, err := manager.tokenManager.ParseBootstrapToken()
-		if err != nil {
-			initErr = err
-			return
-		}
+	if opts.DevMode {
+		return manager, manager.startDev(opts)
+	}
+
+	// Air-gapped deployments load the EDL from a file and never contact the API
+	if opts.EDLFilePath != "" {
+		return manager, manager.startOffline(opts)
+	}
+
+	// Initialize token manager
+	manager.tokenManager = NewTokenManager(opts.BootstrapToken, manager.deviceID)
+	manager.tokenManager.SetRefreshHook(manager.CheckConfigUpdates)
+	manager.tokenManager.SetRetry(opts.Retry)
+	manager.tokenManager.SetTLSConfig(tlsConfig)
+
+	// Parse JWT to validate component_type and issuer
+	claims, err := manager.tokenManager.ParseBootstrapToken()
+	if err != nil {
+		return manager, err
+	}
+
+	// Store deployment ID
+	manager.deploymentID = claims.DeploymentID
+
+	// Validate component type
+	if err := validateComponentType(claims.ComponentType, opts.ComponentTypes); err != nil {
+		return manager, err
+	}
+
+	// Validate issuer is present (required for bootstrap URL construction)
+	if claims.Issuer == "" {
+		return manager, errors.New("bootstrap token missing issuer")
+	}
+
+	if opts.CacheDir != "" {
+		manager.cacheDir = deploymentCacheDir(opts.CacheDir, manager.deploymentID)
+	}
+
+	if opts.AsyncInit {
+		logger.Info("Continuing initialization in the background, allowing all traffic until ready")
+		go func() {
+			if err := manager.start(opts); err != nil {
+				logger.Errorf("Background initialization failed, allowing all traffic: %v", err)
+			}
+		}()
+		return manager, nil
+	}
+
+	return manager, manager.start(opts)
+}
+
+// start bootstraps the deployment within the startup deadline and then
+// starts the log shipper and loads the initial EDL. The manager reports
+// ready once both are done. When bootstrap fails for a reason that may
+// pass, such as a timeout on a slow network, the manager keeps initializing
+// and bootstrap is retried in the background, see retryBootstrap.
+func (m *Manager) start(opts Options) error {
+	if m.deploymentID != "" {
+		logger.Infof("Initializing ELLIO middleware for deployment: %s", m.deploymentID)
+	}
+	if m.cacheDir != "" {
+		m.loadCachedEDL()
+	}
+
+	timeout := bootstrapTimeout(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	err := m.bootstrap(ctx)
+	cancel()
+	if err != nil {
+		logger.Warnf("Bootstrap did not complete within %v, retrying in the background: %v", timeout, err)
+		m.bootstrapRetrying.Store(true)
+		go m.retryBootstrap(opts, timeout)
+		return nil
+	}
+	return m.startServices(opts)
+}
 
-		// Store deployment ID
-		manager.deploymentID = claims.DeploymentID
+// bootstrapTimeout returns the startup deadline of the bootstrap call
+func bootstrapTimeout(opts Options) time.Duration {
+	switch {
+	case opts.BootstrapTimeout > 0:
+		return opts.BootstrapTimeout
+	case opts.InitTimeout > 0:
+		return opts.InitTimeout
+	}
+	return defaultBootstrapTimeout
+}
+
+// bootstrap exchanges the bootstrap token. Deployments deleted or disabled
+// on the backend are not an error, traffic is allowed for them.
+func (m *Manager) bootstrap(ctx context.Context) error {
+	err := m.tokenManager.Initialize(ctx)
+	switch {
+	case err == nil:
+	case api.IsPermanentError(err):
+		// Deployment deleted, run in allow-all mode
+		m.mu.Lock()
+		m.deploymentEnabled = false
+		m.mu.Unlock()
+		logger.Info("Deployment deleted (410), running in allow-all mode")
+	case api.IsTemporaryDisabled(err):
+		// Deployment temporarily disabled, run in allow-all mode but retry
+		m.mu.Lock()
+		m.temporarilyDisabled = true
+		m.disabledCheckTime = time.Now().Add(1 * time.Minute)
+		m.mu.Unlock()
+		logger.Info("Deployment temporarily disabled (403), running in allow-all mode, will retry in 1 minute")
+		// Start retry goroutine
+		go m.startDisabledRetryLoop()
+	default:
+		return err
+	}
+	return nil
+}
 
-		// Validate component type
-		if claims.ComponentType != "ellio_traefik_middleware_plugin" {
-			initErr = errors.New("invalid component_type in JWT, expected ellio_traefik_middleware_plugin")
+// retryBootstrap retries bootstrap with backoff until it succeeds or the
+// manager stops, each attempt bounded by timeout. Until then the manager
+// is not ready, so traffic is handled according to the failure mode.
+func (m *Manager) retryBootstrap(opts Options, timeout time.Duration) {
+	policy := m.retry.Or(defaultBootstrapRetry)
+	for retry := 1; ; retry++ {
+		timer := time.NewTimer(policy.Delay(retry))
+		select {
+		case <-m.stopCh:
+			timer.Stop()
 			return
+		case <-timer.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := m.bootstrap(ctx)
+		cancel()
+		if err != nil {
+			logger.Warnf("Bootstrap retry %d failed: %v", retry, err)
+			continue
 		}
 
-		// Validate issuer is present (required for bootstrap URL construction)
-		if claims.Issuer == "" {
-			initErr = errors.New("bootstrap token missing issuer")
+		select {
+		case <-m.stopCh:
 			return
+		default:
+		}
+		logger.Infof("Bootstrap succeeded after %d retries, finishing initialization", retry)
+		m.bootstrapRetrying.Store(false)
+		if err := m.startServices(opts); err != nil {
+			logger.Errorf("Initialization failed after bootstrap, allowing all traffic: %v", err)
 		}
+		return
+	}
+}
+
+// startServices starts the log shipper and loads the initial EDL of a
+// bootstrapped deployment, then reports the manager ready
+func (m *Manager) startServices(opts Options) (err error) {
+	defer func() {
+		m.mu.Lock()
+		m.initErr = err
+		m.mu.Unlock()
+		m.ready.Store(true)
+		m.refreshState()
+		logger.Tracef("Manager ready - err=%v", err)
+	}()
+
+	edlCtx := context.Background() // No timeout for EDL parsing in Yaegi
+	if opts.InitTimeout > 0 {
+		var cancelInit context.CancelFunc
+		edlCtx, cancelInit = context.WithTimeout(context.Background(), opts.InitTimeout)
+		defer cancelInit()
+	}
 
-		// Initialize with bootstrap (30 second timeout is fine for bootstrap)
-		if manager.deploymentID != "" {
-			logger.Infof("Initializing ELLIO middleware for deployment: %s", manager.deploymentID)
+	// Initialize log shipper if we have a logs URL
+	if logsURL := m.tokenManager.GetLogsURL(); logsURL != "" {
+		logger.Debugf("Initializing log shipper with URL: %s", logsURL)
+		rate, burst := opts.LogsRate, opts.LogsBurst
+		if rate <= 0 {
+			rate = 100
+		}
+		if burst <= 0 {
+			burst = rate * 10
+		}
+		flushMin, flushMax := opts.EventFlushMin, opts.EventFlushMax
+		if flushMin <= 0 {
+			flushMin = defaultEventFlushMin
+		}
+		if flushMax <= 0 {
+			flushMax = defaultEventFlushMax
+		}
+		if flushMax < flushMin {
+			logger.Warnf("Event flush max %v is below the min %v, flushing every %v", flushMax, flushMin, flushMin)
+		}
+		logConfig := &logs.LogShipperConfig{
+			BatchSize:        100,
+			FlushInterval:    flushMin,
+			MaxFlushInterval: flushMax,
+			BucketCapacity:   burst,
+			RefillRate:       rate,
+			Adaptive:         opts.LogsRate <= 0 && opts.LogsBurst <= 0,
+			BufferSize:       defaultShipperBuffer,
+			PollingMode:      !m.runtimeProbe.ChannelSelect,
+			EncryptEvents:    opts.EncryptEvents,
+			Retry:            opts.Retry,
+			TLSConfig:        m.tlsConfig,
+
+			DedupWindow:     opts.EventDedup,
+			DedupMaxEntries: opts.EventDedupMax,
+
+			SpoolMax:    opts.QuietSpoolMax,
+			CatchUpRate: opts.QuietCatchUpRate,
+		}
+		if quiet, err := logs.ParseQuietHours(opts.QuietHours, opts.QuietHoursTimezone); err != nil {
+			logger.Errorf("Ignoring quietHours, events are shipped at all times: %v", err)
+		} else if quiet != nil {
+			logConfig.QuietHours = quiet
+			logger.Infof("Pausing event shipping during quiet hours %s", strings.Join(opts.QuietHours, ", "))
 		}
+		shipper := logs.NewLogShipper(m.tokenManager, logConfig)
+		if opts.EncryptEvents {
+			if _, key := m.tokenManager.GetEventsKey(); key == "" {
+				logger.Warn("encryptEvents is set but bootstrap delivered no events key, holding events")
+			} else {
+				logger.Info("Encrypting event payloads to the deployment key")
+			}
+		}
+		m.mu.Lock()
+		m.logShipper = shipper
+		m.mu.Unlock()
+
+		// Set batch metadata from the latest instance configuration, which
+		// may already have been applied while initializing in the background
+		cfg := m.GetInstanceConfig()
+		if cfg == nil {
+			cfg = &InstanceConfig{
+				IPStrategy:     opts.IPStrategy,
+				TrustedHeader:  opts.TrustedHeader,
+				TrustedProxies: opts.TrustedProxies,
+			}
+		}
+		m.ApplyInstanceConfig(cfg)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+		m.logShipper.Start()
+		logger.Debug("Log shipper initialized and started")
+	} else {
+		logger.Trace("No logs URL available, log shipper not initialized")
+	}
 
-		if err := manager.tokenManager.Initialize(ctx); err != nil {
+	if m.deploymentEnabled = m.tokenManager.IsDeploymentActive(); m.deploymentEnabled {
+		// Fetch EDL configuration (edlCtx is unbounded unless initTimeout is set, Yaegi is slower than native Go)
+		logger.Debugf("Fetching EDL configuration for deployment: %s", m.deploymentID)
+		edlConfig, err := m.fetchEDLConfig(edlCtx)
+		if err != nil {
 			if api.IsPermanentError(err) {
-				// Deployment deleted, run in allow-all mode
-				manager.deploymentEnabled = false
-				logger.Info("Deployment deleted (410), running in allow-all mode")
+				m.deploymentEnabled = false
+				logger.Info("Deployment deleted while fetching config")
 			} else if api.IsTemporaryDisabled(err) {
-				// Deployment temporarily disabled, run in allow-all mode but retry
-				manager.temporarilyDisabled = true
-				manager.disabledCheckTime = time.Now().Add(1 * time.Minute)
-				logger.Info("Deployment temporarily disabled (403), running in allow-all mode, will retry in 1 minute")
-				// Start retry goroutine
-				go manager.startDisabledRetryLoop()
+				m.temporarilyDisabled = true
+				m.disabledCheckTime = time.Now().Add(1 * time.Minute)
+				logger.Info("Deployment temporarily disabled while fetching config")
+				go m.startDisabledRetryLoop()
 			} else {
-				initErr = err
-				return
+				logger.Errorf("Failed to fetch EDL config: %v", err)
+				return err
 			}
 		}
 
-		// Initialize log shipper if we have a logs URL
-		if logsURL := manager.tokenManager.GetLogsURL(); logsURL != "" {
-			logger.Debugf("Initializing log shipper with URL: %s", logsURL)
-			logConfig := &logs.LogShipperConfig{
-				BatchSize:      100,
-				FlushInterval:  1 * time.Second,
-				BucketCapacity: 1000,
-				RefillRate:     100,
-				BufferSize:     10000,
-			}
-			manager.logShipper = logs.NewLogShipper(manager.tokenManager, logConfig)
+		// EDL is enabled if we have a valid config with URLs
+		if m.deploymentEnabled && edlConfig != nil && len(edlConfig.URLs.All()) > 0 {
+			// Set EDL mode; a cached EDL may already be enforced
+			mode, edlURLs, allowURLs := edlLists(edlConfig)
+			m.mu.Lock()
+			m.edlMode = mode
+			m.mu.Unlock()
 
-			// Set batch metadata
-			metadata := &logs.BatchMetadata{
-				DeviceID:   manager.deviceID,
-				IPStrategy: ipStrategy,
+			updateFreq := time.Duration(edlConfig.UpdateFrequencySeconds) * time.Second
+			if updateFreq <= 0 {
+				updateFreq = defaultEDLUpdateFrequency
 			}
-			// Only include optional fields if configured
-			if ipStrategy == "custom" && trustedHeader != "" {
-				metadata.TrustedHeader = trustedHeader
-			}
-			if len(trustedProxies) > 0 {
-				metadata.TrustedProxies = trustedProxies
+
+			// Store current configuration. The updater of a cached EDL is
+			// kept so unchanged sources are not downloaded again.
+			m.mu.Lock()
+			m.edlURLs = edlURLs
+			m.edlAllowURLs = allowURLs
+			m.edlUpdateFreq = updateFreq
+			if m.edlUpdater != nil {
+				m.edlUpdater.configure(edlURLs, updateFreq)
+			} else {
+				m.edlUpdater = m.newEDLUpdater(edlURLs, updateFreq)
 			}
-			manager.logShipper.SetBatchMetadata(metadata)
+			m.edlUpdater.SetAllowlist(allowURLs)
+			m.mu.Unlock()
 
-			manager.logShipper.Start()
-			logger.Debug("Log shipper initialized and started")
-		} else {
-			logger.Trace("No logs URL available, log shipper not initialized")
-		}
-
-		if manager.deploymentEnabled = manager.tokenManager.IsDeploymentActive(); manager.deploymentEnabled {
-			// Use longer timeout for EDL operations (Yaegi is slower than native Go)
-			edlCtx := context.Background() // No timeout for EDL parsing in Yaegi
-
-			// Fetch EDL configuration
-			logger.Debugf("Fetching EDL configuration for deployment: %s", manager.deploymentID)
-			edlConfig, err := manager.fetchEDLConfig(edlCtx)
-			if err != nil {
-				if api.IsPermanentError(err) {
-					manager.deploymentEnabled = false
-					logger.Info("Deployment deleted while fetching config")
-				} else if api.IsTemporaryDisabled(err) {
-					manager.temporarilyDisabled = true
-					manager.disabledCheckTime = time.Now().Add(1 * time.Minute)
-					logger.Info("Deployment temporarily disabled while fetching config")
-					go manager.startDisabledRetryLoop()
-				} else {
-					logger.Errorf("Failed to fetch EDL config: %v", err)
-					initErr = err
-					return
+			// Start EDL updater
+			logger.Debugf("Starting EDL updater for deployment: %s", m.deploymentID)
+			if err := m.edlUpdater.Start(edlCtx); err != nil {
+				if !m.cacheLoaded.Load() {
+					logger.Errorf("Failed to start EDL updater: %v", err)
+					return err
 				}
+				logger.Warnf("Initial EDL download failed, keeping the cached EDL until an update succeeds: %v", err)
 			}
+			logger.Debug("EDL updater started successfully")
 
-			// EDL is enabled if we have a valid config with URLs
-			if manager.deploymentEnabled && edlConfig != nil && len(edlConfig.URLs.Combined) > 0 {
-				// Set EDL mode
-				switch edlConfig.Purpose {
-				case "allowlist":
-					manager.edlMode = "allowlist"
-				case "blocklist", "other", "others":
-					manager.edlMode = "blocklist"
-				default:
-					manager.edlMode = "blocklist"
-				}
+			// Start background refresh loops
+			m.tokenManager.StartRefreshLoop(context.Background())
+			m.edlUpdater.StartUpdateLoop(context.Background())
+		} else {
+			m.deploymentEnabled = false
+		}
+	}
+	logger.Tracef("Initialization complete - deploymentEnabled=%v", m.deploymentEnabled)
+	return nil
+}
 
-				// Initialize EDL updater
-				var edlURL string
-				if len(edlConfig.URLs.Combined) > 0 {
-					edlURL = edlConfig.URLs.Combined[0]
-				}
+// newEDLUpdater creates an updater feeding the manager's matcher
+func (m *Manager) newEDLUpdater(urls []string, updateFreq time.Duration) *EDLUpdater {
+	updater := NewEDLUpdater(urls, updateFreq, m.matcher, m)
+	updater.SetFormat(m.edlFormat)
+	updater.SetASNTable(m.asnTable)
+	updater.SetCacheDir(m.cacheDir)
+	updater.SetRetry(m.retry)
+	updater.SetTLSConfig(m.tlsConfig)
+	return updater
+}
 
-				updateFreq := time.Duration(edlConfig.UpdateFrequencySeconds) * time.Second
-				if updateFreq <= 0 {
-					updateFreq = 5 * time.Minute
-				}
+// loadASNTable loads the prefix-to-ASN table at path. A table that fails
+// to load is logged and left out, ASN entries are then skipped.
+func loadASNTable(path string) *asn.Table {
+	table, invalid, err := asn.Load(path)
+	if err != nil {
+		logger.Errorf("Failed to load ASN table %s, skipping ASN entries of EDLs: %v", path, err)
+		return nil
+	}
+	if len(invalid) > 0 {
+		logger.Warnf("Skipped %d invalid lines of ASN table %s, first: %q", len(invalid), path, invalid[0])
+	}
+	logger.Infof("Loaded ASN table %s: %d prefixes of %d ASNs", path, table.Len(), table.ASNs())
+	return table
+}
 
-				// Store current configuration
-				manager.edlURL = edlURL
-				manager.edlUpdateFreq = updateFreq
+// edlLists returns the EDL mode of a config and the URLs of its sources.
+// In combined mode urls also holds the allowlist URLs, given once more in
+// allow; a URL on both lists stays in the blocklist.
+func edlLists(cfg *api.EDLConfig) (mode string, urls, allow []string) {
+	urls = cfg.URLs.All()
+	if !cfg.Combined() {
+		if cfg.Purpose == "allowlist" {
+			return "allowlist", urls, nil
+		}
+		return "blocklist", urls, nil
+	}
 
-				manager.edlUpdater = NewEDLUpdater(edlURL, updateFreq, manager.matcher, manager)
+	blocklist := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		blocklist[url] = true
+	}
+	for _, url := range cfg.AllowlistURLs.All() {
+		if blocklist[url] {
+			logger.Warnf("EDL %s is on both lists, using it as blocklist", url)
+			continue
+		}
+		allow = append(allow, url)
+		urls = append(urls, url)
+	}
+	if len(allow) == 0 {
+		return "blocklist", urls, nil
+	}
+	return EDLModeCombined, urls, allow
+}
 
-				// Start EDL updater (use edlCtx without timeout for Yaegi)
-				logger.Debugf("Starting EDL updater for deployment: %s", manager.deploymentID)
-				if err := manager.edlUpdater.Start(edlCtx); err != nil {
-					logger.Errorf("Failed to start EDL updater: %v", err)
-					initErr = err
-					return
-				}
-				logger.Debug("EDL updater started successfully")
+// validateComponentType checks the JWT component_type against the accepted list.
+// A list without non-blank entries accepts only DefaultComponentType, and a
+// missing claim is always rejected.
+func validateComponentType(componentType string, allowed []string) error {
+	allowed = parseComponentTypes(allowed)
+	if componentType == "" {
+		return errors.New("missing component_type in JWT, expected one of: " + strings.Join(allowed, ", "))
+	}
 
-				// Start background refresh loops
-				go manager.tokenManager.StartRefreshLoop(context.Background())
-				go manager.edlUpdater.StartUpdateLoop(context.Background())
-			} else {
-				manager.deploymentEnabled = false
-			}
+	for _, t := range allowed {
+		if componentType == t {
+			return nil
 		}
-		logger.Tracef("Initialization complete - deploymentEnabled=%v", manager.deploymentEnabled)
-	})
+	}
 
-	logger.Tracef("Initialize returning - err=%v", initErr)
-	return initErr
+	return errors.New("invalid component_type in JWT, expected one of: " + strings.Join(allowed, ", "))
 }
 
-// GetManager returns the singleton manager instance
-func GetManager() *Manager {
-	return instance
+// parseComponentTypes trims the accepted component types and drops blank
+// entries, falling back to DefaultComponentType when none are left
+func parseComponentTypes(types []string) []string {
+	var result []string
+	for _, t := range types {
+		if t = strings.TrimSpace(t); t != "" {
+			result = append(result, t)
+		}
+	}
+	if len(result) == 0 {
+		return []string{DefaultComponentType}
+	}
+	return result
 }
 
-// IsDeploymentEnabled returns whether deployment is enabled
-func (m *Manager) IsDeploymentEnabled() bool {
-	if m == nil {
+// InstanceConfig is the per-middleware configuration that is reported
+// alongside shipped events. Traefik creates new middleware instances on
+// every dynamic configuration reload, each applying its own snapshot.
+type InstanceConfig struct {
+	Name           string // Middleware instance name, empty for the initial bootstrap call
+	IPStrategy     string
+	TrustedHeader  string
+	TrustedProxies []string
+}
+
+// instanceGenerationGap separates configuration generations. Traefik
+// recreates every middleware on each dynamic configuration reload, within
+// moments of each other; an instance config applied after a longer pause
+// starts a new generation, and instances that were not recreated since are
+// gone.
+const instanceGenerationGap = 10 * time.Second
+
+// trackedInstance is an instance config tagged with its generation
+type trackedInstance struct {
+	cfg        *InstanceConfig
+	generation uint64
+}
+
+// sameExtraction reports whether two instances extract client IPs identically
+func (c *InstanceConfig) sameExtraction(other *InstanceConfig) bool {
+	if c.IPStrategy != other.IPStrategy || c.TrustedHeader != other.TrustedHeader {
 		return false
 	}
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.deploymentEnabled && !m.temporarilyDisabled
+	if len(c.TrustedProxies) != len(other.TrustedProxies) {
+		return false
+	}
+
+	a := append([]string(nil), c.TrustedProxies...)
+	b := append([]string(nil), other.TrustedProxies...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
-// IsIPAllowed checks if an IP is allowed based on EDL
-func (m *Manager) IsIPAllowed(clientIP string) (bool, error) {
-	// If deployment is disabled, allow all (check without lock)
-	if !m.IsDeploymentEnabled() {
-		return true, nil
+// ApplyInstanceConfig atomically replaces the active instance configuration
+// and refreshes the log shipper batch metadata
+func (m *Manager) ApplyInstanceConfig(cfg *InstanceConfig) {
+	if m == nil || cfg == nil {
+		return
 	}
 
-	// Check against EDL directly (no cache)
-	inList := m.matcher.Contains(clientIP)
+	m.instanceConfig.Store(cfg)
+	m.trackInstance(cfg)
 
-	// XOR operation: allowed if (blocklist AND NOT in list) OR (allowlist AND in list)
 	m.mu.RLock()
-	isBlocklist := m.edlMode == "blocklist"
+	shipper := m.logShipper
 	m.mu.RUnlock()
+	if shipper == nil {
+		return
+	}
 
-	allowed := isBlocklist != inList
-	return allowed, nil
+	metadata := &logs.BatchMetadata{
+		DeviceID:   m.deviceID,
+		IPStrategy: cfg.IPStrategy,
+	}
+	// Only include optional fields if configured
+	if cfg.IPStrategy == "custom" && cfg.TrustedHeader != "" {
+		metadata.TrustedHeader = cfg.TrustedHeader
+	}
+	if len(cfg.TrustedProxies) > 0 {
+		metadata.TrustedProxies = cfg.TrustedProxies
+	}
+	shipper.SetBatchMetadata(metadata)
+	logger.Debugf("Applied instance config - ipStrategy=%s trustedProxies=%d", cfg.IPStrategy, len(cfg.TrustedProxies))
 }
 
-// IsIPAllowedWithStats checks if an IP is allowed and returns timing stats
-func (m *Manager) IsIPAllowedWithStats(clientIP string) (bool, bool, error) {
-	// If deployment is disabled, allow all (check without lock)
-	if !m.IsDeploymentEnabled() {
-		return true, false, nil
+// trackInstance records a named instance and checks it against the others.
+// Reloads replace the entry with the same name and drop instances of older
+// generations; differing settings across names mean batch metadata cannot
+// describe every event correctly. The conflict flag is recomputed from the
+// current instances on every call.
+func (m *Manager) trackInstance(cfg *InstanceConfig) {
+	if cfg.Name == "" {
+		return
 	}
-
-	var debugMode = logger.IsDebugEnabled()
-	var timings = make(map[string]time.Duration)
-	var overallStart time.Time
-	if debugMode {
-		overallStart = time.Now()
+	now := time.Now
+	if m.now != nil {
+		now = m.now
 	}
 
-	// Check against EDL directly (no cache)
-
-	// Parse IP address
-	var parseStart time.Time
-	if debugMode {
-		parseStart = time.Now()
+	m.mu.Lock()
+	if m.instances == nil {
+		m.instances = make(map[string]trackedInstance)
 	}
-	addr, err := netip.ParseAddr(clientIP)
-	if err != nil {
-		return false, false, err
+	at := now()
+	if !m.lastInstanceApply.IsZero() && at.Sub(m.lastInstanceApply) > instanceGenerationGap {
+		m.instanceGeneration++
 	}
-	if debugMode {
-		timings["parse"] = time.Since(parseStart)
+	m.lastInstanceApply = at
+	m.instances[cfg.Name] = trackedInstance{cfg: cfg, generation: m.instanceGeneration}
+	for name, tracked := range m.instances {
+		if tracked.generation != m.instanceGeneration {
+			delete(m.instances, name)
+		}
 	}
 
-	// Check against EDL
-	var lookupStart time.Time
-	if debugMode {
-		lookupStart = time.Now()
+	// Matching settings are transitive, so the current instances conflict
+	// exactly when one differs from the latest
+	var conflicting []string
+	for name, other := range m.instances {
+		if name != cfg.Name && !cfg.sameExtraction(other.cfg) {
+			conflicting = append(conflicting, name)
+		}
 	}
-	inList := m.matcher.ContainsAddr(addr)
-	if debugMode {
-		timings["lookup"] = time.Since(lookupStart)
+	m.configConflict.Store(len(conflicting) > 0)
+	m.mu.Unlock()
+
+	if len(conflicting) == 0 {
+		return
 	}
 
-	// XOR operation: allowed if (blocklist AND NOT in list) OR (allowlist AND in list)
-	var modeCheckStart time.Time
-	if debugMode {
-		modeCheckStart = time.Now()
+	sort.Strings(conflicting)
+	logger.Warnf("CONFIGURATION CONFLICT: middleware %q (ipStrategy=%s) uses different IP extraction settings than %s "+
+		"for the same deployment; affected block events carry their own strategy info",
+		cfg.Name, cfg.IPStrategy, strings.Join(conflicting, ", "))
+}
+
+// HasConfigConflict reports whether instances disagree on IP extraction settings
+func (m *Manager) HasConfigConflict() bool {
+	if m == nil {
+		return false
 	}
+	return m.configConflict.Load()
+}
+
+// GetInstanceConfig returns the active instance configuration snapshot
+func (m *Manager) GetInstanceConfig() *InstanceConfig {
+	cfg, _ := m.instanceConfig.Load().(*InstanceConfig)
+	return cfg
+}
+
+// Readiness reason codes returned by Manager.Readiness
+const (
+	ReasonInitializing    = "initializing"
+	ReasonBootstrapFailed = "bootstrap_failed"
+	ReasonEDLNotLoaded    = "edl_not_loaded"
+	ReasonTokenExpired    = "token_expired"
+	ReasonEDLStale        = "edl_stale"
+)
+
+// Readiness reports whether the manager can enforce the EDL, with a
+// machine-readable reason code when it cannot. Deployments deleted or
+// disabled on the backend count as ready, allowing traffic is their
+// intended state.
+func (m *Manager) Readiness() (ready bool, reason string) {
+	return m.ReadinessWithin(0)
+}
+
+// ReadinessWithin is Readiness with a staleness limit: the EDL also counts
+// as unavailable when its last successful update is older than maxStale.
+// Zero disables the limit.
+func (m *Manager) ReadinessWithin(maxStale time.Duration) (ready bool, reason string) {
+	if m == nil {
+		return false, ReasonInitializing
+	}
+	if !m.ready.Load() {
+		if m.bootstrapRetrying.Load() {
+			return false, ReasonBootstrapFailed
+		}
+		return false, ReasonInitializing
+	}
+
 	m.mu.RLock()
-	isBlocklist := m.edlMode == "blocklist"
+	tokenManager := m.tokenManager
+	updater := m.edlUpdater
+	disabled := m.temporarilyDisabled
+	offline := m.offline
+	dev := m.dev
 	m.mu.RUnlock()
-	if debugMode {
-		timings["mode_check"] = time.Since(modeCheckStart)
-	}
 
-	var logicStart time.Time
-	if debugMode {
-		logicStart = time.Now()
+	if disabled || (tokenManager != nil && !tokenManager.IsDeploymentActive()) {
+		return true, ""
+	}
+	if !offline && (tokenManager == nil || tokenManager.GetTokenExpiry().IsZero()) {
+		return false, ReasonBootstrapFailed
+	}
+	if dev {
+		// The inline list is loaded at start and never goes stale
+		return true, ""
+	}
+	if updater == nil {
+		return false, ReasonEDLNotLoaded
+	}
+	lastUpdate, _, _ := updater.GetStatus()
+	if lastUpdate.IsZero() {
+		return false, ReasonEDLNotLoaded
+	}
+	if maxStale > 0 && time.Since(lastUpdate) > maxStale {
+		return false, ReasonEDLStale
 	}
-	allowed := isBlocklist != inList
-	if debugMode {
-		timings["logic"] = time.Since(logicStart)
+	if !offline && tokenManager.TokenExpired() {
+		return false, ReasonTokenExpired
 	}
+	return true, ""
+}
 
-	// Log timing breakdown
-	if debugMode {
-		total := time.Since(overallStart)
-		logger.Debugf("IP_CHECK %s - total=%v [parse=%v, lookup=%v, mode_check=%v, logic=%v]",
-			clientIP, total, timings["parse"], timings["lookup"], timings["mode_check"], timings["logic"])
+// IsDeploymentEnabled returns whether deployment is enabled. While
+// initializing it is enabled when a cached EDL is enforced.
+func (m *Manager) IsDeploymentEnabled() bool {
+	if m == nil {
+		return false
+	}
+	if !m.ready.Load() {
+		return m.cacheLoaded.Load()
 	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.deploymentEnabled && !m.temporarilyDisabled
+}
 
-	return allowed, false, nil // false = no cache anymore
+// IsIPAllowed checks if an IP is allowed based on EDL
+func (m *Manager) IsIPAllowed(clientIP string) (bool, error) {
+	d := m.Decide(clientIP)
+	return d.Allowed, d.Err
 }
 
 // fetchEDLConfig fetches the EDL configuration from the API
@@ -340,20 +907,98 @@ func (m *Manager) fetchEDLConfig(ctx context.Context) (*api.EDLConfig, error) {
 	logger.Tracef("Fetching EDL config from URL: %s", configURL)
 
 	configClient := api.NewConfigClient(configURL, m.tokenManager.GetToken)
+	configClient.SetTLSConfig(m.tlsConfig)
 
-	edlConfig, err := configClient.GetEDLConfig(ctx)
+	val, err, _ := fetchGroup.Do("config:"+configURL, func() (interface{}, error) {
+		return configClient.GetEDLConfig(ctx)
+	})
 	if err != nil {
 		logger.Errorf("Failed to get EDL config: %v", err)
 		return nil, err
 	}
+	edlConfig := val.(*api.EDLConfig)
+	m.mu.Lock()
+	m.configHash = edlConfig.RawHash
+	m.configSchema = edlConfig.SchemaVersion
+	m.mu.Unlock()
+	m.applyPrivacy(edlConfig.Privacy)
+	m.applyFeatures(edlConfig.Features)
+	m.applyLogLevel(edlConfig.LogLevel, time.Duration(edlConfig.LogLevelTTLSeconds)*time.Second)
 
 	logger.Infof("EDL configuration for deployment %s: mode=%s",
 		m.deploymentID, edlConfig.Purpose)
 	return edlConfig, nil
 }
 
+// applyPrivacy updates identifier hashing from the config API. A missing
+// privacy section disables hashing.
+func (m *Manager) applyPrivacy(cfg *api.PrivacyConfig) {
+	if m.privacy == nil {
+		return
+	}
+	if cfg == nil {
+		m.privacy.Update(false, "", "", 0)
+		return
+	}
+	m.privacy.Update(cfg.HashIdentifiers, cfg.SaltID, cfg.Salt,
+		time.Duration(cfg.OverlapSeconds)*time.Second)
+}
+
+// applyLogLevel honors a log level pushed through the config API. The
+// override is applied when the pushed level changes and reverted when it
+// is withdrawn; admin overrides in between are left alone.
+func (m *Manager) applyLogLevel(levelStr string, ttl time.Duration) {
+	m.mu.Lock()
+	previous := m.remoteLogLevel
+	m.remoteLogLevel = levelStr
+	m.mu.Unlock()
+
+	if levelStr == previous {
+		return
+	}
+	if levelStr == "" {
+		logger.ClearOverride("config API")
+		return
+	}
+	level, err := logger.ParseLevel(levelStr)
+	if err != nil {
+		logger.Warnf("Ignoring invalid log_level %q from config API", levelStr)
+		return
+	}
+	logger.Override(level, ttl, "config API")
+}
+
+// hashIdentifiers replaces the client IPs of an event with salted hashes
+// and drops detail fields that would carry raw addresses
+func (m *Manager) hashIdentifiers(event *logs.BlockEvent) {
+	ip := m.privacy.Hash(event.Client.IP)
+	direct := m.privacy.Hash(event.Client.DirectIP)
+
+	event.Client.IP = ip.Value
+	event.Client.DirectIP = direct.Value
+	event.Client.SaltID = ip.SaltID
+	if ip.PreviousSaltID != "" {
+		event.Client.Previous = &logs.PreviousHashes{
+			SaltID:   ip.PreviousSaltID,
+			IP:       ip.Previous,
+			DirectIP: direct.Previous,
+		}
+	}
+	if details, ok := event.Details.(*logs.FirstBlockDetails); ok {
+		details.ForwardedFor = ""
+	}
+	// Captured headers may carry addresses or session identifiers
+	event.Request.Headers = nil
+}
+
 // SendBlockEvent sends a block event to the log shipper
 func (m *Manager) SendBlockEvent(event *logs.BlockEvent) {
+	if event.Policy.Generation == "" {
+		event.Policy.Generation = m.GetEDLGeneration()
+	}
+	if m.privacy != nil && m.privacy.Enabled() {
+		m.hashIdentifiers(event)
+	}
 	if m.logShipper != nil {
 		logger.Tracef("Sending block event to log shipper - ip=%s directIP=%s",
 			event.Client.IP, event.Client.DirectIP)
@@ -368,6 +1013,23 @@ func (m *Manager) GetDeviceID() string {
 	return m.deviceID
 }
 
+// IsReady reports whether initialization has finished
+func (m *Manager) IsReady() bool {
+	return m != nil && m.ready.Load()
+}
+
+// InitError returns the error that ended initialization, if any
+func (m *Manager) InitError() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.initErr
+}
+
+// GetDeploymentID returns the deployment ID from the bootstrap token
+func (m *Manager) GetDeploymentID() string {
+	return m.deploymentID
+}
+
 // GetEDLMode returns the current EDL mode
 func (m *Manager) GetEDLMode() string {
 	m.mu.RLock()
@@ -375,6 +1037,137 @@ func (m *Manager) GetEDLMode() string {
 	return m.edlMode
 }
 
+// DecisionVersion identifies the EDL state decisions are made against
+type DecisionVersion struct {
+	Lists uint64 // Matcher version of the enforced lists
+	Mode  string // EDL mode the lists are applied in
+}
+
+// DecisionVersion returns the current EDL state. Decisions made under a
+// different version are stale.
+func (m *Manager) DecisionVersion() DecisionVersion {
+	return DecisionVersion{Lists: m.matcher.Version(), Mode: m.GetEDLMode()}
+}
+
+// CountXFFTruncated records a request whose X-Forwarded-For header was truncated
+func (m *Manager) CountXFFTruncated() {
+	m.xffTruncated.Add(1)
+}
+
+// GetXFFTruncated returns how many X-Forwarded-For headers were truncated
+func (m *Manager) GetXFFTruncated() int64 {
+	return m.xffTruncated.Load()
+}
+
+// RegisterTracker registers the usage reporter of a bounded per-IP
+// structure under name, replacing any previous reporter of that name
+func (m *Manager) RegisterTracker(name string, stats func() bounded.Stats) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.trackers == nil {
+		m.trackers = make(map[string]func() bounded.Stats)
+	}
+	m.trackers[name] = stats
+}
+
+// GetTrackerStats reports the memory usage of all registered per-IP structures
+func (m *Manager) GetTrackerStats() []bounded.Stats {
+	m.mu.RLock()
+	reporters := make([]func() bounded.Stats, 0, len(m.trackers))
+	for _, stats := range m.trackers {
+		reporters = append(reporters, stats)
+	}
+	m.mu.RUnlock()
+
+	result := make([]bounded.Stats, 0, len(reporters))
+	for _, stats := range reporters {
+		result = append(result, stats())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Overlay returns the runtime allow/block overlay shared by all instances
+func (m *Manager) Overlay() *locallist.Overlay {
+	return m.overlay
+}
+
+// ShipAuditRecord signs an admin audit record with the audit key derived
+// from the bootstrap token and ships it through the log pipeline. Without a
+// token, as in dev mode, the record is shipped with an empty signature.
+func (m *Manager) ShipAuditRecord(record *admin.AuditRecord) {
+	if len(m.auditKey) == 0 {
+		logger.Debugf("No audit signing key, shipping %s record unsigned", record.Action)
+	} else if err := record.Sign(m.auditKey); err != nil {
+		logger.Errorf("Failed to sign audit record for %s: %v", record.Action, err)
+		return
+	}
+	m.SendBlockEvent(logs.NewReportEvent("admin_audit", m.GetEDLMode(), record))
+}
+
+// dryRunReportInterval is how often the monitor mode report is shipped
+const dryRunReportInterval = 24 * time.Hour
+
+// RecordWouldBlock adds a monitor mode decision to the dry-run report. The
+// report and its daily shipping loop are started on first use.
+func (m *Manager) RecordWouldBlock(clientIP, host, path string) {
+	m.mu.Lock()
+	report := m.dryRun
+	if report == nil {
+		report = dryrun.NewReport(dryrun.DefaultMaxKeys)
+		m.dryRun = report
+		go m.dryRunReportLoop(report)
+	}
+	m.mu.Unlock()
+
+	report.Record(clientIP, host, path)
+}
+
+// GetDryRunReport returns the current dry-run window, nil when no request
+// has been evaluated in monitor mode
+func (m *Manager) GetDryRunReport() *dryrun.Summary {
+	m.mu.RLock()
+	report := m.dryRun
+	m.mu.RUnlock()
+	if report == nil {
+		return nil
+	}
+	return report.Snapshot(dryrun.DefaultTopN)
+}
+
+// dryRunReportLoop ships and resets the dry-run report once a day
+func (m *Manager) dryRunReportLoop(report *dryrun.Report) {
+	ticker := time.NewTicker(dryRunReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			summary := report.Rotate(dryrun.DefaultTopN)
+			logger.Infof("Dry-run report: %d requests would have been blocked since %s",
+				summary.WouldBlock, summary.Since.Format(time.RFC3339))
+			m.SendBlockEvent(logs.NewReportEvent("dry_run_report", m.GetEDLMode(), summary))
+		}
+	}
+}
+
+// GetEDLGeneration returns the generation ID of the active EDL, empty when
+// the backend does not provide one
+func (m *Manager) GetEDLGeneration() string {
+	m.mu.RLock()
+	updater := m.edlUpdater
+	m.mu.RUnlock()
+	if updater == nil {
+		return ""
+	}
+	return updater.Generation()
+}
+
 // CheckConfigUpdates fetches and applies any configuration changes
 func (m *Manager) CheckConfigUpdates(ctx context.Context) {
 	// Only check if deployment is enabled
@@ -397,36 +1190,26 @@ func (m *Manager) CheckConfigUpdates(ctx context.Context) {
 			m.mu.Unlock()
 			logger.Info("Deployment temporarily disabled during config check, will retry in 1 minute")
 		}
+		m.refreshState()
 		return // Keep using current config on error
 	}
 
 	// Check if we have valid EDL config
-	if edlConfig == nil || len(edlConfig.URLs.Combined) == 0 {
+	if edlConfig == nil || len(edlConfig.URLs.All()) == 0 {
 		return
 	}
 
 	// Extract new configuration
-	var newURL string
-	if len(edlConfig.URLs.Combined) > 0 {
-		newURL = edlConfig.URLs.Combined[0]
-	}
+	newMode, newURLs, newAllowURLs := edlLists(edlConfig)
 
 	newUpdateFreq := time.Duration(edlConfig.UpdateFrequencySeconds) * time.Second
 	if newUpdateFreq <= 0 {
-		newUpdateFreq = 5 * time.Minute
-	}
-
-	newMode := "blocklist"
-	switch edlConfig.Purpose {
-	case "allowlist":
-		newMode = "allowlist"
-	case "blocklist", "other", "others":
-		newMode = "blocklist"
+		newUpdateFreq = defaultEDLUpdateFrequency
 	}
 
 	// Check if configuration changed
 	m.mu.Lock()
-	urlChanged := m.edlURL != newURL
+	urlChanged := !sameURLs(m.edlURLs, newURLs) || !sameURLs(m.edlAllowURLs, newAllowURLs)
 	freqChanged := m.edlUpdateFreq != newUpdateFreq
 	modeChanged := m.edlMode != newMode
 	m.mu.Unlock()
@@ -437,7 +1220,7 @@ func (m *Manager) CheckConfigUpdates(ctx context.Context) {
 
 	// Log configuration changes
 	if urlChanged {
-		logger.Infof("EDL URL changed from %s to %s", m.edlURL, newURL)
+		logger.Infof("EDL URLs changed from %s to %s", strings.Join(m.edlURLs, ", "), strings.Join(newURLs, ", "))
 	}
 	if freqChanged {
 		logger.Infof("EDL update frequency changed from %v to %v", m.edlUpdateFreq, newUpdateFreq)
@@ -448,7 +1231,8 @@ func (m *Manager) CheckConfigUpdates(ctx context.Context) {
 
 	// Update configuration
 	m.mu.Lock()
-	m.edlURL = newURL
+	m.edlURLs = newURLs
+	m.edlAllowURLs = newAllowURLs
 	m.edlUpdateFreq = newUpdateFreq
 	m.edlMode = newMode
 	m.mu.Unlock()
@@ -457,24 +1241,50 @@ func (m *Manager) CheckConfigUpdates(ctx context.Context) {
 
 	// Reconfigure EDL updater
 	if m.edlUpdater != nil {
-		m.edlUpdater.Reconfigure(newURL, newUpdateFreq)
+		m.edlUpdater.SetAllowlist(newAllowURLs)
+		m.edlUpdater.Reconfigure(newURLs, newUpdateFreq)
 	}
 }
 
-// Stop gracefully stops the manager
-func (m *Manager) Stop() {
-	close(m.stopCh)
-	if m.tokenManager != nil {
-		m.tokenManager.Stop()
-	}
-	if m.edlUpdater != nil {
-		m.edlUpdater.Stop()
-	}
-	if m.logShipper != nil {
-		if err := m.logShipper.Stop(); err != nil {
-			logger.Errorf("Error stopping log shipper: %v", err)
+// Stop gracefully stops the manager. Subsystems are stopped concurrently,
+// each within its own deadline, and failures are returned as one
+// *ShutdownError. Later calls return the result of the first.
+func (m *Manager) Stop() error {
+	m.stopOnce.Do(func() {
+		start := time.Now()
+		if m.stopCh != nil {
+			close(m.stopCh)
 		}
-	}
+
+		m.mu.RLock()
+		tokenManager, updater, shipper := m.tokenManager, m.edlUpdater, m.logShipper
+		m.mu.RUnlock()
+
+		var subsystems []subsystem
+		if tokenManager != nil {
+			subsystems = append(subsystems, subsystem{name: "token", timeout: loopStopTimeout, stop: func() error {
+				tokenManager.Stop()
+				return nil
+			}})
+		}
+		if updater != nil {
+			subsystems = append(subsystems, subsystem{name: "edl", timeout: loopStopTimeout, stop: func() error {
+				updater.Stop()
+				return nil
+			}})
+		}
+		if shipper != nil {
+			subsystems = append(subsystems, subsystem{name: "logs", timeout: logsStopTimeout, stop: shipper.Stop})
+		}
+
+		m.stopErr = stopSubsystems(subsystems)
+		if m.stopErr != nil {
+			logger.Errorf("Manager stopped with errors after %v: %v", time.Since(start), m.stopErr)
+		} else {
+			logger.Debugf("Manager stopped in %v", time.Since(start))
+		}
+	})
+	return m.stopErr
 }
 
 // startDisabledRetryLoop starts a goroutine that retries when deployment is temporarily disabled
@@ -510,39 +1320,38 @@ func (m *Manager) startDisabledRetryLoop() {
 				m.mu.Unlock()
 
 				logger.Info("Deployment re-enabled successfully")
+				m.refreshState()
+
+				// Token refreshes were not started while disabled; a running loop is kept
+				m.tokenManager.StartRefreshLoop(context.Background())
 
 				// Fetch EDL config and reinitialize
 				ctx := context.Background()
 				edlConfig, err := m.fetchEDLConfig(ctx)
-				if err == nil && edlConfig != nil && len(edlConfig.URLs.Combined) > 0 {
+				if err == nil && edlConfig != nil && len(edlConfig.URLs.All()) > 0 {
 					// Reinitialize EDL
 					m.mu.Lock()
-					switch edlConfig.Purpose {
-					case "allowlist":
-						m.edlMode = "allowlist"
-					default:
-						m.edlMode = "blocklist"
-					}
-
-					if len(edlConfig.URLs.Combined) > 0 {
-						m.edlURL = edlConfig.URLs.Combined[0]
-					}
+					m.edlMode, m.edlURLs, m.edlAllowURLs = edlLists(edlConfig)
 
 					m.edlUpdateFreq = time.Duration(edlConfig.UpdateFrequencySeconds) * time.Second
 					if m.edlUpdateFreq <= 0 {
-						m.edlUpdateFreq = 5 * time.Minute
+						m.edlUpdateFreq = defaultEDLUpdateFrequency
 					}
 					m.mu.Unlock()
 
-					// Restart EDL updater if needed
+					// Restart EDL updater if needed; starting a running loop is a no-op
 					if m.edlUpdater != nil {
-						m.edlUpdater.Reconfigure(m.edlURL, m.edlUpdateFreq)
-						go m.edlUpdater.StartUpdateLoop(context.Background())
-					} else if m.edlURL != "" {
+						m.edlUpdater.SetAllowlist(m.edlAllowURLs)
+						m.edlUpdater.Reconfigure(m.edlURLs, m.edlUpdateFreq)
+						m.edlUpdater.StartUpdateLoop(context.Background())
+					} else if len(m.edlURLs) > 0 {
 						// Create new EDL updater
-						m.edlUpdater = NewEDLUpdater(m.edlURL, m.edlUpdateFreq, m.matcher, m)
+						m.mu.Lock()
+						m.edlUpdater = m.newEDLUpdater(m.edlURLs, m.edlUpdateFreq)
+						m.edlUpdater.SetAllowlist(m.edlAllowURLs)
+						m.mu.Unlock()
 						if err := m.edlUpdater.Start(context.Background()); err == nil {
-							go m.edlUpdater.StartUpdateLoop(context.Background())
+							m.edlUpdater.StartUpdateLoop(context.Background())
 						}
 					}
 				}
@@ -555,6 +1364,7 @@ func (m *Manager) startDisabledRetryLoop() {
 				m.deploymentEnabled = false
 				m.mu.Unlock()
 				logger.Info("Deployment deleted (410) during retry")
+				m.refreshState()
 				return // Exit retry loop
 			} else if api.IsTemporaryDisabled(err) {
 				// Still disabled, update check time
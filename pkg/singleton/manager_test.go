@@ -0,0 +1,432 @@
+package singleton
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/api"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/backoff"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/bounded"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/privacy"
+)
+
+func TestValidateComponentType(t *testing.T) {
+	tests := []struct {
+		name          string
+		componentType string
+		allowed       []string
+		expectError   bool
+	}{
+		{"default accepts plugin type", DefaultComponentType, nil, false},
+		{"default rejects variant", "ellio_traefik_middleware_plugin_staging", nil, true},
+		{"configured variant accepted", "ellio_traefik_middleware_plugin_staging", []string{DefaultComponentType, "ellio_traefik_middleware_plugin_staging"}, false},
+		{"configured list excludes default", DefaultComponentType, []string{"ellio_gateway"}, true},
+		{"empty claim rejected", "", nil, true},
+		{"blank entry rejects empty claim", "", []string{""}, true},
+		{"whitespace entry rejects empty claim", "", []string{" "}, true},
+		{"blank entries fall back to default", DefaultComponentType, []string{"", " "}, false},
+		{"blank entries dropped", "ellio_gateway", []string{" ", " ellio_gateway "}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateComponentType(tt.componentType, tt.allowed)
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error=%v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestApplyInstanceConfigReplacesMetadata(t *testing.T) {
+	m := &Manager{
+		deviceID:   "device-1",
+		logShipper: logs.NewLogShipper(nil, &logs.LogShipperConfig{}),
+	}
+
+	m.ApplyInstanceConfig(&InstanceConfig{IPStrategy: "direct"})
+	m.ApplyInstanceConfig(&InstanceConfig{
+		IPStrategy:     "custom",
+		TrustedHeader:  "CF-Connecting-IP",
+		TrustedProxies: []string{"10.0.0.0/8"},
+	})
+
+	metadata := m.logShipper.GetBatchMetadata()
+	if metadata == nil {
+		t.Fatal("expected batch metadata to be set")
+	}
+	if metadata.DeviceID != "device-1" {
+		t.Errorf("expected device ID 'device-1', got %q", metadata.DeviceID)
+	}
+	if metadata.IPStrategy != "custom" {
+		t.Errorf("expected latest ipStrategy 'custom', got %q", metadata.IPStrategy)
+	}
+	if metadata.TrustedHeader != "CF-Connecting-IP" {
+		t.Errorf("expected trusted header to be propagated, got %q", metadata.TrustedHeader)
+	}
+	if got := m.GetInstanceConfig(); got == nil || got.IPStrategy != "custom" {
+		t.Errorf("expected instance config snapshot to be replaced, got %+v", got)
+	}
+}
+
+func TestTrackInstanceDetectsConflicts(t *testing.T) {
+	m := &Manager{}
+
+	m.ApplyInstanceConfig(&InstanceConfig{Name: "edge", IPStrategy: "xff", TrustedProxies: []string{"10.0.0.0/8", "loopback"}})
+	m.ApplyInstanceConfig(&InstanceConfig{Name: "internal", IPStrategy: "xff", TrustedProxies: []string{"loopback", "10.0.0.0/8"}})
+	if m.HasConfigConflict() {
+		t.Fatal("identical settings in different order must not conflict")
+	}
+
+	// Reload of the same instance with new settings replaces it
+	m.ApplyInstanceConfig(&InstanceConfig{Name: "edge", IPStrategy: "xff", TrustedProxies: []string{"loopback", "10.0.0.0/8"}})
+	if m.HasConfigConflict() {
+		t.Fatal("reloading an instance must not conflict with itself")
+	}
+
+	m.ApplyInstanceConfig(&InstanceConfig{Name: "public", IPStrategy: "direct"})
+	if !m.HasConfigConflict() {
+		t.Error("expected conflict for differing ipStrategy")
+	}
+}
+
+func TestTrackInstanceConflictClears(t *testing.T) {
+	clock := time.Unix(1700000000, 0)
+	m := &Manager{now: func() time.Time { return clock }}
+
+	m.ApplyInstanceConfig(&InstanceConfig{Name: "edge", IPStrategy: "xff"})
+	m.ApplyInstanceConfig(&InstanceConfig{Name: "public", IPStrategy: "direct"})
+	if !m.HasConfigConflict() {
+		t.Fatal("expected conflict for differing ipStrategy")
+	}
+
+	// A reload of the same instance that now agrees clears the flag
+	m.ApplyInstanceConfig(&InstanceConfig{Name: "public", IPStrategy: "xff"})
+	if m.HasConfigConflict() {
+		t.Fatal("expected conflict to clear once the instance agrees")
+	}
+	m.ApplyInstanceConfig(&InstanceConfig{Name: "public", IPStrategy: "direct"})
+	if !m.HasConfigConflict() {
+		t.Fatal("expected conflict for differing ipStrategy")
+	}
+
+	// A later reload without the conflicting instance drops it
+	clock = clock.Add(time.Minute)
+	m.ApplyInstanceConfig(&InstanceConfig{Name: "edge", IPStrategy: "xff"})
+	if m.HasConfigConflict() {
+		t.Error("expected conflict to clear once the conflicting instance is gone")
+	}
+	if status := m.Status(); status.ConfigConflict {
+		t.Error("expected status to report no conflict")
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.instances["public"]; ok || len(m.instances) != 1 {
+		t.Errorf("expected only the current generation tracked, got %v", m.instances)
+	}
+}
+
+// testBootstrapToken is an unsigned JWT for deployment "dep-1"
+const testBootstrapToken = "eyJhbGciOiJub25lIn0.eyJpc3MiOiJodHRwczovL2FwaS5leGFtcGxlLmNvbSIsImNvbXBvbmVudF90eXBlIjoiZWxsaW9fdHJhZWZpa19taWRkbGV3YXJlX3BsdWdpbiIsImRlcGxveW1lbnRfaWQiOiJkZXAtMSJ9.sig"
+
+// roundTripFunc stubs an HTTP transport for tests
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubAPI routes all API clients through transport for the duration of a test
+func stubAPI(t *testing.T, transport roundTripFunc) {
+	t.Helper()
+	original := api.HTTPClientFactory
+	api.HTTPClientFactory = func(timeout time.Duration) *http.Client {
+		return &http.Client{Timeout: timeout, Transport: transport}
+	}
+	t.Cleanup(func() { api.HTTPClientFactory = original })
+}
+
+func TestNewManagerAsyncInit(t *testing.T) {
+	release := make(chan struct{})
+	stubAPI(t, func(req *http.Request) (*http.Response, error) {
+		<-release
+		return &http.Response{
+			StatusCode: http.StatusGone,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	})
+
+	m, err := NewManager(Options{BootstrapToken: testBootstrapToken, AsyncInit: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer m.Stop()
+
+	if m.IsReady() {
+		t.Fatal("manager must not be ready before bootstrap completes")
+	}
+	if m.IsDeploymentEnabled() {
+		t.Fatal("traffic must be allowed while initializing")
+	}
+
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.IsReady() {
+		if time.Now().After(deadline) {
+			t.Fatal("manager did not become ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if m.IsDeploymentEnabled() {
+		t.Error("deleted deployment must stay disabled")
+	}
+	if err := m.InitError(); err != nil {
+		t.Errorf("410 is not an initialization error, got %v", err)
+	}
+}
+
+func TestNewManagerBootstrapDeadline(t *testing.T) {
+	var slow atomic.Bool
+	slow.Store(true)
+	stubAPI(t, func(req *http.Request) (*http.Response, error) {
+		if slow.Load() {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return &http.Response{
+			StatusCode: http.StatusGone,
+			Body:       io.NopCloser(strings.NewReader("")),
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	})
+
+	start := time.Now()
+	m, err := NewManager(Options{
+		BootstrapToken:   testBootstrapToken,
+		BootstrapTimeout: 100 * time.Millisecond,
+		Retry:            backoff.Policy{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("missing the startup deadline must not fail initialization: %v", err)
+	}
+	defer m.Stop()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("bootstrapTimeout not honored, took %v", elapsed)
+	}
+
+	if m.IsReady() {
+		t.Fatal("manager must not be ready while bootstrap is retried")
+	}
+	if ready, reason := m.Readiness(); ready || reason != ReasonBootstrapFailed {
+		t.Errorf("expected bootstrap_failed while retrying, got %v %q", ready, reason)
+	}
+
+	slow.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for !m.IsReady() {
+		if time.Now().After(deadline) {
+			t.Fatal("manager did not become ready after bootstrap recovered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := m.InitError(); err != nil {
+		t.Errorf("expected no initialization error, got %v", err)
+	}
+	if ready, reason := m.Readiness(); !ready {
+		t.Errorf("deleted deployment must count as ready, got %q", reason)
+	}
+}
+
+func TestBootstrapTimeout(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want time.Duration
+	}{
+		{Options{}, defaultBootstrapTimeout},
+		{Options{InitTimeout: time.Minute}, time.Minute},
+		{Options{InitTimeout: time.Minute, BootstrapTimeout: 10 * time.Second}, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := bootstrapTimeout(tt.opts); got != tt.want {
+			t.Errorf("bootstrapTimeout(%+v) = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestRecordWouldBlock(t *testing.T) {
+	m := &Manager{stopCh: make(chan struct{})}
+	defer close(m.stopCh)
+
+	if m.GetDryRunReport() != nil {
+		t.Fatal("expected no report before any monitor mode decision")
+	}
+
+	m.RecordWouldBlock("203.0.113.7", "example.com", "/login")
+	m.RecordWouldBlock("203.0.113.8", "example.com", "/")
+
+	report := m.GetDryRunReport()
+	if report == nil {
+		t.Fatal("expected report after monitor mode decisions")
+	}
+	if report.WouldBlock != 2 {
+		t.Errorf("expected 2 would-block decisions, got %d", report.WouldBlock)
+	}
+	if len(report.TopPrefixes) != 1 || report.TopPrefixes[0].Key != "203.0.113.0/24" {
+		t.Errorf("unexpected prefixes: %+v", report.TopPrefixes)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	var nilManager *Manager
+	if ready, reason := nilManager.Readiness(); ready || reason != ReasonInitializing {
+		t.Errorf("nil manager: expected initializing, got %v %q", ready, reason)
+	}
+
+	m := &Manager{tokenManager: NewTokenManager(testBootstrapToken, "machine")}
+	if _, reason := m.Readiness(); reason != ReasonInitializing {
+		t.Errorf("expected initializing before start finishes, got %q", reason)
+	}
+
+	m.ready.Store(true)
+	if _, reason := m.Readiness(); reason != ReasonBootstrapFailed {
+		t.Errorf("expected bootstrap_failed without a token, got %q", reason)
+	}
+
+	m.tokenManager.tokenExpiry = time.Now().Add(time.Hour)
+	if _, reason := m.Readiness(); reason != ReasonEDLNotLoaded {
+		t.Errorf("expected edl_not_loaded without an updater, got %q", reason)
+	}
+
+	m.edlUpdater = NewEDLUpdater([]string{"https://edl.example.com"}, time.Minute, nil, m)
+	if _, reason := m.Readiness(); reason != ReasonEDLNotLoaded {
+		t.Errorf("expected edl_not_loaded before the first update, got %q", reason)
+	}
+
+	m.edlUpdater.lastUpdate = time.Now()
+	if ready, reason := m.Readiness(); !ready {
+		t.Errorf("expected ready, got %q", reason)
+	}
+
+	m.edlUpdater.lastUpdate = time.Now().Add(-2 * time.Hour)
+	if _, reason := m.ReadinessWithin(time.Hour); reason != ReasonEDLStale {
+		t.Errorf("expected edl_stale, got %q", reason)
+	}
+	if ready, reason := m.Readiness(); !ready {
+		t.Errorf("expected ready without a staleness limit, got %q", reason)
+	}
+
+	m.tokenManager.tokenExpiry = time.Now().Add(-time.Minute)
+	if _, reason := m.Readiness(); reason != ReasonTokenExpired {
+		t.Errorf("expected token_expired, got %q", reason)
+	}
+
+	// A deployment disabled on the backend allows traffic by design
+	m.temporarilyDisabled = true
+	if ready, _ := m.Readiness(); !ready {
+		t.Error("expected temporarily disabled deployment to count as ready")
+	}
+}
+
+func TestTrackerStats(t *testing.T) {
+	m := &Manager{}
+	b := bounded.NewLRU("b", 10, 0)
+	b.Add("1.2.3.4", true)
+	m.RegisterTracker("b", b.Stats)
+	m.RegisterTracker("a", bounded.NewLRU("a", 5, 0).Stats)
+
+	stats := m.GetTrackerStats()
+	if len(stats) != 2 || stats[0].Name != "a" || stats[1].Name != "b" {
+		t.Fatalf("expected stats sorted by name, got %+v", stats)
+	}
+	if stats[1].Entries != 1 || stats[1].Capacity != 10 {
+		t.Errorf("unexpected stats %+v", stats[1])
+	}
+
+	var nilManager *Manager
+	nilManager.RegisterTracker("ignored", b.Stats)
+}
+
+func TestHashIdentifiers(t *testing.T) {
+	m := &Manager{privacy: privacy.NewHasher()}
+	m.applyPrivacy(&api.PrivacyConfig{HashIdentifiers: true, SaltID: "s1", Salt: "a"})
+	m.applyPrivacy(&api.PrivacyConfig{HashIdentifiers: true, SaltID: "s2", Salt: "b"})
+
+	event := logs.NewBlockEvent("192.0.2.1", "10.0.0.1", "GET", "example.com", "/", "https", "", "blocklist")
+	event.Details = &logs.FirstBlockDetails{ForwardedFor: "192.0.2.1, 10.0.0.1"}
+	m.SendBlockEvent(event)
+
+	if event.Client.IP == "192.0.2.1" || event.Client.DirectIP == "10.0.0.1" {
+		t.Fatal("expected raw IPs to be replaced")
+	}
+	if event.Client.SaltID != "s2" || event.Client.Previous == nil || event.Client.Previous.SaltID != "s1" {
+		t.Errorf("expected hashes under s2 with s1 overlap, got %+v", event.Client)
+	}
+	if event.Details.(*logs.FirstBlockDetails).ForwardedFor != "" {
+		t.Error("expected forwarded-for detail to be dropped")
+	}
+
+	m.applyPrivacy(nil)
+	event = logs.NewBlockEvent("192.0.2.1", "10.0.0.1", "GET", "example.com", "/", "https", "", "blocklist")
+	m.SendBlockEvent(event)
+	if event.Client.IP != "192.0.2.1" || event.Client.SaltID != "" {
+		t.Errorf("expected raw IPs once hashing is disabled, got %+v", event.Client)
+	}
+}
+
+func TestApplyLogLevel(t *testing.T) {
+	logger.Configure(logger.InfoLevel)
+	defer logger.ClearOverride("test")
+	m := &Manager{}
+
+	m.applyLogLevel("debug", time.Hour)
+	if logger.GetLevel() != logger.DebugLevel {
+		t.Fatalf("expected debug from the config API, got %s", logger.GetLevel())
+	}
+
+	// An unchanged value does not override an admin change made since
+	logger.Override(logger.TraceLevel, 0, "test")
+	m.applyLogLevel("debug", time.Hour)
+	if logger.GetLevel() != logger.TraceLevel {
+		t.Errorf("expected the admin override to stay, got %s", logger.GetLevel())
+	}
+
+	m.applyLogLevel("bogus", 0)
+	m.applyLogLevel("", 0)
+	if logger.GetLevel() != logger.InfoLevel {
+		t.Errorf("expected the configured level once withdrawn, got %s", logger.GetLevel())
+	}
+}
+
+func TestEDLLists(t *testing.T) {
+	cfg := &api.EDLConfig{Purpose: "allowlist", URLs: api.EDLURLs{Combined: []string{"https://edl.example.com/a"}}}
+	if mode, urls, allow := edlLists(cfg); mode != "allowlist" || len(urls) != 1 || allow != nil {
+		t.Errorf("single list: got %s %v %v", mode, urls, allow)
+	}
+
+	cfg = &api.EDLConfig{
+		Purpose:       "blocklist",
+		URLs:          api.EDLURLs{Combined: []string{"https://edl.example.com/block", "https://edl.example.com/both"}},
+		AllowlistURLs: api.EDLURLs{Combined: []string{"https://edl.example.com/allow", "https://edl.example.com/both"}},
+	}
+	mode, urls, allow := edlLists(cfg)
+	if mode != EDLModeCombined {
+		t.Errorf("expected combined mode, got %s", mode)
+	}
+	if len(urls) != 3 || urls[2] != "https://edl.example.com/allow" {
+		t.Errorf("expected the allowlist URL after the blocklist ones, got %v", urls)
+	}
+	if len(allow) != 1 || allow[0] != "https://edl.example.com/allow" {
+		t.Errorf("a URL on both lists must stay in the blocklist, got %v", allow)
+	}
+}
@@ -0,0 +1,71 @@
+package singleton
+
+import (
+	"fmt"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+const (
+	// eventBytes approximates the heap held by one buffered event
+	eventBytes = 1024
+	// degradedShipperBuffer is the event buffer capacity while degraded
+	degradedShipperBuffer = 1000
+	// defaultShipperBuffer is the event buffer capacity within budget
+	defaultShipperBuffer = 10000
+)
+
+// checkMemoryBudget decides whether an EDL whose trie needs trieBytes can be
+// loaded within the memory budget. Buffers are shrunk first; an EDL that
+// does not fit even then is refused and the loaded one stays in effect.
+// Either way the manager is degraded until a list fits with full buffers.
+func (m *Manager) checkMemoryBudget(trieBytes int64) error {
+	if m == nil || m.memoryBudget <= 0 {
+		return nil
+	}
+	budget := m.memoryBudget
+
+	if trieBytes+defaultShipperBuffer*eventBytes <= budget {
+		m.resizeShipperBuffer(defaultShipperBuffer)
+		m.setDegraded(false, "")
+		return nil
+	}
+	if trieBytes+degradedShipperBuffer*eventBytes <= budget {
+		m.resizeShipperBuffer(degradedShipperBuffer)
+		m.setDegraded(true, fmt.Sprintf("EDL needs about %d MB, event buffer shrunk to %d", trieBytes>>20, degradedShipperBuffer))
+		return nil
+	}
+
+	m.resizeShipperBuffer(degradedShipperBuffer)
+	m.setDegraded(true, fmt.Sprintf("EDL of about %d MB refused", trieBytes>>20))
+	return fmt.Errorf("EDL needs about %d MB, over the memory budget of %d MB", trieBytes>>20, budget>>20)
+}
+
+// resizeShipperBuffer changes the event buffer capacity, if there is a shipper
+func (m *Manager) resizeShipperBuffer(capacity int) {
+	m.mu.RLock()
+	shipper := m.logShipper
+	m.mu.RUnlock()
+	if shipper != nil && shipper.BufferCapacity() != capacity {
+		shipper.ResizeBuffer(capacity)
+	}
+}
+
+// setDegraded records the degraded state and notifies hooks on changes
+func (m *Manager) setDegraded(degraded bool, reason string) {
+	if m.degraded.Swap(degraded) == degraded {
+		return
+	}
+	if degraded {
+		logger.Warnf("Memory budget exceeded, degrading: %s", reason)
+	} else {
+		logger.Info("EDL fits the memory budget again, leaving degraded mode")
+	}
+	m.refreshState()
+}
+
+// MemoryDegraded reports whether the memory budget forced a degradation.
+// Optional per-client tracking should be skipped while it is set.
+func (m *Manager) MemoryDegraded() bool {
+	return m != nil && m.degraded.Load()
+}
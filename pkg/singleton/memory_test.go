@@ -0,0 +1,75 @@
+package singleton
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+)
+
+func TestCheckMemoryBudget(t *testing.T) {
+	m := &Manager{deploymentEnabled: true}
+	m.ready.Store(true)
+	m.logShipper = logs.NewLogShipper(nil, &logs.LogShipperConfig{BufferSize: defaultShipperBuffer})
+
+	if err := m.checkMemoryBudget(1 << 30); err != nil || m.MemoryDegraded() {
+		t.Fatalf("an unset budget must not limit, got %v", err)
+	}
+
+	m.memoryBudget = 12 << 20
+	if err := m.checkMemoryBudget(1 << 20); err != nil || m.MemoryDegraded() || m.State() != StateActive {
+		t.Fatalf("expected a fitting EDL to keep the active state, got %v %s", err, m.State())
+	}
+
+	// Too large for the full buffers: buffers shrink, the EDL is accepted
+	if err := m.checkMemoryBudget(4 << 20); err != nil {
+		t.Fatalf("expected the EDL to fit with shrunk buffers, got %v", err)
+	}
+	if !m.MemoryDegraded() || m.State() != StateDegraded || m.logShipper.BufferCapacity() != degradedShipperBuffer {
+		t.Errorf("expected degraded state with shrunk buffers, got %s capacity %d", m.State(), m.logShipper.BufferCapacity())
+	}
+
+	if err := m.checkMemoryBudget(12 << 20); err == nil || !strings.Contains(err.Error(), "memory budget") {
+		t.Errorf("expected the EDL to be refused, got %v", err)
+	}
+
+	// A smaller list restores the buffers and leaves degraded mode
+	if err := m.checkMemoryBudget(1 << 20); err != nil || m.MemoryDegraded() || m.logShipper.BufferCapacity() != defaultShipperBuffer {
+		t.Errorf("expected recovery, got %v degraded=%v capacity %d", err, m.MemoryDegraded(), m.logShipper.BufferCapacity())
+	}
+}
+
+func TestEDLUpdaterRefusesOverBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "edl.txt")
+	var list strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&list, "2001:db8::%x\n", i)
+	}
+	if err := os.WriteFile(path, []byte("192.0.2.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{deploymentEnabled: true, memoryBudget: degradedShipperBuffer*eventBytes + 4<<10}
+	m.ready.Store(true)
+	matcher := ipmatcher.New()
+	u := NewEDLUpdater([]string{FileURLPrefix + path}, 0, matcher, m)
+	if err := u.updateNow(context.Background()); err != nil {
+		t.Fatalf("expected the small list to load, got %v", err)
+	}
+
+	// 200 IPv6 hosts need more than the 4 KiB left for the trie
+	if err := os.WriteFile(path, []byte(list.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.updateNow(context.Background()); err == nil {
+		t.Fatal("expected the oversized list to be refused")
+	}
+	if matcher.Count() != 1 || m.State() != StateDegraded {
+		t.Errorf("expected the previous list to stay loaded in degraded state, got %d entries, %s", matcher.Count(), m.State())
+	}
+}
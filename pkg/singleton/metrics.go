@@ -0,0 +1,189 @@
+package singleton
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/metrics"
+)
+
+// lookupBuckets are the upper bounds in seconds of the lookup latency histogram
+var lookupBuckets = []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.01}
+
+// Metrics holds the Prometheus metrics shared by all middleware instances
+type Metrics struct {
+	Registry *metrics.Registry
+
+	Allowed    *metrics.Counter // Requests let through
+	Blocked    *metrics.Counter // Requests answered with a block response
+	WouldBlock *metrics.Counter // Requests forwarded in monitor mode that would have been blocked
+	IPMissing  *metrics.Counter // Requests without a client IP
+	IPInvalid  *metrics.Counter // Requests whose client IP did not parse
+
+	EDLUpdateSuccess *metrics.Counter
+	EDLUpdateFailure *metrics.Counter
+
+	Lookup *metrics.Histogram // Time spent deciding on a request
+
+	mu         sync.Mutex
+	pathGroups map[string]*metrics.Counter // Per path group counters, keyed by group and action
+	rules      map[string]*ruleCounter     // Per rule hit counters, keyed by labels
+}
+
+// ruleCounter is the hit counter of one configured rule
+type ruleCounter struct {
+	hit RuleHit
+	c   *metrics.Counter
+}
+
+// RuleHit is the hit count of one configured rule of a middleware instance
+type RuleHit struct {
+	Middleware string `json:"middleware"`
+	Kind       string `json:"kind"` // Rule type, e.g. "excluded_path" or "allow_override"
+	Rule       string `json:"rule"` // Configured entry as written
+	Hits       int64  `json:"hits"`
+}
+
+// newMetrics registers the plugin metrics. Values owned by other
+// components are read from the manager at scrape time.
+func newMetrics(m *Manager) *Metrics {
+	r := metrics.NewRegistry()
+	const requestsHelp = "Requests evaluated by the middleware, by decision."
+	const updatesHelp = "EDL update attempts, by result."
+
+	mm := &Metrics{
+		Registry:         r,
+		Allowed:          r.Counter("ellio_requests_total", requestsHelp, metrics.Label("decision", "allowed")),
+		Blocked:          r.Counter("ellio_requests_total", requestsHelp, metrics.Label("decision", "blocked")),
+		WouldBlock:       r.Counter("ellio_requests_total", requestsHelp, metrics.Label("decision", "would_block")),
+		IPMissing:        r.Counter("ellio_requests_total", requestsHelp, metrics.Label("decision", "ip_missing")),
+		IPInvalid:        r.Counter("ellio_requests_total", requestsHelp, metrics.Label("decision", "ip_invalid")),
+		EDLUpdateSuccess: r.Counter("ellio_edl_updates_total", updatesHelp, metrics.Label("result", "success")),
+		EDLUpdateFailure: r.Counter("ellio_edl_updates_total", updatesHelp, metrics.Label("result", "failure")),
+		Lookup:           r.Histogram("ellio_lookup_duration_seconds", "Time spent deciding whether to block a request.", lookupBuckets),
+	}
+
+	r.GaugeFunc("ellio_edl_entries", "Entries in the loaded EDL.", "", func() float64 {
+		return float64(m.matcher.Count())
+	})
+	r.GaugeFunc("ellio_memory_degraded", "1 while the memory budget forces degraded operation.", "", func() float64 {
+		if m.MemoryDegraded() {
+			return 1
+		}
+		return 0
+	})
+	r.CounterFunc("ellio_xff_truncated_total", "Requests whose X-Forwarded-For exceeded the parsing limits.", "", func() float64 {
+		return float64(m.GetXFFTruncated())
+	})
+
+	const eventsHelp = "Log events by outcome."
+	r.CounterFunc("ellio_events_total", eventsHelp, metrics.Label("outcome", "shipped"), func() float64 {
+		shipped, _ := m.shipperStats()
+		return float64(shipped)
+	})
+	r.CounterFunc("ellio_events_total", eventsHelp, metrics.Label("outcome", "dropped"), func() float64 {
+		_, dropped := m.shipperStats()
+		return float64(dropped)
+	})
+	r.CounterFunc("ellio_events_total", eventsHelp, metrics.Label("outcome", "sampled_out"), func() float64 {
+		if m.logShipper == nil {
+			return 0
+		}
+		return float64(m.logShipper.GetSampledOut())
+	})
+	r.CounterFunc("ellio_events_total", eventsHelp, metrics.Label("outcome", "deduplicated"), func() float64 {
+		if m.logShipper == nil {
+			return 0
+		}
+		return float64(m.logShipper.GetDeduplicated())
+	})
+
+	return mm
+}
+
+// PathGroup returns the counter of listed clients blocked or monitored on a
+// path group. Counters are registered on first use and shared by instances,
+// so reloaded middlewares keep counting into the same series.
+func (mm *Metrics) PathGroup(group, action string) *metrics.Counter {
+	labels := metrics.Label("group", group) + "," + metrics.Label("action", action)
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if mm.pathGroups == nil {
+		mm.pathGroups = make(map[string]*metrics.Counter)
+	}
+	c, ok := mm.pathGroups[labels]
+	if !ok {
+		c = mm.Registry.Counter("ellio_path_group_requests_total",
+			"Listed clients by path group and action taken, blocked or monitored.", labels)
+		mm.pathGroups[labels] = c
+	}
+	return c
+}
+
+// Rule returns the hit counter of a configured rule. Like path group
+// counters they are registered on first use and shared by instances, so
+// rules never hit are listed with zero hits once registered.
+func (mm *Metrics) Rule(middleware, kind, rule string) *metrics.Counter {
+	labels := metrics.Label("middleware", middleware) + "," + metrics.Label("kind", kind) + "," + metrics.Label("rule", rule)
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if mm.rules == nil {
+		mm.rules = make(map[string]*ruleCounter)
+	}
+	rc, ok := mm.rules[labels]
+	if !ok {
+		rc = &ruleCounter{
+			hit: RuleHit{Middleware: middleware, Kind: kind, Rule: rule},
+			c: mm.Registry.Counter("ellio_rule_hits_total",
+				"Requests matched by configurable rules such as exclusions, health checks and overrides.", labels),
+		}
+		mm.rules[labels] = rc
+	}
+	return rc.c
+}
+
+// RuleHits returns the hit counts of all registered rules ordered by
+// middleware, kind and rule
+func (mm *Metrics) RuleHits() []RuleHit {
+	if mm == nil {
+		return nil
+	}
+	mm.mu.Lock()
+	hits := make([]RuleHit, 0, len(mm.rules))
+	for _, rc := range mm.rules {
+		hit := rc.hit
+		hit.Hits = rc.c.Value()
+		hits = append(hits, hit)
+	}
+	mm.mu.Unlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.Middleware != b.Middleware {
+			return a.Middleware < b.Middleware
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Rule < b.Rule
+	})
+	return hits
+}
+
+// Metrics returns the shared metrics, nil for a nil manager
+func (m *Manager) Metrics() *Metrics {
+	if m == nil {
+		return nil
+	}
+	return m.metrics
+}
+
+// shipperStats returns the log shipper counters, zero without a shipper
+func (m *Manager) shipperStats() (shipped, dropped int64) {
+	if m.logShipper == nil {
+		return 0, 0
+	}
+	return m.logShipper.GetStats()
+}
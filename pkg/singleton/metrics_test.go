@@ -0,0 +1,58 @@
+package singleton
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+)
+
+func TestMetrics(t *testing.T) {
+	m := &Manager{matcher: ipmatcher.New()}
+	m.metrics = newMetrics(m)
+	m.RegisterHooks(metricsHooks(m.metrics))
+
+	m.Metrics().Blocked.Inc()
+	m.notifyEDLUpdated(EDLUpdate{})
+	m.notifyEDLUpdated(EDLUpdate{Err: errors.New("boom")})
+	m.notifyEDLUpdated(EDLUpdate{Err: errors.New("boom")})
+	m.CountXFFTruncated()
+	m.Metrics().PathGroup("admin", "blocked").Inc()
+	m.Metrics().PathGroup("admin", "blocked").Inc() // same series after a reload
+	m.Metrics().Rule("ellio", "excluded_path", "/healthz").Inc()
+	m.Metrics().Rule("ellio", "excluded_path", "/unused")
+
+	var out strings.Builder
+	if _, err := m.Metrics().Registry.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	text := out.String()
+	for _, want := range []string{
+		`ellio_requests_total{decision="blocked"} 1`,
+		`ellio_requests_total{decision="allowed"} 0`,
+		`ellio_edl_updates_total{result="success"} 1`,
+		`ellio_edl_updates_total{result="failure"} 2`,
+		"ellio_edl_entries 0",
+		"ellio_xff_truncated_total 1",
+		`ellio_events_total{outcome="shipped"} 0`,
+		"ellio_lookup_duration_seconds_count 0",
+		`ellio_path_group_requests_total{group="admin",action="blocked"} 2`,
+		`ellio_rule_hits_total{middleware="ellio",kind="excluded_path",rule="/healthz"} 1`,
+		`ellio_rule_hits_total{middleware="ellio",kind="excluded_path",rule="/unused"} 0`,
+	} {
+		if !strings.Contains(text, want+"\n") {
+			t.Errorf("expected %q in:\n%s", want, text)
+		}
+	}
+
+	if hits := m.Metrics().RuleHits(); len(hits) != 2 || hits[0].Rule != "/healthz" || hits[0].Hits != 1 {
+		t.Errorf("unexpected rule hits %+v", hits)
+	}
+
+	var nilManager *Manager
+	if nilManager.Metrics() != nil {
+		t.Error("expected nil metrics for a nil manager")
+	}
+	nilManager.notifyEDLUpdated(EDLUpdate{})
+}
@@ -0,0 +1,65 @@
+package singleton
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// defaultEDLFileRefresh is how often a file EDL is checked for changes
+const defaultEDLFileRefresh = 10 * time.Second
+
+// startOffline loads the EDL from a local file for air-gapped deployments.
+// There is no bootstrap, config API or log shipper; the file is re-read
+// whenever its modification time or size changes.
+func (m *Manager) startOffline(opts Options) (err error) {
+	defer func() {
+		m.mu.Lock()
+		m.initErr = err
+		m.mu.Unlock()
+		m.ready.Store(true)
+		m.refreshState()
+		logger.Tracef("Manager ready (offline) - err=%v", err)
+	}()
+
+	edlURL := FileURLPrefix + strings.TrimPrefix(opts.EDLFilePath, FileURLPrefix)
+
+	mode := "blocklist"
+	if opts.EDLFileMode == "allowlist" {
+		mode = "allowlist"
+	}
+
+	refresh := opts.EDLFileRefresh
+	if refresh <= 0 {
+		refresh = defaultEDLFileRefresh
+	}
+
+	updater := m.newEDLUpdater([]string{edlURL}, refresh)
+
+	m.mu.Lock()
+	m.offline = true
+	m.deploymentEnabled = true
+	m.edlMode = mode
+	m.edlURLs = []string{edlURL}
+	m.edlUpdateFreq = refresh
+	m.edlUpdater = updater
+	m.mu.Unlock()
+
+	logger.Infof("Loading %s EDL from %s, the ELLIO API is not used", mode, edlURL)
+
+	ctx := context.Background()
+	if opts.InitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.InitTimeout)
+		defer cancel()
+	}
+
+	if err := updater.Start(ctx); err != nil {
+		logger.Errorf("Failed to load EDL file: %v", err)
+		return err
+	}
+	updater.StartUpdateLoop(context.Background())
+	return nil
+}
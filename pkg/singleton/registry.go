@@ -0,0 +1,104 @@
+package singleton
+
+import (
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// registryEntry holds the manager of one deployment. The once guards the
+// creation so concurrent instances of a deployment share a single manager.
+type registryEntry struct {
+	once    sync.Once
+	manager *Manager // Set once created (guarded by registryMu)
+	err     error
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*registryEntry) // Keyed by deploymentKey
+	instance   *Manager                          // Manager of the first deployment, see GetManager
+)
+
+// Acquire returns the manager of the deployment named by opts, creating and
+// starting it on first use. Middleware instances with the same bootstrap
+// token share one manager, instances with different tokens or EDL files get
+// their own. Like NewManager, the returned manager may be non-nil together
+// with an error; the outcome of the first attempt is kept for the process.
+func Acquire(opts Options) (*Manager, error) {
+	key := deploymentKey(opts)
+
+	registryMu.Lock()
+	entry, ok := registry[key]
+	if !ok {
+		entry = &registryEntry{}
+		registry[key] = entry
+	}
+	registryMu.Unlock()
+
+	entry.once.Do(func() {
+		logger.Tracef("Creating manager for deployment %s", key)
+		manager, err := NewManager(opts)
+
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		entry.manager, entry.err = manager, err
+		// Even if initialization fails part way, keep the valid (but disabled) manager
+		if manager != nil && instance == nil {
+			instance = manager
+		}
+	})
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return entry.manager, entry.err
+}
+
+// Initialize creates and starts the manager of the deployment named by opts
+func Initialize(opts Options) error {
+	_, err := Acquire(opts)
+	return err
+}
+
+// GetManager returns the manager of the first deployment that was
+// initialized. Callers serving a specific deployment should keep the
+// manager returned by Acquire instead.
+func GetManager() *Manager {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return instance
+}
+
+// LookupManager returns the manager of a deployment ID, or of a file:// EDL
+// URL for offline managers. It is nil while no instance created it.
+func LookupManager(deploymentID string) *Manager {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if entry := registry[deploymentID]; entry != nil {
+		return entry.manager
+	}
+	return nil
+}
+
+// deploymentKey names the deployment of opts: the deployment ID of the
+// bootstrap token, or the EDL file for offline managers. Tokens without a
+// deployment ID are keyed by their hash so the token is never logged. Dev
+// mode managers are keyed by their inline list, which cannot be reloaded.
+func deploymentKey(opts Options) string {
+	if opts.DevMode {
+		sum := crypto.Sum([]byte(strings.Join(opts.DevBlocklist, "\n")))
+		return devDeploymentID + "-" + hex.EncodeToString(sum[:8])
+	}
+	if opts.EDLFilePath != "" {
+		return FileURLPrefix + strings.TrimPrefix(opts.EDLFilePath, FileURLPrefix)
+	}
+	claims, err := NewTokenManager(opts.BootstrapToken, "").ParseBootstrapToken()
+	if err == nil && claims.DeploymentID != "" {
+		return claims.DeploymentID
+	}
+	sum := crypto.Sum([]byte(opts.BootstrapToken))
+	return "token-" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,74 @@
+package singleton
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAcquirePerDeployment(t *testing.T) {
+	dir := t.TempDir()
+	pathA := filepath.Join(dir, "a.bin")
+	pathB := filepath.Join(dir, "b.bin")
+	for _, path := range []string{pathA, pathB} {
+		if err := os.WriteFile(path, emptyTrieBody(t), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, err := Acquire(Options{EDLFilePath: pathA})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer a.Stop()
+	again, err := Acquire(Options{EDLFilePath: FileURLPrefix + pathA, EDLFileMode: "allowlist"})
+	if err != nil || again != a {
+		t.Fatalf("expected the same deployment to share its manager, got %p and %p (%v)", a, again, err)
+	}
+	if a.GetEDLMode() != "blocklist" {
+		t.Errorf("settings of a later instance must not replace the deployment's, got %s", a.GetEDLMode())
+	}
+
+	b, err := Acquire(Options{EDLFilePath: pathB, EDLFileMode: "allowlist"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer b.Stop()
+	if b == a || b.GetEDLMode() != "allowlist" {
+		t.Errorf("expected a separate allowlist manager for another deployment")
+	}
+
+	if GetManager() == nil || GetManager() == b {
+		t.Error("expected GetManager to return the first deployment's manager")
+	}
+	if LookupManager(FileURLPrefix+pathB) != b || LookupManager("unknown") != nil {
+		t.Error("unexpected manager lookup result")
+	}
+
+	// A failed creation is remembered for the deployment
+	missing := filepath.Join(dir, "missing.bin")
+	_, err1 := Acquire(Options{EDLFilePath: missing})
+	_, err2 := Acquire(Options{EDLFilePath: missing})
+	if err1 == nil || err2 == nil || err1.Error() != err2.Error() {
+		t.Errorf("expected the same error twice, got %v and %v", err1, err2)
+	}
+}
+
+func TestDeploymentKey(t *testing.T) {
+	token := func(claims string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+	}
+
+	if key := deploymentKey(Options{BootstrapToken: token(`{"deployment_id":"dep-1"}`)}); key != "dep-1" {
+		t.Errorf("expected the deployment ID, got %q", key)
+	}
+	key := deploymentKey(Options{BootstrapToken: "not-a-jwt"})
+	if !strings.HasPrefix(key, "token-") || strings.Contains(key, "not-a-jwt") {
+		t.Errorf("expected a hashed key for a token without deployment ID, got %q", key)
+	}
+	if deploymentKey(Options{BootstrapToken: "other"}) == key {
+		t.Error("different tokens must not share a key")
+	}
+}
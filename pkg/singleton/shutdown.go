@@ -0,0 +1,90 @@
+package singleton
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Deadlines of the individual subsystem stops. The log shipper flushes
+// its buffer on stop and needs longer than the loops that only exit.
+const (
+	loopStopTimeout = 2 * time.Second
+	logsStopTimeout = 10 * time.Second
+)
+
+// subsystem is a component of the manager stopped on shutdown
+type subsystem struct {
+	name    string
+	timeout time.Duration
+	stop    func() error
+}
+
+// SubsystemError is the failure of one subsystem to stop
+type SubsystemError struct {
+	Subsystem string
+	Err       error
+}
+
+// ShutdownError reports every subsystem that failed to stop cleanly
+type ShutdownError struct {
+	Failures []SubsystemError
+}
+
+func (e *ShutdownError) Error() string {
+	parts := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		parts[i] = f.Subsystem + ": " + f.Err.Error()
+	}
+	return "shutdown incomplete: " + strings.Join(parts, "; ")
+}
+
+// stopSubsystems stops all subsystems concurrently, each bounded by its own
+// deadline, and aggregates the failures into a *ShutdownError. A subsystem
+// that misses its deadline is left to finish in the background.
+func stopSubsystems(subsystems []subsystem) error {
+	errs := make([]error, len(subsystems))
+	var wg sync.WaitGroup
+	for i, sub := range subsystems {
+		wg.Add(1)
+		go func(i int, sub subsystem) {
+			defer wg.Done()
+			errs[i] = stopWithin(sub)
+		}(i, sub)
+	}
+	wg.Wait()
+
+	var failures []SubsystemError
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, SubsystemError{Subsystem: subsystems[i].name, Err: err})
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &ShutdownError{Failures: failures}
+}
+
+// stopWithin runs one stop, turning a panic or a missed deadline into an error
+func stopWithin(sub subsystem) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- sub.stop()
+	}()
+
+	timer := time.NewTimer(sub.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("did not stop within %v", sub.timeout)
+	}
+}
@@ -0,0 +1,66 @@
+package singleton
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+)
+
+func TestStopSubsystems(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	start := time.Now()
+	err := stopSubsystems([]subsystem{
+		{name: "ok", timeout: time.Second, stop: func() error { return nil }},
+		{name: "failing", timeout: time.Second, stop: func() error { return errors.New("boom") }},
+		{name: "stuck", timeout: 50 * time.Millisecond, stop: func() error { <-block; return nil }},
+		{name: "panicking", timeout: time.Second, stop: func() error { panic("bad") }},
+	})
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("expected subsystems to stop concurrently, took %v", took)
+	}
+
+	shutdownErr, ok := err.(*ShutdownError)
+	if !ok {
+		t.Fatalf("expected a *ShutdownError, got %v", err)
+	}
+	failed := make(map[string]string)
+	for _, f := range shutdownErr.Failures {
+		failed[f.Subsystem] = f.Err.Error()
+	}
+	if len(failed) != 3 || failed["failing"] != "boom" ||
+		!strings.Contains(failed["stuck"], "did not stop") || !strings.Contains(failed["panicking"], "panic") {
+		t.Errorf("unexpected failures %v", failed)
+	}
+	if !strings.Contains(err.Error(), "failing: boom") {
+		t.Errorf("expected the aggregated report to name each subsystem, got %q", err)
+	}
+
+	if err := stopSubsystems(nil); err != nil {
+		t.Errorf("expected no error without subsystems, got %v", err)
+	}
+}
+
+func TestManagerStopTwice(t *testing.T) {
+	m := &Manager{
+		stopCh:       make(chan struct{}),
+		tokenManager: NewTokenManager("token", "machine"),
+		logShipper:   logs.NewLogShipper(nil, &logs.LogShipperConfig{BufferSize: 10}),
+	}
+	m.edlUpdater = NewEDLUpdater([]string{"https://edl.example.com"}, time.Minute, ipmatcher.New(), m)
+	m.logShipper.Start()
+
+	if err := m.Stop(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Stop(); err != nil {
+		t.Errorf("expected a second Stop to be a no-op, got %v", err)
+	}
+	m.tokenManager.Stop()
+	m.edlUpdater.Stop()
+}
@@ -0,0 +1,131 @@
+package singleton
+
+import "time"
+
+// Status is a point-in-time snapshot of a manager for operators
+type Status struct {
+	DeploymentID   string          `json:"deployment_id"`
+	State          string          `json:"state"`
+	Ready          bool            `json:"ready"`
+	Reason         string          `json:"reason,omitempty"`     // Readiness reason code when not ready
+	InitError      string          `json:"init_error,omitempty"` // Error that ended initialization
+	Offline        bool            `json:"offline"`
+	DevMode        bool            `json:"dev_mode,omitempty"`              // The inline devBlocklist is enforced without the ELLIO API
+	Mode           string          `json:"mode"`                            // "blocklist" or "allowlist"
+	ConfigHash     string          `json:"config_hash,omitempty"`           // SHA-256 of the last config API response
+	ConfigSchema   int             `json:"config_schema_version,omitempty"` // Schema version of that response
+	Features       map[string]bool `json:"features,omitempty"`              // Feature flags set through the config API
+	EDL            *EDLStatus      `json:"edl,omitempty"`
+	Token          *TokenStatus    `json:"token,omitempty"`
+	Shipper        ShipperStatus   `json:"shipper"`
+	XFFTruncated   int64           `json:"xff_truncated"`
+	TorExitEntries int64           `json:"tor_exit_entries,omitempty"` // Size of the Tor exit list when blockTorExits is enabled
+	ConfigConflict bool            `json:"config_conflict"`            // Instances disagree on IP extraction settings
+
+	DecisionErrors      []DecisionError `json:"decision_errors"`       // Most recent first
+	DecisionErrorsTotal int64           `json:"decision_errors_total"` // Recorded since start
+
+	RuleHits []RuleHit `json:"rule_hits"` // Hits per configured rule, zero for rules never matched
+}
+
+// EDLStatus describes the loaded EDL
+type EDLStatus struct {
+	Entries         int64             `json:"entries"`
+	AllowEntries    int64             `json:"allowlist_entries,omitempty"` // Allowlist entries of a combined EDL, Entries counts the blocklist
+	Precedence      string            `json:"precedence,omitempty"`        // List deciding clients on both lists of a combined EDL
+	Generation      string            `json:"generation,omitempty"`
+	LastUpdate      *time.Time        `json:"last_update,omitempty"`
+	LastError       string            `json:"last_error,omitempty"`
+	UpdateCount     int64             `json:"update_count"`
+	UpdateFrequency string            `json:"update_frequency"`
+	Sources         []EDLSourceStatus `json:"sources"`
+	FamilyMismatch  bool              `json:"family_mismatch,omitempty"` // All clients are IPv6 but the EDL has only IPv4 entries
+}
+
+// TokenStatus describes the access token
+type TokenStatus struct {
+	Expiry           *time.Time `json:"expiry,omitempty"`
+	DeploymentActive bool       `json:"deployment_active"`
+}
+
+// ShipperStatus holds the log shipper counters
+type ShipperStatus struct {
+	Enabled bool  `json:"enabled"`
+	Shipped int64 `json:"shipped"`
+	Dropped int64 `json:"dropped"`
+}
+
+// Status returns a snapshot of the manager, nil for a nil manager
+func (m *Manager) Status() *Status {
+	if m == nil {
+		return nil
+	}
+	s := &Status{
+		DeploymentID:   m.deploymentID,
+		State:          m.State(),
+		XFFTruncated:   m.xffTruncated.Load(),
+		ConfigConflict: m.configConflict.Load(),
+	}
+	s.Ready, s.Reason = m.Readiness()
+	s.DecisionErrors, s.DecisionErrorsTotal = m.RecentDecisionErrors()
+	s.RuleHits = m.metrics.RuleHits()
+	s.Features = m.Features()
+	s.TorExitEntries = m.torExitEntries()
+	if !m.ready.Load() {
+		return s
+	}
+
+	m.mu.RLock()
+	tokenManager := m.tokenManager
+	updater := m.edlUpdater
+	shipper := m.logShipper
+	s.Offline = m.offline
+	s.DevMode = m.dev
+	s.Mode = m.edlMode
+	precedence := m.edlPrecedence
+	updateFreq := m.edlUpdateFreq
+	s.ConfigHash = m.configHash
+	s.ConfigSchema = m.configSchema
+	if m.initErr != nil {
+		s.InitError = m.initErr.Error()
+	}
+	m.mu.RUnlock()
+
+	if s.DevMode {
+		s.EDL = &EDLStatus{Entries: m.matcher.Count(), FamilyMismatch: m.FamilyMismatch()}
+	}
+	if updater != nil {
+		lastUpdate, lastErr, updateCount := updater.GetStatus()
+		edl := &EDLStatus{
+			Entries:         m.matcher.Count(),
+			Generation:      updater.Generation(),
+			UpdateCount:     updateCount,
+			UpdateFrequency: updateFreq.String(),
+			Sources:         updater.Sources(),
+			FamilyMismatch:  m.FamilyMismatch(),
+		}
+		if !lastUpdate.IsZero() {
+			edl.LastUpdate = &lastUpdate
+		}
+		if lastErr != nil {
+			edl.LastError = lastErr.Error()
+		}
+		if s.Mode == EDLModeCombined {
+			edl.AllowEntries = m.matcher.AllowCount()
+			edl.Precedence = precedence
+		}
+		s.EDL = edl
+	}
+	if tokenManager != nil {
+		token := &TokenStatus{DeploymentActive: tokenManager.IsDeploymentActive()}
+		if expiry := tokenManager.GetTokenExpiry(); !expiry.IsZero() {
+			token.Expiry = &expiry
+		}
+		s.Token = token
+	}
+	if shipper != nil {
+		s.Shipper.Enabled = true
+		s.Shipper.Shipped, s.Shipper.Dropped = shipper.GetStats()
+	}
+	return s
+}
@@ -2,6 +2,7 @@ package singleton
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,10 +11,19 @@ import (
 	"time"
 
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/api"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/backoff"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/clock"
 	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token refresh scheduling
+const (
+	refreshRatio         = 0.8              // Refresh after this share of the token lifetime
+	minRefreshInterval   = 30 * time.Second // Lower bound of the refresh interval and the retry delay
+	refreshCheckInterval = time.Minute      // Upper bound of the refresh timer, see refreshLoop
+)
+
 // TokenManager manages JWT tokens and refreshing
 type TokenManager struct {
 	bootstrapClient *api.BootstrapClient
@@ -23,11 +33,19 @@ type TokenManager struct {
 	mu                sync.RWMutex
 	currentToken      string
 	tokenExpiry       time.Time
+	refreshAt         time.Time     // When the token is due for refresh
+	refreshInterval   time.Duration // Time from issuance to refreshAt
 	configURL         string
 	logsURL           string
+	eventsKeyID       string // Key ID of eventsPublicKey
+	eventsPublicKey   string // Base64 X25519 key for event encryption, empty if not delivered
 	deploymentDeleted bool
 
-	stopCh chan struct{}
+	onRefresh func(ctx context.Context) // Called after each successful refresh
+
+	loop lifecycle // Background refresh loop
+
+	now func() time.Time // clock, replaced in tests
 }
 
 // BootstrapClaims represents the JWT claims in the bootstrap token
@@ -46,7 +64,7 @@ func NewTokenManager(bootstrapToken string, machineID string) *TokenManager {
 		bootstrapClient: api.NewBootstrapClient(),
 		bootstrapToken:  bootstrapToken,
 		machineID:       machineID,
-		stopCh:          make(chan struct{}),
+		now:             time.Now,
 	}
 }
 
@@ -94,7 +112,10 @@ func (tm *TokenManager) ParseBootstrapToken() (*BootstrapClaims, error) {
 
 // Initialize performs initial bootstrap
 func (tm *TokenManager) Initialize(ctx context.Context) error {
-	resp, err := tm.bootstrapClient.Bootstrap(ctx, tm.bootstrapToken, tm.machineID)
+	// Coalesce with other managers bootstrapping the same token concurrently
+	val, err, _ := fetchGroup.Do("bootstrap:"+tm.bootstrapToken+":"+tm.machineID, func() (interface{}, error) {
+		return tm.bootstrapClient.Bootstrap(ctx, tm.bootstrapToken, tm.machineID)
+	})
 	if err != nil {
 		if api.IsPermanentError(err) {
 			tm.mu.Lock()
@@ -104,13 +125,9 @@ func (tm *TokenManager) Initialize(ctx context.Context) error {
 		}
 		return err
 	}
+	resp := val.(*api.BootstrapResponse)
 
-	tm.mu.Lock()
-	tm.currentToken = resp.AccessToken
-	tm.tokenExpiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
-	tm.configURL = resp.ConfigURL
-	tm.logsURL = resp.LogsURL
-	tm.mu.Unlock()
+	tm.setToken(resp)
 
 	logger.Debugf("Bootstrap successful, token expires in %d seconds", resp.ExpiresIn)
 	logger.Debugf("Config URL from bootstrap: %s", resp.ConfigURL)
@@ -120,7 +137,9 @@ func (tm *TokenManager) Initialize(ctx context.Context) error {
 	return nil
 }
 
-// StartRefreshLoop starts the background token refresh loop
+// StartRefreshLoop starts the background token refresh loop unless it is
+// already running or the deployment is deleted. A loop ended by Stop can be
+// started again.
 func (tm *TokenManager) StartRefreshLoop(ctx context.Context) {
 	// Don't start if deployment is deleted
 	tm.mu.RLock()
@@ -130,14 +149,30 @@ func (tm *TokenManager) StartRefreshLoop(ctx context.Context) {
 	}
 	tm.mu.RUnlock()
 
-	refreshTimer := time.NewTimer(tm.calculateRefreshInterval())
+	stopCh, ok := tm.loop.start()
+	if !ok {
+		logger.Trace("Token refresh loop already running")
+		return
+	}
+	go func() {
+		defer tm.loop.finish(stopCh)
+		tm.refreshLoop(ctx, stopCh)
+	}()
+}
+
+// refreshLoop refreshes the token until ctx is done, stopCh is closed or
+// the deployment is deleted. Timers do not run while the host is suspended,
+// so the timer never waits longer than refreshCheckInterval and the refresh
+// time is checked against both clocks when it fires.
+func (tm *TokenManager) refreshLoop(ctx context.Context, stopCh chan struct{}) {
+	refreshTimer := time.NewTimer(tm.nextCheck())
 	defer refreshTimer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-tm.stopCh:
+		case <-stopCh:
 			return
 		case <-refreshTimer.C:
 			tm.mu.RLock()
@@ -148,33 +183,70 @@ func (tm *TokenManager) StartRefreshLoop(ctx context.Context) {
 				logger.Info("Stopping token refresh - deployment deleted")
 				return
 			}
+			if tm.untilRefresh() > 0 {
+				refreshTimer.Reset(tm.nextCheck())
+				continue
+			}
 
 			if err := tm.refresh(ctx); err != nil {
 				logger.Warnf("Token refresh failed: %v", err)
-				// Retry after 30 seconds
-				refreshTimer.Reset(30 * time.Second)
+				refreshTimer.Reset(minRefreshInterval)
 			} else {
-				refreshTimer.Reset(tm.calculateRefreshInterval())
+				refreshTimer.Reset(tm.nextCheck())
 			}
 		}
 	}
 }
 
-// calculateRefreshInterval calculates when to refresh (80% of token lifetime)
-func (tm *TokenManager) calculateRefreshInterval() time.Duration {
+// setToken stores a bootstrap response and schedules its refresh at
+// refreshRatio of the token lifetime, at least minRefreshInterval away
+func (tm *TokenManager) setToken(resp *api.BootstrapResponse) {
+	now := tm.now()
+	lifetime := time.Duration(resp.ExpiresIn) * time.Second
+	interval := time.Duration(float64(lifetime) * refreshRatio)
+	if interval < minRefreshInterval {
+		interval = minRefreshInterval
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.currentToken = resp.AccessToken
+	tm.tokenExpiry = now.Add(lifetime)
+	tm.refreshAt = now.Add(interval)
+	tm.refreshInterval = interval
+	tm.configURL = resp.ConfigURL
+	tm.logsURL = resp.LogsURL
+	tm.eventsKeyID = resp.EventsKeyID
+	tm.eventsPublicKey = resp.EventsPublicKey
+}
+
+// untilRefresh returns the time left before the token is due for refresh,
+// zero or less when it is due. The wall clock counts as well because the
+// backend expires tokens by wall time and the monotonic clock stops while
+// the host is suspended.
+func (tm *TokenManager) untilRefresh() time.Duration {
 	tm.mu.RLock()
-	expiry := tm.tokenExpiry
+	at, interval := tm.refreshAt, tm.refreshInterval
 	tm.mu.RUnlock()
 
-	timeUntilExpiry := time.Until(expiry)
-	refreshAt := time.Duration(float64(timeUntilExpiry) * 0.8)
-
-	// Minimum 30 seconds
-	if refreshAt < 30*time.Second {
-		refreshAt = 30 * time.Second
+	left := clock.Until(tm.now(), at)
+	if left > interval {
+		// More time left than was scheduled: the clock stepped backwards
+		return 0
 	}
+	return left
+}
 
-	return refreshAt
+// nextCheck returns how long the refresh timer waits
+func (tm *TokenManager) nextCheck() time.Duration {
+	left := tm.untilRefresh()
+	if left < 0 {
+		return 0
+	}
+	if left > refreshCheckInterval {
+		return refreshCheckInterval
+	}
+	return left
 }
 
 // refresh refreshes the token
@@ -190,23 +262,38 @@ func (tm *TokenManager) refresh(ctx context.Context) error {
 		return err
 	}
 
-	tm.mu.Lock()
-	tm.currentToken = resp.AccessToken
-	tm.tokenExpiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
-	tm.configURL = resp.ConfigURL
-	tm.logsURL = resp.LogsURL
-	tm.mu.Unlock()
+	tm.setToken(resp)
 
 	logger.Trace("Token refreshed successfully")
 
 	// Check for configuration updates
-	if manager := GetManager(); manager != nil {
-		manager.CheckConfigUpdates(ctx)
+	tm.mu.RLock()
+	onRefresh := tm.onRefresh
+	tm.mu.RUnlock()
+	if onRefresh != nil {
+		onRefresh(ctx)
 	}
 
 	return nil
 }
 
+// SetRefreshHook registers a callback run after each successful token refresh
+func (tm *TokenManager) SetRefreshHook(hook func(ctx context.Context)) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.onRefresh = hook
+}
+
+// SetRetry sets the retry policy of bootstrap calls, zero fields keep the defaults
+func (tm *TokenManager) SetRetry(p backoff.Policy) {
+	tm.bootstrapClient.SetRetry(p)
+}
+
+// SetTLSConfig sets the TLS settings of bootstrap calls, nil keeps the defaults
+func (tm *TokenManager) SetTLSConfig(cfg *tls.Config) {
+	tm.bootstrapClient.SetTLSConfig(cfg)
+}
+
 // GetToken returns the current access token
 func (tm *TokenManager) GetToken() string {
 	tm.mu.RLock()
@@ -232,6 +319,30 @@ func (tm *TokenManager) GetLogsURL() string {
 	return tm.logsURL
 }
 
+// GetEventsKey returns the public key events are encrypted with, empty
+// when bootstrap did not deliver one
+func (tm *TokenManager) GetEventsKey() (keyID, publicKey string) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.eventsKeyID, tm.eventsPublicKey
+}
+
+// GetTokenExpiry returns when the current access token expires, zero before bootstrap
+func (tm *TokenManager) GetTokenExpiry() time.Time {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.tokenExpiry
+}
+
+// TokenExpired reports whether the current access token has expired by
+// either the monotonic or the wall clock, true before bootstrap
+func (tm *TokenManager) TokenExpired() bool {
+	tm.mu.RLock()
+	expiry := tm.tokenExpiry
+	tm.mu.RUnlock()
+	return expiry.IsZero() || clock.Until(tm.now(), expiry) <= 0
+}
+
 // IsDeploymentActive returns whether the deployment is active
 func (tm *TokenManager) IsDeploymentActive() bool {
 	tm.mu.RLock()
@@ -239,7 +350,8 @@ func (tm *TokenManager) IsDeploymentActive() bool {
 	return !tm.deploymentDeleted
 }
 
-// Stop stops the token manager
+// Stop stops the refresh loop. It is safe to call more than once, and
+// StartRefreshLoop starts a new loop afterwards.
 func (tm *TokenManager) Stop() {
-	close(tm.stopCh)
+	tm.loop.stop()
 }
@@ -0,0 +1,65 @@
+package singleton
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/api"
+)
+
+func TestTokenRefreshSchedule(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tm := NewTokenManager("token", "machine")
+	tm.now = func() time.Time { return clock }
+
+	if !tm.TokenExpired() || tm.untilRefresh() > 0 {
+		t.Error("expected an expired token due for refresh before bootstrap")
+	}
+
+	tm.setToken(&api.BootstrapResponse{AccessToken: "a", ExpiresIn: 3600})
+	if got := tm.untilRefresh(); got != 48*time.Minute {
+		t.Errorf("expected a refresh at 80%% of the lifetime, got %v", got)
+	}
+	if got := tm.nextCheck(); got != refreshCheckInterval {
+		t.Errorf("expected the timer capped at %v, got %v", refreshCheckInterval, got)
+	}
+
+	clock = clock.Add(47*time.Minute + 30*time.Second)
+	if got := tm.nextCheck(); got != 30*time.Second {
+		t.Errorf("expected the timer to wait for the refresh time, got %v", got)
+	}
+
+	tm.setToken(&api.BootstrapResponse{AccessToken: "b", ExpiresIn: 10})
+	if got := tm.untilRefresh(); got != minRefreshInterval {
+		t.Errorf("expected short lifetimes to refresh after %v, got %v", minRefreshInterval, got)
+	}
+}
+
+func TestTokenRefreshClockJumps(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tm := NewTokenManager("token", "machine")
+	tm.now = func() time.Time { return clock }
+	tm.setToken(&api.BootstrapResponse{AccessToken: "a", ExpiresIn: 3600})
+
+	// Resuming from a two hour suspend: the token expired meanwhile
+	clock = clock.Add(2 * time.Hour)
+	if tm.untilRefresh() > 0 || tm.nextCheck() != 0 {
+		t.Error("expected a refresh right after a forward jump")
+	}
+	if !tm.TokenExpired() {
+		t.Error("expected the token to count as expired after a forward jump")
+	}
+
+	// A clock stepped back a day must not postpone the refresh by a day
+	tm.setToken(&api.BootstrapResponse{AccessToken: "b", ExpiresIn: 3600})
+	clock = clock.Add(-24 * time.Hour)
+	if tm.untilRefresh() > 0 {
+		t.Errorf("expected a refresh after a backward jump, got %v left", tm.untilRefresh())
+	}
+
+	// Refreshing reschedules from the stepped clock
+	tm.setToken(&api.BootstrapResponse{AccessToken: "c", ExpiresIn: 3600})
+	if got := tm.untilRefresh(); got != 48*time.Minute || tm.TokenExpired() {
+		t.Errorf("expected a regular schedule after the refresh, got %v", got)
+	}
+}
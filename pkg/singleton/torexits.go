@@ -0,0 +1,84 @@
+package singleton
+
+import (
+	"context"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// DefaultTorExitListURL is the Tor Project's list of exit node addresses,
+// one per line
+const DefaultTorExitListURL = "https://check.torproject.org/torbulkexitlist"
+
+// DefaultTorExitRefresh is how often the Tor exit list is downloaded
+const DefaultTorExitRefresh = time.Hour
+
+// torExitList is the Tor exit list shared by the instances of a manager.
+// It is loaded through an EDL updater of its own, outside the EDL hooks,
+// cache and memory budget.
+type torExitList struct {
+	url     string
+	matcher *ipmatcher.Matcher
+	updater *EDLUpdater
+}
+
+// TorExits returns the matcher of the Tor exit list, starting its download
+// loop on first use. Instances share one list; a different url or refresh
+// of a later instance is ignored with a warning. The matcher is empty until
+// the first download completes.
+func (m *Manager) TorExits(url string, refresh time.Duration) *ipmatcher.Matcher {
+	if m == nil {
+		return nil
+	}
+	if url == "" {
+		url = DefaultTorExitListURL
+	}
+	if refresh <= 0 {
+		refresh = DefaultTorExitRefresh
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.torExits != nil {
+		if m.torExits.url != url {
+			logger.Warnf("Tor exit list %s is already loaded, ignoring %s", m.torExits.url, url)
+		}
+		return m.torExits.matcher
+	}
+
+	matcher := ipmatcher.New()
+	updater := NewEDLUpdater([]string{url}, refresh, matcher, nil)
+	updater.SetRetry(m.retry)
+	m.torExits = &torExitList{url: url, matcher: matcher, updater: updater}
+	logger.Infof("Blocking Tor exit nodes listed at %s, refreshed every %v", url, refresh)
+
+	// Downloads end when the manager stops
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-m.stopCh
+		cancel()
+	}()
+	go func() {
+		initCtx, cancelInit := context.WithTimeout(ctx, refresh)
+		err := updater.updateNow(initCtx)
+		cancelInit()
+		if err != nil {
+			logger.Errorf("Initial Tor exit list download failed, retrying in %v: %v", refresh, err)
+		}
+		updater.StartUpdateLoop(ctx)
+	}()
+	return matcher
+}
+
+// torExitEntries returns the size of the Tor exit list, 0 when it is not
+// in use
+func (m *Manager) torExitEntries() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.torExits == nil {
+		return 0
+	}
+	return m.torExits.matcher.Count()
+}
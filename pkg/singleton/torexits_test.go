@@ -0,0 +1,41 @@
+package singleton
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTorExits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exits.txt")
+	if err := os.WriteFile(path, []byte("203.0.113.7\n2001:db8::7\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{stopCh: make(chan struct{})}
+	defer close(m.stopCh)
+
+	matcher := m.TorExits(FileURLPrefix+path, time.Hour)
+	deadline := time.Now().Add(5 * time.Second)
+	for matcher.Count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if matcher.Count() != 2 || m.torExitEntries() != 2 {
+		t.Fatalf("expected 2 exit nodes, got %d", matcher.Count())
+	}
+	if _, ok := matcher.Lookup(netip.MustParseAddr("203.0.113.7")); !ok {
+		t.Error("expected the exit node to be listed")
+	}
+
+	// Instances share the first list
+	if other := m.TorExits(FileURLPrefix+path+".other", 0); other != matcher {
+		t.Error("expected later instances to share the loaded list")
+	}
+
+	var nilManager *Manager
+	if nilManager.TorExits("", 0) != nil {
+		t.Error("expected no list without a manager")
+	}
+}
@@ -0,0 +1,141 @@
+package singleton
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/api"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/compat"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/ipmatcher"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/utils"
+)
+
+// ValidationReport describes the deployment a bootstrap token resolves to
+type ValidationReport struct {
+	DeploymentID    string
+	Mode            string   // "blocklist" or "allowlist"
+	URLs            []string // EDL URLs, a file:// URL for offline validation
+	UpdateFrequency time.Duration
+	Entries         int64  // Entries of the loaded EDL
+	Generation      string // Generation of the loaded EDL, if the backend sends one
+	Format          string // FormatELLIOTRIE or FormatPlain
+	TokenExpiry     time.Time
+	LogsEnabled     bool // Bootstrap returned a logs URL
+}
+
+// Validate bootstraps the token, fetches the deployment config and loads
+// the EDL once, without starting background loops or shipping events. It
+// lets operators check credentials and connectivity before enforcing. With
+// EDLFilePath set only the file is loaded.
+func Validate(ctx context.Context, opts Options) (*ValidationReport, error) {
+	probe, err := compat.Run()
+	if err != nil {
+		return nil, err
+	}
+	api.SetManualDecoding(!probe.StructTagJSON)
+
+	if opts.InitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.InitTimeout)
+		defer cancel()
+	}
+
+	report := &ValidationReport{}
+	if opts.EDLFilePath != "" {
+		report.Mode = "blocklist"
+		if opts.EDLFileMode == "allowlist" {
+			report.Mode = "allowlist"
+		}
+		report.URLs = []string{FileURLPrefix + strings.TrimPrefix(opts.EDLFilePath, FileURLPrefix)}
+		return report, validateEDL(ctx, report, opts.EDLFormat, nil)
+	}
+
+	if opts.BootstrapToken == "" {
+		return nil, errors.New("bootstrap token is required")
+	}
+	machineID := opts.MachineID
+	if machineID == "" {
+		machineID = utils.GenerateMachineID()
+	}
+	tlsConfig, err := opts.TLS.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tm := NewTokenManager(opts.BootstrapToken, machineID)
+	tm.SetRetry(opts.Retry)
+	tm.SetTLSConfig(tlsConfig)
+	claims, err := tm.ParseBootstrapToken()
+	if err != nil {
+		return nil, err
+	}
+	report.DeploymentID = claims.DeploymentID
+	if err := validateComponentType(claims.ComponentType, opts.ComponentTypes); err != nil {
+		return report, err
+	}
+	if claims.Issuer == "" {
+		return report, errors.New("bootstrap token missing issuer")
+	}
+
+	if err := tm.Initialize(ctx); err != nil {
+		return report, errors.New("bootstrap failed: " + err.Error())
+	}
+	report.TokenExpiry = tm.GetTokenExpiry()
+	report.LogsEnabled = tm.GetLogsURL() != ""
+
+	configClient := api.NewConfigClient(tm.GetConfigURL(), tm.GetToken)
+	configClient.SetTLSConfig(tlsConfig)
+	edlConfig, err := configClient.GetEDLConfig(ctx)
+	if err != nil {
+		return report, errors.New("config fetch failed: " + err.Error())
+	}
+	report.Mode = "blocklist"
+	if edlConfig.Purpose == "allowlist" {
+		report.Mode = "allowlist"
+	}
+	report.URLs = edlConfig.URLs.All()
+	report.UpdateFrequency = time.Duration(edlConfig.UpdateFrequencySeconds) * time.Second
+	if len(report.URLs) == 0 {
+		return report, errors.New("deployment config has no EDL URLs")
+	}
+	return report, validateEDL(ctx, report, opts.EDLFormat, tlsConfig)
+}
+
+// validateEDL loads the report's EDL URLs once into a throwaway matcher
+func validateEDL(ctx context.Context, report *ValidationReport, format string, tlsConfig *tls.Config) error {
+	matcher := ipmatcher.New()
+	updater := NewEDLUpdater(report.URLs, 0, matcher, nil)
+	updater.SetTLSConfig(tlsConfig)
+	if format == EDLFormatBinary {
+		updater.SetFormat(format)
+	}
+	if err := updater.updateNow(ctx); err != nil {
+		return errors.New("EDL load failed: " + err.Error())
+	}
+	report.Entries = matcher.Count()
+	report.Generation = updater.Generation()
+	updater.mu.RLock()
+	if updater.summary != nil {
+		report.Format = updater.summary.Format
+	}
+	updater.mu.RUnlock()
+	return nil
+}
+
+// LogValidation logs the outcome of Validate
+func LogValidation(report *ValidationReport, err error) {
+	if report == nil {
+		logger.Errorf("Token validation failed: %v", err)
+		return
+	}
+	if err != nil {
+		logger.Errorf("Token validation failed for deployment %q: %v", report.DeploymentID, err)
+		return
+	}
+	logger.Infof("Token validation succeeded: deployment=%q mode=%s entries=%d format=%s generation=%q urls=%s update_frequency=%v token_expiry=%s logs_enabled=%v",
+		report.DeploymentID, report.Mode, report.Entries, report.Format, report.Generation,
+		strings.Join(report.URLs, ","), report.UpdateFrequency, report.TokenExpiry.UTC().Format(time.RFC3339), report.LogsEnabled)
+}
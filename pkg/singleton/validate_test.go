@@ -0,0 +1,70 @@
+package singleton
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	stubAPI(t, func(req *http.Request) (*http.Response, error) {
+		body := `{"access_token":"abc","expires_in":3600,"config_url":"https://api.example.com/config"}`
+		if req.URL.Path == "/config" {
+			body = `{"deployment_id":"dep-1","purpose":"allowlist","update_frequency_seconds":300,"urls":{"combined":["https://edl.example.com/list"]}}`
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	})
+	generation := "gen-7"
+	original := EDLHTTPClientFactory
+	EDLHTTPClientFactory = func() *http.Client { return edlServer(t, &generation) }
+	t.Cleanup(func() { EDLHTTPClientFactory = original })
+
+	report, err := Validate(context.Background(), Options{BootstrapToken: testBootstrapToken})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.DeploymentID != "dep-1" || report.Mode != "allowlist" {
+		t.Errorf("unexpected deployment %q mode %q", report.DeploymentID, report.Mode)
+	}
+	if len(report.URLs) != 1 || report.URLs[0] != "https://edl.example.com/list" {
+		t.Errorf("unexpected URLs %v", report.URLs)
+	}
+	if report.Generation != "gen-7" || report.Format != FormatELLIOTRIE {
+		t.Errorf("unexpected generation %q format %q", report.Generation, report.Format)
+	}
+	if report.TokenExpiry.IsZero() {
+		t.Error("expected token expiry to be set")
+	}
+
+	if _, err := Validate(context.Background(), Options{BootstrapToken: "not-a-jwt"}); err == nil {
+		t.Error("expected error for a malformed token")
+	}
+}
+
+func TestValidateOffline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "edl.bin")
+	if err := os.WriteFile(path, emptyTrieBody(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Validate(context.Background(), Options{EDLFilePath: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Mode != "blocklist" || report.Entries != 0 || report.URLs[0] != FileURLPrefix+path {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if _, err := Validate(context.Background(), Options{EDLFilePath: path + ".missing"}); err == nil {
+		t.Error("expected error for a missing EDL file")
+	}
+}
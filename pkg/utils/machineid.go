@@ -1,15 +1,15 @@
 package utils
 
 import (
-	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/crypto"
 )
 
 // GenerateMachineID generates a random machine ID
 func GenerateMachineID() string {
-	bytes := make([]byte, 16)
-	_, err := rand.Read(bytes)
+	bytes, err := crypto.RandomBytes(16)
 	if err != nil {
 		return "unknown-machine-id"
 	}
@@ -19,8 +19,7 @@ func GenerateMachineID() string {
 
 // GenerateUUID generates a UUID v4
 func GenerateUUID() string {
-	bytes := make([]byte, 16)
-	_, err := rand.Read(bytes)
+	bytes, err := crypto.RandomBytes(16)
 	if err != nil {
 		return "00000000-0000-0000-0000-000000000000"
 	}
@@ -0,0 +1,121 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/clock"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+const (
+	defaultProxyRefresh = 5 * time.Minute
+	proxyResolveTimeout = 5 * time.Second
+)
+
+// lookupHost resolves a hostname to IP addresses. Tests replace it to avoid DNS.
+var lookupHost = func(ctx context.Context, host string) ([]string, error) {
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// proxyResolver tracks trustedProxies entries given as hostnames, e.g. load
+// balancer DNS names. Addresses are re-resolved once the refresh interval has
+// passed, triggered by the next lookup so no goroutine outlives the middleware.
+type proxyResolver struct {
+	hosts    []string
+	interval time.Duration
+
+	prefixes  atomic.Value   // holds []netip.Prefix, replaced as a whole
+	expiresAt clock.Deadline // after which a refresh is due
+	resolving atomic.Bool    // true while a background refresh runs
+
+	last map[string][]netip.Prefix // last good addresses per host, only used by resolve
+}
+
+// newProxyResolver resolves hosts synchronously so the first requests see them
+func newProxyResolver(hosts []string, interval time.Duration) *proxyResolver {
+	if interval <= 0 {
+		interval = defaultProxyRefresh
+	}
+	r := &proxyResolver{
+		hosts:    hosts,
+		interval: interval,
+		last:     make(map[string][]netip.Prefix),
+	}
+	r.prefixes.Store([]netip.Prefix(nil))
+	r.resolve()
+	return r
+}
+
+// Contains reports whether addr belongs to one of the resolved hosts
+func (r *proxyResolver) Contains(addr netip.Addr) bool {
+	if r.expiresAt.Passed(time.Now(), r.interval) && r.resolving.CompareAndSwap(false, true) {
+		go func() {
+			defer r.resolving.Store(false)
+			r.resolve()
+		}()
+	}
+
+	prefixes, _ := r.prefixes.Load().([]netip.Prefix)
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve looks up every host and atomically publishes the union. A host that
+// fails to resolve keeps its previous addresses rather than losing trust.
+func (r *proxyResolver) resolve() {
+	ctx, cancel := context.WithTimeout(context.Background(), proxyResolveTimeout)
+	defer cancel()
+
+	var result []netip.Prefix
+	for _, host := range r.hosts {
+		addrs, err := lookupHost(ctx, host)
+		if err != nil {
+			logger.Warnf("Failed to resolve trusted proxy %s, keeping %d previous addresses: %v",
+				host, len(r.last[host]), err)
+			result = append(result, r.last[host]...)
+			continue
+		}
+
+		var resolved []netip.Prefix
+		for _, a := range addrs {
+			addr, err := netip.ParseAddr(a)
+			if err != nil {
+				continue
+			}
+			addr = addr.Unmap()
+			resolved = append(resolved, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+		logger.Debugf("Resolved trusted proxy %s to %d addresses", host, len(resolved))
+		r.last[host] = resolved
+		result = append(result, resolved...)
+	}
+
+	r.prefixes.Store(result)
+	r.expiresAt.Set(time.Now(), r.interval)
+}
+
+// isHostnameEntry reports whether a trustedProxies entry is a DNS name
+// rather than an IP, CIDR or keyword. Names must contain a dot.
+func isHostnameEntry(entry string) bool {
+	if !strings.Contains(entry, ".") || strings.Contains(entry, "/") {
+		return false
+	}
+	if _, err := netip.ParseAddr(entry); err == nil {
+		return false
+	}
+	for _, c := range entry {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubLookup replaces DNS resolution with a mutable table
+type stubLookup struct {
+	mu    sync.Mutex
+	table map[string][]string
+	calls int
+}
+
+func (s *stubLookup) set(host string, addrs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.table[host] = addrs
+}
+
+func (s *stubLookup) lookup(ctx context.Context, host string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	addrs, ok := s.table[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func installStubLookup(t *testing.T) *stubLookup {
+	t.Helper()
+	stub := &stubLookup{table: make(map[string][]string)}
+	original := lookupHost
+	lookupHost = stub.lookup
+	t.Cleanup(func() { lookupHost = original })
+	return stub
+}
+
+func TestIsHostnameEntry(t *testing.T) {
+	tests := map[string]bool{
+		"lb.example.com":    true,
+		"my-elb-1.aws.com":  true,
+		"10.0.0.1":          false,
+		"10.0.0.0/8":        false,
+		"2001:db8::1":       false,
+		"loopback":          false,
+		"*":                 false,
+		"bad host.example":  false,
+		"proxy.example.com": true,
+	}
+	for entry, want := range tests {
+		if got := isHostnameEntry(entry); got != want {
+			t.Errorf("isHostnameEntry(%q) = %v, want %v", entry, got, want)
+		}
+	}
+}
+
+func TestParseTrustedProxiesWildcardAndHostnames(t *testing.T) {
+	prefixes := parseTrustedProxies([]string{"*", "lb.example.com"})
+	if len(prefixes) != 2 {
+		t.Fatalf("expected wildcard to expand to 2 prefixes and hostnames skipped, got %v", prefixes)
+	}
+	for _, ip := range []string{"203.0.113.1", "2001:db8::1"} {
+		addr := netip.MustParseAddr(ip)
+		if !prefixes[0].Contains(addr) && !prefixes[1].Contains(addr) {
+			t.Errorf("expected wildcard to trust %s", ip)
+		}
+	}
+}
+
+func TestProxyResolverRefresh(t *testing.T) {
+	stub := installStubLookup(t)
+	stub.set("lb.example.com", "10.1.1.1", "::ffff:10.1.1.2")
+
+	r := newProxyResolver([]string{"lb.example.com", "gone.example.com"}, time.Hour)
+	if !r.Contains(netip.MustParseAddr("10.1.1.1")) || !r.Contains(netip.MustParseAddr("10.1.1.2")) {
+		t.Fatal("expected resolved addresses to be trusted")
+	}
+	if r.Contains(netip.MustParseAddr("10.1.1.3")) {
+		t.Error("unexpected address trusted")
+	}
+
+	// The host moves; nothing changes until the interval expires
+	stub.set("lb.example.com", "10.2.2.2")
+	if r.Contains(netip.MustParseAddr("10.2.2.2")) {
+		t.Error("address changed before refresh interval")
+	}
+
+	r.expiresAt.Set(time.Now(), -time.Second)
+	r.Contains(netip.MustParseAddr("10.2.2.2")) // triggers the background refresh
+	deadline := time.Now().Add(2 * time.Second)
+	for !r.Contains(netip.MustParseAddr("10.2.2.2")) {
+		if time.Now().After(deadline) {
+			t.Fatal("re-resolved address not picked up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if r.Contains(netip.MustParseAddr("10.1.1.1")) {
+		t.Error("stale address still trusted after refresh")
+	}
+}
+
+func TestProxyResolverKeepsAddressesOnFailure(t *testing.T) {
+	stub := installStubLookup(t)
+	stub.set("lb.example.com", "10.1.1.1")
+
+	r := newProxyResolver([]string{"lb.example.com"}, time.Hour)
+
+	stub.mu.Lock()
+	delete(stub.table, "lb.example.com")
+	stub.mu.Unlock()
+	r.resolve()
+
+	if !r.Contains(netip.MustParseAddr("10.1.1.1")) {
+		t.Error("expected previous addresses to be kept when resolution fails")
+	}
+}
@@ -0,0 +1,144 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxEventHostLen caps the host recorded in events, the DNS name limit
+	maxEventHostLen = 253
+	// maxEventPathLen caps the path recorded in events and reports
+	maxEventPathLen = 2048
+	// maxEventContentTypeLen caps the Content-Type recorded for write requests
+	maxEventContentTypeLen = 256
+	// maxEventHeaderLen caps other request headers recorded in events
+	maxEventHeaderLen = 1024
+	// maxUserAgentLen caps the User-Agent read for events and health checks
+	maxUserAgentLen = 512
+	// maxIPHeaderLen caps single-address headers such as X-Real-IP; longer
+	// values cannot hold one address
+	maxIPHeaderLen = 256
+	// maxTokenHeaderLen caps short token headers such as X-Forwarded-Proto
+	// and the entrypoint header
+	maxTokenHeaderLen = 128
+)
+
+// Request headers are client controlled and flow into decisions, events and
+// logs. They are read through the helpers below, which look at the first
+// occurrence only (or a bounded concatenation for list headers) and cap the
+// bytes returned, so oversized or repeated headers cost bounded work.
+
+// firstHeader returns the first occurrence of a header, truncated to max bytes
+func firstHeader(h http.Header, name string, max int) string {
+	values := h.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	v := values[0]
+	if len(v) > max {
+		v = v[:max]
+	}
+	return v
+}
+
+// listHeader joins all occurrences of a comma-separated list header such as
+// X-Forwarded-For, as proxies may append a line instead of extending the
+// existing one. Only the rightmost max bytes are kept, cut at an entry
+// boundary; truncated reports whether anything was dropped.
+func listHeader(h http.Header, name string, max int) (value string, truncated bool) {
+	values := h.Values(name)
+	if len(values) == 1 && len(values[0]) <= max {
+		return values[0], false
+	}
+
+	// Collect from the right so dropped lines are never copied
+	var parts []string
+	size := 0
+	for i := len(values) - 1; i >= 0; i-- {
+		v := values[i]
+		if len(parts) > 0 {
+			size += 2 // ", " separator
+		}
+		if size+len(v) > max {
+			truncated = true
+			if keep := max - size; keep > 0 {
+				v = v[len(v)-keep:]
+				if j := strings.IndexByte(v, ','); j >= 0 {
+					parts = append(parts, v[j+1:])
+				}
+			}
+			break
+		}
+		size += len(v)
+		parts = append(parts, v)
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, ", "), truncated
+}
+
+// eventHeader returns the first occurrence of a header prepared for events:
+// trimmed, truncated to max bytes and with control characters replaced
+func eventHeader(h http.Header, name string, max int) string {
+	return sanitizeEventField(strings.TrimSpace(firstHeader(h, name, max)), max)
+}
+
+// requestTarget returns the host and path of a request normalized for
+// events and reports. It tolerates an empty Host header (falling back to
+// the authority of absolute-form request URIs), CONNECT requests, which
+// have no path, and paths with invalid UTF-8 or control characters.
+func requestTarget(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" && req.URL != nil {
+		host = req.URL.Host
+	}
+	host = sanitizeEventField(strings.ToLower(strings.TrimSpace(host)), maxEventHostLen)
+
+	if req.Method == http.MethodConnect {
+		return host, ""
+	}
+
+	path := ""
+	if req.URL != nil {
+		path = req.URL.Path
+	}
+	if path == "" {
+		path = "/"
+	}
+	return host, sanitizeEventField(path, maxEventPathLen)
+}
+
+// sanitizeEventField replaces invalid UTF-8 and control characters and
+// truncates s to at most max bytes
+func sanitizeEventField(s string, max int) string {
+	if len(s) > max {
+		s = s[:max]
+	}
+	s = strings.ToValidUTF8(s, "�")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '�'
+		}
+		return r
+	}, s)
+}
+
+// isWriteMethod reports whether the method usually carries a request body
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// requestBodyInfo returns the declared Content-Length and Content-Type of a
+// write request. The body itself is never read. The length is -1 when it is
+// unknown, such as for chunked uploads.
+func requestBodyInfo(req *http.Request) (int64, string) {
+	contentType := eventHeader(req.Header, "Content-Type", maxEventContentTypeLen)
+	return req.ContentLength, contentType
+}
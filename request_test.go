@@ -0,0 +1,241 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logs"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+// readRequest parses a raw request the way the HTTP server does
+func readRequest(t *testing.T, raw string) *http.Request {
+	t.Helper()
+	req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatalf("failed to parse request: %v", err)
+	}
+	return req
+}
+
+func TestRequestTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		wantHost string
+		wantPath string
+	}{
+		{"origin form", "GET /login HTTP/1.1\r\nHost: Example.COM\r\n\r\n", "example.com", "/login"},
+		{"no host header", "GET /login HTTP/1.0\r\n\r\n", "", "/login"},
+		{"absolute form", "GET http://example.com:8080/a/b?q=1 HTTP/1.1\r\nHost: \r\n\r\n", "example.com:8080", "/a/b"},
+		{"connect", "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n", "example.com:443", ""},
+		{"asterisk", "OPTIONS * HTTP/1.1\r\nHost: example.com\r\n\r\n", "example.com", "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, path := requestTarget(readRequest(t, tt.raw))
+			if host != tt.wantHost || path != tt.wantPath {
+				t.Errorf("expected %q %q, got %q %q", tt.wantHost, tt.wantPath, host, path)
+			}
+		})
+	}
+}
+
+func TestRequestTargetSanitizes(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.URL.Path = "/a\x00b\xff" + strings.Repeat("x", maxEventPathLen)
+	req.Host = strings.Repeat("h", 300)
+
+	host, path := requestTarget(req)
+	if len(host) != maxEventHostLen {
+		t.Errorf("expected host truncated to %d bytes, got %d", maxEventHostLen, len(host))
+	}
+	if !strings.HasPrefix(path, "/a�b�") {
+		t.Errorf("expected control and invalid bytes replaced, got %q", path[:8])
+	}
+	if strings.ContainsRune(path, 0) {
+		t.Error("expected no NUL in path")
+	}
+}
+
+func TestConnectEvent(t *testing.T) {
+	e := &EllioMiddleware{config: &Config{}}
+	req := readRequest(t, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	event := e.newRequestEvent(req, "192.0.2.1", "blocklist", singleton.Decision{Source: singleton.SourceEDL})
+	defer logs.ReturnToPool(event)
+	if event.Request.Method != "CONNECT" || event.Request.Host != "example.com:443" || event.Request.Path != "" {
+		t.Errorf("unexpected CONNECT event request %+v", event.Request)
+	}
+}
+
+func TestServeHTTP_NilURL(t *testing.T) {
+	e := &EllioMiddleware{config: &Config{}, next: http.NotFoundHandler()}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.URL = nil
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a request without URL, got %d", rec.Code)
+	}
+}
+
+func TestBlockedWriteRequestBodyInfo(t *testing.T) {
+	e := &EllioMiddleware{config: &Config{}}
+	blocked := singleton.Decision{Source: singleton.SourceEDL}
+
+	post := readRequest(t, "POST /login HTTP/1.1\r\nHost: example.com\r\n"+
+		"Content-Type: application/x-www-form-urlencoded\r\nContent-Length: 27\r\n\r\nuser=a&password=supersecret")
+	event := e.newRequestEvent(post, "192.0.2.1", "blocklist", blocked)
+	if event.Request.ContentLength == nil || *event.Request.ContentLength != 27 ||
+		event.Request.ContentType != "application/x-www-form-urlencoded" {
+		t.Errorf("unexpected body info %+v", event.Request)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "supersecret") {
+		t.Error("request body must never be captured")
+	}
+	logs.ReturnToPool(event)
+
+	chunked := readRequest(t, "PUT /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	event = e.newRequestEvent(chunked, "192.0.2.1", "blocklist", blocked)
+	if event.Request.ContentLength == nil || *event.Request.ContentLength != -1 {
+		t.Errorf("expected unknown length for chunked upload, got %+v", event.Request)
+	}
+	logs.ReturnToPool(event)
+
+	// Reads and allowed writes carry no body info
+	get := readRequest(t, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	event = e.newRequestEvent(get, "192.0.2.1", "blocklist", blocked)
+	if event.Request.ContentLength != nil || event.Request.ContentType != "" {
+		t.Errorf("expected no body info for GET, got %+v", event.Request)
+	}
+	logs.ReturnToPool(event)
+
+	post = readRequest(t, "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 0\r\n\r\n")
+	event = e.newRequestEvent(post, "192.0.2.1", "allowlist", singleton.Decision{Allowed: true, Source: singleton.SourceEDL})
+	if event.Request.ContentLength != nil {
+		t.Errorf("expected no body info for allowed POST, got %+v", event.Request)
+	}
+	logs.ReturnToPool(event)
+}
+
+func TestFirstHeader(t *testing.T) {
+	h := http.Header{}
+	h.Add("X-Real-IP", "203.0.113.1")
+	h.Add("X-Real-IP", "198.51.100.1")
+	if got := firstHeader(h, "x-real-ip", maxIPHeaderLen); got != "203.0.113.1" {
+		t.Errorf("expected the first occurrence, got %q", got)
+	}
+	h.Set("User-Agent", strings.Repeat("a", 2*maxUserAgentLen))
+	if got := firstHeader(h, "User-Agent", maxUserAgentLen); len(got) != maxUserAgentLen {
+		t.Errorf("expected %d bytes, got %d", maxUserAgentLen, len(got))
+	}
+	if got := firstHeader(h, "Missing", 10); got != "" {
+		t.Errorf("expected empty value, got %q", got)
+	}
+}
+
+func TestListHeader(t *testing.T) {
+	tests := []struct {
+		name          string
+		values        []string
+		max           int
+		want          string
+		wantTruncated bool
+	}{
+		{"none", nil, 64, "", false},
+		{"single", []string{"203.0.113.1, 10.0.0.1"}, 64, "203.0.113.1, 10.0.0.1", false},
+		{"repeated", []string{"203.0.113.1", "10.0.0.1"}, 64, "203.0.113.1, 10.0.0.1", false},
+		{"oversized line", []string{"203.0.113.1, 10.0.0.1"}, 12, " 10.0.0.1", true},
+		{"oldest line dropped", []string{"203.0.113.1", "10.0.0.1, 10.0.0.2"}, 20, "10.0.0.1, 10.0.0.2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for _, v := range tt.values {
+				h.Add("X-Forwarded-For", v)
+			}
+			got, truncated := listHeader(h, "X-Forwarded-For", tt.max)
+			if got != tt.want || truncated != tt.wantTruncated {
+				t.Errorf("expected %q truncated=%v, got %q truncated=%v", tt.want, tt.wantTruncated, got, truncated)
+			}
+		})
+	}
+}
+
+func TestExtractClientIPRepeatedXFF(t *testing.T) {
+	middleware := &EllioMiddleware{
+		config:         &Config{IPStrategy: "xff"},
+		trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Add("X-Forwarded-For", "203.0.113.7")
+	req.Header.Add("X-Forwarded-For", "10.0.0.2")
+	if got := middleware.extractClientIP(req); got != "203.0.113.7" {
+		t.Errorf("expected the client from the first line, got %q", got)
+	}
+}
+
+// FuzzListHeader checks that any combination of header lines yields a value
+// within the budget that splitXFF can digest
+func FuzzListHeader(f *testing.F) {
+	f.Add("203.0.113.1, 10.0.0.1", "10.0.0.2", 32)
+	f.Add(strings.Repeat(",", 100), "", 8)
+	f.Add("\x00\xff, ::1", "2001:db8::1,,", 1)
+	f.Fuzz(func(t *testing.T, first, second string, max int) {
+		if max <= 0 || max > 4096 {
+			return
+		}
+		h := http.Header{}
+		h.Add("X-Forwarded-For", first)
+		h.Add("X-Forwarded-For", second)
+		value, _ := listHeader(h, "X-Forwarded-For", max)
+		if len(value) > max {
+			t.Fatalf("value of %d bytes exceeds budget %d", len(value), max)
+		}
+		entries, _ := splitXFF(value, 0, max)
+		if len(entries) > defaultXFFMaxHops {
+			t.Fatalf("got %d entries, more than %d hops", len(entries), defaultXFFMaxHops)
+		}
+	})
+}
+
+// FuzzEventHeader checks that event header values stay bounded, valid UTF-8
+// and free of control characters
+func FuzzEventHeader(f *testing.F) {
+	f.Add("Mozilla/5.0", 64)
+	f.Add("a\r\nb\x00\xff\xfe", 4)
+	f.Fuzz(func(t *testing.T, value string, max int) {
+		if max <= 0 || max > 4096 {
+			return
+		}
+		h := http.Header{"User-Agent": {value}}
+		got := eventHeader(h, "User-Agent", max)
+		if !utf8.ValidString(got) {
+			t.Fatalf("invalid UTF-8 in %q", got)
+		}
+		for _, r := range got {
+			if unicode.IsControl(r) {
+				t.Fatalf("control character in %q", got)
+			}
+		}
+		if len(got) > 3*max {
+			t.Fatalf("value of %d bytes from a %d byte budget", len(got), max)
+		}
+	})
+}
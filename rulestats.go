@@ -0,0 +1,132 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/metrics"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+// Rule kinds counted in ellio_rule_hits_total and the admin status
+const (
+	ruleExcludedPath      = "excluded_path"       // excludedPaths entry, request bypassed
+	ruleHealthCheckAgent  = "health_check_agent"  // healthCheckUserAgents marker, request bypassed
+	ruleHealthCheckSource = "health_check_source" // healthCheckSources range, request bypassed
+	ruleEntrypoint        = "entrypoint_bypass"   // Entrypoint outside enforcedEntrypoints, request bypassed
+	ruleExcludeHost       = "exclude_host"        // excludeHosts pattern, request bypassed
+	ruleIncludeHost       = "include_host"        // includeHosts pattern, request enforced
+	ruleBypassConnect     = "bypass_connect"      // CONNECT request bypassed
+	ruleUpstreamAllowList = "upstream_allowlist"  // upstreamAllowList range in skip mode, request bypassed
+	ruleAllowOverride     = "allow_override"      // allowOverride range
+	ruleBlockOverride     = "block_override"      // blockOverride range
+	ruleLocalAllow        = "local_allowlist"     // Local allowlist file
+	ruleLocalBlock        = "local_blocklist"     // Local blocklist file
+	ruleOverlayAllow      = "overlay_allow"       // Runtime overlay allow entries
+	ruleOverlayBlock      = "overlay_block"       // Runtime overlay block entries
+	ruleTorExit           = "tor_exit"            // Tor exit list, counted per list URL
+	ruleBlockedCountry    = "blocked_country"     // blockedCountries entry
+	ruleAllowedCountry    = "allowed_country"     // Country outside allowedCountries, counted as ruleOtherCountry
+
+	// ruleUnmatched names requests no includeHosts pattern matched
+	ruleUnmatched = "unmatched"
+	// ruleOverlay names the runtime overlay, whose entries change at runtime
+	ruleOverlay = "overlay"
+	// ruleOtherCountry names the countries outside allowedCountries
+	ruleOtherCountry = "other"
+)
+
+// ruleStats counts hits per configured rule so operators can spot dead
+// rules and overly broad exclusions. Local lists are counted per file, not
+// per entry, to keep the number of series bounded.
+type ruleStats struct {
+	metrics  *singleton.Metrics
+	name     string
+	counters map[string]*metrics.Counter // Registered rules keyed by kind and rule, read-only after New
+}
+
+// newRuleStats returns the rule counters of an instance, nil without metrics
+func newRuleStats(mm *singleton.Metrics, name string) *ruleStats {
+	if mm == nil {
+		return nil
+	}
+	return &ruleStats{metrics: mm, name: name, counters: make(map[string]*metrics.Counter)}
+}
+
+// register creates the counters of configured rules up front so rules that
+// never match show up with zero hits
+func (s *ruleStats) register(kind string, rules ...string) {
+	if s == nil {
+		return
+	}
+	for _, rule := range rules {
+		s.counters[kind+"\x00"+rule] = s.metrics.Rule(s.name, kind, rule)
+	}
+}
+
+// hit counts a match of a rule, a no-op on nil stats
+func (s *ruleStats) hit(kind, rule string) {
+	if s == nil {
+		return
+	}
+	c, ok := s.counters[kind+"\x00"+rule]
+	if !ok {
+		c = s.metrics.Rule(s.name, kind, rule)
+	}
+	c.Inc()
+}
+
+// registerRules registers the counters of all configured rules
+func (e *EllioMiddleware) registerRules(blockOverrides []netip.Prefix) {
+	s := e.rules
+	if s == nil {
+		return
+	}
+	s.register(ruleExcludedPath, e.excludedPaths.entries()...)
+	s.register(ruleHealthCheckAgent, e.healthCheckAgents...)
+	s.register(ruleHealthCheckSource, prefixStrings(e.healthCheckSources, false)...)
+	s.register(ruleExcludeHost, e.excludeHosts...)
+	if len(e.includeHosts) > 0 {
+		s.register(ruleIncludeHost, e.includeHosts...)
+		s.register(ruleIncludeHost, ruleUnmatched)
+	}
+	if e.config.BypassConnect {
+		s.register(ruleBypassConnect, http.MethodConnect)
+	}
+	if e.upstream != nil && e.upstream.skip {
+		s.register(ruleUpstreamAllowList, prefixStrings(e.upstream.prefixes, false)...)
+	}
+	s.register(ruleAllowOverride, prefixStrings(e.allowOverride, false)...)
+	s.register(ruleBlockOverride, prefixStrings(blockOverrides, true)...)
+	if e.localAllow != nil {
+		s.register(ruleLocalAllow, e.localAllow.Path())
+	}
+	if e.localBlock != nil {
+		s.register(ruleLocalBlock, e.localBlock.Path())
+	}
+	if e.overlay != nil {
+		s.register(ruleOverlayAllow, ruleOverlay)
+		s.register(ruleOverlayBlock, ruleOverlay)
+	}
+	if e.torExits != nil {
+		s.register(ruleTorExit, e.config.TorExitListURL)
+	}
+	if e.geo != nil {
+		for kind, countries := range e.geo.rules() {
+			s.register(kind, countries...)
+		}
+	}
+}
+
+// prefixStrings formats prefixes as rule names. Block overrides are matched
+// through a trie that reports masked prefixes.
+func prefixStrings(prefixes []netip.Prefix, masked bool) []string {
+	names := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if masked {
+			prefix = prefix.Masked()
+		}
+		names = append(names, prefix.String())
+	}
+	return names
+}
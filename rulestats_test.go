@@ -0,0 +1,86 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/metrics"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestRuleStats(t *testing.T) {
+	mm := &singleton.Metrics{Registry: metrics.NewRegistry()}
+	blockOverrides := parsePrefixes([]string{"198.51.100.7/24"}, "block override")
+	e := &EllioMiddleware{
+		next:              http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		config:            &Config{},
+		excludedPaths:     newPathMatcher([]string{"/healthz", "/static/*", "/unused"}, "excluded path"),
+		healthCheckAgents: []string{"kube-probe"},
+		healthCheckAnyUA:  true,
+		excludeHosts:      parseHostPatterns([]string{"internal.example.com"}),
+		includeHosts:      parseHostPatterns([]string{"*.example.com"}),
+		allowOverride:     parsePrefixes([]string{"192.0.2.0/24"}, "allow override"),
+		blockOverride:     newOverrideTrie(blockOverrides),
+		rules:             newRuleStats(mm, "ellio"),
+	}
+	e.registerRules(blockOverrides)
+
+	for _, path := range []string{"/healthz", "/static/app.js", "/static/app.css"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", "kube-probe/1.29")
+	if kind, rule, ok := e.healthCheck(req); !ok {
+		t.Error("expected a health check")
+	} else {
+		e.rules.hit(kind, rule)
+	}
+	for _, host := range []string{"internal.example.com", "app.example.com", "other.org"} {
+		if kind, pattern, _ := e.hostRule(host); kind != "" {
+			e.rules.hit(kind, pattern)
+		}
+	}
+	e.overrideDecision("192.0.2.1")
+	e.overrideDecision("198.51.100.1")
+	e.rules.hit(ruleEntrypoint, "internal") // dynamic rules are registered on first hit
+
+	got := make(map[string]int64)
+	for _, hit := range mm.RuleHits() {
+		if hit.Middleware != "ellio" {
+			t.Errorf("unexpected middleware %q", hit.Middleware)
+		}
+		got[hit.Kind+" "+hit.Rule] = hit.Hits
+	}
+	want := map[string]int64{
+		"excluded_path /healthz":            1,
+		"excluded_path /static/*":           2,
+		"excluded_path /unused":             0,
+		"health_check_agent kube-probe":     1,
+		"exclude_host internal.example.com": 1,
+		"include_host *.example.com":        1,
+		"include_host unmatched":            1,
+		"allow_override 192.0.2.0/24":       1,
+		"block_override 198.51.100.0/24":    1,
+		"entrypoint_bypass internal":        1,
+	}
+	for key, hits := range want {
+		if n, ok := got[key]; !ok || n != hits {
+			t.Errorf("%s: expected %d hits, got %d (registered %v)", key, hits, n, ok)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d rules, got %v", len(want), got)
+	}
+}
+
+func TestRuleStatsNil(t *testing.T) {
+	var s *ruleStats
+	s.register(ruleExcludedPath, "/healthz")
+	s.hit(ruleExcludedPath, "/healthz")
+	if newRuleStats(nil, "ellio") != nil {
+		t.Error("expected nil stats without metrics")
+	}
+	(&EllioMiddleware{config: &Config{}}).registerRules([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")})
+}
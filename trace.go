@@ -0,0 +1,78 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// defaultTraceDuration is how long traceClientIPs stays active when no
+// expiry is configured
+const defaultTraceDuration = time.Hour
+
+// clientTracer selects client IPs whose requests are trace logged
+// regardless of the global log level, until it expires. A zero until
+// never expires.
+type clientTracer struct {
+	prefixes []netip.Prefix
+	until    time.Time
+	expired  atomic.Bool
+	now      func() time.Time
+}
+
+// newClientTracer returns nil when no valid entries are given
+func newClientTracer(prefixes []netip.Prefix, until time.Time) *clientTracer {
+	if len(prefixes) == 0 {
+		return nil
+	}
+	return &clientTracer{prefixes: prefixes, until: until, now: time.Now}
+}
+
+// parseTraceUntil reads traceClientIPsUntil, either an RFC 3339 time or a
+// duration counted from now. Empty or invalid values use defaultTraceDuration.
+func parseTraceUntil(value string, now time.Time) time.Time {
+	if value == "" {
+		return now.Add(defaultTraceDuration)
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(d)
+	}
+	logger.Warnf("Invalid traceClientIPsUntil '%s', tracing for %v", value, defaultTraceDuration)
+	return now.Add(defaultTraceDuration)
+}
+
+// Matches reports whether requests from clientIP should be traced
+func (t *clientTracer) Matches(clientIP string) bool {
+	if t == nil || t.expired.Load() {
+		return false
+	}
+	if !t.until.IsZero() && t.now().After(t.until) {
+		if t.expired.CompareAndSwap(false, true) {
+			logger.Info("traceClientIPs expired, selective tracing disabled")
+		}
+		return false
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// tracef logs a trace line prefixed with the client IP when traced is set
+func tracef(traced bool, clientIP, format string, args ...interface{}) {
+	if traced {
+		logger.ForceTracef("[trace %s] "+format, append([]interface{}{clientIP}, args...)...)
+	}
+}
@@ -0,0 +1,72 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestClientTracerMatches(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracer := newClientTracer([]netip.Prefix{
+		netip.MustParsePrefix("203.0.113.7/32"),
+		netip.MustParsePrefix("2001:db8::/64"),
+	}, now.Add(time.Hour))
+	tracer.now = func() time.Time { return now }
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"203.0.113.7", true},
+		{"::ffff:203.0.113.7", true},
+		{"203.0.113.8", false},
+		{"2001:db8::1", true},
+		{"2001:db8:1::1", false},
+		{"not-an-ip", false},
+	}
+	for _, tt := range tests {
+		if got := tracer.Matches(tt.ip); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	now = now.Add(2 * time.Hour)
+	if tracer.Matches("203.0.113.7") {
+		t.Error("expected no match after expiry")
+	}
+
+	dev := newDevTracer()
+	dev.now = func() time.Time { return now.AddDate(10, 0, 0) }
+	if !dev.Matches("192.0.2.1") || !dev.Matches("2001:db8::1") {
+		t.Error("expected the dev tracer to match every client without expiring")
+	}
+
+	var disabled *clientTracer
+	if disabled.Matches("203.0.113.7") {
+		t.Error("nil tracer must not match")
+	}
+	if newClientTracer(nil, now) != nil {
+		t.Error("expected nil tracer without prefixes")
+	}
+}
+
+func TestParseTraceUntil(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", now.Add(defaultTraceDuration)},
+		{"30m", now.Add(30 * time.Minute)},
+		{"2026-01-02T00:00:00Z", time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"-5m", now.Add(defaultTraceDuration)},
+		{"tomorrow", now.Add(defaultTraceDuration)},
+	}
+	for _, tt := range tests {
+		if got := parseTraceUntil(tt.value, now); !got.Equal(tt.want) {
+			t.Errorf("parseTraceUntil(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
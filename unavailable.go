@@ -0,0 +1,112 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/bounded"
+)
+
+// unavailableHTML is served with 503 when failing closed. It names the
+// reason so operators can tell plugin health issues from security blocks.
+const unavailableHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Service Temporarily Unavailable</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; background: #f5f5f5; color: #333; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; }
+        .container { background: #fff; border-radius: 8px; box-shadow: 0 2px 10px rgba(0,0,0,0.1); padding: 40px; max-width: 520px; text-align: center; }
+        h1 { font-size: 22px; margin: 0 0 12px; }
+        p { color: #666; line-height: 1.5; }
+        code { background: #f0f0f0; padding: 2px 6px; border-radius: 4px; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>Service Temporarily Unavailable</h1>
+        <p>Access protection is not ready to evaluate requests. Please try again shortly.</p>
+        <p>Reason: <code>{{.Reason}}</code></p>
+    </div>
+</body>
+</html>`
+
+var unavailableTemplate = template.Must(template.New("unavailable").Parse(unavailableHTML))
+
+// unavailableRetryAfter is the Retry-After hint in seconds for 503 responses
+const unavailableRetryAfter = "30"
+
+// unavailableResponse is the JSON body of fail-closed 503 responses
+type unavailableResponse struct {
+	Error  string `json:"error"`  // Always "service_unavailable"
+	Reason string `json:"reason"` // Machine-readable code, e.g. "token_expired"
+	Source string `json:"source"` // Always "ellio", distinguishes plugin health from upstream errors
+}
+
+// writeUnavailable answers a request that cannot be evaluated while failing
+// closed. The reason code is sent in X-Ellio-Reason and in the body, as JSON
+// or HTML depending on unavailableFormat and the Accept header.
+func (e *EllioMiddleware) writeUnavailable(w http.ResponseWriter, req *http.Request, reason string) {
+	h := w.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set("Retry-After", unavailableRetryAfter)
+	h.Set("X-Ellio-Reason", reason)
+
+	if req.Method == http.MethodHead {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if wantsJSON(e.config.UnavailableFormat, req.Header.Get("Accept")) {
+		h.Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(unavailableResponse{
+			Error:  "service_unavailable",
+			Reason: reason,
+			Source: "ellio",
+		})
+		return
+	}
+
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = unavailableTemplate.Execute(w, struct{ Reason string }{reason})
+}
+
+// wantsJSON picks the 503 body format. "auto" (default) serves HTML to
+// clients that accept text/html, such as browsers, and JSON to everything else.
+func wantsJSON(format, accept string) bool {
+	switch format {
+	case "json":
+		return true
+	case "html":
+		return false
+	}
+	return !strings.Contains(strings.ToLower(accept), "text/html")
+}
+
+// knownClientTTL is how long an allowed client keeps access in "closed-new"
+// failure mode after its last allowed request
+const knownClientTTL = 24 * time.Hour
+
+// newKnownClients tracks recently allowed clients for "closed-new" mode
+func newKnownClients(maxEntries int) *bounded.LRU {
+	if maxEntries <= 0 {
+		maxEntries = defaultTrackerMaxEntries
+	}
+	return bounded.NewLRU("known_clients", maxEntries, knownClientTTL)
+}
+
+// isKnownClient reports whether the request comes from a client allowed
+// recently, only in "closed-new" failure mode
+func (e *EllioMiddleware) isKnownClient(req *http.Request) bool {
+	if e.knownClients == nil {
+		return false
+	}
+	_, known := e.knownClients.Get(e.extractClientIP(req))
+	return known
+}
@@ -0,0 +1,101 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/admin"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestWriteUnavailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		method   string
+		accept   string
+		wantJSON bool
+		wantBody bool
+	}{
+		{"auto browser", "", "GET", "text/html,application/xhtml+xml,*/*;q=0.8", false, true},
+		{"auto api client", "", "GET", "application/json", true, true},
+		{"auto no accept", "auto", "GET", "", true, true},
+		{"forced json", "json", "GET", "text/html", true, true},
+		{"forced html", "html", "GET", "application/json", false, true},
+		{"head", "", "HEAD", "application/json", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &EllioMiddleware{config: &Config{UnavailableFormat: tt.format}}
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			e.writeUnavailable(rec, req, "token_expired")
+
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("expected 503, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("X-Ellio-Reason"); got != "token_expired" {
+				t.Errorf("expected X-Ellio-Reason token_expired, got %q", got)
+			}
+			if rec.Header().Get("Retry-After") == "" || rec.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("missing Retry-After or Cache-Control: %v", rec.Header())
+			}
+			if !tt.wantBody {
+				if rec.Body.Len() != 0 {
+					t.Errorf("expected empty body, got %q", rec.Body.String())
+				}
+				return
+			}
+
+			if tt.wantJSON {
+				var body map[string]interface{}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatalf("expected JSON body: %v", err)
+				}
+				if body["reason"] != "token_expired" || body["source"] != "ellio" || body["error"] != "service_unavailable" {
+					t.Errorf("unexpected JSON body %v", body)
+				}
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+				t.Errorf("expected HTML, got %q", ct)
+			}
+			if !strings.Contains(rec.Body.String(), "token_expired") {
+				t.Error("expected HTML body to name the reason")
+			}
+		})
+	}
+}
+
+func TestServeHTTP_FailClosedNewAllowsKnownClients(t *testing.T) {
+	middleware := &EllioMiddleware{
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		name:         "test",
+		config:       &Config{FailureMode: "closed-new", IPStrategy: "direct"},
+		readiness:    admin.ReadinessHandler(singleton.GetManager().Readiness),
+		knownClients: newKnownClients(0),
+	}
+	middleware.knownClients.Add("192.0.2.10", struct{}{})
+
+	for ip, want := range map[string]int{
+		"192.0.2.10": http.StatusOK,
+		"192.0.2.11": http.StatusServiceUnavailable,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = ip + ":12345"
+		rec := httptest.NewRecorder()
+		middleware.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", ip, want, rec.Code)
+		}
+	}
+}
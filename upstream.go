@@ -0,0 +1,96 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/logger"
+)
+
+// upstreamAllowListMode values
+const (
+	upstreamEnforce = "enforce" // Clients that passed the upstream allowlist are still checked
+	upstreamSkip    = "skip"    // Clients that passed the upstream allowlist are forwarded unchecked
+)
+
+// upstreamAllowList describes a Traefik ipAllowList (ipWhiteList before
+// Traefik v3) middleware chained before this one. Traefik gives no signal
+// that a request passed it, so its sourceRange is repeated in the config:
+// every client within it has passed the allowlist.
+type upstreamAllowList struct {
+	prefixes []netip.Prefix
+	skip     bool
+	warned   atomic.Bool // A client outside the ranges was reported
+}
+
+// newUpstreamAllowList validates the upstream allowlist settings against
+// each other and the overrides. Contradictory stacking is refused with an
+// error explaining the fix. It returns nil when none is configured.
+func newUpstreamAllowList(config *Config, blockOverrides []netip.Prefix) (*upstreamAllowList, error) {
+	mode := config.UpstreamAllowListMode
+	switch mode {
+	case "":
+		mode = upstreamEnforce
+	case upstreamEnforce, upstreamSkip:
+	default:
+		return nil, fmt.Errorf("invalid upstreamAllowListMode %q: use %q to check clients that passed the upstream ipAllowList against ELLIO too, or %q to forward them unchecked",
+			mode, upstreamEnforce, upstreamSkip)
+	}
+	if len(config.UpstreamAllowList) == 0 {
+		if config.UpstreamAllowListMode != "" {
+			return nil, errors.New("upstreamAllowListMode is set without upstreamAllowList: copy the sourceRange of the Traefik ipAllowList middleware chained before this one")
+		}
+		return nil, nil
+	}
+
+	prefixes := parsePrefixes(config.UpstreamAllowList, "upstream allowlist")
+	if len(prefixes) == 0 {
+		return nil, errors.New("upstreamAllowList has no valid entries: copy the sourceRange of the Traefik ipAllowList middleware chained before this one")
+	}
+	u := &upstreamAllowList{prefixes: prefixes, skip: mode == upstreamSkip}
+	if !u.skip {
+		logger.Infof("Clients within %d upstream allowlist ranges are checked against ELLIO too", len(prefixes))
+		return u, nil
+	}
+
+	for _, prefix := range prefixes {
+		if prefix.Bits() == 0 {
+			return nil, fmt.Errorf("upstreamAllowList %s covers every client, so upstreamAllowListMode %q would disable ELLIO: use %q or remove the ELLIO middleware from the chain",
+				prefix, upstreamSkip, upstreamEnforce)
+		}
+		for _, block := range blockOverrides {
+			if prefix.Overlaps(block) {
+				return nil, fmt.Errorf("blockOverride %s overlaps upstreamAllowList %s, whose clients are forwarded unchecked with upstreamAllowListMode %q: use %q to block them anyway, or narrow either range",
+					block, prefix, upstreamSkip, upstreamEnforce)
+			}
+		}
+	}
+	logger.Infof("Clients within %d upstream allowlist ranges skip ELLIO", len(prefixes))
+	return u, nil
+}
+
+// Skip reports whether clientIP passed the upstream allowlist and skips
+// ELLIO, with the matched range as rule. A client outside every range means
+// the allowlist is not chained before this middleware or its sourceRange
+// differs; that is logged once. A nil list skips nothing.
+func (u *upstreamAllowList) Skip(clientIP string) (rule string, ok bool) {
+	if u == nil {
+		return "", false
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range u.prefixes {
+		if prefix.Contains(addr) {
+			return prefix.String(), u.skip
+		}
+	}
+	if u.warned.CompareAndSwap(false, true) {
+		logger.Warnf("Client %s is outside upstreamAllowList: the ipAllowList middleware is not chained before ELLIO, or its sourceRange or ipStrategy differs", clientIP)
+	}
+	return "", false
+}
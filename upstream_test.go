@@ -0,0 +1,98 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestNewUpstreamAllowList(t *testing.T) {
+	blockOverrides := parsePrefixes([]string{"198.51.100.7"}, "block override")
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr string
+	}{
+		{"unset", &Config{}, ""},
+		{"enforce by default", &Config{UpstreamAllowList: []string{"198.51.100.0/24"}}, ""},
+		{"skip", &Config{UpstreamAllowList: []string{"203.0.113.0/24"}, UpstreamAllowListMode: "skip"}, ""},
+		{"invalid mode", &Config{UpstreamAllowList: []string{"203.0.113.0/24"}, UpstreamAllowListMode: "trust"}, "invalid upstreamAllowListMode"},
+		{"mode without ranges", &Config{UpstreamAllowListMode: "skip"}, "without upstreamAllowList"},
+		{"no valid ranges", &Config{UpstreamAllowList: []string{"bogus"}}, "no valid entries"},
+		{"skip everything", &Config{UpstreamAllowList: []string{"0.0.0.0/0"}, UpstreamAllowListMode: "skip"}, "covers every client"},
+		{"skip over a block override", &Config{UpstreamAllowList: []string{"198.51.100.0/24"}, UpstreamAllowListMode: "skip"}, "blockOverride 198.51.100.7/32 overlaps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newUpstreamAllowList(tt.config, blockOverrides)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUpstreamAllowListSkip(t *testing.T) {
+	skip, err := newUpstreamAllowList(&Config{UpstreamAllowList: []string{"203.0.113.0/24"}, UpstreamAllowListMode: "skip"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule, ok := skip.Skip("::ffff:203.0.113.5"); !ok || rule != "203.0.113.0/24" {
+		t.Errorf("expected the client to skip ELLIO, got %q %v", rule, ok)
+	}
+	if _, ok := skip.Skip("192.0.2.1"); ok || !skip.warned.Load() {
+		t.Error("expected a client outside the ranges to be checked and reported")
+	}
+
+	enforce, err := newUpstreamAllowList(&Config{UpstreamAllowList: []string{"203.0.113.0/24"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := enforce.Skip("203.0.113.5"); ok {
+		t.Error("expected clients to be checked in enforce mode")
+	}
+	var none *upstreamAllowList
+	if _, ok := none.Skip("203.0.113.5"); ok {
+		t.Error("nil upstream allowlist must skip nothing")
+	}
+}
+
+func TestServeHTTP_UpstreamAllowListSkip(t *testing.T) {
+	upstream, err := newUpstreamAllowList(&Config{UpstreamAllowList: []string{"203.0.113.0/24"}, UpstreamAllowListMode: "skip"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager, err := singleton.NewManager(singleton.Options{DevMode: true, DevBlocklist: []string{"203.0.113.0/24", "192.0.2.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Stop()
+
+	e := &EllioMiddleware{
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+		config:   &Config{IPStrategy: "direct", BlockStatusCode: http.StatusForbidden},
+		manager:  manager,
+		upstream: upstream,
+	}
+	serve := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve("203.0.113.5:4711"); code != http.StatusOK {
+		t.Errorf("expected a client that passed the upstream allowlist to be forwarded unchecked, got %d", code)
+	}
+	if code := serve("192.0.2.1:4711"); code != http.StatusForbidden {
+		t.Errorf("expected other clients to be checked, got %d", code)
+	}
+}
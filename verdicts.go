@@ -0,0 +1,79 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/bounded"
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+// defaultVerdictCacheTTL bounds how long a cached EDL verdict is reused
+const defaultVerdictCacheTTL = 10 * time.Second
+
+// cachedVerdict is an EDL decision with the EDL state it was made against
+type cachedVerdict struct {
+	d       singleton.Decision
+	version singleton.DecisionVersion
+}
+
+// newVerdictCache keeps the EDL verdicts of recent clients per rule scope,
+// nil when decisionCacheSize is not set
+func newVerdictCache(size int, ttl time.Duration) *bounded.LRU {
+	if size <= 0 {
+		return nil
+	}
+	return bounded.NewLRU("verdicts", size, ttl)
+}
+
+// verdictScope names the rule scope of a request: the includeHosts pattern
+// that enforced its host and its path group. Both are empty when no such
+// rules are configured, so every request of a client shares one entry.
+// Rules of a scope only change with the configuration, which creates a new
+// middleware and cache.
+func (e *EllioMiddleware) verdictScope(req *http.Request, hostKind, hostPattern string) string {
+	if e.verdicts == nil {
+		return ""
+	}
+	if hostKind != ruleIncludeHost {
+		hostPattern = ""
+	}
+	if e.pathRules == nil {
+		return hostPattern
+	}
+	_, path := requestTarget(req)
+	return hostPattern + "\x00" + e.pathRules.groupName(path)
+}
+
+// cachedDecision returns the EDL decision cached for client, the IP or its
+// aggregated prefix, in scope. Entries made against an older EDL state are
+// ignored.
+func (e *EllioMiddleware) cachedDecision(manager *singleton.Manager, client, scope string) (singleton.Decision, bool) {
+	if e.verdicts == nil || manager == nil {
+		return singleton.Decision{}, false
+	}
+	value, ok := e.verdicts.Get(client + "\x00" + scope)
+	if !ok {
+		return singleton.Decision{}, false
+	}
+	v := value.(*cachedVerdict)
+	if v.version != manager.DecisionVersion() {
+		return singleton.Decision{}, false
+	}
+	if prefix, err := netip.ParsePrefix(client); err == nil {
+		manager.CountCachedCheck(prefix.Addr())
+	} else if addr, err := netip.ParseAddr(client); err == nil {
+		manager.CountCachedCheck(addr)
+	}
+	return v.d, true
+}
+
+// cacheDecision remembers an EDL decision of client in scope. Errors and
+// bypassed checks are not cached.
+func (e *EllioMiddleware) cacheDecision(manager *singleton.Manager, client, scope string, version singleton.DecisionVersion, d singleton.Decision) {
+	if e.verdicts == nil || manager == nil || d.Err != nil || d.Source != singleton.SourceEDL {
+		return
+	}
+	e.verdicts.Add(client+"\x00"+scope, &cachedVerdict{d: d, version: version})
+}
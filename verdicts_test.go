@@ -0,0 +1,83 @@
+package ELLIO_Traefik_Middleware_Plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ELLIO-Technology/ELLIO-Traefik-Middleware-Plugin/pkg/singleton"
+)
+
+func TestVerdictCache(t *testing.T) {
+	manager, err := singleton.NewManager(singleton.Options{DevMode: true, DevBlocklist: []string{"203.0.113.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Stop()
+
+	e := &EllioMiddleware{
+		config:       &Config{},
+		manager:      manager,
+		includeHosts: parseHostPatterns([]string{"*.example.com", "shop.example.org"}),
+		pathRules:    newPathRules([]PathGroup{{Name: "admin", Paths: []string{"/admin"}, Sensitivity: 2}}, 0, nil),
+		verdicts:     newVerdictCache(100, defaultVerdictCacheTTL),
+	}
+	scope := func(host, path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		kind, pattern, _ := e.hostRule(req.Host)
+		return e.verdictScope(req, kind, pattern)
+	}
+
+	// Hosts of one pattern share a scope, paths of one group too
+	admin := scope("app.example.com", "/admin/users")
+	if other := scope("api.example.com", "/admin"); other != admin {
+		t.Errorf("expected hosts of one pattern in one scope, got %q and %q", admin, other)
+	}
+	public := scope("app.example.com", "/")
+	shop := scope("shop.example.org", "/admin")
+	if public == admin || shop == admin {
+		t.Fatalf("expected distinct scopes, got %q %q %q", admin, public, shop)
+	}
+
+	d := e.decide(manager, "203.0.113.5", admin)
+	if d.Allowed || d.Source != singleton.SourceEDL {
+		t.Fatalf("expected EDL block, got %s", d)
+	}
+	if again := e.decide(manager, "203.0.113.5", admin); again.Allowed || again.Source != singleton.SourceEDL {
+		t.Errorf("expected the cached block, got %s", again)
+	}
+	e.decide(manager, "203.0.113.5", public)
+	e.decide(manager, "203.0.113.5", shop)
+	if n := e.verdicts.Stats().Entries; n != 3 {
+		t.Errorf("expected one entry per scope, got %d", n)
+	}
+
+	// A verdict made against another EDL state is not reused
+	stale := manager.DecisionVersion()
+	stale.Lists++
+	e.verdicts.Add("192.0.2.1\x00"+admin, &cachedVerdict{d: singleton.Decision{Source: singleton.SourceEDL}, version: stale})
+	if d := e.decide(manager, "192.0.2.1", admin); !d.Allowed {
+		t.Errorf("expected a stale verdict to be ignored, got %s", d)
+	}
+	if d := e.decide(manager, "192.0.2.1", admin); !d.Allowed {
+		t.Errorf("expected the fresh verdict to replace the stale one, got %s", d)
+	}
+
+	// Local rules apply before the cache
+	e.allowOverride = parsePrefixes([]string{"203.0.113.5/32"}, "allow override")
+	if d := e.decide(manager, "203.0.113.5", admin); !d.Allowed || d.Source != singleton.SourceOverride {
+		t.Errorf("expected the override to win over the cached verdict, got %s", d)
+	}
+}
+
+func TestVerdictScopeWithoutCache(t *testing.T) {
+	e := &EllioMiddleware{config: &Config{}, includeHosts: parseHostPatterns([]string{"*.example.com"})}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if scope := e.verdictScope(req, ruleIncludeHost, "*.example.com"); scope != "" {
+		t.Errorf("expected no scope without a cache, got %q", scope)
+	}
+	if newVerdictCache(0, defaultVerdictCacheTTL) != nil {
+		t.Error("expected decisionCacheSize 0 to disable the cache")
+	}
+}